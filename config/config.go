@@ -1,17 +1,63 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Supported storage backends
+const (
+	StorageMongoDB = "mongodb"
+	StorageMemory  = "memory"
+	StorageBolt    = "bolt"
+	StorageSQL     = "sql"
+)
+
+// Supported short code counters
+const (
+	CounterShared    = "shared"
+	CounterSnowflake = "snowflake"
+)
+
 // Config holds application configuration
 type Config struct {
-	Port         string
-	MongoURI     string
-	DatabaseName string
-	RedisURL     string
-	Timeout      time.Duration
+	Port                      string
+	MetricsAddr               string
+	TrustedProxies            []string
+	MongoURI                  string
+	DatabaseName              string
+	RedisURL                  string
+	StorageBackend            string
+	BoltPath                  string
+	SQLDialect                string
+	SQLDSN                    string
+	ExpirySweepInterval       time.Duration
+	LocalCacheSize            int
+	LocalCacheTTL             time.Duration
+	CounterBlockSize          int
+	CounterType               string
+	NodeID                    int
+	CodeScrambleKey           string
+	CodeMinLength             int
+	RestoreWindow             time.Duration
+	PurgeInterval             time.Duration
+	BatchMaxSize              int
+	ClickBufferSize           int
+	ClickBatchSize            int
+	ClickFlushInterval        time.Duration
+	GeoIPDatabasePath         string
+	GeoIPReloadInterval       time.Duration
+	VisitorRetention          time.Duration
+	BotPatternsPath           string
+	BotPatternsReloadInterval time.Duration
+	ClickStreamHistory        int
+	ClickStreamHeartbeat      time.Duration
+	InstanceID                string
+	ShutdownTimeout           time.Duration
+	Timeout                   time.Duration
 }
 
 // LoadConfig loads configuration from environment variables
@@ -21,6 +67,12 @@ func LoadConfig() *Config {
 		port = "8080"
 	}
 
+	// Internal address serving the metrics; setting it empty turns the listener off
+	metricsAddr, ok := os.LookupEnv("METRICS_ADDR")
+	if !ok {
+		metricsAddr = "localhost:9090"
+	}
+
 	mongoURI := os.Getenv("MONGO_URI")
 	if mongoURI == "" {
 		mongoURI = "mongodb://localhost:27017"
@@ -36,13 +88,160 @@ func LoadConfig() *Config {
 		redisURL = "redis://localhost:6379"
 	}
 
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" {
+		storageBackend = StorageMongoDB
+	}
+
+	boltPath := os.Getenv("BOLT_PATH")
+	if boltPath == "" {
+		boltPath = "url_shortener.db"
+	}
+
+	sqlDialect := os.Getenv("SQL_DIALECT")
+	if sqlDialect == "" {
+		sqlDialect = "sqlite"
+	}
+
+	sqlDSN := os.Getenv("SQL_DSN")
+	if sqlDSN == "" {
+		sqlDSN = "file:url_shortener.sqlite?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	}
+
+	// Matches the interval of the MongoDB TTL monitor
+	expirySweepInterval := getEnvDuration("EXPIRY_SWEEP_INTERVAL", 60*time.Second)
+
+	// In-process LRU tier in front of the shared cache; a size of 0 disables it
+	localCacheSize := getEnvInt("LOCAL_CACHE_SIZE", 10000)
+	localCacheTTL := getEnvDuration("LOCAL_CACHE_TTL", time.Minute)
+
+	// Counter values leased per round trip to the shared counter; 1 disables block allocation
+	counterBlockSize := getEnvInt("COUNTER_BLOCK_SIZE", 1)
+
+	// The storage backend's shared counter, or coordination-free Snowflake values per node
+	counterType := os.Getenv("COUNTER_TYPE")
+	if counterType == "" {
+		counterType = CounterShared
+	}
+	nodeID := getEnvInt("NODE_ID", -1) // required with the Snowflake counter; -1 when unset
+
+	// Proxies whose X-Forwarded-For header names the client; none are trusted by default, so click
+	// events record the connecting address
+	trustedProxies := getEnvList("TRUSTED_PROXIES")
+
+	// Secret key for the counter permutation; empty keeps short codes sequential
+	codeScrambleKey := os.Getenv("CODE_SCRAMBLE_KEY")
+	codeMinLength := getEnvInt("CODE_MIN_LENGTH", 0)
+
+	// How long deleted links can be restored, and how often those past it are purged
+	restoreWindow := getEnvDuration("RESTORE_WINDOW", 30*24*time.Hour)
+	purgeInterval := getEnvDuration("PURGE_INTERVAL", time.Hour)
+
+	// Most URLs a single POST /urls/batch may create
+	batchMaxSize := getEnvInt("BATCH_MAX_SIZE", 1000)
+
+	// Click events buffered in process between redirects and storage, and how they are flushed
+	clickBufferSize := getEnvInt("CLICK_BUFFER_SIZE", 10000)
+	clickBatchSize := getEnvInt("CLICK_BATCH_SIZE", 500)
+	clickFlushInterval := getEnvDuration("CLICK_FLUSH_INTERVAL", time.Second)
+
+	// MaxMind-format database used to locate clicks, and how often it is checked for changes
+	geoIPDatabasePath := os.Getenv("GEOIP_DATABASE_PATH")
+	geoIPReloadInterval := getEnvDuration("GEOIP_RELOAD_INTERVAL", time.Minute)
+
+	// How long each day's unique visitor estimate is kept in Redis
+	visitorRetention := getEnvDuration("VISITOR_RETENTION", 90*24*time.Hour)
+
+	// File of user agent patterns that replaces the built-in bot list, and how often it is checked for changes
+	botPatternsPath := os.Getenv("BOT_PATTERNS_PATH")
+	botPatternsReloadInterval := getEnvDuration("BOT_PATTERNS_RELOAD_INTERVAL", time.Minute)
+
+	// Recent clicks kept for live subscribers resuming with Last-Event-ID, and how often they get a heartbeat
+	clickStreamHistory := getEnvInt("CLICK_STREAM_HISTORY", 10000)
+	clickStreamHeartbeat := getEnvDuration("CLICK_STREAM_HEARTBEAT", 15*time.Second)
+
+	instanceID := os.Getenv("INSTANCE_ID")
+	if instanceID == "" {
+		hostname, _ := os.Hostname()
+		instanceID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	// How long in-flight requests get to finish after SIGINT or SIGTERM
+	shutdownTimeout := getEnvDuration("SHUTDOWN_TIMEOUT", 15*time.Second)
+
 	timeout := 10 * time.Second
 
 	return &Config{
-		Port:         port,
-		MongoURI:     mongoURI,
-		DatabaseName: databaseName,
-		RedisURL:     redisURL,
-		Timeout:      timeout,
+		Port:                      port,
+		MetricsAddr:               metricsAddr,
+		TrustedProxies:            trustedProxies,
+		MongoURI:                  mongoURI,
+		DatabaseName:              databaseName,
+		RedisURL:                  redisURL,
+		StorageBackend:            storageBackend,
+		BoltPath:                  boltPath,
+		SQLDialect:                sqlDialect,
+		SQLDSN:                    sqlDSN,
+		ExpirySweepInterval:       expirySweepInterval,
+		LocalCacheSize:            localCacheSize,
+		LocalCacheTTL:             localCacheTTL,
+		CounterBlockSize:          counterBlockSize,
+		CounterType:               counterType,
+		NodeID:                    nodeID,
+		CodeScrambleKey:           codeScrambleKey,
+		CodeMinLength:             codeMinLength,
+		RestoreWindow:             restoreWindow,
+		PurgeInterval:             purgeInterval,
+		BatchMaxSize:              batchMaxSize,
+		ClickBufferSize:           clickBufferSize,
+		ClickBatchSize:            clickBatchSize,
+		ClickFlushInterval:        clickFlushInterval,
+		GeoIPDatabasePath:         geoIPDatabasePath,
+		GeoIPReloadInterval:       geoIPReloadInterval,
+		VisitorRetention:          visitorRetention,
+		BotPatternsPath:           botPatternsPath,
+		BotPatternsReloadInterval: botPatternsReloadInterval,
+		ClickStreamHistory:        clickStreamHistory,
+		ClickStreamHeartbeat:      clickStreamHeartbeat,
+		InstanceID:                instanceID,
+		ShutdownTimeout:           shutdownTimeout,
+		Timeout:                   timeout,
+	}
+}
+
+// getEnvDuration reads a duration such as "30s" from the environment, falling back on parse errors
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvList reads a comma-separated list from the environment, dropping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvInt reads an integer from the environment, falling back on parse errors
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
 	}
+	return parsed
 }
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"url-shortener-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportFileBytes bounds an uploaded import file; keep in sync with ErrImportTooLarge
+const maxImportFileBytes = 32 << 20
+
+// maxImportFormOverhead leaves room in the request body for the multipart headers and the format field
+const maxImportFormOverhead = 1 << 20
+
+// ImportHandler handles HTTP requests for bulk imports
+type ImportHandler struct {
+	importService models.ImportService
+}
+
+// NewImportHandler creates a new instance of ImportHandler
+func NewImportHandler(importService models.ImportService) *ImportHandler {
+	return &ImportHandler{
+		importService: importService,
+	}
+}
+
+// CreateImport handles POST /imports; the multipart form carries the file in "file" and an optional
+// "format" (csv or jsonl), which otherwise comes from the file extension
+func (h *ImportHandler) CreateImport(c *gin.Context) {
+	// Stop reading an oversized upload instead of spooling all of it to disk first
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileBytes+maxImportFormOverhead)
+
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		HandleError(c, models.ErrImportTooLarge)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "multipart form field file is required"})
+		return
+	}
+	if header.Size > maxImportFileBytes {
+		HandleError(c, models.ErrImportTooLarge)
+		return
+	}
+
+	format := strings.ToLower(c.PostForm("format"))
+	if format == "" {
+		format = importFormatFromFilename(header.Filename)
+	}
+
+	// Get user ID from JWT context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDStr, ok := userID.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	defer file.Close()
+
+	job, err := h.importService.CreateImport(&models.ImportRequest{Format: format, File: file}, userIDStr)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Header("Location", "/imports/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetImport handles GET /imports/{id}
+func (h *ImportHandler) GetImport(c *gin.Context) {
+	// Get user ID from JWT context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDStr, ok := userID.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	job, err := h.importService.GetImport(c.Param("id"), userIDStr)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// importFormatFromFilename guesses the import format from the uploaded file's extension
+func importFormatFromFilename(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return models.ImportFormatCSV
+	case ".jsonl", ".ndjson":
+		return models.ImportFormatJSONL
+	default:
+		return ""
+	}
+}
@@ -1,6 +1,10 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -51,6 +55,331 @@ func (h *URLHandler) CreateShortURL(c *gin.Context) {
 	c.JSON(http.StatusCreated, response)
 }
 
+// CreateShortURLs handles POST /urls/batch; the body is an array of URLRequest objects and
+// ?atomic=true makes the batch all-or-nothing
+func (h *URLHandler) CreateShortURLs(c *gin.Context) {
+	var req models.URLBatchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindJSON(&req.URLs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from JWT context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDStr, ok := userID.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	response, err := h.urlService.CreateShortURLs(&req, userIDStr)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	// Every item carries its own status; the response status summarizes them
+	switch {
+	case response.Failed == 0:
+		c.JSON(http.StatusCreated, response)
+	case response.Created == 0:
+		c.JSON(http.StatusUnprocessableEntity, response)
+	default:
+		c.JSON(http.StatusMultiStatus, response)
+	}
+}
+
+// ListURLs handles GET /urls
+func (h *URLHandler) ListURLs(c *gin.Context) {
+	var req models.URLListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from JWT context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDStr, ok := userID.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	response, err := h.urlService.ListURLs(&req, userIDStr)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ExportURLs handles GET /urls/export; ?format=csv (the default) or jsonl. The file is streamed as it
+// is read, so a failure halfway through can only end the download early.
+func (h *URLHandler) ExportURLs(c *gin.Context) {
+	var req models.URLExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from JWT context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDStr, ok := userID.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	contentType, extension := "text/csv; charset=utf-8", models.ExportFormatCSV
+	if req.Format == models.ExportFormatJSONL {
+		contentType, extension = "application/x-ndjson", models.ExportFormatJSONL
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="links.`+extension+`"`)
+
+	err := h.urlService.ExportURLs(&req, userIDStr, c.Writer)
+	if err == nil {
+		return
+	}
+	if c.Writer.Written() {
+		log.Printf("Export for user %s stopped early: %v", userIDStr, err)
+		return
+	}
+
+	c.Writer.Header().Del("Content-Type")
+	c.Writer.Header().Del("Content-Disposition")
+	HandleError(c, err)
+}
+
+// GetURLInfo handles GET /urls/{short_code}/info
+func (h *URLHandler) GetURLInfo(c *gin.Context) {
+	shortCode := c.Param("short_code")
+
+	// Anonymous callers have no user ID and only see the public subset
+	userID := c.GetString("user_id")
+
+	info, err := h.urlService.GetURLInfo(shortCode, userID)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	// Owners get the ETag to send back in If-Match when editing
+	if info.ETag != "" {
+		c.Header("ETag", info.ETag)
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// GetURLStats handles GET /urls/{short_code}/stats; ?from and ?to are RFC 3339 times and ?interval is
+// hour, day (the default) or week
+func (h *URLHandler) GetURLStats(c *gin.Context) {
+	var req models.URLStatsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from JWT context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDStr, ok := userID.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	stats, err := h.urlService.GetURLStats(c.Param("short_code"), &req, userIDStr)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// StreamClicks handles GET /urls/{short_code}/events/stream and, without a short code,
+// GET /urls/events/stream for every link of the caller. Clicks are pushed as server-sent events named
+// click, with heartbeats in between; both carry the stream ID, so a reconnecting client resumes after
+// the last one it got through the Last-Event-ID header or ?last_event_id.
+func (h *URLHandler) StreamClicks(c *gin.Context) {
+	var req models.ClickStreamRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+		req.LastEventID = lastEventID
+	}
+
+	// Get user ID from JWT context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDStr, ok := userID.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	subscription, err := h.urlService.SubscribeClicks(c.Param("short_code"), &req, userIDStr)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	defer subscription.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case message, ok := <-subscription.Messages():
+			// A closed subscription fell behind or is shutting down; the client reconnects and resumes
+			if !ok {
+				return
+			}
+			if err := writeClickStreamMessage(c.Writer, message); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeClickStreamMessage writes a click or heartbeat as a server-sent event. A heartbeat before the
+// first click has no ID to carry, so it is a comment.
+func writeClickStreamMessage(w io.Writer, message models.ClickStreamMessage) error {
+	if message.Click == nil {
+		if message.ID == "" {
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err
+		}
+		_, err := fmt.Fprintf(w, "id: %s\nevent: heartbeat\ndata: {}\n\n", message.ID)
+		return err
+	}
+
+	data, err := json.Marshal(message.Click)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: click\ndata: %s\n\n", message.ID, data)
+	return err
+}
+
+// UpdateShortURL handles PATCH /urls/{short_code}
+func (h *URLHandler) UpdateShortURL(c *gin.Context) {
+	var req models.URLUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.IfMatch = c.GetHeader("If-Match")
+
+	// Get user ID from JWT context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDStr, ok := userID.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	info, err := h.urlService.UpdateShortURL(c.Param("short_code"), &req, userIDStr)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Header("ETag", info.ETag)
+	c.JSON(http.StatusOK, info)
+}
+
+// DeleteShortURL handles DELETE /urls/{short_code}
+func (h *URLHandler) DeleteShortURL(c *gin.Context) {
+	// Get user ID from JWT context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDStr, ok := userID.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	if err := h.urlService.DeleteShortURL(c.Param("short_code"), userIDStr); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RestoreShortURL handles POST /urls/{short_code}/restore
+func (h *URLHandler) RestoreShortURL(c *gin.Context) {
+	// Get user ID from JWT context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDStr, ok := userID.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	info, err := h.urlService.RestoreShortURL(c.Param("short_code"), userIDStr)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Header("ETag", info.ETag)
+	c.JSON(http.StatusOK, info)
+}
+
 // RedirectToURL handles GET /urls/{short_code}
 func (h *URLHandler) RedirectToURL(c *gin.Context) {
 	shortCode := c.Param("short_code")
@@ -69,7 +398,8 @@ func (h *URLHandler) RedirectToURL(c *gin.Context) {
 		return
 	}
 
-	// Redirect to original URL
+	// Redirect to original URL. A temporary redirect keeps browsers from caching it, so every visit
+	// reaches the server and is counted, and edits to the link take effect
 	c.Header("Location", originalURL)
-	c.Status(http.StatusMovedPermanently)
+	c.Status(http.StatusFound)
 }
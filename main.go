@@ -2,71 +2,102 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"url-shortener-api/config"
 	"url-shortener-api/routes"
 	"url-shortener-api/services"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
-	// Connect to MongoDB
-	client, err := connectToMongoDB(cfg)
+	// Initialize services using factory for the configured storage backend
+	serviceFactory, err := services.NewServiceFactory(cfg)
 	if err != nil {
-		log.Fatal("Failed to connect to MongoDB:", err)
+		log.Fatal("Failed to initialize services:", err)
 	}
-	defer func() {
-		if err = client.Disconnect(context.TODO()); err != nil {
-			log.Fatal("Failed to disconnect from MongoDB:", err)
-		}
-	}()
-
-	// Get database and collection
-	db := client.Database(cfg.DatabaseName)
-	collection := db.Collection("url_mappings")
 
-	// Initialize services using factory with MongoDB collection and Redis URL
-	serviceFactory := services.NewServiceFactory(collection, cfg.RedisURL)
 	urlService := serviceFactory.CreateURLService()
+	importService := serviceFactory.CreateImportService()
+	clickRecorder := serviceFactory.CreateClickRecorder()
 
 	// Setup Gin router
 	r := gin.Default()
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 
 	// Setup routes
-	routes.SetupRoutes(r, urlService)
+	routes.SetupRoutes(r, urlService, importService, clickRecorder)
 
-	// Start server
-	fmt.Printf("URL Shortener API starting on :%s\n", cfg.Port)
-	if err := r.Run(":" + cfg.Port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	// Request contexts derive from this one, so open click streams end as soon as shutdown starts
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        ":" + cfg.Port,
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return requestCtx },
 	}
-}
+	server.RegisterOnShutdown(cancelRequests)
 
-// connectToMongoDB establishes a connection to MongoDB
-func connectToMongoDB(cfg *config.Config) (*mongo.Client, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
-	defer cancel()
+	// Serve metrics on their own internal listener
+	var metricsServer *http.Server
+	if cfg.MetricsAddr != "" {
+		metrics := gin.New()
+		metrics.Use(gin.Recovery())
+		routes.SetupMetricsRoutes(metrics)
+		metricsServer = &http.Server{Addr: cfg.MetricsAddr, Handler: metrics}
+		go func() {
+			fmt.Printf("Metrics listening on %s\n", cfg.MetricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal("Failed to start metrics server:", err)
+			}
+		}()
+	}
 
-	clientOptions := options.Client().ApplyURI(cfg.MongoURI)
-	client, err := mongo.Connect(ctx, clientOptions)
-	if err != nil {
-		return nil, err
+	// Start server
+	serverErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("URL Shortener API starting on :%s (storage: %s)\n", cfg.Port, cfg.StorageBackend)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	case <-ctx.Done():
+		stop()
+		log.Println("Shutting down")
 	}
 
-	// Test the connection
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		return nil, err
+	// Let in-flight requests finish before the workers they feed are stopped
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Warning: Server did not shut down cleanly:", err)
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			log.Println("Warning: Metrics server did not shut down cleanly:", err)
+		}
 	}
 
-	fmt.Printf("Connected to MongoDB at %s\n", cfg.MongoURI)
-	return client, nil
+	if err := serviceFactory.Close(); err != nil {
+		log.Fatal("Failed to shut down services:", err)
+	}
 }
@@ -78,6 +78,19 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// OptionalAuthMiddleware authenticates like AuthMiddleware when an Authorization header is sent,
+// and lets requests without one through anonymously
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	authenticate := AuthMiddleware()
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		authenticate(c)
+	}
+}
+
 // GenerateJWT generates a JWT token for a user
 func GenerateJWT(userID string) (string, error) {
 	// Get the secret key from environment variable
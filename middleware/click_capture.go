@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"url-shortener-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxClickHeaderLength bounds the header values copied into a click event
+const maxClickHeaderLength = 512
+
+// ClickCaptureMiddleware records a click event for every request the handler answers with a redirect.
+// The event is handed to the recorder without blocking, so capture never slows the redirect down. The
+// client IP is passed on in full; the recorder truncates it after locating it. It comes from
+// X-Forwarded-For only when the router trusts the connecting proxy. HEAD requests and
+// browser prefetches are marked as bots here, since only the request shows them; the recorder
+// classifies the rest by user agent.
+func ClickCaptureMiddleware(recorder models.ClickRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if c.Writer.Status() != http.StatusFound {
+			return
+		}
+
+		recorder.Record(models.ClickEvent{
+			ShortCode:      c.Param("short_code"),
+			Timestamp:      time.Now(),
+			Referrer:       truncateHeader(c.Request.Referer()),
+			UserAgent:      truncateHeader(c.Request.UserAgent()),
+			IP:             c.ClientIP(),
+			AcceptLanguage: truncateHeader(c.GetHeader("Accept-Language")),
+			Bot:            c.Request.Method == http.MethodHead || isPrefetch(c.Request),
+		})
+	}
+}
+
+// isPrefetch reports whether a request carries one of the headers browsers and link previews send
+// when fetching ahead of a real visit
+func isPrefetch(r *http.Request) bool {
+	for _, header := range []string{"Purpose", "Sec-Purpose", "X-Purpose", "X-Moz"} {
+		value := strings.ToLower(r.Header.Get(header))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "prerender") || strings.Contains(value, "preview") {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateHeader cuts a header value to maxClickHeaderLength bytes and drops invalid UTF-8,
+// which PostgreSQL would reject along with the rest of the batch
+func truncateHeader(value string) string {
+	if len(value) > maxClickHeaderLength {
+		value = value[:maxClickHeaderLength]
+	}
+	return strings.ToValidUTF8(value, "")
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrCacheMiss is returned by Cache.Get when the key is not cached
+var ErrCacheMiss = errors.New("key not found")
+
+// Cache interface defines the contract for key-value caches in front of URL storage
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,173 @@
+package models
+
+import "time"
+
+// ClickEvent records one redirect through a short code. IP is recorded in full and truncated before
+// it is stored. The referrer host, browser, OS, device class and language are derived from the headers,
+// and the location from the full IP, before storage. Bot marks clicks made by crawlers, link unfurlers,
+// uptime checkers and prefetches rather than by a person.
+type ClickEvent struct {
+	ShortCode      string    `bson:"short_code" json:"short_code"`
+	Timestamp      time.Time `bson:"timestamp" json:"timestamp"`
+	Referrer       string    `bson:"referrer,omitempty" json:"referrer,omitempty"`
+	UserAgent      string    `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	IP             string    `bson:"ip,omitempty" json:"ip,omitempty"`
+	AcceptLanguage string    `bson:"accept_language,omitempty" json:"accept_language,omitempty"`
+	ReferrerHost   string    `bson:"referrer_host,omitempty" json:"referrer_host,omitempty"`
+	Browser        string    `bson:"browser,omitempty" json:"browser,omitempty"`
+	OS             string    `bson:"os,omitempty" json:"os,omitempty"`
+	Device         string    `bson:"device,omitempty" json:"device,omitempty"`
+	Language       string    `bson:"language,omitempty" json:"language,omitempty"`
+	Country        string    `bson:"country,omitempty" json:"country,omitempty"`
+	Region         string    `bson:"region,omitempty" json:"region,omitempty"`
+	City           string    `bson:"city,omitempty" json:"city,omitempty"`
+	Bot            bool      `bson:"bot,omitempty" json:"bot,omitempty"`
+}
+
+// GeoLocation is where an IP address is located; fields the lookup cannot tell are empty
+type GeoLocation struct {
+	Country string // ISO 3166-1 alpha-2 code
+	Region  string
+	City    string
+}
+
+// GeoLocator resolves client IP addresses to locations
+type GeoLocator interface {
+	Locate(ip string) GeoLocation
+}
+
+// BotClassifier recognizes the user agents of automated clients
+type BotClassifier interface {
+	IsBot(userAgent string) bool
+}
+
+// Time series intervals accepted in URLStatsRequest.Interval
+const (
+	StatsIntervalHour = "hour"
+	StatsIntervalDay  = "day"
+	StatsIntervalWeek = "week"
+)
+
+// ClickStatsQuery selects the clicks of one short code in [From, To) and how to summarize them
+type ClickStatsQuery struct {
+	ShortCode   string
+	From        time.Time
+	To          time.Time
+	Interval    string
+	Top         int // most values returned per breakdown
+	IncludeBots bool
+}
+
+// ClickBucket is the number of clicks in the interval starting at Start
+type ClickBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+}
+
+// ClickCount is the number of clicks sharing one value of a breakdown
+type ClickCount struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+// ClickStats summarizes the clicks matched by a ClickStatsQuery. Breakdowns are sorted by clicks,
+// most first; an empty value stands for clicks where the dimension is unknown.
+type ClickStats struct {
+	TotalClicks      int64         `json:"total_clicks"`
+	Series           []ClickBucket `json:"series"`
+	Referrers        []ClickCount  `json:"referrers"`
+	Browsers         []ClickCount  `json:"browsers"`
+	OperatingSystems []ClickCount  `json:"operating_systems"`
+	Devices          []ClickCount  `json:"devices"`
+	Languages        []ClickCount  `json:"languages"`
+	Countries        []ClickCount  `json:"countries"`
+}
+
+// URLStatsRequest represents the query string of a request for a short URL's click stats
+type URLStatsRequest struct {
+	From        string `form:"from"`
+	To          string `form:"to"`
+	Interval    string `form:"interval"`
+	IncludeBots bool   `form:"include_bots"`
+}
+
+// URLStats represents the click stats of a short URL over a time range
+type URLStats struct {
+	ShortCode      string    `json:"short_code"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	Interval       string    `json:"interval"`
+	IncludeBots    bool      `json:"include_bots"`
+	UniqueVisitors int64     `json:"unique_visitors"` // estimated over the whole UTC days the range overlaps; never bots
+	ClickStats
+}
+
+// ClickRecorder accepts click events from the redirect path. Record must never block; events that
+// cannot be taken right away are dropped.
+type ClickRecorder interface {
+	Record(event ClickEvent)
+}
+
+// VisitorCounter estimates how many distinct visitors clicked a short code. A visitor is a client IP
+// and user agent, hashed with a salt that changes every UTC day, so nobody can be recognized once the
+// salt is gone. The same client on two days counts as two visitors.
+type VisitorCounter interface {
+	AddVisitors(events []ClickEvent) error
+	CountVisitors(shortCode string, from time.Time, to time.Time) (int64, error)
+}
+
+// ClickStreamRequest represents the query string of a request for live clicks. LastEventID is for
+// clients that cannot send the Last-Event-ID header; the header wins when both are set.
+type ClickStreamRequest struct {
+	IncludeBots bool   `form:"include_bots"`
+	LastEventID string `form:"last_event_id"`
+}
+
+// ClickStreamFilter selects the live clicks of a user's links, or of one of them when ShortCode is set
+type ClickStreamFilter struct {
+	UserID      string
+	ShortCode   string
+	IncludeBots bool
+}
+
+// Matches reports whether a live click is selected by the filter
+func (f ClickStreamFilter) Matches(click LiveClick) bool {
+	return click.UserID == f.UserID && (f.ShortCode == "" || click.ShortCode == f.ShortCode) && (f.IncludeBots || !click.Bot)
+}
+
+// LiveClick is a stored click event as pushed to live subscribers. ID is its place in the click
+// stream, which orders clicks across API instances and lets a subscriber resume after it.
+type LiveClick struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	ClickEvent
+}
+
+// ClickStreamMessage is one message of a live subscription: a click, or a heartbeat when Click is nil.
+// ID is the stream ID the subscriber has been sent everything up to, so a heartbeat moves it past
+// clicks that did not match its filter.
+type ClickStreamMessage struct {
+	ID    string
+	Click *LiveClick
+}
+
+// ClickSubscription delivers the live clicks matching a filter. Messages is closed when the
+// subscription ends, for example because its reader fell too far behind.
+type ClickSubscription interface {
+	Messages() <-chan ClickStreamMessage
+	Close()
+}
+
+// ClickStream fans stored click events out to live subscribers on every API instance. Subscribe
+// first replays the retained clicks after lastEventID, when it is not empty.
+type ClickStream interface {
+	PublishClicks(events []ClickEvent) error
+	Subscribe(filter ClickStreamFilter, lastEventID string) (ClickSubscription, error)
+}
+
+// ClickEventRepository interface defines the contract for click event persistence
+type ClickEventRepository interface {
+	StoreClickEvents(events []ClickEvent) error
+	CountClicks(shortCodes []string, includeBots bool) (map[string]int64, error)
+	ClickStats(query ClickStatsQuery) (*ClickStats, error)
+}
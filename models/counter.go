@@ -19,3 +19,23 @@ type CounterService interface {
 	GetCurrentCounter() (int64, error)
 	InitializeCounter() error
 }
+
+// CounterBlockAllocator leases contiguous blocks of counter values in a single atomic step,
+// so an instance can hand out values locally instead of incrementing the shared counter each time
+type CounterBlockAllocator interface {
+	AllocateBlock(size int64) (start int64, end int64, err error)
+}
+
+// CounterSeeder raises a counter to at least a known high-water mark; it never lowers it
+type CounterSeeder interface {
+	SeedCounter(minimum int64) error
+}
+
+// CounterLease records the latest block of counter values leased by an API instance
+type CounterLease struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	InstanceID string             `bson:"instance_id" json:"instance_id"`
+	Start      int64              `bson:"start" json:"start"`
+	End        int64              `bson:"end" json:"end"`
+	LeasedAt   time.Time          `bson:"leased_at" json:"leased_at"`
+}
@@ -30,6 +30,43 @@ var (
 	ErrAliasAlreadyExists   = &AppError{Message: "alias already exists", StatusCode: http.StatusConflict}
 	ErrShortCodeNotFound    = &AppError{Message: "short code not found", StatusCode: http.StatusNotFound}
 	ErrShortCodeExpired     = &AppError{Message: "short code has expired", StatusCode: http.StatusNotFound}
+	ErrInvalidStrategy      = &AppError{Message: "strategy must be one of counter, random or hash, and cannot be combined with an alias", StatusCode: http.StatusBadRequest}
+	ErrInvalidCodeLength    = &AppError{Message: "length must be between 6 and 20 characters", StatusCode: http.StatusBadRequest}
+	ErrShortCodeTaken       = &AppError{Message: "short code is already taken by a different URL", StatusCode: http.StatusConflict}
+	ErrCodeSpaceExhausted   = &AppError{Message: "could not generate a unique short code, try a longer length", StatusCode: http.StatusServiceUnavailable}
+	ErrClockMovedBackwards  = &AppError{Message: "system clock moved backwards, refusing to generate codes", StatusCode: http.StatusServiceUnavailable}
+	ErrInvalidCursor        = &AppError{Message: "invalid cursor", StatusCode: http.StatusBadRequest}
+	ErrInvalidListLimit     = &AppError{Message: "limit must be between 1 and 100", StatusCode: http.StatusBadRequest}
+	ErrInvalidListFilter    = &AppError{Message: "sort must be created_at or -created_at and status must be active, expired or deleted", StatusCode: http.StatusBadRequest}
+	ErrInvalidVisibility    = &AppError{Message: "visibility must be public or private", StatusCode: http.StatusBadRequest}
+	ErrInvalidExpiration    = &AppError{Message: "expiration_ms must not be negative", StatusCode: http.StatusBadRequest}
+	ErrEmptyUpdate          = &AppError{Message: "at least one of url, alias, expiration_ms or visibility is required", StatusCode: http.StatusBadRequest}
+	ErrNotURLOwner          = &AppError{Message: "only the owner can modify this short URL", StatusCode: http.StatusForbidden}
+	ErrPreconditionFailed   = &AppError{Message: "short URL was modified since the given ETag", StatusCode: http.StatusPreconditionFailed}
+	ErrConcurrentUpdate     = &AppError{Message: "short URL was modified concurrently, retry the request", StatusCode: http.StatusConflict}
+	ErrShortCodeDeleted     = &AppError{Message: "short code has been deleted", StatusCode: http.StatusGone}
+	ErrNotDeleted           = &AppError{Message: "short URL is not deleted", StatusCode: http.StatusConflict}
+	ErrRestoreWindowPassed  = &AppError{Message: "short URL was deleted too long ago to be restored", StatusCode: http.StatusGone}
+	ErrInvalidTags          = &AppError{Message: "at most 10 tags of 1 to 32 letters, numbers, hyphens or underscores are allowed", StatusCode: http.StatusBadRequest}
+	ErrEmptyBatch           = &AppError{Message: "batch must contain at least one URL", StatusCode: http.StatusBadRequest}
+	ErrBatchTooLarge        = &AppError{Message: "batch contains more URLs than allowed", StatusCode: http.StatusRequestEntityTooLarge}
+	ErrBatchAborted         = &AppError{Message: "not created because another URL of the all-or-nothing batch failed", StatusCode: http.StatusFailedDependency}
+	ErrInvalidImportFormat  = &AppError{Message: "format must be csv or jsonl", StatusCode: http.StatusBadRequest}
+	ErrInvalidImportFile    = &AppError{Message: "import file could not be parsed", StatusCode: http.StatusBadRequest}
+	ErrMissingURLColumn     = &AppError{Message: "import file needs a url column", StatusCode: http.StatusBadRequest}
+	ErrEmptyImport          = &AppError{Message: "import file contains no rows", StatusCode: http.StatusBadRequest}
+	ErrImportTooLarge       = &AppError{Message: "import file is larger than 32 MB", StatusCode: http.StatusRequestEntityTooLarge}
+	ErrImportNotFound       = &AppError{Message: "import job not found", StatusCode: http.StatusNotFound}
+	ErrExpirationPassed     = &AppError{Message: "expiration is in the past", StatusCode: http.StatusBadRequest}
+	ErrInvalidExportFormat  = &AppError{Message: "format must be csv or jsonl", StatusCode: http.StatusBadRequest}
+	ErrAliasReserved        = &AppError{Message: "alias is reserved", StatusCode: http.StatusBadRequest}
+	ErrNotStatsOwner        = &AppError{Message: "only the owner can view the stats of this short URL", StatusCode: http.StatusForbidden}
+	ErrInvalidStatsInterval = &AppError{Message: "interval must be hour, day or week", StatusCode: http.StatusBadRequest}
+	ErrInvalidStatsRange    = &AppError{Message: "from and to must be RFC 3339 times with from before to", StatusCode: http.StatusBadRequest}
+	ErrStatsRangeTooLong    = &AppError{Message: "range spans more than 1000 intervals, use a longer interval", StatusCode: http.StatusBadRequest}
+	ErrNotStreamOwner       = &AppError{Message: "only the owner can watch the clicks of this short URL", StatusCode: http.StatusForbidden}
+	ErrInvalidLastEventID   = &AppError{Message: "Last-Event-ID must be a click stream ID", StatusCode: http.StatusBadRequest}
+	ErrClickStreamDisabled  = &AppError{Message: "live clicks are unavailable because click capture is disabled", StatusCode: http.StatusServiceUnavailable}
 )
 
 // GetStatusCodeFromError extracts HTTP status code from an error
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"io"
+	"time"
+)
+
+// Import job states
+const (
+	ImportStatusQueued    = "queued"
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+)
+
+// Import file formats accepted in ImportRequest.Format
+const (
+	ImportFormatCSV   = "csv"
+	ImportFormatJSONL = "jsonl"
+)
+
+// ImportRequest represents an uploaded file of links to import
+type ImportRequest struct {
+	Format string
+	File   io.Reader
+}
+
+// MaxImportErrors bounds the row errors kept on a job; Failed still counts every one
+const MaxImportErrors = 1000
+
+// ImportJob tracks the background import of an uploaded file. Rows are processed in order and
+// progress is saved every few rows, so a restarted worker resumes right after Cursor.
+type ImportJob struct {
+	ID            string           `bson:"_id" json:"id"`
+	UserID        string           `bson:"user_id" json:"-"`
+	Format        string           `bson:"format" json:"format"`
+	Status        string           `bson:"status" json:"status"`
+	TotalRows     int              `bson:"total_rows" json:"total_rows"`
+	ProcessedRows int              `bson:"processed_rows" json:"processed_rows"`
+	Created       int              `bson:"created" json:"created"`
+	Failed        int              `bson:"failed" json:"failed"`
+	Errors        []ImportRowError `bson:"errors,omitempty" json:"errors,omitempty"` // the first failed rows only
+	Cursor        int              `bson:"cursor" json:"-"`                          // Row of the last processed row
+	LeaseOwner    string           `bson:"lease_owner" json:"-"`
+	LeaseUntil    time.Time        `bson:"lease_until" json:"-"`
+	CreatedAt     time.Time        `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time        `bson:"updated_at" json:"updated_at"`
+	CompletedAt   *time.Time       `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// IsFinished reports whether every row of the job has been processed
+func (j ImportJob) IsFinished() bool {
+	return j.Status == ImportStatusCompleted
+}
+
+// ImportRowError reports why one row of an import was not created
+type ImportRowError struct {
+	Row    int    `bson:"row" json:"row"`
+	Status int    `bson:"status" json:"status"`
+	Error  string `bson:"error" json:"error"`
+}
+
+// ImportRow is one parsed row of an import file. Row is the CSV record number after the header,
+// or the JSONL line number.
+type ImportRow struct {
+	Row        int        `bson:"row" json:"row"`
+	URL        string     `bson:"url" json:"url"`
+	Alias      string     `bson:"alias,omitempty" json:"alias,omitempty"`
+	Expiration *time.Time `bson:"expiration,omitempty" json:"expiration,omitempty"`
+	Tags       []string   `bson:"tags,omitempty" json:"tags,omitempty"`
+	Error      string     `bson:"error,omitempty" json:"error,omitempty"`           // why the row could not be parsed
+	ShortCode  string     `bson:"short_code,omitempty" json:"short_code,omitempty"` // set once the row's link is created
+}
+
+// ImportJobRepository interface defines the contract for import job persistence. A job is processed
+// by whoever holds its lease; saving fails once the lease has passed to another worker. Saving a job
+// writes its progress and appends newErrors to the stored errors, up to MaxImportErrors; job.Errors
+// itself is not written.
+type ImportJobRepository interface {
+	CreateImportJob(job ImportJob, rows []ImportRow) error
+	GetImportJob(id string) (ImportJob, bool, error)
+	ListUnfinishedImportJobs() ([]ImportJob, error)
+	ClaimImportJob(id string, owner string, until time.Time) (ImportJob, bool, error)
+	SaveImportJob(job ImportJob, newErrors []ImportRowError) (bool, error)
+	GetImportRows(jobID string, after int, limit int) ([]ImportRow, error)
+	SetImportRowShortCode(jobID string, row int, shortCode string) error
+	DeleteImportRows(jobID string) error
+}
+
+// ImportService interface defines the contract for import operations
+type ImportService interface {
+	CreateImport(req *ImportRequest, userID string) (*ImportJob, error)
+	GetImport(id string, userID string) (*ImportJob, error)
+}
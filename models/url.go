@@ -1,16 +1,44 @@
 package models
 
 import (
+	"io"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Short code strategies accepted in URLRequest.Strategy
+const (
+	StrategyCounter = "counter"
+	StrategyRandom  = "random"
+	StrategyHash    = "hash"
+)
+
+// Link visibility accepted in URLRequest.Visibility; it governs what GET /urls/:short_code/info
+// shows to anyone but the owner
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
 // URLRequest represents the request body for creating a short URL
 type URLRequest struct {
-	URL          string `json:"url" binding:"required"`
-	Alias        string `json:"alias"`
-	ExpirationMs int64  `json:"expiration_ms"`
+	URL          string   `json:"url" binding:"required"`
+	Alias        string   `json:"alias"`
+	ExpirationMs int64    `json:"expiration_ms"`
+	Strategy     string   `json:"strategy"`
+	Length       int      `json:"length"`
+	Visibility   string   `json:"visibility"`
+	Tags         []string `json:"tags"`
+}
+
+// URLUpdateRequest represents the request body for editing a short URL; omitted fields are unchanged
+type URLUpdateRequest struct {
+	URL          *string `json:"url"`
+	Alias        *string `json:"alias"`         // renames the link to this alias
+	ExpirationMs *int64  `json:"expiration_ms"` // from now; 0 removes the expiration
+	Visibility   *string `json:"visibility"`
+	IfMatch      string  `json:"-"` // ETag the caller last saw, from the If-Match header
 }
 
 // URLResponse represents the response for creating a short URL
@@ -18,6 +46,26 @@ type URLResponse struct {
 	ShortCode string `json:"short_code"`
 }
 
+// URLBatchRequest represents a request creating many short URLs at once
+type URLBatchRequest struct {
+	URLs   []URLRequest `json:"-"`      // the request body
+	Atomic bool         `form:"atomic"` // all-or-nothing; otherwise every valid item is created
+}
+
+// URLBatchResult represents the outcome of one item of a batch, in request order
+type URLBatchResult struct {
+	ShortCode string `json:"short_code,omitempty"`
+	Status    int    `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// URLBatchResponse represents the response for creating a batch of short URLs
+type URLBatchResponse struct {
+	Results []URLBatchResult `json:"results"`
+	Created int              `json:"created"`
+	Failed  int              `json:"failed"`
+}
+
 // URLMapping represents a URL mapping document in MongoDB
 type URLMapping struct {
 	ID                  primitive.ObjectID `bson:"_id,omitempty" json:"id"`
@@ -25,14 +73,182 @@ type URLMapping struct {
 	ShortURL            string             `bson:"short_url" json:"short_url"`
 	ExpirationTimestamp *time.Time         `bson:"expiration_timestamp,omitempty" json:"expiration_timestamp,omitempty"`
 	Alias               string             `bson:"alias,omitempty" json:"alias,omitempty"`
+	Strategy            string             `bson:"strategy,omitempty" json:"strategy,omitempty"`
+	Visibility          string             `bson:"visibility,omitempty" json:"visibility,omitempty"`
 	CreatedAt           time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt           time.Time          `bson:"updated_at" json:"updated_at"`
 	UserID              string             `bson:"user_id" json:"user_id"`
+	DeletedAt           *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	Tags                []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+	Counter             int64              `bson:"counter" json:"-"`              // counter value of a counter code; 0 otherwise
+	RenamedTo           string             `bson:"renamed_to,omitempty" json:"-"` // set on the mapping left under the old code of a renamed link
+}
+
+// IsExpired reports whether the mapping has passed its expiration timestamp
+func (m URLMapping) IsExpired() bool {
+	if m.ExpirationTimestamp == nil {
+		return false
+	}
+	return time.Now().After(*m.ExpirationTimestamp)
+}
+
+// IsDeleted reports whether the owner deleted the mapping; it is kept, reserving its code, until purged
+func (m URLMapping) IsDeleted() bool {
+	return m.DeletedAt != nil
+}
+
+// IsRenamed reports whether the mapping only keeps the old code of a renamed link, redirecting to RenamedTo
+func (m URLMapping) IsRenamed() bool {
+	return m.RenamedTo != ""
+}
+
+// IsPublic reports whether non-owners may see the destination; mappings without a setting are public
+func (m URLMapping) IsPublic() bool {
+	return m.Visibility != VisibilityPrivate
+}
+
+// URLInfo represents the metadata of a short URL, returned without redirecting.
+// Fields a caller may not see are left empty.
+type URLInfo struct {
+	ShortCode           string     `json:"short_code"`
+	OriginalURL         string     `json:"original_url,omitempty"`
+	Alias               string     `json:"alias,omitempty"`
+	Strategy            string     `json:"strategy,omitempty"`
+	Visibility          string     `json:"visibility"`
+	CreatedAt           *time.Time `json:"created_at,omitempty"`
+	UpdatedAt           *time.Time `json:"updated_at,omitempty"`
+	ExpirationTimestamp *time.Time `json:"expiration_timestamp,omitempty"`
+	Expired             bool       `json:"expired"`
+	DeletedAt           *time.Time `json:"deleted_at,omitempty"`
+	UserID              string     `json:"user_id,omitempty"`
+	Tags                []string   `json:"tags,omitempty"`
+	TotalClicks         *int64     `json:"total_clicks,omitempty"`
+	UniqueVisitors      *int64     `json:"unique_visitors,omitempty"`
+	IsOwner             bool       `json:"is_owner"`
+	ETag                string     `json:"-"` // only set for the owner
+}
+
+// IsCounterGenerated reports whether the short code was encoded from the counter, as opposed to
+// an alias or a random or hash code. Mappings stored before strategies existed have none.
+func (m URLMapping) IsCounterGenerated() bool {
+	return m.Alias == "" && (m.Strategy == "" || m.Strategy == StrategyCounter)
+}
+
+// Status filters accepted by URLListRequest.Status
+const (
+	LinkStatusActive  = "active"
+	LinkStatusExpired = "expired"
+	LinkStatusDeleted = "deleted"
+)
+
+// URLListRequest represents the query string of a request listing the caller's short URLs
+type URLListRequest struct {
+	Cursor    string `form:"cursor"`
+	Limit     int    `form:"limit"`
+	Sort      string `form:"sort"`
+	Status    string `form:"status"`
+	AliasOnly bool   `form:"alias_only"`
+	Domain    string `form:"domain"`
+}
+
+// URLListResponse represents one page of the caller's short URLs
+type URLListResponse struct {
+	URLs       []URLMapping `json:"urls"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// Export file formats accepted in URLExportRequest.Format
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatJSONL = "jsonl"
+)
+
+// URLExportRequest represents the query parameters for exporting the caller's short URLs
+type URLExportRequest struct {
+	Format      string `form:"format"`
+	Clicks      bool   `form:"clicks"` // adds each link's click total
+	IncludeBots bool   `form:"include_bots"`
+}
+
+// URLExport is one exported link. The url, alias, expiration and tags fields match the import
+// columns, so an export can be uploaded again as an import.
+type URLExport struct {
+	ShortCode  string     `json:"short_code"`
+	URL        string     `json:"url"`
+	Alias      string     `json:"alias,omitempty"`
+	Expiration *time.Time `json:"expiration,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	Visibility string     `json:"visibility"`
+	Strategy   string     `json:"strategy,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Clicks     *int64     `json:"clicks,omitempty"` // only when requested
+}
+
+// URLListCursor identifies the last mapping of a page; the next page starts right after it
+type URLListCursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+}
+
+// URLListQuery selects one page of a user's mappings ordered by created_at and then ID
+type URLListQuery struct {
+	UserID    string
+	After     *URLListCursor // nil for the first page
+	Limit     int
+	Ascending bool // newest first unless set
+	Status    string
+	AliasOnly bool
+	Domain    string // matches the destination host and its subdomains
+}
+
+// CodeInput is what a CodeGenerator may derive a short code from
+type CodeInput struct {
+	URL    string
+	UserID string
+	Length int
+}
+
+// CodeGenerator produces short codes for one strategy
+type CodeGenerator interface {
+	Generate(input CodeInput) (string, error)
+}
+
+// BatchCodeGenerator is a CodeGenerator that can produce many codes in one round trip to shared state
+type BatchCodeGenerator interface {
+	GenerateBatch(count int) ([]string, error)
+}
+
+// URLRepository interface defines the contract for URL mapping persistence
+type URLRepository interface {
+	Store(shortCode string, mapping URLMapping) error
+	StoreMany(mappings []URLMapping, atomic bool) ([]error, error)
+	Get(shortCode string) (URLMapping, bool, error)
+	Exists(shortCode string) (bool, error)
+	Delete(shortCode string) error
+	Update(shortCode string, mapping URLMapping) error
+	GetByUserID(userID string) ([]URLMapping, error)
+	ListByUserID(query URLListQuery) ([]URLMapping, error)
+	ReplaceIfUnchanged(shortCode string, lastUpdatedAt time.Time, mapping URLMapping) (bool, error)
+	PurgeDeleted(before time.Time) (int64, error)
+	GetByAlias(alias string) (URLMapping, bool, error)
+	BackfillCounters(counterOf func(mapping URLMapping) int64) error
+	HighestCounter() (int64, error)
+	ScanByUserID(userID string, fn func(mapping URLMapping) (bool, error)) error
 }
 
 // URLService interface defines the contract for URL operations
 type URLService interface {
 	CreateShortURL(req *URLRequest, userID string) (*URLResponse, error)
+	CreateShortURLs(req *URLBatchRequest, userID string) (*URLBatchResponse, error)
 	GetOriginalURL(shortCode string, useCache bool) (string, error)
 	DeleteExpiredURL(shortCode string)
+	ListURLs(req *URLListRequest, userID string) (*URLListResponse, error)
+	ExportURLs(req *URLExportRequest, userID string, w io.Writer) error
+	GetURLInfo(shortCode string, userID string) (*URLInfo, error)
+	GetURLStats(shortCode string, req *URLStatsRequest, userID string) (*URLStats, error)
+	SubscribeClicks(shortCode string, req *ClickStreamRequest, userID string) (ClickSubscription, error)
+	UpdateShortURL(shortCode string, req *URLUpdateRequest, userID string) (*URLInfo, error)
+	DeleteShortURL(shortCode string, userID string) error
+	RestoreShortURL(shortCode string, userID string) (*URLInfo, error)
 }
@@ -4,12 +4,13 @@ import (
 	"url-shortener-api/handlers"
 	"url-shortener-api/middleware"
 	"url-shortener-api/models"
+	"url-shortener-api/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRoutes configures all the routes for the application
-func SetupRoutes(r *gin.Engine, urlService models.URLService) {
+func SetupRoutes(r *gin.Engine, urlService models.URLService, importService models.ImportService, clickRecorder models.ClickRecorder) {
 	// Health check endpoint
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -20,15 +21,49 @@ func SetupRoutes(r *gin.Engine, urlService models.URLService) {
 
 	// Create handlers
 	urlHandler := handlers.NewURLHandler(urlService)
+	importHandler := handlers.NewImportHandler(importService)
 
-	// URL creation route (authentication required)
+	// URL management routes (authentication required)
 	urls := r.Group("/urls")
 	urls.Use(middleware.AuthMiddleware())
 	{
 		urls.POST("", urlHandler.CreateShortURL)
+		urls.POST("/batch", urlHandler.CreateShortURLs)
+		urls.GET("", urlHandler.ListURLs)
+		urls.GET("/export", urlHandler.ExportURLs)
+		urls.PATCH("/:short_code", urlHandler.UpdateShortURL)
+		urls.DELETE("/:short_code", urlHandler.DeleteShortURL)
+		urls.POST("/:short_code/restore", urlHandler.RestoreShortURL)
+		urls.GET("/:short_code/stats", urlHandler.GetURLStats)
+		urls.GET("/events/stream", urlHandler.StreamClicks)
+		urls.GET("/:short_code/events/stream", urlHandler.StreamClicks)
 	}
 
-	// URL redirect route (no authentication required)
-	r.GET("/urls/:short_code", urlHandler.RedirectToURL)
+	// Bulk import routes (authentication required)
+	imports := r.Group("/imports")
+	imports.Use(middleware.AuthMiddleware())
+	{
+		imports.POST("", importHandler.CreateImport)
+		imports.GET("/:id", importHandler.GetImport)
+	}
+
+	// URL redirect routes (no authentication required); redirects are recorded as clicks unless
+	// click capture is disabled, and HEAD redirects are recorded as bots
+	redirect := []gin.HandlerFunc{urlHandler.RedirectToURL}
+	if clickRecorder != nil {
+		redirect = append([]gin.HandlerFunc{middleware.ClickCaptureMiddleware(clickRecorder)}, redirect...)
+	}
+	r.GET("/urls/:short_code", redirect...)
+	r.HEAD("/urls/:short_code", redirect...)
+
+	// URL metadata route (authentication optional; owners see every field)
+	r.GET("/urls/:short_code/info", middleware.OptionalAuthMiddleware(), urlHandler.GetURLInfo)
+
+}
 
+// SetupMetricsRoutes configures the routes of the internal metrics listener, which is kept off the
+// public one
+func SetupMetricsRoutes(r *gin.Engine) {
+	// Cache hit/miss, counter and click counters
+	r.GET("/debug/vars", gin.WrapH(services.MetricsHandler()))
 }
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+
+	"url-shortener-api/models"
+)
+
+// blockAllocatingCounter is a shared counter that can also lease blocks of values
+type blockAllocatingCounter interface {
+	models.CounterService
+	models.CounterBlockAllocator
+}
+
+// BlockCounter implements models.CounterService with hi/lo allocation: it leases a block of
+// values from the shared counter in one atomic step and hands them out from memory, so only
+// one in every blockSize calls touches the shared counter. Values left in a block when the
+// process stops are skipped, never reissued, because the lease already advanced the shared counter.
+type BlockCounter struct {
+	shared    blockAllocatingCounter
+	blockSize int64
+
+	mu   sync.Mutex
+	next int64
+	end  int64
+}
+
+// NewBlockCounter creates a new instance of BlockCounter leasing blockSize values at a time
+func NewBlockCounter(shared blockAllocatingCounter, blockSize int64) *BlockCounter {
+	return &BlockCounter{
+		shared:    shared,
+		blockSize: blockSize,
+	}
+}
+
+// GetNextCounter returns the next value of the current block, leasing a new block when it runs out
+func (c *BlockCounter) GetNextCounter() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.next == 0 || c.next > c.end {
+		start, end, err := c.shared.AllocateBlock(c.blockSize)
+		if err != nil {
+			return 0, fmt.Errorf("failed to lease counter block: %w", err)
+		}
+		c.next, c.end = start, end
+		counterMetrics.Add("blocks_leased", 1)
+	}
+
+	counter := c.next
+	c.next++
+	return counter, nil
+}
+
+// AllocateBlock leases a dedicated block of size values from the shared counter, leaving the
+// current block to GetNextCounter
+func (c *BlockCounter) AllocateBlock(size int64) (int64, int64, error) {
+	start, end, err := c.shared.AllocateBlock(size)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to lease counter block: %w", err)
+	}
+	counterMetrics.Add("blocks_leased", 1)
+	return start, end, nil
+}
+
+// GetCurrentCounter returns the shared high-water mark, which covers every leased block
+func (c *BlockCounter) GetCurrentCounter() (int64, error) {
+	return c.shared.GetCurrentCounter()
+}
+
+// InitializeCounter initializes the shared counter
+func (c *BlockCounter) InitializeCounter() error {
+	return c.shared.InitializeCounter()
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"url-shortener-api/models"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Bucket names used for click events in the embedded bbolt store
+var (
+	boltClickEventsBucket    = []byte("click_events")
+	boltClickTotalsBucket    = []byte("click_totals")
+	boltClickBotTotalsBucket = []byte("click_bot_totals")
+)
+
+// BoltClickStorage implements models.ClickEventRepository on top of the embedded bbolt file.
+// Events are keyed by short code and time, and running totals per code, one for people and one for
+// bots, are kept alongside them.
+type BoltClickStorage struct {
+	db *bbolt.DB
+}
+
+// NewBoltClickStorage creates a new instance of BoltClickStorage
+func NewBoltClickStorage(db *bbolt.DB) *BoltClickStorage {
+	return &BoltClickStorage{
+		db: db,
+	}
+}
+
+// StoreClickEvents stores a batch of events and updates the totals in one transaction
+func (s *BoltClickStorage) StoreClickEvents(events []models.ClickEvent) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltClickEventsBucket)
+
+		added := make(map[string]uint64)
+		addedBots := make(map[string]uint64)
+		for _, event := range events {
+			data, err := bson.Marshal(event)
+			if err != nil {
+				return err
+			}
+			sequence, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(boltClickEventKey(event, sequence), data); err != nil {
+				return err
+			}
+			if event.Bot {
+				addedBots[event.ShortCode]++
+			} else {
+				added[event.ShortCode]++
+			}
+		}
+
+		if err := addBoltClickTotals(tx.Bucket(boltClickTotalsBucket), added); err != nil {
+			return err
+		}
+		return addBoltClickTotals(tx.Bucket(boltClickBotTotalsBucket), addedBots)
+	})
+}
+
+// addBoltClickTotals adds counts per short code to the totals in bucket
+func addBoltClickTotals(bucket *bbolt.Bucket, added map[string]uint64) error {
+	for shortCode, count := range added {
+		total := count
+		if existing := bucket.Get([]byte(shortCode)); existing != nil {
+			total += binary.BigEndian.Uint64(existing)
+		}
+		if err := bucket.Put([]byte(shortCode), binary.BigEndian.AppendUint64(nil, total)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountClicks returns the number of recorded clicks of each short code, without bots unless includeBots
+// is set; codes without clicks are omitted
+func (s *BoltClickStorage) CountClicks(shortCodes []string, includeBots bool) (map[string]int64, error) {
+	counts := make(map[string]int64)
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		buckets := []*bbolt.Bucket{tx.Bucket(boltClickTotalsBucket)}
+		if includeBots {
+			buckets = append(buckets, tx.Bucket(boltClickBotTotalsBucket))
+		}
+
+		for _, totals := range buckets {
+			for _, shortCode := range shortCodes {
+				if total := totals.Get([]byte(shortCode)); total != nil {
+					counts[shortCode] += int64(binary.BigEndian.Uint64(total))
+				}
+			}
+		}
+		return nil
+	})
+
+	return counts, err
+}
+
+// ClickStats summarizes the clicks of one short code in the query's range, reading only the keys
+// between its start and end
+func (s *BoltClickStorage) ClickStats(query models.ClickStatsQuery) (*models.ClickStats, error) {
+	builder := newClickStatsBuilder(query)
+	from := boltClickEventKey(models.ClickEvent{ShortCode: query.ShortCode, Timestamp: query.From}, 0)
+	to := boltClickEventKey(models.ClickEvent{ShortCode: query.ShortCode, Timestamp: query.To}, 0)
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(boltClickEventsBucket).Cursor()
+		for key, data := cursor.Seek(from); key != nil && bytes.Compare(key, to) < 0; key, data = cursor.Next() {
+			var event models.ClickEvent
+			if err := bson.Unmarshal(data, &event); err != nil {
+				return err
+			}
+			builder.add(event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return builder.build(), nil
+}
+
+// boltClickEventKey returns the key of an event: the short code, a zero byte, the big-endian time and
+// a sequence number, so a code's events form one range in time order. Short codes never contain a zero byte.
+func boltClickEventKey(event models.ClickEvent, sequence uint64) []byte {
+	key := append([]byte(event.ShortCode), 0)
+	key = binary.BigEndian.AppendUint64(key, uint64(event.Timestamp.UnixNano()))
+	return binary.BigEndian.AppendUint64(key, sequence)
+}
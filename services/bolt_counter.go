@@ -0,0 +1,95 @@
+package services
+
+import (
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// boltCounterBucket holds the short code counter; its bucket sequence is the counter value
+var boltCounterBucket = []byte("short_code_counters")
+
+// BoltCounter implements models.CounterService on top of the embedded bbolt file.
+// Every increment is committed to disk before it is returned, so a restart can never
+// hand out a value twice.
+type BoltCounter struct {
+	db *bbolt.DB
+}
+
+// NewBoltCounter creates a new instance of BoltCounter
+func NewBoltCounter(db *bbolt.DB) *BoltCounter {
+	return &BoltCounter{
+		db: db,
+	}
+}
+
+// GetNextCounter increments and returns the next counter value
+func (c *BoltCounter) GetNextCounter() (int64, error) {
+	var counter uint64
+
+	err := c.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		counter, err = tx.Bucket(boltCounterBucket).NextSequence()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment counter in bbolt: %w", err)
+	}
+
+	return int64(counter), nil
+}
+
+// GetCurrentCounter returns the current counter value
+func (c *BoltCounter) GetCurrentCounter() (int64, error) {
+	var counter uint64
+
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		counter = tx.Bucket(boltCounterBucket).Sequence()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get counter from bbolt: %w", err)
+	}
+
+	return int64(counter), nil
+}
+
+// InitializeCounter ensures the counter bucket exists
+func (c *BoltCounter) InitializeCounter() error {
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltCounterBucket)
+		return err
+	})
+}
+
+// AllocateBlock advances the counter by size in one committed transaction and returns the leased range
+func (c *BoltCounter) AllocateBlock(size int64) (int64, int64, error) {
+	var end uint64
+
+	err := c.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltCounterBucket)
+		end = bucket.Sequence() + uint64(size)
+		return bucket.SetSequence(end)
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to lease counter block in bbolt: %w", err)
+	}
+
+	return int64(end) - size + 1, int64(end), nil
+}
+
+// SeedCounter raises the counter to at least minimum in one committed transaction
+func (c *BoltCounter) SeedCounter(minimum int64) error {
+	err := c.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltCounterBucket)
+		if bucket.Sequence() >= uint64(minimum) {
+			return nil
+		}
+		return bucket.SetSequence(uint64(minimum))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to seed counter in bbolt: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"url-shortener-api/models"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Bucket names used for import jobs in the embedded bbolt store
+var (
+	boltImportJobsBucket = []byte("import_jobs")
+	boltImportRowsBucket = []byte("import_rows")
+)
+
+// BoltImportStorage implements models.ImportJobRepository on top of the embedded bbolt file.
+// Rows are keyed by job ID and Row, so a job's remaining rows are one cursor range.
+type BoltImportStorage struct {
+	db *bbolt.DB
+}
+
+// NewBoltImportStorage creates a new instance of BoltImportStorage
+func NewBoltImportStorage(db *bbolt.DB) *BoltImportStorage {
+	return &BoltImportStorage{
+		db: db,
+	}
+}
+
+// CreateImportJob stores a new job together with its rows in one transaction
+func (s *BoltImportStorage) CreateImportJob(job models.ImportJob, rows []models.ImportRow) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if err := putBoltImportJob(tx, job); err != nil {
+			return err
+		}
+
+		bucket := tx.Bucket(boltImportRowsBucket)
+		for _, row := range rows {
+			data, err := bson.Marshal(row)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(boltImportRowKey(job.ID, row.Row), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetImportJob retrieves a job by ID
+func (s *BoltImportStorage) GetImportJob(id string) (models.ImportJob, bool, error) {
+	var job models.ImportJob
+	var exists bool
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		job, exists, err = getBoltImportJob(tx, id)
+		return err
+	})
+
+	return job, exists, err
+}
+
+// ListUnfinishedImportJobs returns every job that still has rows to process, oldest first
+func (s *BoltImportStorage) ListUnfinishedImportJobs() ([]models.ImportJob, error) {
+	var jobs []models.ImportJob
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltImportJobsBucket).ForEach(func(key, data []byte) error {
+			var job models.ImportJob
+			if err := bson.Unmarshal(data, &job); err != nil {
+				return err
+			}
+			if !job.IsFinished() {
+				jobs = append(jobs, job)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// ClaimImportJob hands an unfinished job to owner until the given time, unless another owner's lease is still running
+func (s *BoltImportStorage) ClaimImportJob(id string, owner string, until time.Time) (models.ImportJob, bool, error) {
+	var job models.ImportJob
+	var claimed bool
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var exists bool
+		var err error
+		job, exists, err = getBoltImportJob(tx, id)
+		if err != nil || !exists || job.IsFinished() || (job.LeaseOwner != owner && job.LeaseUntil.After(time.Now())) {
+			return err
+		}
+
+		job.LeaseOwner = owner
+		job.LeaseUntil = until
+		job.Status = models.ImportStatusRunning
+		claimed = true
+		return putBoltImportJob(tx, job)
+	})
+	if err != nil || !claimed {
+		return models.ImportJob{}, false, err
+	}
+
+	return job, true, nil
+}
+
+// SaveImportJob saves the progress of a job and appends newErrors to its errors, but only while
+// job.LeaseOwner still holds its lease
+func (s *BoltImportStorage) SaveImportJob(job models.ImportJob, newErrors []models.ImportRowError) (bool, error) {
+	var saved bool
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		existing, exists, err := getBoltImportJob(tx, job.ID)
+		if err != nil || !exists || existing.LeaseOwner != job.LeaseOwner {
+			return err
+		}
+
+		saved = true
+		job.Errors = appendImportErrors(existing.Errors, newErrors)
+		return putBoltImportJob(tx, job)
+	})
+
+	return saved, err
+}
+
+// GetImportRows returns up to limit rows of a job that come after the given Row
+func (s *BoltImportStorage) GetImportRows(jobID string, after int, limit int) ([]models.ImportRow, error) {
+	var rows []models.ImportRow
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		prefix := []byte(jobID)
+		cursor := tx.Bucket(boltImportRowsBucket).Cursor()
+		for key, data := cursor.Seek(boltImportRowKey(jobID, after+1)); key != nil && bytes.HasPrefix(key, prefix) && len(rows) < limit; key, data = cursor.Next() {
+			var row models.ImportRow
+			if err := bson.Unmarshal(data, &row); err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+		return nil
+	})
+
+	return rows, err
+}
+
+// SetImportRowShortCode records the short code created for a row
+func (s *BoltImportStorage) SetImportRowShortCode(jobID string, row int, shortCode string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltImportRowsBucket)
+		key := boltImportRowKey(jobID, row)
+		data := bucket.Get(key)
+		if data == nil {
+			return nil
+		}
+
+		var stored models.ImportRow
+		if err := bson.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		stored.ShortCode = shortCode
+
+		data, err := bson.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, data)
+	})
+}
+
+// DeleteImportRows removes the rows of a job once they are no longer needed
+func (s *BoltImportStorage) DeleteImportRows(jobID string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		prefix := []byte(jobID)
+		cursor := tx.Bucket(boltImportRowsBucket).Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Seek(prefix) {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// getBoltImportJob decodes the job stored under an ID
+func getBoltImportJob(tx *bbolt.Tx, id string) (models.ImportJob, bool, error) {
+	var job models.ImportJob
+
+	data := tx.Bucket(boltImportJobsBucket).Get([]byte(id))
+	if data == nil {
+		return job, false, nil
+	}
+	if err := bson.Unmarshal(data, &job); err != nil {
+		return job, false, err
+	}
+	return job, true, nil
+}
+
+// putBoltImportJob encodes and writes a job
+func putBoltImportJob(tx *bbolt.Tx, job models.ImportJob) error {
+	data, err := bson.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltImportJobsBucket).Put([]byte(job.ID), data)
+}
+
+// boltImportRowKey returns the key of a row: the job ID followed by the big-endian Row,
+// so rows sort in file order. Job IDs have a fixed length, so no job's keys prefix another's.
+func boltImportRowKey(jobID string, row int) []byte {
+	return binary.BigEndian.AppendUint64([]byte(jobID), uint64(row))
+}
@@ -0,0 +1,597 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"time"
+
+	"url-shortener-api/models"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Bucket names used by the embedded bbolt store
+var (
+	boltMappingsBucket    = []byte("url_mappings")
+	boltAliasesBucket     = []byte("url_aliases")
+	boltUserIndexBucket   = []byte("url_user_index")
+	boltUserCreatedBucket = []byte("url_user_created_index")
+	boltExpirationsBucket = []byte("url_expirations")
+	boltDeletionsBucket   = []byte("url_deletions")
+)
+
+// errBoltBatchConflict rolls back the transaction of an atomic batch in which a mapping conflicted
+var errBoltBatchConflict = errors.New("batch conflict")
+
+// OpenBoltDB opens (creating if needed) the bbolt database file and its buckets
+func OpenBoltDB(path string, timeout time.Duration) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{
+			boltMappingsBucket,
+			boltAliasesBucket,
+			boltUserIndexBucket,
+			boltExpirationsBucket,
+			boltDeletionsBucket,
+			boltCounterBucket,
+			boltImportJobsBucket,
+			boltImportRowsBucket,
+			boltClickEventsBucket,
+			boltClickTotalsBucket,
+			boltClickBotTotalsBucket,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		// Files written before the creation-time index existed are indexed once
+		if tx.Bucket(boltUserCreatedBucket) != nil {
+			return nil
+		}
+		index, err := tx.CreateBucket(boltUserCreatedBucket)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(boltMappingsBucket).ForEach(func(key, data []byte) error {
+			var mapping models.URLMapping
+			if err := bson.Unmarshal(data, &mapping); err != nil {
+				return err
+			}
+			return index.Put(boltUserCreatedKey(mapping), key)
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// BoltURLStorage handles URL mapping storage operations with an embedded bbolt file.
+// Secondary buckets index mappings by alias, user and expiration so every lookup
+// the MongoDB backend serves from an index is a key or prefix lookup here.
+type BoltURLStorage struct {
+	db *bbolt.DB
+}
+
+// NewBoltURLStorage creates a new instance of BoltURLStorage
+func NewBoltURLStorage(db *bbolt.DB) *BoltURLStorage {
+	return &BoltURLStorage{
+		db: db,
+	}
+}
+
+// Store inserts a new URL mapping into the bbolt file, failing with ErrAliasAlreadyExists if the
+// short code or alias is taken. The check and the write share one transaction.
+func (s *BoltURLStorage) Store(shortCode string, mapping models.URLMapping) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(boltMappingsBucket).Get([]byte(shortCode)) != nil {
+			return models.ErrAliasAlreadyExists
+		}
+		if err := checkBoltAlias(tx, mapping.Alias, shortCode); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		mapping.ID = primitive.NewObjectID()
+		mapping.CreatedAt = now
+		mapping.UpdatedAt = now
+		mapping.ShortURL = shortCode
+
+		return putBoltMapping(tx, mapping)
+	})
+}
+
+// StoreMany inserts mappings under their ShortURL in one transaction, failing each one whose short
+// code or alias is taken with ErrAliasAlreadyExists. When atomic, a single conflict rolls back the batch.
+func (s *BoltURLStorage) StoreMany(mappings []models.URLMapping, atomic bool) ([]error, error) {
+	errs := make([]error, len(mappings))
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		conflicts := false
+		for i, mapping := range mappings {
+			// Mappings put earlier in the transaction are visible, so duplicates within the batch conflict too
+			if tx.Bucket(boltMappingsBucket).Get([]byte(mapping.ShortURL)) != nil {
+				errs[i] = models.ErrAliasAlreadyExists
+			} else {
+				errs[i] = checkBoltAlias(tx, mapping.Alias, mapping.ShortURL)
+			}
+			if errs[i] != nil {
+				conflicts = true
+				continue
+			}
+
+			mapping.ID = primitive.NewObjectID()
+			mapping.CreatedAt = now
+			mapping.UpdatedAt = now
+			if err := putBoltMapping(tx, mapping); err != nil {
+				return err
+			}
+		}
+
+		if atomic && conflicts {
+			return errBoltBatchConflict
+		}
+		return nil
+	})
+	if err == errBoltBatchConflict {
+		return errs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+// Get retrieves a URL mapping by short code from the bbolt file
+func (s *BoltURLStorage) Get(shortCode string) (models.URLMapping, bool, error) {
+	var mapping models.URLMapping
+	var exists bool
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		mapping, exists, err = getBoltMapping(tx, shortCode)
+		return err
+	})
+
+	return mapping, exists, err
+}
+
+// Exists checks if a short code already exists in the bbolt file
+func (s *BoltURLStorage) Exists(shortCode string) (bool, error) {
+	var exists bool
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		exists = tx.Bucket(boltMappingsBucket).Get([]byte(shortCode)) != nil
+		return nil
+	})
+
+	return exists, err
+}
+
+// Delete removes a URL mapping from the bbolt file
+func (s *BoltURLStorage) Delete(shortCode string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return deleteBoltMapping(tx, shortCode)
+	})
+}
+
+// IsExpired checks if a URL mapping has expired
+func (s *BoltURLStorage) IsExpired(mapping models.URLMapping) bool {
+	return mapping.IsExpired()
+}
+
+// GetByAlias retrieves a URL mapping by alias from the bbolt file
+func (s *BoltURLStorage) GetByAlias(alias string) (models.URLMapping, bool, error) {
+	var mapping models.URLMapping
+	var exists bool
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		shortCode := tx.Bucket(boltAliasesBucket).Get([]byte(alias))
+		if shortCode == nil {
+			return nil
+		}
+
+		var err error
+		mapping, exists, err = getBoltMapping(tx, string(shortCode))
+		return err
+	})
+
+	return mapping, exists, err
+}
+
+// GetByUserID retrieves all URL mappings for a specific user, oldest first
+func (s *BoltURLStorage) GetByUserID(userID string) ([]models.URLMapping, error) {
+	var mappings []models.URLMapping
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		prefix := boltUserIndexPrefix(userID)
+		cursor := tx.Bucket(boltUserIndexBucket).Cursor()
+
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			mapping, exists, err := getBoltMapping(tx, string(key[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if exists {
+				mappings = append(mappings, mapping)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].CreatedAt.Before(mappings[j].CreatedAt)
+	})
+
+	return mappings, nil
+}
+
+// ListByUserID returns up to query.Limit of the user's mappings that match the query, in its order.
+// The creation-time index is walked from the cursor, so earlier pages are never read.
+func (s *BoltURLStorage) ListByUserID(query models.URLListQuery) ([]models.URLMapping, error) {
+	domain := compileDomainFilter(query)
+	mappings := make([]models.URLMapping, 0, query.Limit)
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		prefix := boltUserIndexPrefix(query.UserID)
+		cursor := tx.Bucket(boltUserCreatedBucket).Cursor()
+
+		var key, shortCode []byte
+		if query.After != nil {
+			// The cursor's own key is never part of the page
+			bound := boltUserCreatedKey(models.URLMapping{UserID: query.UserID, CreatedAt: query.After.CreatedAt, ID: query.After.ID})
+			key, shortCode = cursor.Seek(bound)
+			if query.Ascending && bytes.Equal(key, bound) {
+				key, shortCode = cursor.Next()
+			}
+			if !query.Ascending {
+				key, shortCode = seekBoltBefore(cursor, key)
+			}
+		} else if query.Ascending {
+			key, shortCode = cursor.Seek(prefix)
+		} else {
+			// Every key of the user sorts below the prefix with its last byte incremented
+			end, _ := cursor.Seek(append([]byte(query.UserID), 1))
+			key, shortCode = seekBoltBefore(cursor, end)
+		}
+
+		for ; key != nil && bytes.HasPrefix(key, prefix) && len(mappings) < query.Limit; key, shortCode = stepBolt(cursor, query.Ascending) {
+			mapping, exists, err := getBoltMapping(tx, string(shortCode))
+			if err != nil {
+				return err
+			}
+			if exists && matchesListQuery(mapping, query, domain) {
+				mappings = append(mappings, mapping)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mappings, nil
+}
+
+// Update updates an existing URL mapping, doing nothing if it does not exist
+func (s *BoltURLStorage) Update(shortCode string, mapping models.URLMapping) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		existing, exists, err := getBoltMapping(tx, shortCode)
+		if err != nil || !exists {
+			return err
+		}
+
+		if err := checkBoltAlias(tx, mapping.Alias, shortCode); err != nil {
+			return err
+		}
+
+		mapping.ID = existing.ID
+		mapping.UpdatedAt = time.Now()
+		mapping.ShortURL = shortCode
+
+		unindexBoltMapping(tx, existing)
+		return putBoltMapping(tx, mapping)
+	})
+}
+
+// ReplaceIfUnchanged replaces the mapping stored under shortCode, moving it to mapping.ShortURL and leaving
+// a renamedRedirect under the old code when that differs, only if it was last updated at lastUpdatedAt.
+// It reports false if the mapping is gone or changed.
+func (s *BoltURLStorage) ReplaceIfUnchanged(shortCode string, lastUpdatedAt time.Time, mapping models.URLMapping) (bool, error) {
+	var replaced bool
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		existing, exists, err := getBoltMapping(tx, shortCode)
+		if err != nil || !exists || !existing.UpdatedAt.Equal(lastUpdatedAt) {
+			return err
+		}
+
+		if mapping.ShortURL == "" {
+			mapping.ShortURL = shortCode
+		}
+		if mapping.ShortURL != shortCode && tx.Bucket(boltMappingsBucket).Get([]byte(mapping.ShortURL)) != nil {
+			return models.ErrAliasAlreadyExists
+		}
+		if err := checkBoltAlias(tx, mapping.Alias, shortCode); err != nil {
+			return err
+		}
+
+		mapping.ID = existing.ID
+		mapping.CreatedAt = existing.CreatedAt
+
+		if err := deleteBoltMapping(tx, shortCode); err != nil {
+			return err
+		}
+		if err := putBoltMapping(tx, mapping); err != nil {
+			return err
+		}
+		if mapping.ShortURL != shortCode {
+			if err := putBoltMapping(tx, renamedRedirect(existing, mapping)); err != nil {
+				return err
+			}
+		}
+		replaced = true
+		return nil
+	})
+
+	return replaced, err
+}
+
+// DeleteExpired removes every mapping whose expiration timestamp is before the given time,
+// walking the expiration bucket in timestamp order
+func (s *BoltURLStorage) DeleteExpired(before time.Time) (int64, error) {
+	var deleted int64
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var expired []string
+		cursor := tx.Bucket(boltExpirationsBucket).Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+			if int64(binary.BigEndian.Uint64(key[:8])) >= before.UnixMilli() {
+				break
+			}
+			expired = append(expired, string(key[8:]))
+		}
+
+		for _, shortCode := range expired {
+			if err := deleteBoltMapping(tx, shortCode); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+
+	return deleted, err
+}
+
+// PurgeDeleted removes every mapping deleted before the given time,
+// walking the deletion bucket in timestamp order
+func (s *BoltURLStorage) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var deleted []string
+		cursor := tx.Bucket(boltDeletionsBucket).Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+			if int64(binary.BigEndian.Uint64(key[:8])) >= before.UnixMilli() {
+				break
+			}
+			deleted = append(deleted, string(key[8:]))
+		}
+
+		for _, shortCode := range deleted {
+			if err := deleteBoltMapping(tx, shortCode); err != nil {
+				return err
+			}
+			purged++
+		}
+		return nil
+	})
+
+	return purged, err
+}
+
+// ScanByUserID calls fn for every mapping of the user that is not deleted, oldest first, until fn
+// returns false
+func (s *BoltURLStorage) ScanByUserID(userID string, fn func(mapping models.URLMapping) (bool, error)) error {
+	return scanByUserIDInPages(s.ListByUserID, userID, fn)
+}
+
+// BackfillCounters sets the counter value of counter codes stored without one
+func (s *BoltURLStorage) BackfillCounters(counterOf func(mapping models.URLMapping) int64) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltMappingsBucket)
+
+		// A bucket must not be written while ForEach walks it
+		var backfilled []models.URLMapping
+		err := bucket.ForEach(func(key, data []byte) error {
+			var mapping models.URLMapping
+			if err := bson.Unmarshal(data, &mapping); err != nil {
+				return err
+			}
+			if mapping.Counter == 0 && mapping.IsCounterGenerated() {
+				if mapping.Counter = counterOf(mapping); mapping.Counter != 0 {
+					backfilled = append(backfilled, mapping)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, mapping := range backfilled {
+			data, err := bson.Marshal(mapping)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(mapping.ShortURL), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// HighestCounter returns the largest counter value stored, or 0 when there is none
+func (s *BoltURLStorage) HighestCounter() (int64, error) {
+	var highest int64
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltMappingsBucket).ForEach(func(key, data []byte) error {
+			var mapping models.URLMapping
+			if err := bson.Unmarshal(data, &mapping); err != nil {
+				return err
+			}
+			highest = max(highest, mapping.Counter)
+			return nil
+		})
+	})
+
+	return highest, err
+}
+
+// checkBoltAlias mirrors the unique sparse index on alias
+func checkBoltAlias(tx *bbolt.Tx, alias string, shortCode string) error {
+	if alias == "" {
+		return nil
+	}
+	owner := tx.Bucket(boltAliasesBucket).Get([]byte(alias))
+	if owner != nil && string(owner) != shortCode {
+		return models.ErrAliasAlreadyExists
+	}
+	return nil
+}
+
+// getBoltMapping decodes the mapping stored under a short code
+func getBoltMapping(tx *bbolt.Tx, shortCode string) (models.URLMapping, bool, error) {
+	var mapping models.URLMapping
+
+	data := tx.Bucket(boltMappingsBucket).Get([]byte(shortCode))
+	if data == nil {
+		return mapping, false, nil
+	}
+
+	if err := bson.Unmarshal(data, &mapping); err != nil {
+		return mapping, false, err
+	}
+	return mapping, true, nil
+}
+
+// putBoltMapping encodes a mapping and writes it together with its index entries
+func putBoltMapping(tx *bbolt.Tx, mapping models.URLMapping) error {
+	data, err := bson.Marshal(mapping)
+	if err != nil {
+		return err
+	}
+
+	shortCode := []byte(mapping.ShortURL)
+	if err := tx.Bucket(boltMappingsBucket).Put(shortCode, data); err != nil {
+		return err
+	}
+	if mapping.Alias != "" {
+		if err := tx.Bucket(boltAliasesBucket).Put([]byte(mapping.Alias), shortCode); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(boltUserIndexBucket).Put(boltUserIndexKey(mapping.UserID, mapping.ShortURL), []byte{}); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltUserCreatedBucket).Put(boltUserCreatedKey(mapping), shortCode); err != nil {
+		return err
+	}
+	if mapping.ExpirationTimestamp != nil {
+		if err := tx.Bucket(boltExpirationsBucket).Put(boltTimeKey(*mapping.ExpirationTimestamp, mapping.ShortURL), []byte{}); err != nil {
+			return err
+		}
+	}
+	if mapping.DeletedAt != nil {
+		if err := tx.Bucket(boltDeletionsBucket).Put(boltTimeKey(*mapping.DeletedAt, mapping.ShortURL), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteBoltMapping removes a mapping and its index entries
+func deleteBoltMapping(tx *bbolt.Tx, shortCode string) error {
+	existing, exists, err := getBoltMapping(tx, shortCode)
+	if err != nil || !exists {
+		return err
+	}
+
+	unindexBoltMapping(tx, existing)
+	return tx.Bucket(boltMappingsBucket).Delete([]byte(shortCode))
+}
+
+// unindexBoltMapping removes the index entries of a stored mapping
+func unindexBoltMapping(tx *bbolt.Tx, mapping models.URLMapping) {
+	if mapping.Alias != "" {
+		tx.Bucket(boltAliasesBucket).Delete([]byte(mapping.Alias))
+	}
+	tx.Bucket(boltUserIndexBucket).Delete(boltUserIndexKey(mapping.UserID, mapping.ShortURL))
+	tx.Bucket(boltUserCreatedBucket).Delete(boltUserCreatedKey(mapping))
+	if mapping.ExpirationTimestamp != nil {
+		tx.Bucket(boltExpirationsBucket).Delete(boltTimeKey(*mapping.ExpirationTimestamp, mapping.ShortURL))
+	}
+	if mapping.DeletedAt != nil {
+		tx.Bucket(boltDeletionsBucket).Delete(boltTimeKey(*mapping.DeletedAt, mapping.ShortURL))
+	}
+}
+
+// boltUserIndexPrefix returns the key prefix shared by all mappings of a user
+func boltUserIndexPrefix(userID string) []byte {
+	return append([]byte(userID), 0)
+}
+
+// boltUserIndexKey returns the user index key for a mapping
+func boltUserIndexKey(userID string, shortCode string) []byte {
+	return append(boltUserIndexPrefix(userID), shortCode...)
+}
+
+// boltUserCreatedKey returns the key ordering a user's mappings by creation time and then ID,
+// at the millisecond precision BSON keeps
+func boltUserCreatedKey(mapping models.URLMapping) []byte {
+	key := binary.BigEndian.AppendUint64(boltUserIndexPrefix(mapping.UserID), uint64(mapping.CreatedAt.UnixMilli()))
+	return append(key, mapping.ID[:]...)
+}
+
+// seekBoltBefore returns the entry just before key, where a nil key stands past the last entry
+func seekBoltBefore(cursor *bbolt.Cursor, key []byte) ([]byte, []byte) {
+	if key == nil {
+		return cursor.Last()
+	}
+	return cursor.Prev()
+}
+
+// stepBolt moves the cursor one entry in the given direction
+func stepBolt(cursor *bbolt.Cursor, ascending bool) ([]byte, []byte) {
+	if ascending {
+		return cursor.Next()
+	}
+	return cursor.Prev()
+}
+
+// boltTimeKey returns a key that sorts by the given time, such as an expiration, at the millisecond
+// precision BSON keeps so a decoded mapping yields the same key it was indexed with
+func boltTimeKey(timestamp time.Time, shortCode string) []byte {
+	key := make([]byte, 8, 8+len(shortCode))
+	binary.BigEndian.PutUint64(key, uint64(timestamp.UnixMilli()))
+	return append(key, shortCode...)
+}
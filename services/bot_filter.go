@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBotPatterns are the lowercase user agent substrings of the crawlers, link unfurlers, uptime
+// checkers and HTTP libraries that commonly hit short links
+var defaultBotPatterns = []string{
+	// Generic crawler words
+	"bot", "crawler", "spider", "slurp",
+	// Link unfurlers and previews
+	"facebookexternalhit", "slackbot", "slack-imgproxy", "twitterbot", "discordbot", "telegrambot",
+	"whatsapp", "linkedinbot", "embedly", "skypeuripreview", "iframely", "applebot", "bingpreview",
+	// Uptime checkers
+	"uptimerobot", "pingdom", "statuscake", "site24x7", "betteruptime", "datadog", "newrelicpinger", "checkly",
+	// HTTP libraries and headless browsers
+	"curl/", "wget/", "python-requests", "go-http-client", "headlesschrome", "lighthouse", "java/",
+	"axios/", "node-fetch", "libwww-perl", "scrapy",
+	// Search engines and SEO tools whose agents do not say bot
+	"ahrefs", "semrush", "yandex", "baiduspider", "duckduckbot", "petalbot", "bytespider", "gptbot", "ccbot",
+}
+
+// BotFilter implements models.BotClassifier by matching user agents against substring patterns. The
+// built-in list is used unless a patterns file is configured; that file is checked every reload
+// interval and loaded again when its modification time or size changes, so the list can be updated
+// without a restart.
+type BotFilter struct {
+	path           string
+	reloadInterval time.Duration
+	mu             sync.RWMutex
+	patterns       []string
+	modTime        time.Time
+	size           int64
+	ctx            context.Context
+	cancel         context.CancelFunc
+}
+
+// NewBotFilter creates a new instance of BotFilter with the built-in patterns, replaced by the patterns
+// file at path once it is loaded when path is not empty
+func NewBotFilter(path string, reloadInterval time.Duration) *BotFilter {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BotFilter{
+		path:           path,
+		reloadInterval: reloadInterval,
+		patterns:       defaultBotPatterns,
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// Start loads the patterns file, if any, and begins watching it for changes. Until a file can be
+// loaded the built-in patterns stay in use.
+func (bf *BotFilter) Start() {
+	if bf.path != "" {
+		if _, err := bf.Reload(); err != nil {
+			log.Printf("Warning: Failed to load bot patterns %s: %v", bf.path, err)
+		}
+		if bf.reloadInterval > 0 {
+			go bf.reloadLoop()
+		}
+	}
+	log.Println("Bot filter started")
+}
+
+// Stop stops watching the patterns file
+func (bf *BotFilter) Stop() {
+	bf.cancel()
+	log.Println("Bot filter stopped")
+}
+
+// Reload loads the patterns file if it changed since the last load and reports whether it did. The
+// file has one pattern per line; blank lines and lines starting with # are ignored, and matching is
+// case-insensitive.
+func (bf *BotFilter) Reload() (bool, error) {
+	info, err := os.Stat(bf.path)
+	if err != nil {
+		return false, err
+	}
+
+	bf.mu.RLock()
+	unchanged := !bf.modTime.IsZero() && info.ModTime().Equal(bf.modTime) && info.Size() == bf.size
+	bf.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(bf.path)
+	if err != nil {
+		return false, err
+	}
+	patterns := parseBotPatterns(data)
+
+	bf.mu.Lock()
+	bf.patterns = patterns
+	bf.modTime = info.ModTime()
+	bf.size = info.Size()
+	bf.mu.Unlock()
+
+	log.Printf("Loaded %d bot patterns from %s", len(patterns), bf.path)
+	return true, nil
+}
+
+// IsBot reports whether a user agent matches any pattern. Requests without a user agent are treated
+// as bots, since browsers always send one.
+func (bf *BotFilter) IsBot(userAgent string) bool {
+	if strings.TrimSpace(userAgent) == "" {
+		return true
+	}
+
+	bf.mu.RLock()
+	patterns := bf.patterns
+	bf.mu.RUnlock()
+
+	userAgent = strings.ToLower(userAgent)
+	for _, pattern := range patterns {
+		if strings.Contains(userAgent, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBotPatterns reads the lowercase patterns of a patterns file
+func parseBotPatterns(data []byte) []string {
+	patterns := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, strings.ToLower(line))
+	}
+	return patterns
+}
+
+// reloadLoop checks the patterns file for changes in a loop
+func (bf *BotFilter) reloadLoop() {
+	ticker := time.NewTicker(bf.reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bf.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := bf.Reload(); err != nil {
+				log.Printf("Bot patterns reload error: %v", err)
+			}
+		}
+	}
+}
@@ -2,9 +2,10 @@ package services
 
 import (
 	"context"
-	"fmt"
 	"time"
 
+	"url-shortener-api/models"
+
 	"github.com/redis/go-redis/v9"
 )
 
@@ -38,11 +39,32 @@ func (c *CacheService) Set(ctx context.Context, key string, value string, ttl ti
 func (c *CacheService) Get(ctx context.Context, key string) (string, error) {
 	result := c.client.Get(ctx, key)
 	if result.Err() == redis.Nil {
-		return "", fmt.Errorf("key not found")
+		return "", models.ErrCacheMiss
 	}
 	return result.Val(), result.Err()
 }
 
+// GetWithTTL retrieves a value and its remaining TTL from Redis in a single round trip.
+// A TTL of zero means the key does not expire.
+func (c *CacheService) GetWithTTL(ctx context.Context, key string) (string, time.Duration, error) {
+	pipe := c.client.Pipeline()
+	get := pipe.Get(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return "", 0, err
+	}
+
+	if get.Err() == redis.Nil {
+		return "", 0, models.ErrCacheMiss
+	}
+
+	ttl := pttl.Val()
+	if ttl < 0 {
+		ttl = 0
+	}
+	return get.Val(), ttl, nil
+}
+
 // Delete removes a key from Redis
 func (c *CacheService) Delete(ctx context.Context, key string) error {
 	return c.client.Del(ctx, key).Err()
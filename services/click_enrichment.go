@@ -0,0 +1,126 @@
+package services
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"url-shortener-api/models"
+)
+
+// Device classes derived from a user agent
+const (
+	deviceDesktop = "desktop"
+	deviceMobile  = "mobile"
+	deviceTablet  = "tablet"
+)
+
+// userAgentRule names the browser or OS of user agents containing any of its tokens
+type userAgentRule struct {
+	name   string
+	tokens []string
+}
+
+// Browsers and operating systems are matched in order, so rules for user agents that imitate
+// others come first: Edge and Opera claim to be Chrome, and Chrome claims to be Safari.
+var (
+	browserRules = []userAgentRule{
+		{"Edge", []string{"Edg/", "EdgA/", "EdgiOS/", "Edge/"}},
+		{"Opera", []string{"OPR/", "Opera"}},
+		{"Samsung Internet", []string{"SamsungBrowser/"}},
+		{"Firefox", []string{"Firefox/", "FxiOS/"}},
+		{"Chrome", []string{"Chrome/", "CriOS/", "Chromium/"}},
+		{"Safari", []string{"Safari/"}},
+		{"Internet Explorer", []string{"MSIE ", "Trident/"}},
+	}
+	osRules = []userAgentRule{
+		{"Windows", []string{"Windows"}},
+		{"iOS", []string{"iPhone", "iPad", "iPod"}},
+		{"Android", []string{"Android"}},
+		{"ChromeOS", []string{"CrOS"}},
+		{"macOS", []string{"Macintosh", "Mac OS X"}},
+		{"Linux", []string{"Linux"}},
+	}
+)
+
+// enrichClickEvent fills in the fields derived from an event's headers and, when a locator is
+// given, its location. The IP is truncated last, once nothing needs the full address.
+func enrichClickEvent(event models.ClickEvent, locator models.GeoLocator) models.ClickEvent {
+	event.ReferrerHost = referrerHost(event.Referrer)
+	event.Browser, event.OS, event.Device = parseUserAgent(event.UserAgent)
+	event.Language = primaryLanguage(event.AcceptLanguage)
+	if locator != nil {
+		location := locator.Locate(event.IP)
+		event.Country, event.Region, event.City = location.Country, location.Region, location.City
+	}
+	event.IP = truncateIP(event.IP)
+	return event
+}
+
+// truncateIP zeroes the host part of an address, keeping the /24 of IPv4 and the /48 of IPv6,
+// so stored events never identify a single client
+func truncateIP(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// parseUserAgent returns the browser, OS and device class of a user agent; names it does not
+// recognize are "Other", and an empty user agent yields empty values
+func parseUserAgent(userAgent string) (browser string, os string, device string) {
+	if userAgent == "" {
+		return "", "", ""
+	}
+
+	browser = matchUserAgent(userAgent, browserRules)
+	os = matchUserAgent(userAgent, osRules)
+
+	switch {
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet") ||
+		(os == "Android" && !strings.Contains(userAgent, "Mobile")):
+		device = deviceTablet
+	case strings.Contains(userAgent, "Mobi") || strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "iPod"):
+		device = deviceMobile
+	default:
+		device = deviceDesktop
+	}
+
+	return browser, os, device
+}
+
+// matchUserAgent returns the name of the first rule with a token in userAgent
+func matchUserAgent(userAgent string, rules []userAgentRule) string {
+	for _, rule := range rules {
+		for _, token := range rule.tokens {
+			if strings.Contains(userAgent, token) {
+				return rule.name
+			}
+		}
+	}
+	return "Other"
+}
+
+// referrerHost returns the lowercased host of a referrer URL, or an empty string when there is none
+func referrerHost(referrer string) string {
+	parsed, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// primaryLanguage returns the first language tag of an Accept-Language header, lowercased
+func primaryLanguage(acceptLanguage string) string {
+	tag, _, _ := strings.Cut(acceptLanguage, ",")
+	tag, _, _ = strings.Cut(tag, ";")
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "*" {
+		return ""
+	}
+	return tag
+}
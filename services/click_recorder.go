@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+// ClickRecorder implements models.ClickRecorder with a bounded in-process buffer. A background worker
+// drains it, classifies bots, counts unique visitors, derives the breakdown fields and location of each
+// event and stores them in batches, so the redirect path never waits on storage, parsing or lookups.
+// When the buffer is full, events are dropped and counted in the "clicks" metrics.
+type ClickRecorder struct {
+	storage       models.ClickEventRepository
+	locator       models.GeoLocator // nil when no GeoIP database is configured
+	bots          models.BotClassifier
+	visitors      models.VisitorCounter
+	stream        models.ClickStream
+	events        chan models.ClickEvent
+	batchSize     int
+	flushInterval time.Duration
+	ctx           context.Context
+	cancel        context.CancelFunc
+	done          chan struct{} // closed when the worker has exited; nil until Start
+}
+
+// NewClickRecorder creates a new instance of ClickRecorder that buffers up to bufferSize events and
+// stores them batchSize at a time, or every flushInterval when fewer are waiting. Events are located
+// with locator, classified with bots, their visitors counted with visitors and, once stored, published
+// to stream, unless those are nil.
+func NewClickRecorder(storage models.ClickEventRepository, locator models.GeoLocator, bots models.BotClassifier, visitors models.VisitorCounter, stream models.ClickStream, bufferSize int, batchSize int, flushInterval time.Duration) *ClickRecorder {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ClickRecorder{
+		storage:       storage,
+		locator:       locator,
+		bots:          bots,
+		visitors:      visitors,
+		stream:        stream,
+		events:        make(chan models.ClickEvent, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Start begins the background flush process
+func (cr *ClickRecorder) Start() {
+	cr.done = make(chan struct{})
+	go cr.flushLoop()
+	log.Println("Click recorder started")
+}
+
+// Stop stops the background flush process after storing the events still buffered
+func (cr *ClickRecorder) Stop() {
+	cr.cancel()
+	if cr.done != nil {
+		<-cr.done
+	}
+	log.Println("Click recorder stopped")
+}
+
+// Record buffers an event without blocking, dropping it when the buffer is full
+func (cr *ClickRecorder) Record(event models.ClickEvent) {
+	select {
+	case cr.events <- event:
+		clickMetrics.Add("recorded", 1)
+	default:
+		clickMetrics.Add("dropped", 1)
+	}
+}
+
+// flushLoop collects buffered events into batches and stores each one when it is full or the
+// flush interval passes
+func (cr *ClickRecorder) flushLoop() {
+	defer close(cr.done)
+
+	ticker := time.NewTicker(cr.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.ClickEvent, 0, cr.batchSize)
+	for {
+		select {
+		case <-cr.ctx.Done():
+			// Drain what is buffered; Record keeps dropping once the buffer is full again
+			for {
+				select {
+				case event := <-cr.events:
+					batch = append(batch, event)
+					if len(batch) >= cr.batchSize {
+						batch = cr.flush(batch)
+					}
+				default:
+					cr.flush(batch)
+					return
+				}
+			}
+		case event := <-cr.events:
+			batch = append(batch, event)
+			if len(batch) >= cr.batchSize {
+				batch = cr.flush(batch)
+			}
+		case <-ticker.C:
+			batch = cr.flush(batch)
+		}
+	}
+}
+
+// flush classifies the bots of a batch, counts its other visitors, enriches, stores and publishes it,
+// and returns it emptied for reuse. Visitors are counted before enrichment, while the IPs are still
+// whole. Events of a batch that fails to store are counted and discarded rather than retried, so a
+// storage outage cannot back up the buffer; they are not published either.
+func (cr *ClickRecorder) flush(batch []models.ClickEvent) []models.ClickEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	humans := make([]models.ClickEvent, 0, len(batch))
+	for i := range batch {
+		if cr.bots != nil && !batch[i].Bot {
+			batch[i].Bot = cr.bots.IsBot(batch[i].UserAgent)
+		}
+		if batch[i].Bot {
+			clickMetrics.Add("bots", 1)
+		} else {
+			humans = append(humans, batch[i])
+		}
+	}
+
+	if cr.visitors != nil && len(humans) > 0 {
+		if err := cr.visitors.AddVisitors(humans); err != nil {
+			log.Printf("Unique visitor update error: %v", err)
+			clickMetrics.Add("visitors_failed", int64(len(humans)))
+		}
+	}
+	for i := range batch {
+		batch[i] = enrichClickEvent(batch[i], cr.locator)
+	}
+
+	if err := cr.storage.StoreClickEvents(batch); err != nil {
+		log.Printf("Click event flush error: %v", err)
+		clickMetrics.Add("failed", int64(len(batch)))
+	} else {
+		clickMetrics.Add("stored", int64(len(batch)))
+		cr.publish(batch)
+	}
+
+	return batch[:0]
+}
+
+// publish hands a stored batch to the live click stream. A batch that cannot be published is only
+// missing from live views; it is counted and not retried.
+func (cr *ClickRecorder) publish(batch []models.ClickEvent) {
+	if cr.stream == nil {
+		return
+	}
+	if err := cr.stream.PublishClicks(batch); err != nil {
+		log.Printf("Live click publish error: %v", err)
+		clickMetrics.Add("stream_failed", int64(len(batch)))
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+// statsIntervals maps each time series interval to its length. Weeks start on Monday: the zero
+// time.Time is a Monday, so truncating to a multiple of seven days lands on one.
+var statsIntervals = map[string]time.Duration{
+	models.StatsIntervalHour: time.Hour,
+	models.StatsIntervalDay:  24 * time.Hour,
+	models.StatsIntervalWeek: 7 * 24 * time.Hour,
+}
+
+// clickBucketStart returns the start of the interval containing t, in UTC
+func clickBucketStart(t time.Time, interval string) time.Time {
+	return t.UTC().Truncate(statsIntervals[interval])
+}
+
+// clickStatsBuilder summarizes click events one at a time, for backends that cannot aggregate
+// them in the database
+type clickStatsBuilder struct {
+	query            models.ClickStatsQuery
+	total            int64
+	series           map[time.Time]int64
+	referrers        map[string]int64
+	browsers         map[string]int64
+	operatingSystems map[string]int64
+	devices          map[string]int64
+	languages        map[string]int64
+	countries        map[string]int64
+}
+
+// newClickStatsBuilder creates an empty builder for query
+func newClickStatsBuilder(query models.ClickStatsQuery) *clickStatsBuilder {
+	return &clickStatsBuilder{
+		query:            query,
+		series:           make(map[time.Time]int64),
+		referrers:        make(map[string]int64),
+		browsers:         make(map[string]int64),
+		operatingSystems: make(map[string]int64),
+		devices:          make(map[string]int64),
+		languages:        make(map[string]int64),
+		countries:        make(map[string]int64),
+	}
+}
+
+// add counts an event if it falls inside the query's range and is not a bot, unless bots are included
+func (b *clickStatsBuilder) add(event models.ClickEvent) {
+	if event.Timestamp.Before(b.query.From) || !event.Timestamp.Before(b.query.To) {
+		return
+	}
+	if event.Bot && !b.query.IncludeBots {
+		return
+	}
+
+	b.total++
+	b.series[clickBucketStart(event.Timestamp, b.query.Interval)]++
+	b.referrers[event.ReferrerHost]++
+	b.browsers[event.Browser]++
+	b.operatingSystems[event.OS]++
+	b.devices[event.Device]++
+	b.languages[event.Language]++
+	b.countries[event.Country]++
+}
+
+// build returns the summary, with only the intervals that had clicks in the series
+func (b *clickStatsBuilder) build() *models.ClickStats {
+	stats := &models.ClickStats{
+		TotalClicks:      b.total,
+		Series:           make([]models.ClickBucket, 0, len(b.series)),
+		Referrers:        topClickCounts(b.referrers, b.query.Top),
+		Browsers:         topClickCounts(b.browsers, b.query.Top),
+		OperatingSystems: topClickCounts(b.operatingSystems, b.query.Top),
+		Devices:          topClickCounts(b.devices, b.query.Top),
+		Languages:        topClickCounts(b.languages, b.query.Top),
+		Countries:        topClickCounts(b.countries, b.query.Top),
+	}
+
+	for start, clicks := range b.series {
+		stats.Series = append(stats.Series, models.ClickBucket{Start: start, Clicks: clicks})
+	}
+	sort.Slice(stats.Series, func(i, j int) bool {
+		return stats.Series[i].Start.Before(stats.Series[j].Start)
+	})
+
+	return stats
+}
+
+// topClickCounts returns the top values of a breakdown, most clicks first and ties by value
+func topClickCounts(counts map[string]int64, top int) []models.ClickCount {
+	result := make([]models.ClickCount, 0, len(counts))
+	for value, clicks := range counts {
+		result = append(result, models.ClickCount{Value: value, Clicks: clicks})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Clicks != result[j].Clicks {
+			return result[i].Clicks > result[j].Clicks
+		}
+		return result[i].Value < result[j].Value
+	})
+
+	if len(result) > top {
+		result = result[:top]
+	}
+	return result
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"url-shortener-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ClickStorage implements models.ClickEventRepository with the click_events collection
+type ClickStorage struct {
+	collection *mongo.Collection
+}
+
+// NewClickStorage creates a new instance of ClickStorage with MongoDB collection
+func NewClickStorage(collection *mongo.Collection) *ClickStorage {
+	return &ClickStorage{
+		collection: collection,
+	}
+}
+
+// StoreClickEvents inserts a batch of events with one unordered InsertMany
+func (s *ClickStorage) StoreClickEvents(events []models.ClickEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	documents := make([]interface{}, len(events))
+	for i, event := range events {
+		documents[i] = event
+	}
+
+	_, err := s.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+// CountClicks returns the number of recorded clicks of each short code, without bots unless includeBots
+// is set; codes without clicks are omitted
+func (s *ClickStorage) CountClicks(shortCodes []string, includeBots bool) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	if len(shortCodes) == 0 {
+		return counts, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	match := bson.M{"short_code": bson.M{"$in": shortCodes}}
+	if !includeBots {
+		match["bot"] = bson.M{"$ne": true}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": "$short_code", "count": bson.M{"$sum": 1}}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ShortCode string `bson:"_id"`
+			Count     int64  `bson:"count"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		counts[doc.ShortCode] = doc.Count
+	}
+
+	return counts, cursor.Err()
+}
+
+// clickCountDocument is one group of a breakdown facet
+type clickCountDocument struct {
+	Value  string `bson:"_id"`
+	Clicks int64  `bson:"clicks"`
+}
+
+// ClickStats summarizes the clicks of one short code in the query's range with a single
+// aggregation: one $facet each for the total, the time series and every breakdown.
+// $dateTrunc requires MongoDB 5.0 or later.
+func (s *ClickStorage) ClickStats(query models.ClickStatsQuery) (*models.ClickStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dateTrunc := bson.M{"date": "$timestamp", "unit": query.Interval}
+	if query.Interval == models.StatsIntervalWeek {
+		dateTrunc["startOfWeek"] = "monday"
+	}
+
+	// topValues groups by a field, treating a missing field as an empty value
+	topValues := func(field string) bson.A {
+		return bson.A{
+			bson.M{"$group": bson.M{"_id": bson.M{"$ifNull": bson.A{"$" + field, ""}}, "clicks": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "clicks", Value: -1}, {Key: "_id", Value: 1}}},
+			bson.M{"$limit": query.Top},
+		}
+	}
+
+	match := bson.M{
+		"short_code": query.ShortCode,
+		"timestamp":  bson.M{"$gte": query.From, "$lt": query.To},
+	}
+	if !query.IncludeBots {
+		match["bot"] = bson.M{"$ne": true}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$facet", Value: bson.M{
+			"total": bson.A{bson.M{"$count": "clicks"}},
+			"series": bson.A{
+				bson.M{"$group": bson.M{"_id": bson.M{"$dateTrunc": dateTrunc}, "clicks": bson.M{"$sum": 1}}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+			"referrers":         topValues("referrer_host"),
+			"browsers":          topValues("browser"),
+			"operating_systems": topValues("os"),
+			"devices":           topValues("device"),
+			"languages":         topValues("language"),
+			"countries":         topValues("country"),
+		}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Total []struct {
+			Clicks int64 `bson:"clicks"`
+		} `bson:"total"`
+		Series []struct {
+			Start  time.Time `bson:"_id"`
+			Clicks int64     `bson:"clicks"`
+		} `bson:"series"`
+		Referrers        []clickCountDocument `bson:"referrers"`
+		Browsers         []clickCountDocument `bson:"browsers"`
+		OperatingSystems []clickCountDocument `bson:"operating_systems"`
+		Devices          []clickCountDocument `bson:"devices"`
+		Languages        []clickCountDocument `bson:"languages"`
+		Countries        []clickCountDocument `bson:"countries"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := &models.ClickStats{
+		Series:           make([]models.ClickBucket, len(result.Series)),
+		Referrers:        newClickCounts(result.Referrers),
+		Browsers:         newClickCounts(result.Browsers),
+		OperatingSystems: newClickCounts(result.OperatingSystems),
+		Devices:          newClickCounts(result.Devices),
+		Languages:        newClickCounts(result.Languages),
+		Countries:        newClickCounts(result.Countries),
+	}
+	if len(result.Total) > 0 {
+		stats.TotalClicks = result.Total[0].Clicks
+	}
+	for i, bucket := range result.Series {
+		stats.Series[i] = models.ClickBucket{Start: bucket.Start.UTC(), Clicks: bucket.Clicks}
+	}
+
+	return stats, nil
+}
+
+// newClickCounts converts the groups of a breakdown facet
+func newClickCounts(documents []clickCountDocument) []models.ClickCount {
+	counts := make([]models.ClickCount, len(documents))
+	for i, document := range documents {
+		counts[i] = models.ClickCount{Value: document.Value, Clicks: document.Clicks}
+	}
+	return counts
+}
+
+// CreateIndexes creates necessary indexes for the collection
+func (s *ClickStorage) CreateIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Create index serving per-link counts and time ranges
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "short_code", Value: 1}, {Key: "timestamp", Value: 1}},
+	})
+	return err
+}
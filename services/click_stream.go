@@ -0,0 +1,551 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener-api/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// clickStreamKey is the Redis stream holding recent clicks for resuming subscribers
+	clickStreamKey = "click_stream"
+
+	// clickStreamChannel is the Redis pub/sub channel fanning clicks out to every instance
+	clickStreamChannel = "click_stream_events"
+
+	// clickSubscriberBuffer is how many messages may wait for one subscriber before it is dropped
+	clickSubscriberBuffer = 256
+
+	// clickOwnerCacheSize and clickOwnerTTL bound the cache of link owners used when publishing
+	clickOwnerCacheSize = 10000
+	clickOwnerTTL       = time.Minute
+)
+
+// publishClicksScript appends each click to the stream and publishes it with its new ID in one step,
+// so messages are published in stream order whichever instance sends them
+var publishClicksScript = redis.NewScript(`
+for i = 2, #ARGV do
+	local id = redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'click', ARGV[i])
+	redis.call('PUBLISH', KEYS[2], id .. ' ' .. ARGV[i])
+end
+return #ARGV - 1
+`)
+
+// RedisClickStream implements models.ClickStream across API instances. Every click is appended to a
+// capped Redis stream, whose IDs order and identify clicks, and published on a pub/sub channel that
+// every instance subscribes to. Pub/sub is fire-and-forget, so after the subscription drops the
+// clicks published meanwhile are read back from the stream.
+type RedisClickStream struct {
+	hub            *clickStreamHub
+	client         *redis.Client
+	maxLen         int64
+	reconnectDelay time.Duration
+	ctx            context.Context
+	cancel         context.CancelFunc
+	done           chan struct{}
+
+	mu     sync.Mutex
+	pubsub *redis.PubSub
+}
+
+// NewRedisClickStream creates a new instance of RedisClickStream keeping the last maxLen clicks for
+// resuming subscribers. Click owners are looked up in storage.
+func NewRedisClickStream(client *redis.Client, storage models.URLRepository, maxLen int, heartbeatInterval time.Duration) *RedisClickStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &RedisClickStream{
+		client:         client,
+		maxLen:         int64(maxLen),
+		reconnectDelay: 500 * time.Millisecond,
+		ctx:            ctx,
+		cancel:         cancel,
+		done:           make(chan struct{}),
+	}
+	s.hub = newClickStreamHub(storage, heartbeatInterval, s.clicksAfter)
+	return s
+}
+
+// Start subscribes to the click channel and begins delivering clicks to subscribers. The first
+// subscription is confirmed before returning, so later clicks are never missed.
+func (s *RedisClickStream) Start() {
+	pubsub, err := s.subscribe()
+	if err != nil {
+		log.Printf("Warning: Failed to subscribe to live clicks, retrying: %v", err)
+	}
+
+	s.hub.start()
+	go s.receiveLoop(pubsub)
+	log.Println("Click stream started")
+}
+
+// Stop unsubscribes, waits for the background loop to exit and ends every subscription
+func (s *RedisClickStream) Stop() {
+	s.cancel()
+
+	// Closing the subscription unblocks a pending receive
+	s.mu.Lock()
+	if s.pubsub != nil {
+		s.pubsub.Close()
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	s.hub.stop()
+	log.Println("Click stream stopped")
+}
+
+// PublishClicks appends the clicks of owned links to the stream and publishes them in one round trip
+func (s *RedisClickStream) PublishClicks(events []models.ClickEvent) error {
+	clicks, err := s.hub.liveClicks(events)
+	if err != nil || len(clicks) == 0 {
+		return err
+	}
+
+	args := make([]interface{}, 0, len(clicks)+1)
+	args = append(args, s.maxLen)
+	for _, click := range clicks {
+		data, err := json.Marshal(click)
+		if err != nil {
+			return err
+		}
+		args = append(args, data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return publishClicksScript.Run(ctx, s.client, []string{clickStreamKey, clickStreamChannel}, args...).Err()
+}
+
+// Subscribe delivers the clicks matching filter, starting with the retained ones after lastEventID
+func (s *RedisClickStream) Subscribe(filter models.ClickStreamFilter, lastEventID string) (models.ClickSubscription, error) {
+	return s.hub.subscribe(filter, lastEventID)
+}
+
+// clicksAfter reads the retained clicks after id, oldest first
+func (s *RedisClickStream) clicksAfter(id string) ([]models.LiveClick, error) {
+	if s.maxLen <= 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := "-"
+	if id != "" {
+		start = "(" + id
+	}
+	messages, err := s.client.XRangeN(ctx, clickStreamKey, start, "+", s.maxLen).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	clicks := make([]models.LiveClick, 0, len(messages))
+	for _, message := range messages {
+		data, _ := message.Values["click"].(string)
+		click, err := decodeLiveClick(message.ID, data)
+		if err != nil {
+			log.Printf("Skipping unreadable click %s: %v", message.ID, err)
+			continue
+		}
+		clicks = append(clicks, click)
+	}
+	return clicks, nil
+}
+
+// subscribe opens a subscription and waits for Redis to confirm it
+func (s *RedisClickStream) subscribe() (*redis.PubSub, error) {
+	pubsub := s.client.Subscribe(s.ctx, clickStreamChannel)
+	if _, err := pubsub.Receive(s.ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		pubsub.Close()
+		return nil, s.ctx.Err()
+	}
+	s.pubsub = pubsub
+	return pubsub, nil
+}
+
+// receiveLoop delivers published clicks, resubscribing with backoff whenever the connection drops and
+// then catching up from the stream
+func (s *RedisClickStream) receiveLoop(pubsub *redis.PubSub) {
+	defer close(s.done)
+
+	delay := s.reconnectDelay
+	for {
+		if pubsub == nil {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			var err error
+			if pubsub, err = s.subscribe(); err != nil {
+				delay = min(delay*2, 30*time.Second)
+				continue
+			}
+			delay = s.reconnectDelay
+			clickMetrics.Add("stream_resubscribes", 1)
+			log.Println("Click stream resubscribed")
+
+			// Clicks published while disconnected are read back from the stream
+			if missed, err := s.clicksAfter(s.hub.latestID()); err != nil {
+				log.Printf("Click stream catch-up error: %v", err)
+			} else {
+				s.hub.dispatch(missed)
+			}
+		}
+
+		message, err := pubsub.ReceiveTimeout(s.ctx, invalidationHealthCheckInterval)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// A quiet channel is fine as long as the connection still answers
+			if err = pubsub.Ping(s.ctx); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			pubsub.Close()
+			pubsub = nil
+
+			if s.ctx.Err() != nil {
+				return
+			}
+
+			clickMetrics.Add("stream_disconnects", 1)
+			log.Printf("Click stream subscription dropped: %v", err)
+			continue
+		}
+
+		if msg, ok := message.(*redis.Message); ok {
+			id, data, _ := strings.Cut(msg.Payload, " ")
+			click, err := decodeLiveClick(id, data)
+			if err != nil {
+				log.Printf("Skipping unreadable click %s: %v", id, err)
+				continue
+			}
+			s.hub.dispatch([]models.LiveClick{click})
+		}
+	}
+}
+
+// decodeLiveClick decodes a published click and sets its stream ID
+func decodeLiveClick(id string, data string) (models.LiveClick, error) {
+	var click models.LiveClick
+	if err := json.Unmarshal([]byte(data), &click); err != nil {
+		return click, err
+	}
+	click.ID = id
+	return click, nil
+}
+
+// clickStreamHub delivers the clicks of a stream to the subscribers of this instance in stream order,
+// and a heartbeat with the latest stream ID every heartbeat interval. A subscriber whose buffer is full
+// is dropped rather than holding the others up; it can resume from the last ID it was sent.
+type clickStreamHub struct {
+	storage           models.URLRepository
+	owners            *LRUCache
+	history           func(afterID string) ([]models.LiveClick, error)
+	heartbeatInterval time.Duration
+	ctx               context.Context
+	cancel            context.CancelFunc
+	done              chan struct{} // closed when the heartbeat loop has exited; nil until start
+
+	mu          sync.Mutex
+	subscribers map[string]map[*clickSubscription]bool // by user ID
+	lastID      string
+}
+
+// newClickStreamHub creates a hub replaying the clicks history returns after an ID
+func newClickStreamHub(storage models.URLRepository, heartbeatInterval time.Duration, history func(afterID string) ([]models.LiveClick, error)) *clickStreamHub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &clickStreamHub{
+		storage:           storage,
+		owners:            NewLRUCache(clickOwnerCacheSize),
+		history:           history,
+		heartbeatInterval: heartbeatInterval,
+		ctx:               ctx,
+		cancel:            cancel,
+		subscribers:       make(map[string]map[*clickSubscription]bool),
+	}
+}
+
+// start begins sending heartbeats
+func (h *clickStreamHub) start() {
+	if h.heartbeatInterval > 0 {
+		h.done = make(chan struct{})
+		go h.heartbeatLoop()
+	}
+}
+
+// stop stops the heartbeats and ends every subscription
+func (h *clickStreamHub) stop() {
+	h.cancel()
+	if h.done != nil {
+		<-h.done
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subscribers := range h.subscribers {
+		for subscriber := range subscribers {
+			h.removeLocked(subscriber)
+		}
+	}
+}
+
+// subscribe delivers the clicks matching filter, starting with the retained ones after lastEventID
+// when it is not empty. The subscriber is registered before the history is read, so no click falls
+// between the two; clicks seen in both are sent once.
+func (h *clickStreamHub) subscribe(filter models.ClickStreamFilter, lastEventID string) (models.ClickSubscription, error) {
+	subscriber := &clickSubscription{
+		hub:      h,
+		filter:   filter,
+		incoming: make(chan models.ClickStreamMessage, clickSubscriberBuffer),
+		messages: make(chan models.ClickStreamMessage),
+		closed:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	if h.ctx.Err() != nil {
+		h.mu.Unlock()
+		return nil, models.ErrClickStreamDisabled
+	}
+	if h.subscribers[filter.UserID] == nil {
+		h.subscribers[filter.UserID] = make(map[*clickSubscription]bool)
+	}
+	h.subscribers[filter.UserID][subscriber] = true
+	h.mu.Unlock()
+
+	var replay []models.LiveClick
+	if lastEventID != "" {
+		clicks, err := h.history(lastEventID)
+		if err != nil {
+			subscriber.Close()
+			return nil, err
+		}
+		for _, click := range clicks {
+			if filter.Matches(click) {
+				replay = append(replay, click)
+			}
+		}
+	}
+
+	go subscriber.pump(lastEventID, replay)
+	return subscriber, nil
+}
+
+// liveClicks looks up the owner of each event's link, leaving out links without one since nobody can
+// subscribe to them
+func (h *clickStreamHub) liveClicks(events []models.ClickEvent) ([]models.LiveClick, error) {
+	ctx := context.Background()
+
+	clicks := make([]models.LiveClick, 0, len(events))
+	for _, event := range events {
+		owner, err := h.owners.Get(ctx, event.ShortCode)
+		if err != nil {
+			mapping, exists, err := h.storage.Get(event.ShortCode)
+			if err != nil {
+				return nil, err
+			}
+			owner = ""
+			if exists {
+				owner = mapping.UserID
+			}
+			h.owners.Set(ctx, event.ShortCode, owner, clickOwnerTTL)
+		}
+
+		if owner != "" {
+			clicks = append(clicks, models.LiveClick{UserID: owner, ClickEvent: event})
+		}
+	}
+	return clicks, nil
+}
+
+// dispatch queues clicks for their subscribers, skipping any not newer than the last one dispatched
+func (h *clickStreamHub) dispatch(clicks []models.LiveClick) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range clicks {
+		click := clicks[i]
+		if !streamIDAfter(click.ID, h.lastID) {
+			continue
+		}
+		h.lastID = click.ID
+
+		for subscriber := range h.subscribers[click.UserID] {
+			if subscriber.filter.Matches(click) {
+				h.sendLocked(subscriber, models.ClickStreamMessage{ID: click.ID, Click: &click})
+			}
+		}
+	}
+}
+
+// latestID returns the ID of the last click dispatched
+func (h *clickStreamHub) latestID() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastID
+}
+
+// heartbeatLoop sends every subscriber the latest stream ID in a loop
+func (h *clickStreamHub) heartbeatLoop() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+			h.mu.Lock()
+			for _, subscribers := range h.subscribers {
+				for subscriber := range subscribers {
+					h.sendLocked(subscriber, models.ClickStreamMessage{ID: h.lastID})
+				}
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// sendLocked queues a message without blocking, dropping a subscriber whose buffer is full
+func (h *clickStreamHub) sendLocked(subscriber *clickSubscription, message models.ClickStreamMessage) {
+	select {
+	case subscriber.incoming <- message:
+	default:
+		h.removeLocked(subscriber)
+		clickMetrics.Add("stream_slow_subscribers", 1)
+	}
+}
+
+// removeLocked unregisters a subscriber and closes its queue, once
+func (h *clickStreamHub) removeLocked(subscriber *clickSubscription) {
+	subscribers := h.subscribers[subscriber.filter.UserID]
+	if !subscribers[subscriber] {
+		return
+	}
+	delete(subscribers, subscriber)
+	if len(subscribers) == 0 {
+		delete(h.subscribers, subscriber.filter.UserID)
+	}
+	close(subscriber.incoming)
+}
+
+// clickSubscription implements models.ClickSubscription. The hub queues messages on incoming and a
+// goroutine passes them on to messages after the replayed history.
+type clickSubscription struct {
+	hub       *clickStreamHub
+	filter    models.ClickStreamFilter
+	incoming  chan models.ClickStreamMessage
+	messages  chan models.ClickStreamMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Messages returns the channel of clicks and heartbeats
+func (s *clickSubscription) Messages() <-chan models.ClickStreamMessage {
+	return s.messages
+}
+
+// Close ends the subscription
+func (s *clickSubscription) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+
+		s.hub.mu.Lock()
+		s.hub.removeLocked(s)
+		s.hub.mu.Unlock()
+	})
+}
+
+// pump sends the replayed clicks, then the queued messages that are newer, until the subscription is
+// closed or dropped. Heartbeats never move a subscriber's ID backwards.
+func (s *clickSubscription) pump(lastID string, replay []models.LiveClick) {
+	defer close(s.messages)
+
+	for i := range replay {
+		if !s.deliver(models.ClickStreamMessage{ID: replay[i].ID, Click: &replay[i]}) {
+			return
+		}
+		lastID = replay[i].ID
+	}
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case message, ok := <-s.incoming:
+			if !ok {
+				return
+			}
+			if !streamIDAfter(message.ID, lastID) {
+				if message.Click != nil {
+					continue
+				}
+				message.ID = lastID
+			}
+			if !s.deliver(message) {
+				return
+			}
+			lastID = message.ID
+		}
+	}
+}
+
+// deliver hands a message to the reader unless the subscription is closed first
+func (s *clickSubscription) deliver(message models.ClickStreamMessage) bool {
+	select {
+	case s.messages <- message:
+		return true
+	case <-s.closed:
+		return false
+	}
+}
+
+// parseStreamID splits a stream ID of the form <milliseconds>-<sequence>
+func parseStreamID(id string) (milliseconds uint64, sequence uint64, ok bool) {
+	ms, seq, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	milliseconds, err := strconv.ParseUint(ms, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	sequence, err = strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return milliseconds, sequence, true
+}
+
+// streamIDAfter reports whether stream ID a comes after b; the empty ID comes before every other
+func streamIDAfter(a string, b string) bool {
+	if b == "" {
+		return a != ""
+	}
+	aMilliseconds, aSequence, _ := parseStreamID(a)
+	bMilliseconds, bSequence, _ := parseStreamID(b)
+	if aMilliseconds != bMilliseconds {
+		return aMilliseconds > bMilliseconds
+	}
+	return aSequence > bSequence
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"url-shortener-api/models"
+)
+
+const (
+	// Bounds and default for the length of random and hash codes
+	minCodeLength     = 6
+	maxCodeLength     = 20
+	defaultCodeLength = 8
+
+	// randomCodeAttempts is how many random codes are tried before giving up on collisions
+	randomCodeAttempts = 5
+)
+
+// RandomCodeGenerator produces unguessable codes from crypto/rand, retrying on collision
+type RandomCodeGenerator struct {
+	storage models.URLRepository
+}
+
+// NewRandomCodeGenerator creates a new instance of RandomCodeGenerator checking collisions against storage
+func NewRandomCodeGenerator(storage models.URLRepository) *RandomCodeGenerator {
+	return &RandomCodeGenerator{
+		storage: storage,
+	}
+}
+
+// Generate returns a random base62 code of the requested length that is not stored yet
+func (g *RandomCodeGenerator) Generate(input models.CodeInput) (string, error) {
+	length := codeLength(input.Length)
+
+	for attempt := 0; attempt < randomCodeAttempts; attempt++ {
+		code, err := randomBase62(length)
+		if err != nil {
+			return "", err
+		}
+
+		exists, err := g.storage.Exists(code)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return code, nil
+		}
+		counterMetrics.Add("random_code_collisions", 1)
+	}
+
+	return "", models.ErrCodeSpaceExhausted
+}
+
+// HashCodeGenerator derives reproducible codes from the normalized URL and the user
+type HashCodeGenerator struct{}
+
+// NewHashCodeGenerator creates a new instance of HashCodeGenerator
+func NewHashCodeGenerator() *HashCodeGenerator {
+	return &HashCodeGenerator{}
+}
+
+// Generate returns the leading base62 digits of SHA-256 over the normalized URL and user ID.
+// The same URL shortened by the same user always yields the same code.
+func (g *HashCodeGenerator) Generate(input models.CodeInput) (string, error) {
+	sum := sha256.Sum256([]byte(input.UserID + "\x00" + normalizeHashURL(input.URL)))
+
+	value := new(big.Int).SetBytes(sum[:])
+	base := big.NewInt(int64(base62Length))
+	digit := new(big.Int)
+
+	code := make([]byte, codeLength(input.Length))
+	for i := range code {
+		value.DivMod(value, base, digit)
+		code[i] = base62Alphabet[digit.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// normalizeHashURL returns the form of a URL that hash codes are derived from, so spellings of the
+// same address share a code: the scheme and host are lowercased, the default port is dropped, an
+// empty path becomes "/" and the fragment is removed. Unparseable URLs are used as they are.
+func normalizeHashURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return rawURL
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	host, port := strings.ToLower(parsed.Hostname()), parsed.Port()
+	if (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	parsed.Host = host
+
+	if parsed.Path == "" && parsed.RawPath == "" {
+		parsed.Path = "/"
+	}
+	parsed.Fragment, parsed.RawFragment = "", ""
+
+	return parsed.String()
+}
+
+// codeLength applies the default to an unset length
+func codeLength(length int) int {
+	if length == 0 {
+		return defaultCodeLength
+	}
+	return length
+}
+
+// randomBase62 returns length uniformly random base62 characters
+func randomBase62(length int) (string, error) {
+	code := make([]byte, 0, length)
+	buffer := make([]byte, length*2)
+
+	for len(code) < length {
+		if _, err := rand.Read(buffer); err != nil {
+			return "", err
+		}
+		for _, b := range buffer {
+			// Rejecting bytes from 248 up keeps every character equally likely
+			if b < 248 && len(code) < length {
+				code = append(code, base62Alphabet[b%byte(base62Length)])
+			}
+		}
+	}
+
+	return string(code), nil
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"url-shortener-api/models"
+)
+
+// maxGeneratedCode is the base62 encoding of the largest counter value
+var maxGeneratedCode = NewBase62Encoder().Encode(math.MaxInt64)
+
+// seedableCounter is a counter that can be raised to a known high-water mark
+type seedableCounter interface {
+	models.CounterService
+	models.CounterSeeder
+}
+
+// CounterRecovery reconciles the short code counter with the codes already stored.
+// A counter reseeded from a lagging source could otherwise hand out a value whose code
+// exists, so this runs before the API serves writes.
+type CounterRecovery struct {
+	storage   models.URLRepository
+	counter   seedableCounter
+	generator *ShortCodeGenerator
+}
+
+// NewCounterRecovery creates a new instance of CounterRecovery for codes written in the given format
+func NewCounterRecovery(storage models.URLRepository, counter seedableCounter, format ShortCodeFormat) *CounterRecovery {
+	return &CounterRecovery{
+		storage:   storage,
+		counter:   counter,
+		generator: NewFormattedShortCodeGenerator(counter, format),
+	}
+}
+
+// Recover raises the counter to the highest counter value stored and returns the gap it closed,
+// which is zero when the counter was already ahead. Codes stored without a counter value, such as
+// those written before links recorded one, are decoded once first.
+func (r *CounterRecovery) Recover() (int64, error) {
+	current, err := r.counter.GetCurrentCounter()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read counter: %w", err)
+	}
+
+	if err := r.storage.BackfillCounters(r.counterOf); err != nil {
+		return 0, fmt.Errorf("failed to backfill counter values: %w", err)
+	}
+
+	highest, err := r.storage.HighestCounter()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the highest counter value: %w", err)
+	}
+
+	if highest <= current {
+		return 0, nil
+	}
+
+	gap := highest - current
+	if err := r.counter.SeedCounter(highest); err != nil {
+		return 0, err
+	}
+
+	counterMetrics.Add("recovery_gap", gap)
+	log.Printf("Warning: Counter was %d behind the stored short codes, raised from %d to %d", gap, current, highest)
+	return gap, nil
+}
+
+// counterOf decodes the counter value of a counter code, or returns 0 for a code the generator
+// could not have produced
+func (r *CounterRecovery) counterOf(mapping models.URLMapping) int64 {
+	if !mapping.IsCounterGenerated() {
+		return 0
+	}
+
+	// Padding codes to a minimum length adds leading zeros that do not change their value
+	digits := strings.TrimLeft(mapping.ShortURL, "0")
+	if len(digits) > len(maxGeneratedCode) ||
+		(len(digits) == len(maxGeneratedCode) && digits > maxGeneratedCode) {
+		return 0
+	}
+
+	counter, err := r.generator.Decode(mapping.ShortURL)
+	if err != nil {
+		// Not produced by the generator, for example a legacy hand-made code
+		return 0
+	}
+	return counter
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+// DeletionPurger periodically removes mappings that were deleted longer ago than the restore window,
+// freeing their short codes
+type DeletionPurger struct {
+	storage       models.URLRepository
+	restoreWindow time.Duration
+	interval      time.Duration
+	ctx           context.Context
+	cancel        context.CancelFunc
+}
+
+// NewDeletionPurger creates a new instance of DeletionPurger
+func NewDeletionPurger(storage models.URLRepository, restoreWindow time.Duration, interval time.Duration) *DeletionPurger {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DeletionPurger{
+		storage:       storage,
+		restoreWindow: restoreWindow,
+		interval:      interval,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Start begins the background purge process
+func (dp *DeletionPurger) Start() {
+	go dp.purgeLoop()
+	log.Println("Deletion purger started")
+}
+
+// Stop stops the background purge process
+func (dp *DeletionPurger) Stop() {
+	dp.cancel()
+	log.Println("Deletion purger stopped")
+}
+
+// Purge removes every mapping deleted before the restore window and returns how many there were
+func (dp *DeletionPurger) Purge() (int64, error) {
+	return dp.storage.PurgeDeleted(time.Now().Add(-dp.restoreWindow))
+}
+
+// purgeLoop runs the purge process in a loop
+func (dp *DeletionPurger) purgeLoop() {
+	ticker := time.NewTicker(dp.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dp.ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := dp.Purge()
+			if err != nil {
+				log.Printf("Deletion purge error: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("Deletion purge removed %d deleted URL mappings", purged)
+			}
+		}
+	}
+}
@@ -13,19 +13,27 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// counterLeaseRetention is how long the lease of an instance that stopped leasing is kept
+const counterLeaseRetention = 24 * time.Hour
+
 // DistributedCounter handles distributed counter operations with Redis and MongoDB
 type DistributedCounter struct {
-	redisClient *redis.Client
-	collection  *mongo.Collection
-	streamName  string
+	redisClient     *redis.Client
+	collection      *mongo.Collection
+	leaseCollection *mongo.Collection
+	instanceID      string
+	streamName      string
 }
 
-// NewDistributedCounter creates a new instance of DistributedCounter
-func NewDistributedCounter(redisClient *redis.Client, collection *mongo.Collection) *DistributedCounter {
+// NewDistributedCounter creates a new instance of DistributedCounter; instanceID identifies
+// this API instance in the counter_leases collection
+func NewDistributedCounter(redisClient *redis.Client, collection *mongo.Collection, instanceID string) *DistributedCounter {
 	return &DistributedCounter{
-		redisClient: redisClient,
-		collection:  collection,
-		streamName:  "counter_replication",
+		redisClient:     redisClient,
+		collection:      collection,
+		leaseCollection: collection.Database().Collection("counter_leases"),
+		instanceID:      instanceID,
+		streamName:      counterReplicationStream,
 	}
 }
 
@@ -47,6 +55,8 @@ func (dc *DistributedCounter) GetNextCounter() (int64, error) {
 
 	_, err = dc.redisClient.XAdd(ctx, &redis.XAddArgs{
 		Stream: dc.streamName,
+		MaxLen: counterReplicationMaxLen,
+		Approx: true,
 		Values: streamData,
 	}).Result()
 
@@ -59,14 +69,59 @@ func (dc *DistributedCounter) GetNextCounter() (int64, error) {
 	return counter, nil
 }
 
+// AllocateBlock leases size counter values with a single INCRBY. The new high-water mark is
+// written to MongoDB with $max before any value of the block is returned, so neither an instance
+// crash nor a Redis reseed can hand the block out again. The lease is then recorded as this
+// instance's latest one, replacing its previous lease.
+func (dc *DistributedCounter) AllocateBlock(size int64) (int64, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	end, err := dc.redisClient.IncrBy(ctx, "short_code_counter", size).Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to lease counter block in Redis: %w", err)
+	}
+	start := end - size + 1
+	now := time.Now()
+
+	if err := dc.PersistHighWaterMark(ctx, end); err != nil {
+		return 0, 0, err
+	}
+
+	_, err = dc.leaseCollection.UpdateOne(
+		ctx,
+		bson.M{"instance_id": dc.instanceID},
+		bson.M{"$set": bson.M{"start": start, "end": end, "leased_at": now}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to record counter lease: %w", err)
+	}
+
+	return start, end, nil
+}
+
+// CreateIndexes creates the indexes of the counter_leases collection: instance_id for recording
+// leases and end for finding the newest one when reseeding
+func (dc *DistributedCounter) CreateIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := dc.leaseCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "instance_id", Value: 1}}},
+		{Keys: bson.D{{Key: "end", Value: -1}}},
+	})
+	return err
+}
+
 // GetCurrentCounter returns the current counter value from Redis
 func (dc *DistributedCounter) GetCurrentCounter() (int64, error) {
 	ctx := context.Background()
 
 	counter, err := dc.redisClient.Get(ctx, "short_code_counter").Int64()
 	if err == redis.Nil {
-		// Counter doesn't exist in Redis, initialize from MongoDB
-		return dc.initializeFromMongoDB()
+		// Counter doesn't exist in Redis, reseed it from MongoDB
+		return dc.seedFromMongoDB(ctx, 0)
 	}
 	if err != nil {
 		return 0, fmt.Errorf("failed to get counter from Redis: %w", err)
@@ -98,97 +153,95 @@ func (dc *DistributedCounter) InitializeCounter() error {
 		return fmt.Errorf("failed to check counter in MongoDB: %w", err)
 	}
 
-	// Set counter in Redis
-	err = dc.redisClient.Set(ctx, "short_code_counter", counterDoc.Counter, 0).Err()
+	// Raise the Redis counter to the durable high-water mark; a live value is never lowered
+	if _, err := dc.seedFromMongoDB(ctx, 0); err != nil {
+		return err
+	}
+
+	return dc.pruneLeases(ctx, counterDoc.Counter)
+}
+
+// pruneLeases deletes the leases of instances that have not leased for counterLeaseRetention, such as
+// stopped instances, when their end is covered by the persisted counter and so adds nothing to a reseed
+func (dc *DistributedCounter) pruneLeases(ctx context.Context, persisted int64) error {
+	_, err := dc.leaseCollection.DeleteMany(ctx, bson.M{
+		"end":       bson.M{"$lte": persisted},
+		"leased_at": bson.M{"$lt": time.Now().Add(-counterLeaseRetention)},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to set counter in Redis: %w", err)
+		return fmt.Errorf("failed to prune counter leases: %w", err)
 	}
 
 	return nil
 }
 
-// initializeFromMongoDB initializes Redis counter from MongoDB
-func (dc *DistributedCounter) initializeFromMongoDB() (int64, error) {
+// SeedCounter raises the counter in Redis and MongoDB to at least minimum, also taking
+// the persisted counter and every recorded lease into account
+func (dc *DistributedCounter) SeedCounter(minimum int64) error {
 	ctx := context.Background()
 
+	counter, err := dc.seedFromMongoDB(ctx, minimum)
+	if err != nil {
+		return err
+	}
+
+	return dc.PersistHighWaterMark(ctx, counter)
+}
+
+// seedCounterScript raises the Redis counter to ARGV[1] unless it is already higher
+// and returns the resulting value
+var seedCounterScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local minimum = tonumber(ARGV[1])
+if current < minimum then
+	redis.call('SET', KEYS[1], ARGV[1])
+	return minimum
+end
+return current
+`)
+
+// seedFromMongoDB raises the Redis counter to the highest of minimum, the persisted counter
+// and the end of the newest lease. short_code_counters alone can lag by a replication
+// interval, while leases are written before their values are used.
+func (dc *DistributedCounter) seedFromMongoDB(ctx context.Context, minimum int64) (int64, error) {
+	highWaterMark := minimum
+
 	var counterDoc models.ShortCodeCounter
 	err := dc.collection.FindOne(ctx, bson.M{}).Decode(&counterDoc)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			// Initialize counter
-			if initErr := dc.InitializeCounter(); initErr != nil {
-				return 0, initErr
-			}
-			return 0, nil
-		}
+	if err != nil && err != mongo.ErrNoDocuments {
 		return 0, fmt.Errorf("failed to get counter from MongoDB: %w", err)
 	}
+	highWaterMark = max(highWaterMark, counterDoc.Counter)
 
-	// Set counter in Redis
-	err = dc.redisClient.Set(ctx, "short_code_counter", counterDoc.Counter, 0).Err()
+	var lease models.CounterLease
+	err = dc.leaseCollection.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "end", Value: -1}})).Decode(&lease)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("failed to get counter leases from MongoDB: %w", err)
+	}
+	highWaterMark = max(highWaterMark, lease.End)
+
+	counter, err := seedCounterScript.Run(ctx, dc.redisClient, []string{"short_code_counter"}, highWaterMark).Int64()
 	if err != nil {
-		return 0, fmt.Errorf("failed to set counter in Redis: %w", err)
+		return 0, fmt.Errorf("failed to seed counter in Redis: %w", err)
 	}
 
-	return counterDoc.Counter, nil
+	return counter, nil
 }
 
-// ReplicateToMongoDB replicates counter updates from Redis stream to MongoDB
-func (dc *DistributedCounter) ReplicateToMongoDB() error {
-	fmt.Println("Replicating counter to MongoDB")
-	ctx := context.Background()
-
-	// Read from stream
-	streams, err := dc.redisClient.XRead(ctx, &redis.XReadArgs{
-		Streams: []string{dc.streamName, "0"},
-		Count:   100,
-		Block:   0,
-	}).Result()
-
+// PersistHighWaterMark raises the counter in MongoDB to at least counter. It uses $max,
+// so a stale or out-of-order value can never move the persisted counter backwards.
+func (dc *DistributedCounter) PersistHighWaterMark(ctx context.Context, counter int64) error {
+	_, err := dc.collection.UpdateOne(
+		ctx,
+		bson.M{},
+		bson.M{
+			"$max": bson.M{"counter": counter},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
 	if err != nil {
-		return fmt.Errorf("failed to read from stream: %w", err)
-	}
-
-	for _, stream := range streams {
-		for _, message := range stream.Messages {
-			counterStr, exists := message.Values["counter"]
-			if !exists {
-				continue
-			}
-
-			counter, ok := counterStr.(int64)
-			if !ok {
-				// Try to convert from string
-				if counterStrStr, ok := counterStr.(string); ok {
-					if parsedCounter, err := fmt.Sscanf(counterStrStr, "%d", &counter); err != nil || parsedCounter != 1 {
-						continue
-					}
-				} else {
-					continue
-				}
-			}
-
-			// Update MongoDB
-			_, err = dc.collection.UpdateOne(
-				ctx,
-				bson.M{},
-				bson.M{
-					"$set": bson.M{
-						"counter":    counter,
-						"updated_at": time.Now(),
-					},
-				},
-				options.Update().SetUpsert(true),
-			)
-
-			if err != nil {
-				fmt.Printf("Warning: Failed to replicate counter %d to MongoDB: %v\n", counter, err)
-				continue
-			}
-
-			// Acknowledge the message
-			dc.redisClient.XAck(ctx, dc.streamName, "replication_group", message.ID)
-		}
+		return fmt.Errorf("failed to persist counter high-water mark: %w", err)
 	}
 
 	return nil
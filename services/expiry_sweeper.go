@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ExpiredURLPurger is implemented by storage backends without native TTL support
+type ExpiredURLPurger interface {
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+// ExpirySweeper periodically removes expired URL mappings, standing in for the MongoDB TTL index
+type ExpirySweeper struct {
+	purger   ExpiredURLPurger
+	interval time.Duration
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// NewExpirySweeper creates a new instance of ExpirySweeper
+func NewExpirySweeper(purger ExpiredURLPurger, interval time.Duration) *ExpirySweeper {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ExpirySweeper{
+		purger:   purger,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start begins the background sweep process
+func (es *ExpirySweeper) Start() {
+	go es.sweepLoop()
+	log.Println("Expiry sweeper started")
+}
+
+// Stop stops the background sweep process
+func (es *ExpirySweeper) Stop() {
+	es.cancel()
+	log.Println("Expiry sweeper stopped")
+}
+
+// sweepLoop runs the sweep process in a loop
+func (es *ExpirySweeper) sweepLoop() {
+	ticker := time.NewTicker(es.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-es.ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := es.purger.DeleteExpired(time.Now())
+			if err != nil {
+				log.Printf("Expiry sweep error: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("Expiry sweep removed %d expired URL mappings", deleted)
+			}
+		}
+	}
+}
@@ -1,28 +1,123 @@
 package services
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"time"
+
+	"url-shortener-api/config"
 	"url-shortener-api/models"
 
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // ServiceFactory handles the creation and dependency injection of services
 type ServiceFactory struct {
-	collection         *mongo.Collection
-	cache              *CacheService
-	counterCollection  *mongo.Collection
+	storage            models.URLRepository
+	counter            models.CounterService
+	codeFormat         ShortCodeFormat
+	cache              models.Cache
 	redisClient        *redis.Client
 	replicationService *ReplicationService
+	invalidationBus    *InvalidationBus
+	expirySweeper      *ExpirySweeper
+	deletionPurger     *DeletionPurger
+	restoreWindow      time.Duration
+	maxBatchSize       int
+	importStorage      models.ImportJobRepository
+	importService      *ImportServiceImpl
+	clickStorage       models.ClickEventRepository
+	visitorCounter     models.VisitorCounter
+	clickRecorder      *ClickRecorder
+	geoIPLocator       *GeoIPLocator
+	botFilter          *BotFilter
+	clickStream        backgroundClickStream
+	instanceID         string
+	closers            []func() error
+}
+
+// NewServiceFactory creates a new instance of ServiceFactory for the storage backend and counter selected in the config
+func NewServiceFactory(cfg *config.Config) (*ServiceFactory, error) {
+	if cfg.CounterType != config.CounterShared && cfg.CounterType != config.CounterSnowflake {
+		return nil, fmt.Errorf("unsupported counter type %q", cfg.CounterType)
+	}
+	if cfg.CounterType == config.CounterSnowflake {
+		// Instances sharing a node ID would mint the same values
+		if cfg.NodeID < 0 {
+			return nil, fmt.Errorf("NODE_ID is required with COUNTER_TYPE=%s", config.CounterSnowflake)
+		}
+		// Snowflake values are above the scrambled range, so the key would silently do nothing
+		if cfg.CodeScrambleKey != "" {
+			return nil, fmt.Errorf("CODE_SCRAMBLE_KEY cannot be combined with COUNTER_TYPE=%s", config.CounterSnowflake)
+		}
+	}
+
+	factory, err := newStorageServiceFactory(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Snowflake values need no shared state, so they replace the backend's counter
+	if cfg.CounterType == config.CounterSnowflake {
+		counter, err := NewSnowflakeCounter(int64(cfg.NodeID))
+		if err != nil {
+			factory.Close()
+			return nil, err
+		}
+		factory.counter = counter
+		log.Printf("Using Snowflake counter with node ID %d", cfg.NodeID)
+	}
+
+	return factory, nil
+}
+
+// newStorageServiceFactory creates a new instance of ServiceFactory for the storage backend selected in the config
+func newStorageServiceFactory(cfg *config.Config) (*ServiceFactory, error) {
+	switch cfg.StorageBackend {
+	case config.StorageMemory:
+		return NewMemoryServiceFactory(cfg), nil
+	case config.StorageBolt:
+		return NewBoltServiceFactory(cfg)
+	case config.StorageSQL:
+		return NewSQLServiceFactory(cfg)
+	case config.StorageMongoDB:
+		client, err := connectToMongoDB(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+		}
+
+		collection := client.Database(cfg.DatabaseName).Collection("url_mappings")
+		factory, err := NewMongoServiceFactory(cfg, collection)
+		if err != nil {
+			client.Disconnect(context.Background())
+			return nil, err
+		}
+		factory.closers = append(factory.closers, func() error {
+			return client.Disconnect(context.Background())
+		})
+		return factory, nil
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q", cfg.StorageBackend)
+	}
 }
 
-// NewServiceFactory creates a new instance of ServiceFactory with MongoDB collection and Redis cache
-func NewServiceFactory(collection *mongo.Collection, redisURL string) *ServiceFactory {
-	cache := NewCacheService(redisURL)
+// NewMongoServiceFactory creates a new instance of ServiceFactory with MongoDB collection and Redis cache.
+// It fails when the link indexes cannot be created, since creates rely on the unique short_url index,
+// or when the counter cannot be reconciled with the stored codes before serving writes.
+func NewMongoServiceFactory(cfg *config.Config, collection *mongo.Collection) (*ServiceFactory, error) {
+	// Create indexes for the collection
+	storage := NewURLStorage(collection)
+	if err := storage.CreateIndexes(); err != nil {
+		return nil, fmt.Errorf("failed to create MongoDB indexes: %w", err)
+	}
+
+	redisCache := NewCacheService(cfg.RedisURL)
 
 	// Parse Redis URL to get client
-	opt, err := redis.ParseURL(redisURL)
+	opt, err := redis.ParseURL(cfg.RedisURL)
 	if err != nil {
 		// Fallback to default localhost connection
 		opt = &redis.Options{
@@ -31,49 +126,346 @@ func NewServiceFactory(collection *mongo.Collection, redisURL string) *ServiceFa
 	}
 	redisClient := redis.NewClient(opt)
 
+	// Serve the hottest links from process memory, falling back to Redis.
+	// Instances evict each other's local copies over pub/sub.
+	var cache models.Cache = redisCache
+	var invalidationBus *InvalidationBus
+	if cfg.LocalCacheSize > 0 {
+		localCache := NewLRUCache(cfg.LocalCacheSize)
+		invalidationBus = NewInvalidationBus(redisClient, localCache)
+		invalidationBus.Start()
+		cache = NewTieredCache(localCache, redisCache, cfg.LocalCacheTTL, invalidationBus)
+	}
+
 	// Create counter collection (using same database as main collection)
 	db := collection.Database()
 	counterCollection := db.Collection("short_code_counters")
 
 	// Create distributed counter
-	distributedCounter := NewDistributedCounter(redisClient, counterCollection)
+	distributedCounter := NewDistributedCounter(redisClient, counterCollection, cfg.InstanceID)
 
 	// Initialize counter
+	if err := distributedCounter.CreateIndexes(); err != nil {
+		log.Printf("Warning: Failed to create counter lease indexes: %v", err)
+	}
 	if err := distributedCounter.InitializeCounter(); err != nil {
 		log.Printf("Warning: Failed to initialize counter: %v", err)
 	}
 
+	// Never hand out a value whose short code is already stored
+	if err := recoverCounter(cfg, storage, distributedCounter); err != nil {
+		if invalidationBus != nil {
+			invalidationBus.Stop()
+		}
+		redisCache.Close()
+		redisClient.Close()
+		return nil, fmt.Errorf("failed to recover counter: %w", err)
+	}
+
+	importStorage := NewImportStorage(db)
+	if err := importStorage.CreateIndexes(); err != nil {
+		log.Printf("Warning: Failed to create import indexes: %v", err)
+	}
+
+	clickStorage := NewClickStorage(db.Collection("click_events"))
+	if err := clickStorage.CreateIndexes(); err != nil {
+		log.Printf("Warning: Failed to create click event indexes: %v", err)
+	}
+
 	// Create and start replication service
-	replicationService := NewReplicationService(distributedCounter)
+	replicationService := NewReplicationService(redisClient, cfg.InstanceID, distributedCounter)
 	replicationService.Start()
 
-	return &ServiceFactory{
-		collection:         collection,
+	factory := &ServiceFactory{
+		storage:            storage,
+		counter:            withCounterBlocks(cfg, distributedCounter),
+		codeFormat:         shortCodeFormat(cfg),
+		maxBatchSize:       cfg.BatchMaxSize,
+		importStorage:      importStorage,
+		instanceID:         cfg.InstanceID,
 		cache:              cache,
-		counterCollection:  counterCollection,
 		redisClient:        redisClient,
 		replicationService: replicationService,
+		invalidationBus:    invalidationBus,
+		closers:            []func() error{redisCache.Close, redisClient.Close},
 	}
+	factory.startDeletionPurger(cfg)
+	factory.startClickRecorder(cfg, clickStorage, NewRedisVisitorCounter(redisClient, cfg.VisitorRetention),
+		NewRedisClickStream(redisClient, storage, cfg.ClickStreamHistory, cfg.ClickStreamHeartbeat))
+
+	return factory, nil
+}
+
+// NewMemoryServiceFactory creates a new instance of ServiceFactory backed entirely by process memory,
+// so the API can run without MongoDB or Redis
+func NewMemoryServiceFactory(cfg *config.Config) *ServiceFactory {
+	storage := NewMemoryURLStorage()
+	factory := &ServiceFactory{
+		storage:       storage,
+		counter:       withCounterBlocks(cfg, NewMemoryCounter()),
+		codeFormat:    shortCodeFormat(cfg),
+		maxBatchSize:  cfg.BatchMaxSize,
+		importStorage: NewMemoryImportStorage(),
+		instanceID:    cfg.InstanceID,
+	}
+
+	if cfg.ExpirySweepInterval > 0 {
+		factory.expirySweeper = NewExpirySweeper(storage, cfg.ExpirySweepInterval)
+		factory.expirySweeper.Start()
+	}
+	factory.startDeletionPurger(cfg)
+	factory.startClickRecorder(cfg, NewMemoryClickStorage(), NewMemoryVisitorCounter(cfg.VisitorRetention),
+		NewMemoryClickStream(storage, cfg.ClickStreamHistory, cfg.ClickStreamHeartbeat))
+
+	return factory
+}
+
+// NewBoltServiceFactory creates a new instance of ServiceFactory backed by a single embedded bbolt file,
+// replacing MongoDB for storage, Redis for the counter, and the cache (lookups are already local)
+func NewBoltServiceFactory(cfg *config.Config) (*ServiceFactory, error) {
+	db, err := OpenBoltDB(cfg.BoltPath, cfg.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bbolt database %s: %w", cfg.BoltPath, err)
+	}
+
+	storage := NewBoltURLStorage(db)
+	counter := NewBoltCounter(db)
+	if err := counter.InitializeCounter(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize counter: %w", err)
+	}
+	if err := recoverCounter(cfg, storage, counter); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	factory := &ServiceFactory{
+		storage:       storage,
+		counter:       withCounterBlocks(cfg, counter),
+		codeFormat:    shortCodeFormat(cfg),
+		maxBatchSize:  cfg.BatchMaxSize,
+		importStorage: NewBoltImportStorage(db),
+		instanceID:    cfg.InstanceID,
+		closers:       []func() error{db.Close},
+	}
+
+	if cfg.ExpirySweepInterval > 0 {
+		factory.expirySweeper = NewExpirySweeper(storage, cfg.ExpirySweepInterval)
+		factory.expirySweeper.Start()
+	}
+	factory.startDeletionPurger(cfg)
+	factory.startClickRecorder(cfg, NewBoltClickStorage(db), NewMemoryVisitorCounter(cfg.VisitorRetention),
+		NewMemoryClickStream(storage, cfg.ClickStreamHistory, cfg.ClickStreamHeartbeat))
+
+	fmt.Printf("Opened bbolt database at %s\n", cfg.BoltPath)
+	return factory, nil
+}
+
+// NewSQLServiceFactory creates a new instance of ServiceFactory backed by PostgreSQL or SQLite.
+// The counter lives in the same database, and a sweeper stands in for the MongoDB TTL index.
+func NewSQLServiceFactory(cfg *config.Config) (*ServiceFactory, error) {
+	db, err := OpenSQLDB(cfg.SQLDialect, cfg.SQLDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", cfg.SQLDialect, err)
+	}
+
+	storage := NewSQLURLStorage(db, cfg.SQLDialect)
+	counter := NewSQLCounter(db, cfg.SQLDialect)
+	if err := counter.InitializeCounter(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := recoverCounter(cfg, storage, counter); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	factory := &ServiceFactory{
+		storage:       storage,
+		counter:       withCounterBlocks(cfg, counter),
+		codeFormat:    shortCodeFormat(cfg),
+		maxBatchSize:  cfg.BatchMaxSize,
+		importStorage: NewSQLImportStorage(db, cfg.SQLDialect),
+		instanceID:    cfg.InstanceID,
+		closers:       []func() error{db.Close},
+	}
+
+	if cfg.ExpirySweepInterval > 0 {
+		factory.expirySweeper = NewExpirySweeper(storage, cfg.ExpirySweepInterval)
+		factory.expirySweeper.Start()
+	}
+	factory.startDeletionPurger(cfg)
+	factory.startClickRecorder(cfg, NewSQLClickStorage(db, cfg.SQLDialect), NewMemoryVisitorCounter(cfg.VisitorRetention),
+		NewMemoryClickStream(storage, cfg.ClickStreamHistory, cfg.ClickStreamHeartbeat))
+
+	fmt.Printf("Connected to %s database\n", cfg.SQLDialect)
+	return factory, nil
 }
 
 // CreateURLService creates a new URLService with all its dependencies
 func (f *ServiceFactory) CreateURLService() models.URLService {
-	storage := NewURLStorage(f.collection)
+	return &URLServiceImpl{
+		storage: f.storage,
+		generators: map[string]models.CodeGenerator{
+			models.StrategyCounter: NewFormattedShortCodeGenerator(f.counter, f.codeFormat),
+			models.StrategyRandom:  NewRandomCodeGenerator(f.storage),
+			models.StrategyHash:    NewHashCodeGenerator(),
+		},
+		validator:     NewURLValidator(),
+		cache:         f.cache,
+		restoreWindow: f.restoreWindow,
+		maxBatchSize:  f.maxBatchSize,
+		clicks:        f.clickStorage,
+		visitors:      f.visitorCounter,
+		stream:        f.clickStream,
+	}
+}
 
-	// Create distributed counter
-	distributedCounter := NewDistributedCounter(f.redisClient, f.counterCollection)
-	generator := NewShortCodeGenerator(distributedCounter)
-	validator := NewURLValidator()
+// CreateClickRecorder returns the ClickRecorder that buffers redirect clicks for storage, or nil
+// when click capture is disabled
+func (f *ServiceFactory) CreateClickRecorder() models.ClickRecorder {
+	if f.clickRecorder == nil {
+		return nil
+	}
+	return f.clickRecorder
+}
 
-	// Create indexes for the collection
-	if err := storage.CreateIndexes(); err != nil {
-		log.Printf("Warning: Failed to create MongoDB indexes: %v", err)
+// CreateImportService returns the ImportService, starting its background worker on first use.
+// Imported links are created through a URLService from CreateURLService.
+func (f *ServiceFactory) CreateImportService() models.ImportService {
+	if f.importService == nil {
+		f.importService = NewImportService(f.importStorage, f.CreateURLService(), f.instanceID)
+		f.importService.Start()
 	}
+	return f.importService
+}
 
-	return &URLServiceImpl{
-		storage:   storage,
-		generator: generator,
-		validator: validator,
-		cache:     f.cache,
+// Close stops background services and releases backend connections
+func (f *ServiceFactory) Close() error {
+	if f.importService != nil {
+		f.importService.Stop()
+	}
+	if f.replicationService != nil {
+		f.replicationService.Stop()
+	}
+	if f.invalidationBus != nil {
+		f.invalidationBus.Stop()
+	}
+	if f.expirySweeper != nil {
+		f.expirySweeper.Stop()
+	}
+	if f.deletionPurger != nil {
+		f.deletionPurger.Stop()
+	}
+	if f.clickRecorder != nil {
+		f.clickRecorder.Stop()
+	}
+	if f.geoIPLocator != nil {
+		f.geoIPLocator.Stop()
+	}
+	if f.botFilter != nil {
+		f.botFilter.Stop()
+	}
+	if f.clickStream != nil {
+		f.clickStream.Stop()
+	}
+
+	var firstErr error
+	for _, closer := range f.closers {
+		if err := closer(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// startDeletionPurger records the restore window and starts purging links deleted before it
+func (f *ServiceFactory) startDeletionPurger(cfg *config.Config) {
+	f.restoreWindow = cfg.RestoreWindow
+	if cfg.PurgeInterval > 0 {
+		f.deletionPurger = NewDeletionPurger(f.storage, cfg.RestoreWindow, cfg.PurgeInterval)
+		f.deletionPurger.Start()
+	}
+}
+
+// startClickRecorder records the click storage and visitor counter and starts buffering click events
+// for them, unless the buffer size or flush interval is zero. Clicks are located when a GeoIP database
+// is configured, classified as bots with the built-in patterns or the configured patterns file, and
+// published to live subscribers through stream once stored.
+func (f *ServiceFactory) startClickRecorder(cfg *config.Config, storage models.ClickEventRepository, visitors models.VisitorCounter, stream backgroundClickStream) {
+	f.clickStorage = storage
+	f.visitorCounter = visitors
+	if cfg.ClickBufferSize <= 0 || cfg.ClickFlushInterval <= 0 {
+		return
 	}
+
+	var locator models.GeoLocator
+	if cfg.GeoIPDatabasePath != "" {
+		f.geoIPLocator = NewGeoIPLocator(cfg.GeoIPDatabasePath, cfg.GeoIPReloadInterval)
+		f.geoIPLocator.Start()
+		locator = f.geoIPLocator
+	}
+
+	f.botFilter = NewBotFilter(cfg.BotPatternsPath, cfg.BotPatternsReloadInterval)
+	f.botFilter.Start()
+
+	f.clickStream = stream
+	f.clickStream.Start()
+
+	f.clickRecorder = NewClickRecorder(storage, locator, f.botFilter, visitors, f.clickStream, cfg.ClickBufferSize, cfg.ClickBatchSize, cfg.ClickFlushInterval)
+	f.clickRecorder.Start()
+}
+
+// backgroundClickStream is a models.ClickStream with background work to start and stop
+type backgroundClickStream interface {
+	models.ClickStream
+	Start()
+	Stop()
+}
+
+// withCounterBlocks wraps the shared counter in a BlockCounter when block allocation is enabled
+func withCounterBlocks(cfg *config.Config, counter blockAllocatingCounter) models.CounterService {
+	if cfg.CounterBlockSize > 1 {
+		return NewBlockCounter(counter, int64(cfg.CounterBlockSize))
+	}
+	return counter
+}
+
+// recoverCounter raises the shared counter above the stored codes. It is skipped when the Snowflake
+// counter replaces the shared one, since its values would push the shared counter up to theirs.
+func recoverCounter(cfg *config.Config, storage models.URLRepository, counter seedableCounter) error {
+	if cfg.CounterType == config.CounterSnowflake {
+		return nil
+	}
+	_, err := NewCounterRecovery(storage, counter, shortCodeFormat(cfg)).Recover()
+	return err
+}
+
+// shortCodeFormat reads the short code format from the config
+func shortCodeFormat(cfg *config.Config) ShortCodeFormat {
+	return ShortCodeFormat{
+		ScrambleKey: cfg.CodeScrambleKey,
+		MinLength:   cfg.CodeMinLength,
+	}
+}
+
+// connectToMongoDB establishes a connection to MongoDB
+func connectToMongoDB(cfg *config.Config) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	clientOptions := options.Client().ApplyURI(cfg.MongoURI)
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test the connection
+	err = client.Ping(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Connected to MongoDB at %s\n", cfg.MongoURI)
+	return client, nil
 }
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+const (
+	// scrambleBits is the width of the permuted domain; larger counters pass through unchanged
+	scrambleBits     = 40
+	scrambleHalfBits = scrambleBits / 2
+	scrambleHalfMask = 1<<scrambleHalfBits - 1
+	scrambleRounds   = 4
+)
+
+// FeistelScrambler is a keyed, reversible permutation of counter values. A balanced Feistel
+// network over scrambleBits bits maps [0, 2^40) onto itself one-to-one, so scrambled values
+// stay unique. Values outside that range are left as they are, which keeps the mapping a
+// bijection over every non-negative int64.
+type FeistelScrambler struct {
+	key []byte
+}
+
+// NewFeistelScrambler creates a new instance of FeistelScrambler keyed with the given secret
+func NewFeistelScrambler(key string) *FeistelScrambler {
+	return &FeistelScrambler{
+		key: []byte(key),
+	}
+}
+
+// Scramble permutes a counter value
+func (s *FeistelScrambler) Scramble(value int64) int64 {
+	if value < 0 || value >= 1<<scrambleBits {
+		return value
+	}
+
+	left, right := uint32(value>>scrambleHalfBits), uint32(value&scrambleHalfMask)
+	for round := 0; round < scrambleRounds; round++ {
+		left, right = right, left^s.roundFunction(round, right)
+	}
+
+	return int64(left)<<scrambleHalfBits | int64(right)
+}
+
+// Unscramble reverses Scramble
+func (s *FeistelScrambler) Unscramble(value int64) int64 {
+	if value < 0 || value >= 1<<scrambleBits {
+		return value
+	}
+
+	left, right := uint32(value>>scrambleHalfBits), uint32(value&scrambleHalfMask)
+	for round := scrambleRounds - 1; round >= 0; round-- {
+		left, right = right^s.roundFunction(round, left), left
+	}
+
+	return int64(left)<<scrambleHalfBits | int64(right)
+}
+
+// roundFunction derives a half-width value from the key, the round number and one half
+func (s *FeistelScrambler) roundFunction(round int, half uint32) uint32 {
+	var input [5]byte
+	input[0] = byte(round)
+	binary.BigEndian.PutUint32(input[1:], half)
+
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(input[:])
+	return binary.BigEndian.Uint32(mac.Sum(nil)) & scrambleHalfMask
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"url-shortener-api/models"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoIPRecord is the part of a GeoIP2 or GeoLite2 City/Country record used for clicks
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// GeoIPLocator implements models.GeoLocator with a MaxMind-format (.mmdb) database file. The file is
+// checked every reload interval and loaded again when its modification time or size changes, so it
+// can be replaced without a restart. Lookups made before a database is loaded return no location.
+type GeoIPLocator struct {
+	path           string
+	reloadInterval time.Duration
+	mu             sync.RWMutex
+	reader         *maxminddb.Reader
+	modTime        time.Time
+	size           int64
+	ctx            context.Context
+	cancel         context.CancelFunc
+}
+
+// NewGeoIPLocator creates a new instance of GeoIPLocator for the database at path
+func NewGeoIPLocator(path string, reloadInterval time.Duration) *GeoIPLocator {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &GeoIPLocator{
+		path:           path,
+		reloadInterval: reloadInterval,
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// Start loads the database and begins watching the file for changes. A database that cannot be
+// loaded yet is retried on every check.
+func (gl *GeoIPLocator) Start() {
+	if _, err := gl.Reload(); err != nil {
+		log.Printf("Warning: Failed to load GeoIP database %s: %v", gl.path, err)
+	}
+	if gl.reloadInterval > 0 {
+		go gl.reloadLoop()
+	}
+	log.Println("GeoIP locator started")
+}
+
+// Stop stops watching the database file
+func (gl *GeoIPLocator) Stop() {
+	gl.cancel()
+	log.Println("GeoIP locator stopped")
+}
+
+// Reload loads the database file if it changed since the last load and reports whether it did.
+// The file is read into memory, so lookups never see a file that is being replaced.
+func (gl *GeoIPLocator) Reload() (bool, error) {
+	info, err := os.Stat(gl.path)
+	if err != nil {
+		return false, err
+	}
+
+	gl.mu.RLock()
+	unchanged := gl.reader != nil && info.ModTime().Equal(gl.modTime) && info.Size() == gl.size
+	gl.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(gl.path)
+	if err != nil {
+		return false, err
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return false, err
+	}
+
+	gl.mu.Lock()
+	gl.reader = reader
+	gl.modTime = info.ModTime()
+	gl.size = info.Size()
+	gl.mu.Unlock()
+
+	log.Printf("Loaded GeoIP database %s (%s, built %s)", gl.path, reader.Metadata.DatabaseType,
+		time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC().Format(time.RFC3339))
+	return true, nil
+}
+
+// Locate returns the country code, region and city of ip in English, or an empty location when
+// the address is invalid or not in the database
+func (gl *GeoIPLocator) Locate(ip string) models.GeoLocation {
+	address := net.ParseIP(ip)
+	if address == nil {
+		return models.GeoLocation{}
+	}
+
+	gl.mu.RLock()
+	reader := gl.reader
+	gl.mu.RUnlock()
+	if reader == nil {
+		return models.GeoLocation{}
+	}
+
+	var record geoIPRecord
+	if err := reader.Lookup(address, &record); err != nil {
+		return models.GeoLocation{}
+	}
+
+	location := models.GeoLocation{
+		Country: record.Country.ISOCode,
+		City:    record.City.Names["en"],
+	}
+	if len(record.Subdivisions) > 0 {
+		location.Region = record.Subdivisions[0].Names["en"]
+	}
+	return location
+}
+
+// reloadLoop checks the database file for changes in a loop
+func (gl *GeoIPLocator) reloadLoop() {
+	ticker := time.NewTicker(gl.reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gl.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := gl.Reload(); err != nil {
+				log.Printf("GeoIP database reload error: %v", err)
+			}
+		}
+	}
+}
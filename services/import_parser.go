@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+const (
+	// importTagSeparator separates the tags of a CSV row
+	importTagSeparator = ";"
+
+	// maxImportLineBytes bounds one JSONL line
+	maxImportLineBytes = 1 << 20
+)
+
+// parseImportRows reads every row of an import file. A row that cannot be parsed keeps the reason in
+// ImportRow.Error and is reported when the job reaches it; only a malformed file fails as a whole.
+func parseImportRows(format string, file io.Reader) ([]models.ImportRow, error) {
+	var rows []models.ImportRow
+	var err error
+
+	switch format {
+	case models.ImportFormatCSV:
+		rows, err = parseCSVImport(file)
+	case models.ImportFormatJSONL:
+		rows, err = parseJSONLImport(file)
+	default:
+		return nil, models.ErrInvalidImportFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, models.ErrEmptyImport
+	}
+	return rows, nil
+}
+
+// parseCSVImport reads a CSV file whose header names its columns: url, and optionally alias,
+// expiration and tags. Other columns are ignored.
+func parseCSVImport(file io.Reader) ([]models.ImportRow, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, models.ErrEmptyImport
+	}
+	if err != nil {
+		return nil, models.ErrInvalidImportFile
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, models.ErrMissingURLColumn
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []models.ImportRow
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, models.ErrInvalidImportFile
+		}
+
+		row := models.ImportRow{
+			Row:   number,
+			URL:   field(record, "url"),
+			Alias: field(record, "alias"),
+		}
+		for _, tag := range strings.Split(field(record, "tags"), importTagSeparator) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				row.Tags = append(row.Tags, tag)
+			}
+		}
+		row.Expiration, err = parseImportExpiration(field(record, "expiration"))
+		if err != nil {
+			row.Error = err.Error()
+		}
+
+		rows = append(rows, row)
+	}
+}
+
+// jsonlImportRow is the shape of one line of a JSONL import file
+type jsonlImportRow struct {
+	URL        string   `json:"url"`
+	Alias      string   `json:"alias"`
+	Expiration string   `json:"expiration"`
+	Tags       []string `json:"tags"`
+}
+
+// parseJSONLImport reads a file with one JSON object per line; blank lines are skipped
+func parseJSONLImport(file io.Reader) ([]models.ImportRow, error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+
+	var rows []models.ImportRow
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		row := models.ImportRow{Row: number}
+		var parsed jsonlImportRow
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			row.Error = "row is not a valid JSON object"
+			rows = append(rows, row)
+			continue
+		}
+
+		row.URL = strings.TrimSpace(parsed.URL)
+		row.Alias = strings.TrimSpace(parsed.Alias)
+		row.Tags = parsed.Tags
+		var err error
+		row.Expiration, err = parseImportExpiration(strings.TrimSpace(parsed.Expiration))
+		if err != nil {
+			row.Error = err.Error()
+		}
+
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, models.ErrInvalidImportFile
+	}
+
+	return rows, nil
+}
+
+// parseImportExpiration parses an optional RFC 3339 expiration timestamp
+func parseImportExpiration(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	expiration, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.New("expiration must be an RFC 3339 timestamp")
+	}
+	return &expiration, nil
+}
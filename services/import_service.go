@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"url-shortener-api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// importLeaseDuration is how long a worker holds a job without saving progress before
+	// another worker, or the same instance after a restart, may take it over
+	importLeaseDuration = time.Minute
+
+	// importPollInterval is how often the worker looks for jobs whose lease has lapsed
+	importPollInterval = 30 * time.Second
+
+	// importRowBatch is how many rows are loaded from storage at a time
+	importRowBatch = 100
+
+	// importSaveRows and importSaveInterval bound the rows processed, and the time spent, between
+	// two saves of a job's progress; both stay well within the lease
+	importSaveRows     = 100
+	importSaveInterval = 5 * time.Second
+)
+
+// ImportServiceImpl implements the ImportService interface. Uploaded rows are stored with the job
+// and a background worker creates them one by one through URLService.CreateShortURL, saving
+// progress every importSaveRows rows or importSaveInterval. Each created row's short code is stored
+// on the row right away, so a worker resuming after a crash skips the rows processed since the last
+// save instead of creating them again; only a crash between those two writes imports a row twice.
+type ImportServiceImpl struct {
+	storage    models.ImportJobRepository
+	urlService models.URLService
+	owner      string // identifies this instance in job leases
+	wake       chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{} // closed when the worker has exited; nil until Start
+}
+
+// NewImportService creates a new instance of ImportServiceImpl; owner identifies this instance in job leases
+func NewImportService(storage models.ImportJobRepository, urlService models.URLService, owner string) *ImportServiceImpl {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ImportServiceImpl{
+		storage:    storage,
+		urlService: urlService,
+		owner:      owner,
+		wake:       make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Start begins the background worker, which first resumes any unfinished jobs
+func (s *ImportServiceImpl) Start() {
+	s.done = make(chan struct{})
+	go s.workLoop()
+	log.Println("Import worker started")
+}
+
+// Stop stops the background worker and waits for it to save the job it was processing
+func (s *ImportServiceImpl) Stop() {
+	s.cancel()
+	if s.done != nil {
+		<-s.done
+	}
+	log.Println("Import worker stopped")
+}
+
+// CreateImport parses an uploaded file and stores it as a queued job for the background worker
+func (s *ImportServiceImpl) CreateImport(req *models.ImportRequest, userID string) (*models.ImportJob, error) {
+	rows, err := parseImportRows(req.Format, req.File)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := models.ImportJob{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    userID,
+		Format:    req.Format,
+		Status:    models.ImportStatusQueued,
+		TotalRows: len(rows),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.storage.CreateImportJob(job, rows); err != nil {
+		return nil, err
+	}
+
+	// Never blocks; a pending wake-up already covers this job
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return &job, nil
+}
+
+// GetImport returns the progress of a job; other users' jobs are reported as not found
+func (s *ImportServiceImpl) GetImport(id string, userID string) (*models.ImportJob, error) {
+	job, exists, err := s.storage.GetImportJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || job.UserID != userID {
+		return nil, models.ErrImportNotFound
+	}
+	return &job, nil
+}
+
+// ProcessPending runs every unfinished job this instance can claim, oldest first, until they are
+// done or the worker stops
+func (s *ImportServiceImpl) ProcessPending() error {
+	jobs, err := s.storage.ListUnfinishedImportJobs()
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if s.ctx.Err() != nil {
+			return nil
+		}
+
+		claimed, ok, err := s.storage.ClaimImportJob(job.ID, s.owner, time.Now().Add(importLeaseDuration))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := s.processJob(claimed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// workLoop processes jobs whenever one is created and periodically picks up abandoned ones
+func (s *ImportServiceImpl) workLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(importPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ProcessPending(); err != nil {
+			log.Printf("Import worker error: %v", err)
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processJob creates the remaining rows of a claimed job. It returns nil without finishing when the
+// worker stops, releasing the lease, or when another worker took the job over.
+func (s *ImportServiceImpl) processJob(job models.ImportJob) error {
+	// Progress and row errors since the last save
+	var newErrors []models.ImportRowError
+	unsaved := 0
+	lastSave := time.Now()
+	save := func() (bool, error) {
+		saved, err := s.storage.SaveImportJob(job, newErrors)
+		newErrors, unsaved, lastSave = nil, 0, time.Now()
+		return saved, err
+	}
+
+	for {
+		rows, err := s.storage.GetImportRows(job.ID, job.Cursor, importRowBatch)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			if s.ctx.Err() != nil {
+				// Let the next instance resume right away instead of waiting for the lease to lapse
+				job.LeaseUntil = time.Time{}
+				_, err := save()
+				return err
+			}
+
+			// A row with a short code was created before the last save was lost
+			var err error
+			if row.ShortCode == "" {
+				err = s.importRow(job.ID, row, job.UserID)
+			}
+			if err != nil && !isAppError(err) {
+				// Storage trouble; the rows since the last save are retried once the lease lapses
+				return err
+			}
+			if rowError := recordImportRow(&job, row, err); rowError != nil {
+				newErrors = append(newErrors, *rowError)
+			}
+
+			unsaved++
+			if unsaved < importSaveRows && time.Since(lastSave) < importSaveInterval {
+				continue
+			}
+			saved, err := save()
+			if err != nil {
+				return err
+			}
+			if !saved {
+				return nil
+			}
+		}
+	}
+
+	now := time.Now()
+	job.Status = models.ImportStatusCompleted
+	job.CompletedAt = &now
+	job.UpdatedAt = now
+	saved, err := save()
+	if err != nil || !saved {
+		return err
+	}
+
+	return s.storage.DeleteImportRows(job.ID)
+}
+
+// importRow creates the link described by one row with the same validation as POST /urls, and
+// records its short code on the row
+func (s *ImportServiceImpl) importRow(jobID string, row models.ImportRow, userID string) error {
+	if row.Error != "" {
+		return &models.AppError{Message: row.Error, StatusCode: http.StatusBadRequest}
+	}
+
+	req := models.URLRequest{
+		URL:   row.URL,
+		Alias: row.Alias,
+		Tags:  row.Tags,
+	}
+	if row.Expiration != nil {
+		req.ExpirationMs = time.Until(*row.Expiration).Milliseconds()
+		if req.ExpirationMs <= 0 {
+			return models.ErrExpirationPassed
+		}
+	}
+
+	response, err := s.urlService.CreateShortURL(&req, userID)
+	if err != nil {
+		return err
+	}
+	return s.storage.SetImportRowShortCode(jobID, row.Row, response.ShortCode)
+}
+
+// recordImportRow advances a job past a row, counting it as created or failed, and extends the lease.
+// It returns the error to store for a failed row, or nil once MaxImportErrors have been stored.
+func recordImportRow(job *models.ImportJob, row models.ImportRow, err error) *models.ImportRowError {
+	job.Cursor = row.Row
+	job.ProcessedRows++
+
+	var rowError *models.ImportRowError
+	if err != nil {
+		job.Failed++
+		if job.Failed <= models.MaxImportErrors {
+			rowError = &models.ImportRowError{
+				Row:    row.Row,
+				Status: models.GetStatusCodeFromError(err),
+				Error:  err.Error(),
+			}
+		}
+	} else {
+		job.Created++
+	}
+
+	now := time.Now()
+	job.Status = models.ImportStatusRunning
+	job.UpdatedAt = now
+	job.LeaseUntil = now.Add(importLeaseDuration)
+	return rowError
+}
+
+// appendImportErrors appends newErrors to the stored errors of a job, keeping the first MaxImportErrors
+func appendImportErrors(stored []models.ImportRowError, newErrors []models.ImportRowError) []models.ImportRowError {
+	stored = append(stored, newErrors...)
+	if len(stored) > models.MaxImportErrors {
+		stored = stored[:models.MaxImportErrors]
+	}
+	return stored
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"url-shortener-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// importRowInsertBatch is how many rows are sent to MongoDB per InsertMany call
+const importRowInsertBatch = 1000
+
+// importRowDocument is how an ImportRow is stored in the import_rows collection
+type importRowDocument struct {
+	JobID            string `bson:"job_id"`
+	models.ImportRow `bson:",inline"`
+}
+
+// ImportStorage implements models.ImportJobRepository with the import_jobs and import_rows collections
+type ImportStorage struct {
+	jobs *mongo.Collection
+	rows *mongo.Collection
+}
+
+// NewImportStorage creates a new instance of ImportStorage using collections of the given database
+func NewImportStorage(db *mongo.Database) *ImportStorage {
+	return &ImportStorage{
+		jobs: db.Collection("import_jobs"),
+		rows: db.Collection("import_rows"),
+	}
+}
+
+// CreateImportJob stores the rows of a new job and then the job itself, so the worker never sees a
+// job whose rows are incomplete
+func (s *ImportStorage) CreateImportJob(job models.ImportJob, rows []models.ImportRow) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	for start := 0; start < len(rows); start += importRowInsertBatch {
+		end := start + importRowInsertBatch
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		documents := make([]interface{}, 0, end-start)
+		for _, row := range rows[start:end] {
+			documents = append(documents, importRowDocument{JobID: job.ID, ImportRow: row})
+		}
+		if _, err := s.rows.InsertMany(ctx, documents); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.jobs.InsertOne(ctx, job)
+	return err
+}
+
+// GetImportJob retrieves a job by ID
+func (s *ImportStorage) GetImportJob(id string) (models.ImportJob, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var job models.ImportJob
+	err := s.jobs.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return job, false, nil
+	}
+	if err != nil {
+		return job, false, err
+	}
+
+	return job, true, nil
+}
+
+// ListUnfinishedImportJobs returns every job that still has rows to process, oldest first
+func (s *ImportStorage) ListUnfinishedImportJobs() ([]models.ImportJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"status": bson.M{"$ne": models.ImportStatusCompleted}}
+	cursor, err := s.jobs.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var jobs []models.ImportJob
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// ClaimImportJob hands an unfinished job to owner until the given time, unless another owner's lease
+// is still running. The check and the update are one findAndModify, so only one instance wins.
+func (s *ImportStorage) ClaimImportJob(id string, owner string, until time.Time) (models.ImportJob, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":    id,
+		"status": bson.M{"$ne": models.ImportStatusCompleted},
+		"$or": bson.A{
+			bson.M{"lease_owner": owner},
+			bson.M{"lease_until": bson.M{"$lt": time.Now()}},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"status":      models.ImportStatusRunning,
+		"lease_owner": owner,
+		"lease_until": until,
+	}}
+
+	var job models.ImportJob
+	err := s.jobs.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return job, false, nil
+	}
+	if err != nil {
+		return job, false, err
+	}
+
+	return job, true, nil
+}
+
+// SaveImportJob saves the progress of a job and pushes newErrors onto its errors, but only while
+// job.LeaseOwner still holds its lease. The stored errors are never rewritten.
+func (s *ImportStorage) SaveImportJob(job models.ImportJob, newErrors []models.ImportRowError) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	progress := bson.M{
+		"status":         job.Status,
+		"processed_rows": job.ProcessedRows,
+		"created":        job.Created,
+		"failed":         job.Failed,
+		"cursor":         job.Cursor,
+		"lease_until":    job.LeaseUntil,
+		"updated_at":     job.UpdatedAt,
+	}
+	if job.CompletedAt != nil {
+		progress["completed_at"] = job.CompletedAt
+	}
+	update := bson.M{"$set": progress}
+	if len(newErrors) > 0 {
+		update["$push"] = bson.M{"errors": bson.M{"$each": newErrors, "$slice": models.MaxImportErrors}}
+	}
+
+	result, err := s.jobs.UpdateOne(ctx, bson.M{"_id": job.ID, "lease_owner": job.LeaseOwner}, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// GetImportRows returns up to limit rows of a job that come after the given Row
+func (s *ImportStorage) GetImportRows(jobID string, after int, limit int) ([]models.ImportRow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"job_id": jobID, "row": bson.M{"$gt": after}}
+	opts := options.Find().SetSort(bson.D{{Key: "row", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := s.rows.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []models.ImportRow
+	for cursor.Next(ctx) {
+		var document importRowDocument
+		if err := cursor.Decode(&document); err != nil {
+			return nil, err
+		}
+		rows = append(rows, document.ImportRow)
+	}
+
+	return rows, cursor.Err()
+}
+
+// SetImportRowShortCode records the short code created for a row
+func (s *ImportStorage) SetImportRowShortCode(jobID string, row int, shortCode string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.rows.UpdateOne(ctx, bson.M{"job_id": jobID, "row": row}, bson.M{"$set": bson.M{"short_code": shortCode}})
+	return err
+}
+
+// DeleteImportRows removes the rows of a job once they are no longer needed
+func (s *ImportStorage) DeleteImportRows(jobID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := s.rows.DeleteMany(ctx, bson.M{"job_id": jobID})
+	return err
+}
+
+// CreateIndexes creates necessary indexes for the import collections
+func (s *ImportStorage) CreateIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Create index serving the worker's scan for unfinished jobs
+	_, err := s.jobs.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Create unique index serving the in-order row reads of a job
+	_, err = s.rows.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "job_id", Value: 1}, {Key: "row", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// cacheInvalidationChannel is the Redis pub/sub channel carrying evicted cache keys
+	cacheInvalidationChannel = "cache_invalidations"
+
+	// invalidationHealthCheckInterval is how long the subscription may stay silent before it is pinged
+	invalidationHealthCheckInterval = 30 * time.Second
+)
+
+// cacheInvalidator is implemented by anything that can tell other instances to drop a key
+type cacheInvalidator interface {
+	Publish(ctx context.Context, key string) error
+}
+
+// InvalidationBus keeps per-instance caches coherent across API instances.
+// Every instance publishes the keys it deletes (such as url:<code>) on a Redis channel
+// and evicts keys published by others from its local LRU. Pub/sub is fire-and-forget,
+// so whenever the subscription drops the local cache is flushed entirely: anything
+// published while disconnected is lost, and a stale entry is worse than a miss.
+type InvalidationBus struct {
+	client         *redis.Client
+	local          *LRUCache
+	channel        string
+	reconnectDelay time.Duration
+	ctx            context.Context
+	cancel         context.CancelFunc
+	done           chan struct{}
+
+	mu     sync.Mutex
+	pubsub *redis.PubSub
+}
+
+// NewInvalidationBus creates a new instance of InvalidationBus evicting from the given local cache
+func NewInvalidationBus(client *redis.Client, local *LRUCache) *InvalidationBus {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &InvalidationBus{
+		client:         client,
+		local:          local,
+		channel:        cacheInvalidationChannel,
+		reconnectDelay: 500 * time.Millisecond,
+		ctx:            ctx,
+		cancel:         cancel,
+		done:           make(chan struct{}),
+	}
+}
+
+// Publish announces that a key changed and must be evicted by every instance
+func (b *InvalidationBus) Publish(ctx context.Context, key string) error {
+	return b.client.Publish(ctx, b.channel, key).Err()
+}
+
+// Start subscribes to the invalidation channel and begins evicting in the background.
+// The first subscription is confirmed before returning, so later publishes are never missed.
+func (b *InvalidationBus) Start() {
+	pubsub, err := b.subscribe()
+	if err != nil {
+		log.Printf("Warning: Failed to subscribe to cache invalidations, retrying: %v", err)
+	}
+
+	go b.receiveLoop(pubsub)
+	log.Println("Cache invalidation bus started")
+}
+
+// Stop unsubscribes and waits for the background loop to exit
+func (b *InvalidationBus) Stop() {
+	b.cancel()
+
+	// Closing the subscription unblocks a pending receive
+	b.mu.Lock()
+	if b.pubsub != nil {
+		b.pubsub.Close()
+	}
+	b.mu.Unlock()
+
+	<-b.done
+	log.Println("Cache invalidation bus stopped")
+}
+
+// subscribe opens a subscription and waits for Redis to confirm it
+func (b *InvalidationBus) subscribe() (*redis.PubSub, error) {
+	pubsub := b.client.Subscribe(b.ctx, b.channel)
+	if _, err := pubsub.Receive(b.ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ctx.Err() != nil {
+		pubsub.Close()
+		return nil, b.ctx.Err()
+	}
+	b.pubsub = pubsub
+
+	// Anything published before this point was missed
+	b.local.Flush()
+	return pubsub, nil
+}
+
+// receiveLoop evicts published keys, resubscribing with backoff whenever the connection drops
+func (b *InvalidationBus) receiveLoop(pubsub *redis.PubSub) {
+	defer close(b.done)
+
+	delay := b.reconnectDelay
+	for {
+		if pubsub == nil {
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			var err error
+			if pubsub, err = b.subscribe(); err != nil {
+				delay = min(delay*2, 30*time.Second)
+				continue
+			}
+			delay = b.reconnectDelay
+			cacheMetrics.Add("invalidation_resubscribes", 1)
+			log.Println("Cache invalidation bus resubscribed")
+		}
+
+		message, err := pubsub.ReceiveTimeout(b.ctx, invalidationHealthCheckInterval)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// A quiet channel is fine as long as the connection still answers
+			if err = pubsub.Ping(b.ctx); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			pubsub.Close()
+			pubsub = nil
+
+			if b.ctx.Err() != nil {
+				return
+			}
+
+			b.local.Flush()
+			cacheMetrics.Add("invalidation_disconnects", 1)
+			log.Printf("Cache invalidation subscription dropped, flushed local cache: %v", err)
+			continue
+		}
+
+		if msg, ok := message.(*redis.Message); ok {
+			b.local.Delete(b.ctx, msg.Payload)
+			cacheMetrics.Add("invalidations_received", 1)
+		}
+	}
+}
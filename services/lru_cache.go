@@ -0,0 +1,125 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+// lruEntry is a cached value with its absolute expiry (zero means no expiry)
+type lruEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+// LRUCache is a size-bounded, thread-safe in-process cache implementing models.Cache.
+// Entries expire after their TTL and the least recently used entry is evicted when full.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+// NewLRUCache creates a new instance of LRUCache holding at most capacity entries
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get retrieves a value by key, treating expired entries as missing
+func (c *LRUCache) Get(ctx context.Context, key string) (string, error) {
+	value, _, err := c.GetWithTTL(ctx, key)
+	return value, err
+}
+
+// GetWithTTL retrieves a value and its remaining TTL. A TTL of zero means the entry does not expire.
+func (c *LRUCache) GetWithTTL(ctx context.Context, key string) (string, time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return "", 0, models.ErrCacheMiss
+	}
+
+	entry := element.Value.(*lruEntry)
+	var ttl time.Duration
+	if !entry.expiresAt.IsZero() {
+		ttl = time.Until(entry.expiresAt)
+		if ttl <= 0 {
+			c.removeElement(element)
+			return "", 0, models.ErrCacheMiss
+		}
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, ttl, nil
+}
+
+// Set stores a value with TTL; a TTL of zero keeps it until evicted
+func (c *LRUCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	if element, ok := c.items[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+
+	return nil
+}
+
+// Delete removes a key from the cache
+func (c *LRUCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.removeElement(element)
+	}
+	return nil
+}
+
+// Flush removes every entry from the cache
+func (c *LRUCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// Len returns the number of entries currently held, including expired ones not yet evicted
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// removeElement unlinks an entry; callers must hold the lock
+func (c *LRUCache) removeElement(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*lruEntry).key)
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"sync"
+
+	"url-shortener-api/models"
+)
+
+// MemoryClickStorage is a thread-safe in-memory implementation of models.ClickEventRepository.
+// Events do not survive a restart.
+type MemoryClickStorage struct {
+	mu     sync.RWMutex
+	events []models.ClickEvent
+}
+
+// NewMemoryClickStorage creates a new, empty instance of MemoryClickStorage
+func NewMemoryClickStorage() *MemoryClickStorage {
+	return &MemoryClickStorage{}
+}
+
+// StoreClickEvents appends a batch of events
+func (s *MemoryClickStorage) StoreClickEvents(events []models.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, events...)
+	return nil
+}
+
+// CountClicks returns the number of recorded clicks of each short code, without bots unless includeBots
+// is set; codes without clicks are omitted
+func (s *MemoryClickStorage) CountClicks(shortCodes []string, includeBots bool) (map[string]int64, error) {
+	wanted := make(map[string]bool, len(shortCodes))
+	for _, shortCode := range shortCodes {
+		wanted[shortCode] = true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, event := range s.events {
+		if wanted[event.ShortCode] && (includeBots || !event.Bot) {
+			counts[event.ShortCode]++
+		}
+	}
+	return counts, nil
+}
+
+// ClickStats summarizes the clicks of one short code in the query's range
+func (s *MemoryClickStorage) ClickStats(query models.ClickStatsQuery) (*models.ClickStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	builder := newClickStatsBuilder(query)
+	for _, event := range s.events {
+		if event.ShortCode == query.ShortCode {
+			builder.add(event)
+		}
+	}
+	return builder.build(), nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+// MemoryClickStream implements models.ClickStream within one process, for the backends that run
+// without Redis. IDs have the same <milliseconds>-<sequence> form as Redis stream IDs, and the last
+// clicks are kept in memory for resuming subscribers, so they do not survive a restart.
+type MemoryClickStream struct {
+	hub *clickStreamHub
+
+	mu           sync.Mutex
+	clicks       []models.LiveClick // oldest first, at most maxLen
+	maxLen       int
+	lastMillis   int64
+	lastSequence int64
+}
+
+// NewMemoryClickStream creates a new instance of MemoryClickStream keeping the last maxLen clicks for
+// resuming subscribers. Click owners are looked up in storage.
+func NewMemoryClickStream(storage models.URLRepository, maxLen int, heartbeatInterval time.Duration) *MemoryClickStream {
+	s := &MemoryClickStream{maxLen: maxLen}
+	s.hub = newClickStreamHub(storage, heartbeatInterval, s.clicksAfter)
+	return s
+}
+
+// Start begins sending heartbeats to subscribers
+func (s *MemoryClickStream) Start() {
+	s.hub.start()
+	log.Println("Click stream started")
+}
+
+// Stop ends every subscription
+func (s *MemoryClickStream) Stop() {
+	s.hub.stop()
+	log.Println("Click stream stopped")
+}
+
+// PublishClicks assigns the clicks of owned links their IDs, keeps them and delivers them to subscribers
+func (s *MemoryClickStream) PublishClicks(events []models.ClickEvent) error {
+	clicks, err := s.hub.liveClicks(events)
+	if err != nil || len(clicks) == 0 {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range clicks {
+		clicks[i].ID = s.nextID()
+	}
+	s.clicks = append(s.clicks, clicks...)
+	if excess := len(s.clicks) - s.maxLen; excess > 0 {
+		s.clicks = append(s.clicks[:0:0], s.clicks[excess:]...)
+	}
+
+	// Delivering under the lock keeps concurrent publishes in ID order
+	s.hub.dispatch(clicks)
+	return nil
+}
+
+// Subscribe delivers the clicks matching filter, starting with the retained ones after lastEventID
+func (s *MemoryClickStream) Subscribe(filter models.ClickStreamFilter, lastEventID string) (models.ClickSubscription, error) {
+	return s.hub.subscribe(filter, lastEventID)
+}
+
+// clicksAfter returns the retained clicks after id, oldest first
+func (s *MemoryClickStream) clicksAfter(id string) ([]models.LiveClick, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var clicks []models.LiveClick
+	for _, click := range s.clicks {
+		if streamIDAfter(click.ID, id) {
+			clicks = append(clicks, click)
+		}
+	}
+	return clicks, nil
+}
+
+// nextID returns a stream ID after every one given before, like Redis does for XADD with *
+func (s *MemoryClickStream) nextID() string {
+	now := time.Now().UnixMilli()
+	if now > s.lastMillis {
+		s.lastMillis, s.lastSequence = now, 0
+	} else {
+		s.lastSequence++
+	}
+	return strconv.FormatInt(s.lastMillis, 10) + "-" + strconv.FormatInt(s.lastSequence, 10)
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"sync/atomic"
+)
+
+// MemoryCounter is a process-local implementation of models.CounterService
+type MemoryCounter struct {
+	counter atomic.Int64
+}
+
+// NewMemoryCounter creates a new instance of MemoryCounter starting at zero
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{}
+}
+
+// GetNextCounter increments and returns the next counter value
+func (c *MemoryCounter) GetNextCounter() (int64, error) {
+	return c.counter.Add(1), nil
+}
+
+// GetCurrentCounter returns the current counter value
+func (c *MemoryCounter) GetCurrentCounter() (int64, error) {
+	return c.counter.Load(), nil
+}
+
+// InitializeCounter is a no-op; the counter starts at zero and lives as long as the process
+func (c *MemoryCounter) InitializeCounter() error {
+	return nil
+}
+
+// AllocateBlock advances the counter by size and returns the leased range
+func (c *MemoryCounter) AllocateBlock(size int64) (int64, int64, error) {
+	end := c.counter.Add(size)
+	return end - size + 1, end, nil
+}
+
+// SeedCounter raises the counter to at least minimum
+func (c *MemoryCounter) SeedCounter(minimum int64) error {
+	for {
+		current := c.counter.Load()
+		if current >= minimum || c.counter.CompareAndSwap(current, minimum) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+// MemoryImportStorage is a thread-safe in-memory implementation of models.ImportJobRepository.
+// Jobs do not survive a restart.
+type MemoryImportStorage struct {
+	mu   sync.Mutex
+	jobs map[string]models.ImportJob
+	rows map[string][]models.ImportRow // in Row order
+}
+
+// NewMemoryImportStorage creates a new, empty instance of MemoryImportStorage
+func NewMemoryImportStorage() *MemoryImportStorage {
+	return &MemoryImportStorage{
+		jobs: make(map[string]models.ImportJob),
+		rows: make(map[string][]models.ImportRow),
+	}
+}
+
+// CreateImportJob stores a new job together with its rows
+func (s *MemoryImportStorage) CreateImportJob(job models.ImportJob, rows []models.ImportRow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = copyImportJob(job)
+	s.rows[job.ID] = append([]models.ImportRow(nil), rows...)
+	return nil
+}
+
+// GetImportJob retrieves a job by ID
+func (s *MemoryImportStorage) GetImportJob(id string) (models.ImportJob, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	return copyImportJob(job), ok, nil
+}
+
+// ListUnfinishedImportJobs returns every job that still has rows to process, oldest first
+func (s *MemoryImportStorage) ListUnfinishedImportJobs() ([]models.ImportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []models.ImportJob
+	for _, job := range s.jobs {
+		if !job.IsFinished() {
+			jobs = append(jobs, copyImportJob(job))
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// ClaimImportJob hands an unfinished job to owner until the given time, unless another owner's lease is still running
+func (s *MemoryImportStorage) ClaimImportJob(id string, owner string, until time.Time) (models.ImportJob, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || job.IsFinished() || (job.LeaseOwner != owner && job.LeaseUntil.After(time.Now())) {
+		return models.ImportJob{}, false, nil
+	}
+
+	job.LeaseOwner = owner
+	job.LeaseUntil = until
+	job.Status = models.ImportStatusRunning
+	s.jobs[id] = job
+	return copyImportJob(job), true, nil
+}
+
+// SaveImportJob saves the progress of a job and appends newErrors to its errors, but only while
+// job.LeaseOwner still holds its lease
+func (s *MemoryImportStorage) SaveImportJob(job models.ImportJob, newErrors []models.ImportRowError) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.jobs[job.ID]
+	if !ok || existing.LeaseOwner != job.LeaseOwner {
+		return false, nil
+	}
+
+	job.Errors = appendImportErrors(existing.Errors, newErrors)
+	s.jobs[job.ID] = copyImportJob(job)
+	return true, nil
+}
+
+// GetImportRows returns up to limit rows of a job that come after the given Row
+func (s *MemoryImportStorage) GetImportRows(jobID string, after int, limit int) ([]models.ImportRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows := s.rows[jobID]
+	start := sort.Search(len(rows), func(i int) bool {
+		return rows[i].Row > after
+	})
+	end := start + limit
+	if end > len(rows) {
+		end = len(rows)
+	}
+
+	return append([]models.ImportRow(nil), rows[start:end]...), nil
+}
+
+// SetImportRowShortCode records the short code created for a row
+func (s *MemoryImportStorage) SetImportRowShortCode(jobID string, row int, shortCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows := s.rows[jobID]
+	i := sort.Search(len(rows), func(i int) bool {
+		return rows[i].Row >= row
+	})
+	if i < len(rows) && rows[i].Row == row {
+		rows[i].ShortCode = shortCode
+	}
+	return nil
+}
+
+// DeleteImportRows removes the rows of a job once they are no longer needed
+func (s *MemoryImportStorage) DeleteImportRows(jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.rows, jobID)
+	return nil
+}
+
+// copyImportJob returns a job that shares no slices or pointers with the original
+func copyImportJob(job models.ImportJob) models.ImportJob {
+	if job.Errors != nil {
+		job.Errors = append([]models.ImportRowError(nil), job.Errors...)
+	}
+	if job.CompletedAt != nil {
+		completedAt := *job.CompletedAt
+		job.CompletedAt = &completedAt
+	}
+	return job
+}
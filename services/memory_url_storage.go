@@ -0,0 +1,344 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"url-shortener-api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryURLStorage is a thread-safe in-memory implementation of models.URLRepository
+type MemoryURLStorage struct {
+	mu       sync.RWMutex
+	mappings map[string]models.URLMapping
+	aliases  map[string]string
+}
+
+// NewMemoryURLStorage creates a new, empty instance of MemoryURLStorage
+func NewMemoryURLStorage() *MemoryURLStorage {
+	return &MemoryURLStorage{
+		mappings: make(map[string]models.URLMapping),
+		aliases:  make(map[string]string),
+	}
+}
+
+// Store inserts a new URL mapping in memory, failing with ErrAliasAlreadyExists if the
+// short code or alias is taken
+func (s *MemoryURLStorage) Store(shortCode string, mapping models.URLMapping) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Mirror the unique indexes on short_url and alias
+	if _, taken := s.mappings[shortCode]; taken {
+		return models.ErrAliasAlreadyExists
+	}
+	if mapping.Alias != "" {
+		if _, taken := s.aliases[mapping.Alias]; taken {
+			return models.ErrAliasAlreadyExists
+		}
+	}
+
+	now := time.Now()
+	mapping.ID = primitive.NewObjectID()
+	mapping.CreatedAt = now
+	mapping.UpdatedAt = now
+	mapping.ShortURL = shortCode
+
+	s.put(mapping)
+	return nil
+}
+
+// StoreMany inserts mappings under their ShortURL, failing each one whose short code or alias is
+// taken with ErrAliasAlreadyExists. When atomic, a single conflict stores none of them.
+func (s *MemoryURLStorage) StoreMany(mappings []models.URLMapping, atomic bool) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Codes and aliases claimed earlier in the batch count as taken too
+	errs := make([]error, len(mappings))
+	codes := make(map[string]bool, len(mappings))
+	aliases := make(map[string]bool)
+	conflicts := false
+	for i, mapping := range mappings {
+		_, codeTaken := s.mappings[mapping.ShortURL]
+		_, aliasTaken := s.aliases[mapping.Alias]
+		if codeTaken || codes[mapping.ShortURL] || (mapping.Alias != "" && (aliasTaken || aliases[mapping.Alias])) {
+			errs[i] = models.ErrAliasAlreadyExists
+			conflicts = true
+			continue
+		}
+		codes[mapping.ShortURL] = true
+		if mapping.Alias != "" {
+			aliases[mapping.Alias] = true
+		}
+	}
+	if atomic && conflicts {
+		return errs, nil
+	}
+
+	now := time.Now()
+	for i, mapping := range mappings {
+		if errs[i] != nil {
+			continue
+		}
+		mapping.ID = primitive.NewObjectID()
+		mapping.CreatedAt = now
+		mapping.UpdatedAt = now
+		s.put(mapping)
+	}
+
+	return errs, nil
+}
+
+// Get retrieves a URL mapping by short code
+func (s *MemoryURLStorage) Get(shortCode string) (models.URLMapping, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	mapping, ok := s.mappings[shortCode]
+	if !ok {
+		return models.URLMapping{}, false, nil
+	}
+	return copyMapping(mapping), true, nil
+}
+
+// Exists checks if a short code already exists
+func (s *MemoryURLStorage) Exists(shortCode string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.mappings[shortCode]
+	return ok, nil
+}
+
+// Delete removes a URL mapping
+func (s *MemoryURLStorage) Delete(shortCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(shortCode)
+	return nil
+}
+
+// IsExpired checks if a URL mapping has expired
+func (s *MemoryURLStorage) IsExpired(mapping models.URLMapping) bool {
+	return mapping.IsExpired()
+}
+
+// GetByAlias retrieves a URL mapping by alias
+func (s *MemoryURLStorage) GetByAlias(alias string) (models.URLMapping, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shortCode, ok := s.aliases[alias]
+	if !ok {
+		return models.URLMapping{}, false, nil
+	}
+	return copyMapping(s.mappings[shortCode]), true, nil
+}
+
+// GetByUserID retrieves all URL mappings for a specific user, oldest first
+func (s *MemoryURLStorage) GetByUserID(userID string) ([]models.URLMapping, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var mappings []models.URLMapping
+	for _, mapping := range s.mappings {
+		if mapping.UserID == userID {
+			mappings = append(mappings, copyMapping(mapping))
+		}
+	}
+
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].CreatedAt.Before(mappings[j].CreatedAt)
+	})
+
+	return mappings, nil
+}
+
+// ListByUserID returns up to query.Limit of the user's mappings that match the query, in its order
+func (s *MemoryURLStorage) ListByUserID(query models.URLListQuery) ([]models.URLMapping, error) {
+	domain := compileDomainFilter(query)
+
+	s.mu.RLock()
+	var mappings []models.URLMapping
+	for _, mapping := range s.mappings {
+		if mapping.UserID == query.UserID && listedAfterCursor(mapping, query) && matchesListQuery(mapping, query, domain) {
+			mappings = append(mappings, copyMapping(mapping))
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(mappings, func(i, j int) bool {
+		return listedBefore(mappings[i], mappings[j], query.Ascending)
+	})
+
+	if len(mappings) > query.Limit {
+		mappings = mappings[:query.Limit]
+	}
+	return mappings, nil
+}
+
+// Update updates an existing URL mapping, doing nothing if it does not exist
+func (s *MemoryURLStorage) Update(shortCode string, mapping models.URLMapping) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.mappings[shortCode]
+	if !ok {
+		return nil
+	}
+
+	if mapping.Alias != "" {
+		if owner, taken := s.aliases[mapping.Alias]; taken && owner != shortCode {
+			return models.ErrAliasAlreadyExists
+		}
+	}
+
+	mapping.ID = existing.ID
+	mapping.UpdatedAt = time.Now()
+	mapping.ShortURL = shortCode
+
+	delete(s.aliases, existing.Alias)
+	s.put(mapping)
+	return nil
+}
+
+// ReplaceIfUnchanged replaces the mapping stored under shortCode, moving it to mapping.ShortURL and leaving
+// a renamedRedirect under the old code when that differs, only if it was last updated at lastUpdatedAt.
+// It reports false if the mapping is gone or changed.
+func (s *MemoryURLStorage) ReplaceIfUnchanged(shortCode string, lastUpdatedAt time.Time, mapping models.URLMapping) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.mappings[shortCode]
+	if !ok || !existing.UpdatedAt.Equal(lastUpdatedAt) {
+		return false, nil
+	}
+
+	if mapping.ShortURL == "" {
+		mapping.ShortURL = shortCode
+	}
+	if _, taken := s.mappings[mapping.ShortURL]; taken && mapping.ShortURL != shortCode {
+		return false, models.ErrAliasAlreadyExists
+	}
+	if mapping.Alias != "" {
+		if owner, taken := s.aliases[mapping.Alias]; taken && owner != shortCode {
+			return false, models.ErrAliasAlreadyExists
+		}
+	}
+
+	mapping.ID = existing.ID
+	mapping.CreatedAt = existing.CreatedAt
+
+	s.remove(shortCode)
+	s.put(mapping)
+	if mapping.ShortURL != shortCode {
+		s.put(renamedRedirect(existing, mapping))
+	}
+	return true, nil
+}
+
+// DeleteExpired removes every mapping whose expiration timestamp is before the given time,
+// standing in for the MongoDB TTL monitor
+func (s *MemoryURLStorage) DeleteExpired(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for shortCode, mapping := range s.mappings {
+		if mapping.ExpirationTimestamp != nil && mapping.ExpirationTimestamp.Before(before) {
+			s.remove(shortCode)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// PurgeDeleted removes every mapping deleted before the given time
+func (s *MemoryURLStorage) PurgeDeleted(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for shortCode, mapping := range s.mappings {
+		if mapping.DeletedAt != nil && mapping.DeletedAt.Before(before) {
+			s.remove(shortCode)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// ScanByUserID calls fn for every mapping of the user that is not deleted, oldest first, until fn
+// returns false
+func (s *MemoryURLStorage) ScanByUserID(userID string, fn func(mapping models.URLMapping) (bool, error)) error {
+	return scanByUserIDInPages(s.ListByUserID, userID, fn)
+}
+
+// BackfillCounters sets the counter value of counter codes stored without one
+func (s *MemoryURLStorage) BackfillCounters(counterOf func(mapping models.URLMapping) int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for shortCode, mapping := range s.mappings {
+		if mapping.Counter == 0 && mapping.IsCounterGenerated() {
+			mapping.Counter = counterOf(mapping)
+			s.mappings[shortCode] = mapping
+		}
+	}
+	return nil
+}
+
+// HighestCounter returns the largest counter value stored, or 0 when there is none
+func (s *MemoryURLStorage) HighestCounter() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var highest int64
+	for _, mapping := range s.mappings {
+		highest = max(highest, mapping.Counter)
+	}
+	return highest, nil
+}
+
+// put stores a mapping and its alias entry; callers must hold the write lock
+func (s *MemoryURLStorage) put(mapping models.URLMapping) {
+	s.mappings[mapping.ShortURL] = copyMapping(mapping)
+	if mapping.Alias != "" {
+		s.aliases[mapping.Alias] = mapping.ShortURL
+	}
+}
+
+// remove deletes a mapping and its alias entry; callers must hold the write lock
+func (s *MemoryURLStorage) remove(shortCode string) {
+	existing, ok := s.mappings[shortCode]
+	if !ok {
+		return
+	}
+	if existing.Alias != "" {
+		delete(s.aliases, existing.Alias)
+	}
+	delete(s.mappings, shortCode)
+}
+
+// copyMapping returns a copy of the mapping that shares no pointers with the original
+func copyMapping(mapping models.URLMapping) models.URLMapping {
+	if mapping.ExpirationTimestamp != nil {
+		expiration := *mapping.ExpirationTimestamp
+		mapping.ExpirationTimestamp = &expiration
+	}
+	if mapping.DeletedAt != nil {
+		deletedAt := *mapping.DeletedAt
+		mapping.DeletedAt = &deletedAt
+	}
+	if mapping.Tags != nil {
+		mapping.Tags = append([]string(nil), mapping.Tags...)
+	}
+	return mapping
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+)
+
+// Process-wide counters, exposed as JSON by MetricsHandler
+var (
+	cacheMetrics   = expvar.NewMap("cache")
+	counterMetrics = expvar.NewMap("counter")
+	clickMetrics   = expvar.NewMap("clicks")
+)
+
+// MetricsHandler serves the cache, counter and click counters as one JSON object, in the format of
+// expvar.Handler but without the rest of the process variables such as cmdline and memstats
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprintf(w, "{\n%q: %s,\n%q: %s,\n%q: %s\n}\n",
+			"cache", cacheMetrics.String(),
+			"counter", counterMetrics.String(),
+			"clicks", clickMetrics.String())
+	})
+}
@@ -2,52 +2,231 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// counterReplicationStream carries every counter value handed out by DistributedCounter
+	counterReplicationStream = "counter_replication"
+
+	// counterReplicationGroup is the consumer group shared by all API instances
+	counterReplicationGroup = "replication_group"
+
+	// counterReplicationMaxLen bounds the stream even if no instance is replicating. Only the
+	// highest value matters, so losing old unacknowledged entries to trimming is harmless.
+	counterReplicationMaxLen = 100000
+
+	// replicationBatchSize is the most stream entries read or reclaimed per round
+	replicationBatchSize = 100
+
+	// replicationClaimIdle is how long an entry may stay pending before another consumer reclaims it
+	replicationClaimIdle = 30 * time.Second
 )
 
-// ReplicationService handles background replication of counter updates
+// CounterCheckpointer persists the highest counter value replicated so far.
+// Implementations must never move the persisted value backwards.
+type CounterCheckpointer interface {
+	PersistHighWaterMark(ctx context.Context, counter int64) error
+}
+
+// ReplicationService replicates counter values from the Redis stream to durable storage.
+// Instances share one consumer group, so each entry is delivered to a single consumer.
+// Entries are acknowledged only after their batch maximum is checkpointed; entries left
+// pending by a crashed consumer are reclaimed with XAUTOCLAIM, and acknowledged entries
+// are trimmed from the stream.
 type ReplicationService struct {
-	counter *DistributedCounter
-	ctx     context.Context
-	cancel  context.CancelFunc
+	client       *redis.Client
+	checkpointer CounterCheckpointer
+	stream       string
+	group        string
+	consumer     string
+	block        time.Duration
+	claimIdle    time.Duration
+	ctx          context.Context
+	cancel       context.CancelFunc
+	done         chan struct{}
 }
 
-// NewReplicationService creates a new instance of ReplicationService
-func NewReplicationService(counter *DistributedCounter) *ReplicationService {
+// NewReplicationService creates a new instance of ReplicationService reading as the named consumer
+func NewReplicationService(client *redis.Client, consumer string, checkpointer CounterCheckpointer) *ReplicationService {
+	if consumer == "" {
+		consumer = "replication_consumer"
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	return &ReplicationService{
-		counter: counter,
-		ctx:     ctx,
-		cancel:  cancel,
+		client:       client,
+		checkpointer: checkpointer,
+		stream:       counterReplicationStream,
+		group:        counterReplicationGroup,
+		consumer:     consumer,
+		block:        2 * time.Second,
+		claimIdle:    replicationClaimIdle,
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
 	}
 }
 
-// Start begins the background replication process
+// Start creates the consumer group if needed and begins the background replication process
 func (rs *ReplicationService) Start() {
+	if err := rs.EnsureGroup(rs.ctx); err != nil {
+		log.Printf("Warning: Failed to create replication consumer group, retrying: %v", err)
+	}
+
 	go rs.replicationLoop()
 	log.Println("Counter replication service started")
 }
 
-// Stop stops the background replication process
+// Stop stops the background replication process and waits for the current round to finish
 func (rs *ReplicationService) Stop() {
 	rs.cancel()
+	<-rs.done
 	log.Println("Counter replication service stopped")
 }
 
-// replicationLoop runs the replication process in a loop
+// EnsureGroup creates the stream and consumer group, starting from the oldest entry so
+// values written before the group existed are still replicated
+func (rs *ReplicationService) EnsureGroup(ctx context.Context) error {
+	err := rs.client.XGroupCreateMkStream(ctx, rs.stream, rs.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	return nil
+}
+
+// Replicate runs one round: reclaim stale pending entries or read new ones, checkpoint the
+// batch maximum, acknowledge the batch and trim the stream. It returns the number of entries
+// acknowledged, and blocks for a short while when there is nothing to read.
+func (rs *ReplicationService) Replicate(ctx context.Context) (int, error) {
+	messages, _, err := rs.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   rs.stream,
+		Group:    rs.group,
+		Consumer: rs.consumer,
+		MinIdle:  rs.claimIdle,
+		Start:    "0-0",
+		Count:    replicationBatchSize,
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to reclaim pending entries: %w", err)
+	}
+	if len(messages) > 0 {
+		counterMetrics.Add("replication_reclaimed", int64(len(messages)))
+	} else {
+		streams, err := rs.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    rs.group,
+			Consumer: rs.consumer,
+			Streams:  []string{rs.stream, ">"},
+			Count:    replicationBatchSize,
+			Block:    rs.block,
+		}).Result()
+		if err == redis.Nil {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read from stream: %w", err)
+		}
+		for _, stream := range streams {
+			messages = append(messages, stream.Messages...)
+		}
+	}
+
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	// Only the highest value matters, so one monotonic write covers the whole batch
+	var highest int64
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+
+		counter, err := parseReplicatedCounter(message.Values)
+		if err != nil {
+			// Acknowledge malformed entries anyway; retrying them would never succeed
+			log.Printf("Warning: Skipping replication entry %s: %v", message.ID, err)
+			continue
+		}
+		highest = max(highest, counter)
+	}
+
+	if highest > 0 {
+		if err := rs.checkpointer.PersistHighWaterMark(ctx, highest); err != nil {
+			// Leave the batch pending; it is reclaimed once it has been idle long enough
+			return 0, err
+		}
+	}
+
+	if err := rs.client.XAck(ctx, rs.stream, rs.group, ids...).Err(); err != nil {
+		return 0, fmt.Errorf("failed to acknowledge entries: %w", err)
+	}
+	counterMetrics.Add("replicated_entries", int64(len(ids)))
+
+	if err := rs.trim(ctx, ids[len(ids)-1]); err != nil {
+		log.Printf("Warning: Failed to trim replication stream: %v", err)
+	}
+
+	return len(ids), nil
+}
+
+// trim removes entries every consumer has acknowledged. Anything older than the oldest
+// pending entry is acknowledged; with nothing pending, everything up to lastID is.
+func (rs *ReplicationService) trim(ctx context.Context, lastID string) error {
+	pending, err := rs.client.XPending(ctx, rs.stream, rs.group).Result()
+	if err != nil {
+		return err
+	}
+
+	minID := lastID
+	if pending.Count > 0 {
+		minID = pending.Lower
+	}
+
+	return rs.client.XTrimMinID(ctx, rs.stream, minID).Err()
+}
+
+// replicationLoop runs replication rounds until stopped, backing off after errors
 func (rs *ReplicationService) replicationLoop() {
-	ticker := time.NewTicker(5 * time.Second) // Replicate every 5 seconds
-	defer ticker.Stop()
+	defer close(rs.done)
+
+	for rs.ctx.Err() == nil {
+		_, err := rs.Replicate(rs.ctx)
+		if err == nil || rs.ctx.Err() != nil {
+			continue
+		}
 
-	for {
+		// The group disappears if the stream is deleted, for example by a Redis flush
+		if strings.Contains(err.Error(), "NOGROUP") {
+			if groupErr := rs.EnsureGroup(rs.ctx); groupErr == nil {
+				continue
+			}
+		}
+
+		log.Printf("Replication error: %v", err)
 		select {
 		case <-rs.ctx.Done():
-			return
-		case <-ticker.C:
-			if err := rs.counter.ReplicateToMongoDB(); err != nil {
-				log.Printf("Replication error: %v", err)
-			}
+		case <-time.After(5 * time.Second):
 		}
 	}
 }
+
+// parseReplicatedCounter extracts the counter field from a stream entry
+func parseReplicatedCounter(values map[string]interface{}) (int64, error) {
+	raw, ok := values["counter"]
+	if !ok {
+		return 0, fmt.Errorf("missing counter field")
+	}
+
+	value, ok := raw.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected counter type %T", raw)
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
@@ -1,29 +1,108 @@
 package services
 
 import (
+	"strings"
+
 	"url-shortener-api/models"
 )
 
+// ShortCodeFormat controls how counter values are turned into short codes
+type ShortCodeFormat struct {
+	// ScrambleKey enables the Feistel permutation of counter values when set
+	ScrambleKey string
+	// MinLength left-pads shorter codes with '0', which does not change their decoded value
+	MinLength int
+}
+
 // ShortCodeGenerator handles the generation of short codes using distributed counter
 type ShortCodeGenerator struct {
-	counter models.CounterService
-	encoder *Base62Encoder
+	counter   models.CounterService
+	encoder   *Base62Encoder
+	scrambler *FeistelScrambler // nil when codes are sequential
+	minLength int
 }
 
-// NewShortCodeGenerator creates a new instance of ShortCodeGenerator
+// NewShortCodeGenerator creates a new instance of ShortCodeGenerator producing sequential codes
 func NewShortCodeGenerator(counter models.CounterService) *ShortCodeGenerator {
-	return &ShortCodeGenerator{
-		counter: counter,
-		encoder: NewBase62Encoder(),
+	return NewFormattedShortCodeGenerator(counter, ShortCodeFormat{})
+}
+
+// NewFormattedShortCodeGenerator creates a new instance of ShortCodeGenerator using the given format
+func NewFormattedShortCodeGenerator(counter models.CounterService, format ShortCodeFormat) *ShortCodeGenerator {
+	generator := &ShortCodeGenerator{
+		counter:   counter,
+		encoder:   NewBase62Encoder(),
+		minLength: format.MinLength,
+	}
+	if format.ScrambleKey != "" {
+		generator.scrambler = NewFeistelScrambler(format.ScrambleKey)
 	}
+	return generator
 }
 
-// Generate creates a short code using the distributed counter and base62 encoding
-func (g *ShortCodeGenerator) Generate() (string, error) {
+// Generate creates a short code using the distributed counter and base62 encoding; the input is not used
+func (g *ShortCodeGenerator) Generate(input models.CodeInput) (string, error) {
 	counter, err := g.counter.GetNextCounter()
 	if err != nil {
 		return "", err
 	}
 
-	return g.encoder.Encode(counter), nil
+	return g.Encode(counter), nil
+}
+
+// GenerateBatch creates count short codes. Counters that lease blocks hand out all the values in a
+// single round trip; any other counter is asked once per code.
+func (g *ShortCodeGenerator) GenerateBatch(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+
+	if allocator, ok := g.counter.(models.CounterBlockAllocator); ok {
+		start, end, err := allocator.AllocateBlock(int64(count))
+		if err != nil {
+			return nil, err
+		}
+		for counter := start; counter <= end; counter++ {
+			codes = append(codes, g.Encode(counter))
+		}
+		return codes, nil
+	}
+
+	for len(codes) < count {
+		counter, err := g.counter.GetNextCounter()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, g.Encode(counter))
+	}
+	return codes, nil
+}
+
+// Encode turns a counter value into its short code
+func (g *ShortCodeGenerator) Encode(counter int64) string {
+	if g.scrambler != nil {
+		counter = g.scrambler.Scramble(counter)
+	}
+
+	code := g.encoder.Encode(counter)
+	if len(code) < g.minLength {
+		code = strings.Repeat("0", g.minLength-len(code)) + code
+	}
+	return code
+}
+
+// Decode recovers the counter value a short code was generated from
+func (g *ShortCodeGenerator) Decode(code string) (int64, error) {
+	value, err := g.encoder.Decode(code)
+	if err != nil {
+		return 0, err
+	}
+
+	if g.scrambler != nil {
+		value = g.scrambler.Unscramble(value)
+	}
+	return value, nil
+}
+
+// Sequential reports whether codes sort like the counter values they encode
+func (g *ShortCodeGenerator) Sequential() bool {
+	return g.scrambler == nil
 }
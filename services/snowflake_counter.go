@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxNodeID    = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+
+	// snowflakeMaxClockSkew is how far the clock may step back before generation fails instead of waiting
+	snowflakeMaxClockSkew = time.Second
+)
+
+// snowflakeEpoch is the zero point of the 41-bit millisecond timestamp, which lasts about 69 years
+var snowflakeEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeCounter implements models.CounterService without any shared state. Each value packs
+// a millisecond timestamp, a node ID unique to the instance and a per-millisecond sequence:
+//
+//	| 41 bits timestamp | 10 bits node ID | 12 bits sequence |
+//
+// Values from different nodes can never collide, and values from one node always increase.
+type SnowflakeCounter struct {
+	mu            sync.Mutex
+	nodeID        int64
+	now           func() time.Time
+	lastTimestamp int64
+	sequence      int64
+	last          int64
+}
+
+// NewSnowflakeCounter creates a new instance of SnowflakeCounter for a node ID between 0 and 1023
+func NewSnowflakeCounter(nodeID int64) (*SnowflakeCounter, error) {
+	return NewSnowflakeCounterWithClock(nodeID, time.Now)
+}
+
+// NewSnowflakeCounterWithClock creates a new instance of SnowflakeCounter reading time from now
+func NewSnowflakeCounterWithClock(nodeID int64, now func() time.Time) (*SnowflakeCounter, error) {
+	if nodeID < 0 || nodeID > snowflakeMaxNodeID {
+		return nil, fmt.Errorf("snowflake node ID must be between 0 and %d, got %d", snowflakeMaxNodeID, nodeID)
+	}
+
+	return &SnowflakeCounter{
+		nodeID: nodeID,
+		now:    now,
+	}, nil
+}
+
+// GetNextCounter returns the next value for this node. If the clock steps back by up to
+// snowflakeMaxClockSkew it waits for it to catch up, and beyond that it fails rather than
+// risk a duplicate. When the sequence of a millisecond is used up it waits for the next one.
+func (c *SnowflakeCounter) GetNextCounter() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timestamp := c.currentTimestamp()
+	if timestamp < c.lastTimestamp {
+		skew := time.Duration(c.lastTimestamp-timestamp) * time.Millisecond
+		if skew > snowflakeMaxClockSkew {
+			counterMetrics.Add("snowflake_clock_rejections", 1)
+			return 0, fmt.Errorf("%w: by %s", models.ErrClockMovedBackwards, skew)
+		}
+		counterMetrics.Add("snowflake_clock_waits", 1)
+		timestamp = c.waitFor(c.lastTimestamp)
+	}
+
+	if timestamp == c.lastTimestamp {
+		c.sequence = (c.sequence + 1) & snowflakeMaxSequence
+		if c.sequence == 0 {
+			counterMetrics.Add("snowflake_sequence_waits", 1)
+			timestamp = c.waitFor(c.lastTimestamp + 1)
+		}
+	} else {
+		c.sequence = 0
+	}
+
+	c.lastTimestamp = timestamp
+	c.last = timestamp<<(snowflakeNodeBits+snowflakeSequenceBits) | c.nodeID<<snowflakeSequenceBits | c.sequence
+	return c.last, nil
+}
+
+// GetCurrentCounter returns the last value handed out by this node
+func (c *SnowflakeCounter) GetCurrentCounter() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.last, nil
+}
+
+// InitializeCounter is a no-op; there is no shared state to prepare
+func (c *SnowflakeCounter) InitializeCounter() error {
+	return nil
+}
+
+// currentTimestamp returns milliseconds since snowflakeEpoch
+func (c *SnowflakeCounter) currentTimestamp() int64 {
+	return c.now().Sub(snowflakeEpoch).Milliseconds()
+}
+
+// waitFor blocks until the clock reaches target and returns the timestamp then; callers must hold the lock
+func (c *SnowflakeCounter) waitFor(target int64) int64 {
+	timestamp := c.currentTimestamp()
+	for timestamp < target {
+		time.Sleep(time.Duration(target-timestamp) * time.Millisecond)
+		timestamp = c.currentTimestamp()
+	}
+	return timestamp
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+// SQLClickStorage implements models.ClickEventRepository with the click_events table
+type SQLClickStorage struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLClickStorage creates a new instance of SQLClickStorage
+func NewSQLClickStorage(db *sql.DB, dialect string) *SQLClickStorage {
+	return &SQLClickStorage{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+// StoreClickEvents inserts a batch of events in one transaction
+func (s *SQLClickStorage) StoreClickEvents(events []models.ClickEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO click_events (short_code, clicked_at, referrer, user_agent, ip, accept_language,
+		referrer_host, browser, os, device, language, country, region, city, bot)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	statement, err := tx.PrepareContext(ctx, rebindSQL(s.dialect, query))
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for _, event := range events {
+		bot := 0
+		if event.Bot {
+			bot = 1
+		}
+
+		_, err := statement.ExecContext(ctx,
+			event.ShortCode,
+			event.Timestamp.UnixMilli(),
+			event.Referrer,
+			event.UserAgent,
+			event.IP,
+			event.AcceptLanguage,
+			event.ReferrerHost,
+			event.Browser,
+			event.OS,
+			event.Device,
+			event.Language,
+			event.Country,
+			event.Region,
+			event.City,
+			bot,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CountClicks returns the number of recorded clicks of each short code, without bots unless includeBots
+// is set; codes without clicks are omitted
+func (s *SQLClickStorage) CountClicks(shortCodes []string, includeBots bool) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	if len(shortCodes) == 0 {
+		return counts, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(shortCodes)), ", ")
+	args := make([]interface{}, len(shortCodes))
+	for i, shortCode := range shortCodes {
+		args[i] = shortCode
+	}
+
+	query := `SELECT short_code, COUNT(*) FROM click_events WHERE short_code IN (` + placeholders + `)` +
+		sqlBotFilter(includeBots) + ` GROUP BY short_code`
+	rows, err := s.db.QueryContext(ctx, rebindSQL(s.dialect, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shortCode string
+		var count int64
+		if err := rows.Scan(&shortCode, &count); err != nil {
+			return nil, err
+		}
+		counts[shortCode] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// sqlWeekOrigin is the first Monday after the Unix epoch in milliseconds; weekly buckets are counted
+// from it so they start on Mondays like on the other backends
+const sqlWeekOrigin = 4 * 24 * 60 * 60 * 1000
+
+// ClickStats summarizes the clicks of one short code in the query's range with one GROUP BY per
+// breakdown. Buckets are computed with integer arithmetic on clicked_at, which both dialects share.
+func (s *SQLClickStorage) ClickStats(query models.ClickStatsQuery) (*models.ClickStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	from, to := query.From.UnixMilli(), query.To.UnixMilli()
+	width := statsIntervals[query.Interval].Milliseconds()
+	origin := int64(0)
+	if query.Interval == models.StatsIntervalWeek {
+		origin = sqlWeekOrigin
+	}
+
+	stats := &models.ClickStats{Series: []models.ClickBucket{}}
+	rows, err := s.db.QueryContext(ctx, rebindSQL(s.dialect, `SELECT (clicked_at - ?) / ?, COUNT(*) FROM click_events
+		WHERE short_code = ? AND clicked_at >= ? AND clicked_at < ?`+sqlBotFilter(query.IncludeBots)+`
+		GROUP BY 1 ORDER BY 1`),
+		origin, width, query.ShortCode, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket, clicks int64
+		if err := rows.Scan(&bucket, &clicks); err != nil {
+			return nil, err
+		}
+		stats.TotalClicks += clicks
+		stats.Series = append(stats.Series, models.ClickBucket{
+			Start:  time.UnixMilli(origin + bucket*width).UTC(),
+			Clicks: clicks,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	breakdowns := []struct {
+		column string
+		counts *[]models.ClickCount
+	}{
+		{"referrer_host", &stats.Referrers},
+		{"browser", &stats.Browsers},
+		{"os", &stats.OperatingSystems},
+		{"device", &stats.Devices},
+		{"language", &stats.Languages},
+		{"country", &stats.Countries},
+	}
+	for _, breakdown := range breakdowns {
+		counts, err := s.countByColumn(ctx, breakdown.column, query)
+		if err != nil {
+			return nil, err
+		}
+		*breakdown.counts = counts
+	}
+
+	return stats, nil
+}
+
+// countByColumn returns the top values of a click_events column in the query's range
+func (s *SQLClickStorage) countByColumn(ctx context.Context, column string, query models.ClickStatsQuery) ([]models.ClickCount, error) {
+	statement := `SELECT ` + column + `, COUNT(*) FROM click_events
+		WHERE short_code = ? AND clicked_at >= ? AND clicked_at < ?` + sqlBotFilter(query.IncludeBots) + `
+		GROUP BY ` + column + ` ORDER BY COUNT(*) DESC, ` + column + ` LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, rebindSQL(s.dialect, statement),
+		query.ShortCode, query.From.UnixMilli(), query.To.UnixMilli(), query.Top)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []models.ClickCount{}
+	for rows.Next() {
+		var count models.ClickCount
+		if err := rows.Scan(&count.Value, &count.Clicks); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// sqlBotFilter returns the condition that leaves bots out, or nothing when they are included
+func sqlBotFilter(includeBots bool) string {
+	if includeBots {
+		return ""
+	}
+	return " AND bot = 0"
+}
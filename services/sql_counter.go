@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// sqlCounterName identifies the short code counter row in short_code_counters
+const sqlCounterName = "short_code_counter"
+
+// SQLCounter implements models.CounterService with a row in short_code_counters.
+// The increment and read happen in a single UPDATE ... RETURNING statement, so
+// concurrent instances sharing the database never receive the same value.
+type SQLCounter struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLCounter creates a new instance of SQLCounter
+func NewSQLCounter(db *sql.DB, dialect string) *SQLCounter {
+	return &SQLCounter{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+// GetNextCounter increments and returns the next counter value
+func (c *SQLCounter) GetNextCounter() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `UPDATE short_code_counters SET counter = counter + 1, updated_at = ? WHERE name = ? RETURNING counter`
+
+	var counter int64
+	err := c.db.QueryRowContext(ctx, rebindSQL(c.dialect, query), time.Now().UnixMilli(), sqlCounterName).Scan(&counter)
+	if err == sql.ErrNoRows {
+		if initErr := c.InitializeCounter(); initErr != nil {
+			return 0, initErr
+		}
+		return c.GetNextCounter()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment counter in SQL: %w", err)
+	}
+
+	return counter, nil
+}
+
+// GetCurrentCounter returns the current counter value
+func (c *SQLCounter) GetCurrentCounter() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var counter int64
+	err := c.db.QueryRowContext(ctx, rebindSQL(c.dialect, `SELECT counter FROM short_code_counters WHERE name = ?`), sqlCounterName).Scan(&counter)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get counter from SQL: %w", err)
+	}
+
+	return counter, nil
+}
+
+// InitializeCounter creates the counter row at zero if it does not exist yet
+func (c *SQLCounter) InitializeCounter() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO short_code_counters (name, counter, updated_at) VALUES (?, 0, ?) ON CONFLICT (name) DO NOTHING`
+	if _, err := c.db.ExecContext(ctx, rebindSQL(c.dialect, query), sqlCounterName, time.Now().UnixMilli()); err != nil {
+		return fmt.Errorf("failed to initialize counter in SQL: %w", err)
+	}
+
+	return nil
+}
+
+// AllocateBlock advances the counter by size in a single statement and returns the leased range
+func (c *SQLCounter) AllocateBlock(size int64) (int64, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `UPDATE short_code_counters SET counter = counter + ?, updated_at = ? WHERE name = ? RETURNING counter`
+
+	var end int64
+	err := c.db.QueryRowContext(ctx, rebindSQL(c.dialect, query), size, time.Now().UnixMilli(), sqlCounterName).Scan(&end)
+	if err == sql.ErrNoRows {
+		if initErr := c.InitializeCounter(); initErr != nil {
+			return 0, 0, initErr
+		}
+		return c.AllocateBlock(size)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to lease counter block in SQL: %w", err)
+	}
+
+	return end - size + 1, end, nil
+}
+
+// SeedCounter raises the counter to at least minimum; the conditional update never lowers it
+func (c *SQLCounter) SeedCounter(minimum int64) error {
+	if err := c.InitializeCounter(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `UPDATE short_code_counters SET counter = ?, updated_at = ? WHERE name = ? AND counter < ?`
+	if _, err := c.db.ExecContext(ctx, rebindSQL(c.dialect, query), minimum, time.Now().UnixMilli(), sqlCounterName, minimum); err != nil {
+		return fmt.Errorf("failed to seed counter in SQL: %w", err)
+	}
+
+	return nil
+}
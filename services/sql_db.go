@@ -0,0 +1,370 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"modernc.org/sqlite"
+)
+
+// Supported SQL dialects
+const (
+	SQLDialectPostgres = "postgres"
+	SQLDialectSQLite   = "sqlite"
+)
+
+// sqlMigration is a versioned schema change; statements run in order inside one transaction
+type sqlMigration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// sqlMigrations is the ordered schema history shared by PostgreSQL and SQLite.
+// Timestamps are stored as Unix milliseconds so both dialects compare them the same way.
+// Never edit an applied migration; append a new one instead.
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		name:    "create url_mappings and short_code_counters",
+		statements: []string{
+			`CREATE TABLE url_mappings (
+				id VARCHAR(24) PRIMARY KEY,
+				short_url VARCHAR(64) NOT NULL,
+				original_url TEXT NOT NULL,
+				alias VARCHAR(64),
+				expiration_timestamp BIGINT,
+				created_at BIGINT NOT NULL,
+				updated_at BIGINT NOT NULL,
+				user_id VARCHAR(255) NOT NULL DEFAULT '',
+				CONSTRAINT url_mappings_short_url_key UNIQUE (short_url)
+			)`,
+			// NULL aliases are distinct in both dialects, so this behaves like the sparse MongoDB index
+			`CREATE UNIQUE INDEX url_mappings_alias_key ON url_mappings (alias)`,
+			`CREATE INDEX url_mappings_user_id_idx ON url_mappings (user_id)`,
+			`CREATE INDEX url_mappings_expiration_idx ON url_mappings (expiration_timestamp)`,
+			`CREATE TABLE short_code_counters (
+				name VARCHAR(64) PRIMARY KEY,
+				counter BIGINT NOT NULL,
+				updated_at BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "add url_mappings.strategy",
+		statements: []string{
+			// Empty for aliases and for rows written before strategies existed
+			`ALTER TABLE url_mappings ADD COLUMN strategy VARCHAR(16) NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 3,
+		name:    "index url_mappings by user and creation time",
+		statements: []string{
+			`CREATE INDEX url_mappings_user_created_idx ON url_mappings (user_id, created_at, id)`,
+		},
+	},
+	{
+		version: 4,
+		name:    "add url_mappings.visibility",
+		statements: []string{
+			// Empty means public, like rows written before visibility existed
+			`ALTER TABLE url_mappings ADD COLUMN visibility VARCHAR(16) NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 5,
+		name:    "add url_mappings.deleted_at",
+		statements: []string{
+			`ALTER TABLE url_mappings ADD COLUMN deleted_at BIGINT`,
+			`CREATE INDEX url_mappings_deleted_idx ON url_mappings (deleted_at)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "add url_mappings.tags",
+		statements: []string{
+			// Comma-separated; empty when the link has no tags
+			`ALTER TABLE url_mappings ADD COLUMN tags TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 7,
+		name:    "create import_jobs and import_rows",
+		statements: []string{
+			`CREATE TABLE import_jobs (
+				id VARCHAR(24) PRIMARY KEY,
+				user_id VARCHAR(255) NOT NULL,
+				format VARCHAR(16) NOT NULL,
+				status VARCHAR(16) NOT NULL,
+				total_rows INTEGER NOT NULL,
+				processed_rows INTEGER NOT NULL,
+				created_rows INTEGER NOT NULL,
+				failed_rows INTEGER NOT NULL,
+				errors TEXT NOT NULL,
+				row_cursor INTEGER NOT NULL,
+				lease_owner VARCHAR(255) NOT NULL DEFAULT '',
+				lease_until BIGINT NOT NULL DEFAULT 0,
+				created_at BIGINT NOT NULL,
+				updated_at BIGINT NOT NULL,
+				completed_at BIGINT
+			)`,
+			`CREATE INDEX import_jobs_status_idx ON import_jobs (status, created_at)`,
+			// data holds the JSON-encoded models.ImportRow
+			`CREATE TABLE import_rows (
+				job_id VARCHAR(24) NOT NULL,
+				row_num INTEGER NOT NULL,
+				data TEXT NOT NULL,
+				PRIMARY KEY (job_id, row_num)
+			)`,
+		},
+	},
+	{
+		version: 8,
+		name:    "create click_events",
+		statements: []string{
+			`CREATE TABLE click_events (
+				short_code VARCHAR(64) NOT NULL,
+				clicked_at BIGINT NOT NULL,
+				referrer TEXT NOT NULL DEFAULT '',
+				user_agent TEXT NOT NULL DEFAULT '',
+				ip VARCHAR(64) NOT NULL DEFAULT '',
+				accept_language TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX click_events_short_code_idx ON click_events (short_code, clicked_at)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "add click_events breakdown columns",
+		statements: []string{
+			// Derived from the headers when the event is stored; empty when unknown
+			`ALTER TABLE click_events ADD COLUMN referrer_host VARCHAR(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE click_events ADD COLUMN browser VARCHAR(32) NOT NULL DEFAULT ''`,
+			`ALTER TABLE click_events ADD COLUMN os VARCHAR(32) NOT NULL DEFAULT ''`,
+			`ALTER TABLE click_events ADD COLUMN device VARCHAR(16) NOT NULL DEFAULT ''`,
+			`ALTER TABLE click_events ADD COLUMN language VARCHAR(64) NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 10,
+		name:    "add click_events location columns",
+		statements: []string{
+			// Looked up in the GeoIP database when one is configured; empty otherwise
+			`ALTER TABLE click_events ADD COLUMN country VARCHAR(2) NOT NULL DEFAULT ''`,
+			`ALTER TABLE click_events ADD COLUMN region VARCHAR(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE click_events ADD COLUMN city VARCHAR(255) NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 11,
+		name:    "add click_events.bot",
+		statements: []string{
+			// 1 for clicks by automated clients; clicks stored before classification count as people
+			`ALTER TABLE click_events ADD COLUMN bot SMALLINT NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		version: 12,
+		name:    "add url_mappings.counter_value",
+		statements: []string{
+			// The counter value of a counter code, 0 for other codes; NULL until counter recovery
+			// backfills the codes stored before the column existed
+			`ALTER TABLE url_mappings ADD COLUMN counter_value BIGINT`,
+			`CREATE INDEX url_mappings_counter_value_idx ON url_mappings (counter_value)`,
+		},
+	},
+	{
+		version: 13,
+		name:    "add import_rows.short_code",
+		statements: []string{
+			// Set once the row's link is created, so a resumed job skips the row
+			`ALTER TABLE import_rows ADD COLUMN short_code VARCHAR(255) NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 14,
+		name:    "add url_mappings.renamed_to",
+		statements: []string{
+			// The code a link was renamed to, set on the row that keeps its old code
+			`ALTER TABLE url_mappings ADD COLUMN renamed_to VARCHAR(255) NOT NULL DEFAULT ''`,
+		},
+	},
+}
+
+// sqliteRegexp caches the last compiled pattern, since SQLite calls regexp once per row
+var sqliteRegexp struct {
+	mu       sync.Mutex
+	compiled *regexp.Regexp
+}
+
+func init() {
+	// Backs "x REGEXP y" in SQLite, which calls regexp(y, x); Go's syntax matches destinationDomainPattern
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		pattern, _ := args[0].(string)
+		value, _ := args[1].(string)
+
+		sqliteRegexp.mu.Lock()
+		defer sqliteRegexp.mu.Unlock()
+		if sqliteRegexp.compiled == nil || sqliteRegexp.compiled.String() != pattern {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			sqliteRegexp.compiled = compiled
+		}
+		return sqliteRegexp.compiled.MatchString(value), nil
+	})
+}
+
+// OpenSQLDB opens a database for the given dialect and applies pending migrations
+func OpenSQLDB(dialect string, dsn string) (*sql.DB, error) {
+	var driverName string
+	switch dialect {
+	case SQLDialectPostgres:
+		driverName = "pgx"
+	case SQLDialectSQLite:
+		driverName = "sqlite"
+	default:
+		return nil, fmt.Errorf("unsupported SQL dialect %q", dialect)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if dialect == SQLDialectSQLite {
+		// SQLite allows a single writer; serializing connections avoids SQLITE_BUSY under load
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := MigrateSQL(db, dialect); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	return db, nil
+}
+
+// sqlMigrationLockKey identifies the PostgreSQL advisory lock held while migrating
+const sqlMigrationLockKey = 7140155237364113451
+
+// MigrateSQL applies every migration newer than the version recorded in schema_migrations. On
+// PostgreSQL it holds an advisory lock throughout, so instances starting together take turns and
+// each one reads the version only once the previous one is done.
+func MigrateSQL(db *sql.DB, dialect string) error {
+	ctx := context.Background()
+
+	// One connection for everything, since an advisory lock belongs to the session that took it
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if dialect == SQLDialectPostgres {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, int64(sqlMigrationLockKey)); err != nil {
+			return fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+		defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, int64(sqlMigrationLockKey))
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for _, migration := range sqlMigrations {
+		if migration.version <= current {
+			continue
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, statement := range migration.statements {
+			if _, err := tx.Exec(statement); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s): %w", migration.version, migration.name, err)
+			}
+		}
+
+		_, err = tx.Exec(
+			rebindSQL(dialect, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+			migration.version, migration.name, time.Now().UnixMilli(),
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebindSQL rewrites ? placeholders into the dialect's bind syntax
+func rebindSQL(dialect string, query string) string {
+	if dialect != SQLDialectPostgres {
+		return query
+	}
+
+	var result strings.Builder
+	position := 0
+	for _, char := range query {
+		if char == '?' {
+			position++
+			result.WriteString("$" + strconv.Itoa(position))
+			continue
+		}
+		result.WriteRune(char)
+	}
+	return result.String()
+}
+
+// isSQLUniqueViolation reports whether err is a unique violation on the given column
+func isSQLUniqueViolation(err error, column string) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505" && strings.Contains(pgErr.ConstraintName, column)
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return strings.Contains(sqliteErr.Error(), "UNIQUE constraint failed") &&
+			strings.Contains(sqliteErr.Error(), "."+column)
+	}
+
+	return false
+}
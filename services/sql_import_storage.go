@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+// sqlImportJobColumns is the column list every import job query selects, in scan order
+const sqlImportJobColumns = `id, user_id, format, status, total_rows, processed_rows, created_rows, failed_rows, errors, row_cursor, lease_owner, lease_until, created_at, updated_at, completed_at`
+
+// SQLImportStorage implements models.ImportJobRepository with the import_jobs and import_rows tables
+type SQLImportStorage struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLImportStorage creates a new instance of SQLImportStorage
+func NewSQLImportStorage(db *sql.DB, dialect string) *SQLImportStorage {
+	return &SQLImportStorage{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+// CreateImportJob stores a new job together with its rows in one transaction
+func (s *SQLImportStorage) CreateImportJob(job models.ImportJob, rows []models.ImportRow) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	errorsJSON, err := json.Marshal(job.Errors)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO import_jobs (` + sqlImportJobColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, rebindSQL(s.dialect, query),
+		job.ID,
+		job.UserID,
+		job.Format,
+		job.Status,
+		job.TotalRows,
+		job.ProcessedRows,
+		job.Created,
+		job.Failed,
+		string(errorsJSON),
+		job.Cursor,
+		job.LeaseOwner,
+		leaseMillis(job.LeaseUntil),
+		job.CreatedAt.UnixMilli(),
+		job.UpdatedAt.UnixMilli(),
+		nullableMillis(job.CompletedAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	statement, err := tx.PrepareContext(ctx, rebindSQL(s.dialect, `INSERT INTO import_rows (job_id, row_num, data) VALUES (?, ?, ?)`))
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for _, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if _, err := statement.ExecContext(ctx, job.ID, row.Row, string(data)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetImportJob retrieves a job by ID
+func (s *SQLImportStorage) GetImportJob(id string) (models.ImportJob, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + sqlImportJobColumns + ` FROM import_jobs WHERE id = ?`
+	job, err := scanSQLImportJob(s.db.QueryRowContext(ctx, rebindSQL(s.dialect, query), id))
+	if err == sql.ErrNoRows {
+		return job, false, nil
+	}
+	if err != nil {
+		return job, false, err
+	}
+
+	return job, true, nil
+}
+
+// ListUnfinishedImportJobs returns every job that still has rows to process, oldest first
+func (s *SQLImportStorage) ListUnfinishedImportJobs() ([]models.ImportJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + sqlImportJobColumns + ` FROM import_jobs WHERE status <> ? ORDER BY created_at, id`
+	rows, err := s.db.QueryContext(ctx, rebindSQL(s.dialect, query), models.ImportStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.ImportJob
+	for rows.Next() {
+		job, err := scanSQLImportJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// ClaimImportJob hands an unfinished job to owner until the given time, unless another owner's lease
+// is still running. The check and the update are one statement, so only one instance wins.
+func (s *SQLImportStorage) ClaimImportJob(id string, owner string, until time.Time) (models.ImportJob, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `UPDATE import_jobs SET status = ?, lease_owner = ?, lease_until = ?
+		WHERE id = ? AND status <> ? AND (lease_owner = ? OR lease_until < ?)`
+	result, err := s.db.ExecContext(ctx, rebindSQL(s.dialect, query),
+		models.ImportStatusRunning, owner, until.UnixMilli(),
+		id, models.ImportStatusCompleted, owner, time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return models.ImportJob{}, false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return models.ImportJob{}, false, err
+	}
+
+	return s.GetImportJob(id)
+}
+
+// SaveImportJob saves the progress of a job and appends newErrors to its errors, but only while
+// job.LeaseOwner still holds its lease. The errors column is only rewritten when there are new errors.
+func (s *SQLImportStorage) SaveImportJob(job models.ImportJob, newErrors []models.ImportRowError) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE import_jobs SET status = ?, processed_rows = ?, created_rows = ?, failed_rows = ?,
+		row_cursor = ?, lease_until = ?, updated_at = ?, completed_at = ?
+		WHERE id = ? AND lease_owner = ?`
+	result, err := tx.ExecContext(ctx, rebindSQL(s.dialect, query),
+		job.Status,
+		job.ProcessedRows,
+		job.Created,
+		job.Failed,
+		job.Cursor,
+		leaseMillis(job.LeaseUntil),
+		job.UpdatedAt.UnixMilli(),
+		nullableMillis(job.CompletedAt),
+		job.ID,
+		job.LeaseOwner,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+
+	if len(newErrors) > 0 {
+		var errorsJSON string
+		err := tx.QueryRowContext(ctx, rebindSQL(s.dialect, `SELECT errors FROM import_jobs WHERE id = ?`), job.ID).Scan(&errorsJSON)
+		if err != nil {
+			return false, err
+		}
+		var stored []models.ImportRowError
+		if err := json.Unmarshal([]byte(errorsJSON), &stored); err != nil {
+			return false, err
+		}
+
+		data, err := json.Marshal(appendImportErrors(stored, newErrors))
+		if err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx, rebindSQL(s.dialect, `UPDATE import_jobs SET errors = ? WHERE id = ?`), string(data), job.ID); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetImportRows returns up to limit rows of a job that come after the given Row
+func (s *SQLImportStorage) GetImportRows(jobID string, after int, limit int) ([]models.ImportRow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `SELECT data, short_code FROM import_rows WHERE job_id = ? AND row_num > ? ORDER BY row_num LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, rebindSQL(s.dialect, query), jobID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.ImportRow
+	for rows.Next() {
+		var data, shortCode string
+		if err := rows.Scan(&data, &shortCode); err != nil {
+			return nil, err
+		}
+
+		var row models.ImportRow
+		if err := json.Unmarshal([]byte(data), &row); err != nil {
+			return nil, err
+		}
+		row.ShortCode = shortCode
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
+
+// SetImportRowShortCode records the short code created for a row
+func (s *SQLImportStorage) SetImportRowShortCode(jobID string, row int, shortCode string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `UPDATE import_rows SET short_code = ? WHERE job_id = ? AND row_num = ?`
+	_, err := s.db.ExecContext(ctx, rebindSQL(s.dialect, query), shortCode, jobID, row)
+	return err
+}
+
+// DeleteImportRows removes the rows of a job once they are no longer needed
+func (s *SQLImportStorage) DeleteImportRows(jobID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, rebindSQL(s.dialect, `DELETE FROM import_rows WHERE job_id = ?`), jobID)
+	return err
+}
+
+// scanSQLImportJob reads the columns of sqlImportJobColumns into an ImportJob
+func scanSQLImportJob(scanner sqlScanner) (models.ImportJob, error) {
+	var job models.ImportJob
+	var errorsJSON string
+	var leaseUntil, createdAt, updatedAt int64
+	var completedAt sql.NullInt64
+
+	err := scanner.Scan(&job.ID, &job.UserID, &job.Format, &job.Status, &job.TotalRows, &job.ProcessedRows, &job.Created, &job.Failed, &errorsJSON, &job.Cursor, &job.LeaseOwner, &leaseUntil, &createdAt, &updatedAt, &completedAt)
+	if err != nil {
+		return job, err
+	}
+
+	if err := json.Unmarshal([]byte(errorsJSON), &job.Errors); err != nil {
+		return job, err
+	}
+	if leaseUntil != 0 {
+		job.LeaseUntil = time.UnixMilli(leaseUntil)
+	}
+	if completedAt.Valid {
+		completedTime := time.UnixMilli(completedAt.Int64)
+		job.CompletedAt = &completedTime
+	}
+	job.CreatedAt = time.UnixMilli(createdAt)
+	job.UpdatedAt = time.UnixMilli(updatedAt)
+
+	return job, nil
+}
+
+// leaseMillis stores a released lease, the zero time, as 0
+func leaseMillis(until time.Time) int64 {
+	if until.IsZero() {
+		return 0
+	}
+	return until.UnixMilli()
+}
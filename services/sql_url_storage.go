@@ -0,0 +1,575 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"url-shortener-api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sqlMappingColumns is the column list every mapping query selects, in scan order
+const sqlMappingColumns = `id, short_url, original_url, alias, expiration_timestamp, created_at, updated_at, user_id, strategy, visibility, deleted_at, tags, counter_value, renamed_to`
+
+// SQLURLStorage handles URL mapping storage operations with a SQL database
+type SQLURLStorage struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLURLStorage creates a new instance of SQLURLStorage
+func NewSQLURLStorage(db *sql.DB, dialect string) *SQLURLStorage {
+	return &SQLURLStorage{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+// Store inserts a new URL mapping into the database, failing with ErrAliasAlreadyExists if the
+// short code or alias is taken
+func (s *SQLURLStorage) Store(shortCode string, mapping models.URLMapping) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	mapping.ShortURL = shortCode
+	mapping.CreatedAt = now
+	mapping.UpdatedAt = now
+	return s.insert(ctx, s.db, mapping)
+}
+
+// insert writes a new row for mapping under its ShortURL, failing with ErrAliasAlreadyExists if the
+// short code or alias is taken
+func (s *SQLURLStorage) insert(ctx context.Context, execer sqlExecer, mapping models.URLMapping) error {
+	query := `INSERT INTO url_mappings (` + sqlMappingColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := execer.ExecContext(ctx, rebindSQL(s.dialect, query),
+		primitive.NewObjectID().Hex(),
+		mapping.ShortURL,
+		mapping.OriginalURL,
+		nullableAlias(mapping.Alias),
+		nullableMillis(mapping.ExpirationTimestamp),
+		mapping.CreatedAt.UnixMilli(),
+		mapping.UpdatedAt.UnixMilli(),
+		mapping.UserID,
+		mapping.Strategy,
+		mapping.Visibility,
+		nullableMillis(mapping.DeletedAt),
+		joinSQLTags(mapping.Tags),
+		nullableCounter(mapping),
+		mapping.RenamedTo,
+	)
+	if isSQLUniqueViolation(err, "alias") || isSQLUniqueViolation(err, "short_url") {
+		return models.ErrAliasAlreadyExists
+	}
+	return err
+}
+
+// StoreMany inserts mappings under their ShortURL in one transaction, failing each one whose short
+// code or alias is taken with ErrAliasAlreadyExists. ON CONFLICT DO NOTHING keeps a conflict from
+// aborting the transaction in PostgreSQL. When atomic, a single conflict rolls back the batch.
+func (s *SQLURLStorage) StoreMany(mappings []models.URLMapping, atomic bool) ([]error, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO url_mappings (` + sqlMappingColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`
+	statement, err := tx.PrepareContext(ctx, rebindSQL(s.dialect, query))
+	if err != nil {
+		return nil, err
+	}
+	defer statement.Close()
+
+	now := time.Now()
+	errs := make([]error, len(mappings))
+	conflicts := false
+	for i, mapping := range mappings {
+		result, err := statement.ExecContext(ctx,
+			primitive.NewObjectID().Hex(),
+			mapping.ShortURL,
+			mapping.OriginalURL,
+			nullableAlias(mapping.Alias),
+			nullableMillis(mapping.ExpirationTimestamp),
+			now.UnixMilli(),
+			now.UnixMilli(),
+			mapping.UserID,
+			mapping.Strategy,
+			mapping.Visibility,
+			nullableMillis(mapping.DeletedAt),
+			joinSQLTags(mapping.Tags),
+			nullableCounter(mapping),
+			mapping.RenamedTo,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if inserted == 0 {
+			errs[i] = models.ErrAliasAlreadyExists
+			conflicts = true
+		}
+	}
+
+	if atomic && conflicts {
+		return errs, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+// Get retrieves a URL mapping by short code from the database
+func (s *SQLURLStorage) Get(shortCode string) (models.URLMapping, bool, error) {
+	return s.getOne(`SELECT `+sqlMappingColumns+` FROM url_mappings WHERE short_url = ?`, shortCode)
+}
+
+// Exists checks if a short code already exists in the database
+func (s *SQLURLStorage) Exists(shortCode string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var one int
+	err := s.db.QueryRowContext(ctx, rebindSQL(s.dialect, `SELECT 1 FROM url_mappings WHERE short_url = ?`), shortCode).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Delete removes a URL mapping from the database
+func (s *SQLURLStorage) Delete(shortCode string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, rebindSQL(s.dialect, `DELETE FROM url_mappings WHERE short_url = ?`), shortCode)
+	return err
+}
+
+// IsExpired checks if a URL mapping has expired
+func (s *SQLURLStorage) IsExpired(mapping models.URLMapping) bool {
+	return mapping.IsExpired()
+}
+
+// GetByAlias retrieves a URL mapping by alias from the database
+func (s *SQLURLStorage) GetByAlias(alias string) (models.URLMapping, bool, error) {
+	return s.getOne(`SELECT `+sqlMappingColumns+` FROM url_mappings WHERE alias = ?`, alias)
+}
+
+// GetByUserID retrieves all URL mappings for a specific user, oldest first
+func (s *SQLURLStorage) GetByUserID(userID string) ([]models.URLMapping, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + sqlMappingColumns + ` FROM url_mappings WHERE user_id = ? ORDER BY created_at, id`
+	rows, err := s.db.QueryContext(ctx, rebindSQL(s.dialect, query), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []models.URLMapping
+	for rows.Next() {
+		mapping, err := scanSQLMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, rows.Err()
+}
+
+// ListByUserID returns up to query.Limit of the user's mappings that match the query, in its order.
+// Pages are read with a range on the (user_id, created_at, id) index, never with OFFSET.
+func (s *SQLURLStorage) ListByUserID(query models.URLListQuery) ([]models.URLMapping, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	direction, after := "DESC", "<"
+	if query.Ascending {
+		direction, after = "ASC", ">"
+	}
+
+	conditions := []string{`user_id = ?`}
+	args := []interface{}{query.UserID}
+
+	if query.After != nil {
+		createdAt := query.After.CreatedAt.UnixMilli()
+		conditions = append(conditions, `(created_at `+after+` ? OR (created_at = ? AND id `+after+` ?))`)
+		args = append(args, createdAt, createdAt, query.After.ID.Hex())
+	}
+
+	if query.Status == models.LinkStatusDeleted {
+		conditions = append(conditions, `deleted_at IS NOT NULL`)
+	} else {
+		conditions = append(conditions, `deleted_at IS NULL`)
+	}
+
+	now := time.Now().UnixMilli()
+	switch query.Status {
+	case models.LinkStatusActive:
+		conditions = append(conditions, `(expiration_timestamp IS NULL OR expiration_timestamp >= ?)`)
+		args = append(args, now)
+	case models.LinkStatusExpired:
+		conditions = append(conditions, `expiration_timestamp < ?`)
+		args = append(args, now)
+	}
+
+	if query.AliasOnly {
+		conditions = append(conditions, `alias IS NOT NULL`)
+	}
+	if query.Domain != "" {
+		// SQLite has no built-in REGEXP operator; OpenSQLDB registers the function behind it
+		operator := `REGEXP`
+		if s.dialect == SQLDialectPostgres {
+			operator = `~`
+		}
+		conditions = append(conditions, `original_url `+operator+` ?`)
+		args = append(args, destinationDomainPattern(query.Domain))
+	}
+
+	sqlQuery := `SELECT ` + sqlMappingColumns + ` FROM url_mappings WHERE ` + strings.Join(conditions, ` AND `) +
+		` ORDER BY created_at ` + direction + `, id ` + direction + ` LIMIT ?`
+	args = append(args, query.Limit)
+
+	rows, err := s.db.QueryContext(ctx, rebindSQL(s.dialect, sqlQuery), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mappings := make([]models.URLMapping, 0, query.Limit)
+	for rows.Next() {
+		mapping, err := scanSQLMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, rows.Err()
+}
+
+// Update updates an existing URL mapping
+func (s *SQLURLStorage) Update(shortCode string, mapping models.URLMapping) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `UPDATE url_mappings SET
+			original_url = ?,
+			alias = ?,
+			expiration_timestamp = ?,
+			created_at = ?,
+			updated_at = ?,
+			user_id = ?,
+			strategy = ?,
+			visibility = ?,
+			deleted_at = ?,
+			tags = ?
+		WHERE short_url = ?`
+
+	_, err := s.db.ExecContext(ctx, rebindSQL(s.dialect, query),
+		mapping.OriginalURL,
+		nullableAlias(mapping.Alias),
+		nullableMillis(mapping.ExpirationTimestamp),
+		mapping.CreatedAt.UnixMilli(),
+		time.Now().UnixMilli(),
+		mapping.UserID,
+		mapping.Strategy,
+		mapping.Visibility,
+		nullableMillis(mapping.DeletedAt),
+		joinSQLTags(mapping.Tags),
+		shortCode,
+	)
+	if isSQLUniqueViolation(err, "alias") {
+		return models.ErrAliasAlreadyExists
+	}
+	return err
+}
+
+// ReplaceIfUnchanged replaces the mapping stored under shortCode, moving it to mapping.ShortURL and leaving
+// a renamedRedirect under the old code when that differs, only if it was last updated at lastUpdatedAt.
+// It reports false if the mapping is gone or changed.
+func (s *SQLURLStorage) ReplaceIfUnchanged(shortCode string, lastUpdatedAt time.Time, mapping models.URLMapping) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if mapping.ShortURL == "" {
+		mapping.ShortURL = shortCode
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// The old code's alias and counter value carry over to the redirect left under it
+	var existing models.URLMapping
+	if mapping.ShortURL != shortCode {
+		query := `SELECT ` + sqlMappingColumns + ` FROM url_mappings WHERE short_url = ? AND updated_at = ?`
+		existing, err = scanSQLMapping(tx.QueryRowContext(ctx, rebindSQL(s.dialect, query), shortCode, lastUpdatedAt.UnixMilli()))
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	query := `UPDATE url_mappings SET
+			short_url = ?,
+			original_url = ?,
+			alias = ?,
+			expiration_timestamp = ?,
+			updated_at = ?,
+			strategy = ?,
+			visibility = ?,
+			deleted_at = ?,
+			tags = ?
+		WHERE short_url = ? AND updated_at = ?`
+
+	result, err := tx.ExecContext(ctx, rebindSQL(s.dialect, query),
+		mapping.ShortURL,
+		mapping.OriginalURL,
+		nullableAlias(mapping.Alias),
+		nullableMillis(mapping.ExpirationTimestamp),
+		mapping.UpdatedAt.UnixMilli(),
+		mapping.Strategy,
+		mapping.Visibility,
+		nullableMillis(mapping.DeletedAt),
+		joinSQLTags(mapping.Tags),
+		shortCode,
+		lastUpdatedAt.UnixMilli(),
+	)
+	if isSQLUniqueViolation(err, "alias") || isSQLUniqueViolation(err, "short_url") {
+		return false, models.ErrAliasAlreadyExists
+	}
+	if err != nil {
+		return false, err
+	}
+
+	replaced, err := result.RowsAffected()
+	if err != nil || replaced != 1 {
+		return false, err
+	}
+	if mapping.ShortURL != shortCode {
+		if err := s.insert(ctx, tx, renamedRedirect(existing, mapping)); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteExpired removes every mapping whose expiration timestamp is before the given time,
+// standing in for the MongoDB TTL index
+func (s *SQLURLStorage) DeleteExpired(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM url_mappings WHERE expiration_timestamp IS NOT NULL AND expiration_timestamp < ?`
+	result, err := s.db.ExecContext(ctx, rebindSQL(s.dialect, query), before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// PurgeDeleted removes every mapping deleted before the given time
+func (s *SQLURLStorage) PurgeDeleted(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM url_mappings WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	result, err := s.db.ExecContext(ctx, rebindSQL(s.dialect, query), before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// ScanByUserID calls fn for every mapping of the user that is not deleted, oldest first, until fn
+// returns false
+func (s *SQLURLStorage) ScanByUserID(userID string, fn func(mapping models.URLMapping) (bool, error)) error {
+	return scanByUserIDInPages(s.ListByUserID, userID, fn)
+}
+
+// BackfillCounters sets the counter value of mappings stored without one, such as those written
+// before the column existed. Codes that are not counter codes get 0.
+func (s *SQLURLStorage) BackfillCounters(counterOf func(mapping models.URLMapping) int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+sqlMappingColumns+` FROM url_mappings WHERE counter_value IS NULL`)
+	if err != nil {
+		return err
+	}
+	var backfilled []models.URLMapping
+	for rows.Next() {
+		mapping, err := scanSQLMapping(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if mapping.IsCounterGenerated() {
+			mapping.Counter = counterOf(mapping)
+		}
+		backfilled = append(backfilled, mapping)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(backfilled) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statement, err := tx.PrepareContext(ctx, rebindSQL(s.dialect, `UPDATE url_mappings SET counter_value = ? WHERE short_url = ?`))
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for _, mapping := range backfilled {
+		if _, err := statement.ExecContext(ctx, mapping.Counter, mapping.ShortURL); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// HighestCounter returns the largest counter value stored, or 0 when there is none
+func (s *SQLURLStorage) HighestCounter() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var highest int64
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(counter_value), 0) FROM url_mappings`).Scan(&highest)
+	return highest, err
+}
+
+// getOne runs a query expected to match at most one mapping
+func (s *SQLURLStorage) getOne(query string, args ...interface{}) (models.URLMapping, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mapping, err := scanSQLMapping(s.db.QueryRowContext(ctx, rebindSQL(s.dialect, query), args...))
+	if err == sql.ErrNoRows {
+		return mapping, false, nil
+	}
+	if err != nil {
+		return mapping, false, err
+	}
+
+	return mapping, true, nil
+}
+
+// sqlScanner is satisfied by both *sql.Row and *sql.Rows
+type sqlScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// scanSQLMapping reads the columns of sqlMappingColumns into a URLMapping
+func scanSQLMapping(scanner sqlScanner) (models.URLMapping, error) {
+	var mapping models.URLMapping
+	var id string
+	var alias sql.NullString
+	var expiration, deletedAt, counter sql.NullInt64
+	var createdAt, updatedAt int64
+	var tags string
+
+	err := scanner.Scan(&id, &mapping.ShortURL, &mapping.OriginalURL, &alias, &expiration, &createdAt, &updatedAt, &mapping.UserID, &mapping.Strategy, &mapping.Visibility, &deletedAt, &tags, &counter, &mapping.RenamedTo)
+	if err != nil {
+		return mapping, err
+	}
+
+	if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+		mapping.ID = objectID
+	}
+	mapping.Alias = alias.String
+	if expiration.Valid {
+		expirationTime := time.UnixMilli(expiration.Int64)
+		mapping.ExpirationTimestamp = &expirationTime
+	}
+	if deletedAt.Valid {
+		deletedTime := time.UnixMilli(deletedAt.Int64)
+		mapping.DeletedAt = &deletedTime
+	}
+	if tags != "" {
+		mapping.Tags = strings.Split(tags, ",")
+	}
+	mapping.Counter = counter.Int64
+	mapping.CreatedAt = time.UnixMilli(createdAt)
+	mapping.UpdatedAt = time.UnixMilli(updatedAt)
+
+	return mapping, nil
+}
+
+// nullableAlias maps an empty alias to NULL so the unique index ignores it
+func nullableAlias(alias string) interface{} {
+	if alias == "" {
+		return nil
+	}
+	return alias
+}
+
+// nullableCounter maps the counter value of a counter code stored without one to NULL, which
+// counter recovery backfills
+func nullableCounter(mapping models.URLMapping) interface{} {
+	if mapping.Counter == 0 && mapping.IsCounterGenerated() {
+		return nil
+	}
+	return mapping.Counter
+}
+
+// nullableMillis maps an optional timestamp to Unix milliseconds or NULL
+func nullableMillis(timestamp *time.Time) interface{} {
+	if timestamp == nil {
+		return nil
+	}
+	return timestamp.UnixMilli()
+}
+
+// joinSQLTags stores tags as one comma-separated column; validated tags never contain commas
+func joinSQLTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+// ttlCache is implemented by caches that can report how long a value has left to live
+type ttlCache interface {
+	GetWithTTL(ctx context.Context, key string) (string, time.Duration, error)
+}
+
+// CacheTierStats holds the hit and miss counters of one cache tier
+type CacheTierStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// TieredCacheStats holds the counters of both tiers of a TieredCache
+type TieredCacheStats struct {
+	Local  CacheTierStats `json:"local"`
+	Remote CacheTierStats `json:"remote"`
+}
+
+// TieredCache is a two-level models.Cache: a size-bounded in-process LRU in front of a shared
+// remote cache such as Redis. Local entries never outlive the remote TTL (and therefore the
+// mapping's ExpirationTimestamp), and are further capped by localTTL to bound staleness.
+// Deletes are announced through the invalidator so other instances evict their local copy.
+type TieredCache struct {
+	local       *LRUCache
+	remote      models.Cache
+	localTTL    time.Duration
+	invalidator cacheInvalidator
+
+	localHits    atomic.Int64
+	localMisses  atomic.Int64
+	remoteHits   atomic.Int64
+	remoteMisses atomic.Int64
+}
+
+// NewTieredCache creates a new instance of TieredCache; invalidator may be nil for a single instance
+func NewTieredCache(local *LRUCache, remote models.Cache, localTTL time.Duration, invalidator cacheInvalidator) *TieredCache {
+	return &TieredCache{
+		local:       local,
+		remote:      remote,
+		localTTL:    localTTL,
+		invalidator: invalidator,
+	}
+}
+
+// Get retrieves a value from the local tier, falling back to the remote tier and promoting hits
+func (c *TieredCache) Get(ctx context.Context, key string) (string, error) {
+	if value, err := c.local.Get(ctx, key); err == nil {
+		c.localHits.Add(1)
+		cacheMetrics.Add("local_hits", 1)
+		return value, nil
+	}
+	c.localMisses.Add(1)
+	cacheMetrics.Add("local_misses", 1)
+
+	var value string
+	var ttl time.Duration
+	var err error
+	if remote, ok := c.remote.(ttlCache); ok {
+		value, ttl, err = remote.GetWithTTL(ctx, key)
+	} else {
+		value, err = c.remote.Get(ctx, key)
+		ttl = c.localTTL
+	}
+	if err != nil {
+		c.remoteMisses.Add(1)
+		cacheMetrics.Add("remote_misses", 1)
+		return "", err
+	}
+	c.remoteHits.Add(1)
+	cacheMetrics.Add("remote_hits", 1)
+
+	c.local.Set(ctx, key, value, c.capTTL(ttl))
+	return value, nil
+}
+
+// Set writes a value through to both tiers
+func (c *TieredCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	if err := c.remote.Set(ctx, key, value, ttl); err != nil {
+		// Never serve locally what the shared tier does not have
+		c.local.Delete(ctx, key)
+		return err
+	}
+	return c.local.Set(ctx, key, value, c.capTTL(ttl))
+}
+
+// Delete removes a key from both tiers and tells other instances to evict it
+func (c *TieredCache) Delete(ctx context.Context, key string) error {
+	c.local.Delete(ctx, key)
+	if err := c.remote.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	if c.invalidator != nil {
+		return c.invalidator.Publish(ctx, key)
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the per-tier hit and miss counters
+func (c *TieredCache) Stats() TieredCacheStats {
+	return TieredCacheStats{
+		Local: CacheTierStats{
+			Hits:   c.localHits.Load(),
+			Misses: c.localMisses.Load(),
+		},
+		Remote: CacheTierStats{
+			Hits:   c.remoteHits.Load(),
+			Misses: c.remoteMisses.Load(),
+		},
+	}
+}
+
+// capTTL bounds a TTL by localTTL; zero means no expiry on either side
+func (c *TieredCache) capTTL(ttl time.Duration) time.Duration {
+	if c.localTTL > 0 && (ttl <= 0 || ttl > c.localTTL) {
+		return c.localTTL
+	}
+	return ttl
+}
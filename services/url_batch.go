@@ -0,0 +1,224 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+
+	"url-shortener-api/models"
+)
+
+// CreateShortURLs creates the short URLs of a batch and reports the outcome of each item in request
+// order. Counter codes for the whole batch are leased in one round trip and the mappings are stored
+// with one write. Unless the batch is atomic, items that fail do not keep the others from being created.
+// Batches skip the write-through cache; the first redirect of each link fills it.
+func (s *URLServiceImpl) CreateShortURLs(req *models.URLBatchRequest, userID string) (*models.URLBatchResponse, error) {
+	if len(req.URLs) == 0 {
+		return nil, models.ErrEmptyBatch
+	}
+	if len(req.URLs) > s.maxBatchSize {
+		return nil, models.ErrBatchTooLarge
+	}
+
+	mappings := make([]models.URLMapping, len(req.URLs))
+	failures := make([]error, len(req.URLs))
+	for i := range req.URLs {
+		mappings[i], failures[i] = s.newMapping(&req.URLs[i], userID)
+	}
+
+	// An atomic batch with an invalid item is rejected before any counter value is spent
+	if !req.Atomic || !anyBatchFailure(failures) {
+		if err := s.storeBatch(req, mappings, failures); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Atomic && anyBatchFailure(failures) {
+		for i := range failures {
+			if failures[i] == nil {
+				failures[i] = models.ErrBatchAborted
+			}
+		}
+	}
+
+	return newURLBatchResponse(mappings, failures), nil
+}
+
+// storeBatch gives the valid mappings their short codes and stores them, recording the failure of
+// each one that could not be stored. Generated codes that collide are replaced, like in CreateShortURL.
+func (s *URLServiceImpl) storeBatch(req *models.URLBatchRequest, mappings []models.URLMapping, failures []error) error {
+	var valid []int
+	for i := range mappings {
+		if failures[i] == nil {
+			valid = append(valid, i)
+		}
+	}
+
+	pending, err := s.assignBatchCodes(req.URLs, mappings, failures, valid)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; len(pending) > 0; attempt++ {
+		if req.Atomic && anyBatchFailure(failures) {
+			return nil
+		}
+
+		batch := make([]models.URLMapping, len(pending))
+		for j, i := range pending {
+			batch[j] = mappings[i]
+		}
+		errs, err := s.storage.StoreMany(batch, req.Atomic)
+		if err != nil {
+			return err
+		}
+
+		var retry []int
+		for j, i := range pending {
+			switch {
+			case errs[j] == nil:
+			case mappings[i].Alias != "" || mappings[i].Strategy == models.StrategyHash:
+				failures[i] = errs[j]
+			case attempt == maxCodeInsertAttempts:
+				failures[i] = models.ErrCodeSpaceExhausted
+			default:
+				retry = append(retry, i)
+				counterMetrics.Add("code_collisions", 1)
+			}
+		}
+		if len(retry) == 0 {
+			return nil
+		}
+
+		reassigned, err := s.assignBatchCodes(req.URLs, mappings, failures, retry)
+		if err != nil {
+			return err
+		}
+		// A conflict stored nothing of an atomic batch, so all of it is written again
+		if !req.Atomic {
+			pending = reassigned
+		}
+	}
+
+	return nil
+}
+
+// assignBatchCodes gives the listed mappings their short codes: the alias, or a code generated for
+// their strategy. It returns the mappings that still need storing, leaving out hash codes that reuse
+// an existing link. Generator errors other than AppErrors fail the whole batch.
+func (s *URLServiceImpl) assignBatchCodes(items []models.URLRequest, mappings []models.URLMapping, failures []error, indices []int) ([]int, error) {
+	var pending, counted []int
+	hashCodes := make(map[string]int)
+
+	for _, i := range indices {
+		mapping := &mappings[i]
+		switch {
+		case mapping.Alias != "":
+			mapping.ShortURL = mapping.Alias
+		case mapping.Strategy == models.StrategyCounter:
+			counted = append(counted, i)
+			continue
+		default:
+			code, err := s.generators[mapping.Strategy].Generate(models.CodeInput{
+				URL:    mapping.OriginalURL,
+				UserID: mapping.UserID,
+				Length: items[i].Length,
+			})
+			if err != nil {
+				if !isAppError(err) {
+					return nil, err
+				}
+				failures[i] = err
+				continue
+			}
+			mapping.ShortURL = code
+		}
+
+		if mapping.Strategy == models.StrategyHash {
+			// The same URL twice in one batch yields the same code, which the first occurrence stores
+			if first, seen := hashCodes[mapping.ShortURL]; seen {
+				if mappings[first].OriginalURL != mapping.OriginalURL {
+					failures[i] = models.ErrShortCodeTaken
+				}
+				continue
+			}
+			hashCodes[mapping.ShortURL] = i
+
+			reuse, err := s.resolveHashCode(mapping.ShortURL, mapping.OriginalURL, mapping.UserID)
+			if err != nil {
+				if !isAppError(err) {
+					return nil, err
+				}
+				failures[i] = err
+				continue
+			}
+			if reuse {
+				continue
+			}
+		}
+
+		pending = append(pending, i)
+	}
+
+	if len(counted) > 0 {
+		codes, err := s.generateCounterCodes(len(counted))
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range counted {
+			mappings[i].ShortURL = codes[j]
+			mappings[i].Counter = s.counterValue(codes[j])
+		}
+		pending = append(pending, counted...)
+	}
+
+	return pending, nil
+}
+
+// generateCounterCodes returns count counter codes, in one round trip when the generator supports it
+func (s *URLServiceImpl) generateCounterCodes(count int) ([]string, error) {
+	generator := s.generators[models.StrategyCounter]
+	if batchGenerator, ok := generator.(models.BatchCodeGenerator); ok {
+		return batchGenerator.GenerateBatch(count)
+	}
+
+	codes := make([]string, count)
+	for i := range codes {
+		code, err := generator.Generate(models.CodeInput{})
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+	return codes, nil
+}
+
+// newURLBatchResponse reports each item of a batch as created or failed, in request order
+func newURLBatchResponse(mappings []models.URLMapping, failures []error) *models.URLBatchResponse {
+	response := &models.URLBatchResponse{Results: make([]models.URLBatchResult, len(mappings))}
+	for i, err := range failures {
+		if err != nil {
+			response.Results[i] = models.URLBatchResult{Status: models.GetStatusCodeFromError(err), Error: err.Error()}
+			response.Failed++
+			continue
+		}
+		response.Results[i] = models.URLBatchResult{ShortCode: mappings[i].ShortURL, Status: http.StatusCreated}
+		response.Created++
+	}
+	return response
+}
+
+// anyBatchFailure reports whether an item of a batch failed
+func anyBatchFailure(failures []error) bool {
+	for _, err := range failures {
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isAppError reports whether err is a client-facing AppError rather than an infrastructure failure
+func isAppError(err error) bool {
+	var appErr *models.AppError
+	return errors.As(err, &appErr)
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+// DeleteShortURL soft-deletes a short URL owned by userID. Redirects answer 410 Gone from then on,
+// and the mapping keeps its code reserved until the DeletionPurger removes it after the restore window.
+// Deleting an already deleted link succeeds without changing it.
+func (s *URLServiceImpl) DeleteShortURL(shortCode string, userID string) error {
+	existing, err := s.getOwnedMapping(shortCode, userID)
+	if err != nil {
+		return err
+	}
+	if existing.IsDeleted() {
+		return nil
+	}
+
+	mapping := existing
+	mapping.UpdatedAt = nextUpdatedAt(existing.UpdatedAt)
+	deletedAt := time.Now()
+	mapping.DeletedAt = &deletedAt
+
+	if err := s.replaceMapping(existing, mapping); err != nil {
+		return err
+	}
+
+	if s.cache != nil {
+		s.cache.Delete(context.Background(), fmt.Sprintf("url:%s", shortCode))
+	}
+	return nil
+}
+
+// RestoreShortURL undoes DeleteShortURL if the link was deleted within the restore window
+func (s *URLServiceImpl) RestoreShortURL(shortCode string, userID string) (*models.URLInfo, error) {
+	existing, err := s.getOwnedMapping(shortCode, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !existing.IsDeleted() {
+		return nil, models.ErrNotDeleted
+	}
+	if time.Since(*existing.DeletedAt) >= s.restoreWindow {
+		return nil, models.ErrRestoreWindowPassed
+	}
+
+	mapping := existing
+	mapping.UpdatedAt = nextUpdatedAt(existing.UpdatedAt)
+	mapping.DeletedAt = nil
+
+	if err := s.replaceMapping(existing, mapping); err != nil {
+		return nil, err
+	}
+
+	return newURLInfo(mapping, userID), nil
+}
+
+// getOwnedMapping loads a mapping and checks that userID owns it
+func (s *URLServiceImpl) getOwnedMapping(shortCode string, userID string) (models.URLMapping, error) {
+	mapping, exists, err := s.storage.Get(shortCode)
+	if err != nil {
+		return mapping, err
+	}
+	if !exists {
+		return mapping, models.ErrShortCodeNotFound
+	}
+	if mapping.UserID == "" || mapping.UserID != userID {
+		return mapping, models.ErrNotURLOwner
+	}
+	return mapping, nil
+}
+
+// replaceMapping writes mapping over existing, failing if someone else changed it in between
+func (s *URLServiceImpl) replaceMapping(existing models.URLMapping, mapping models.URLMapping) error {
+	replaced, err := s.storage.ReplaceIfUnchanged(existing.ShortURL, existing.UpdatedAt, mapping)
+	if err != nil {
+		return err
+	}
+	if !replaced {
+		return models.ErrConcurrentUpdate
+	}
+	return nil
+}
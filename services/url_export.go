@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener-api/models"
+)
+
+// exportFlushRows is how many links are buffered before they are flushed to the client; click
+// totals are looked up once per group of this size
+const exportFlushRows = 100
+
+// exportCSVHeader names the CSV export columns; url, alias, expiration and tags are the import columns
+var exportCSVHeader = []string{"short_code", "url", "alias", "expiration", "tags", "visibility", "strategy", "created_at", "updated_at"}
+
+// ExportURLs writes every link of the user that is not deleted to w, oldest first, as CSV (the
+// default) or JSONL, optionally with each link's click total, which leaves bots out unless
+// req.IncludeBots is set. Links are streamed from storage as they are written, so memory use does
+// not grow with the number of links. An invalid format fails before anything is written.
+func (s *URLServiceImpl) ExportURLs(req *models.URLExportRequest, userID string, w io.Writer) error {
+	var write func(export models.URLExport) error
+	var flush func() error
+
+	switch req.Format {
+	case "", models.ExportFormatCSV:
+		header := exportCSVHeader
+		if req.Clicks {
+			header = append(header[:len(header):len(header)], "clicks")
+		}
+
+		writer := csv.NewWriter(w)
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		write = func(export models.URLExport) error {
+			return writer.Write(exportCSVRecord(export))
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case models.ExportFormatJSONL:
+		buffered := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buffered)
+		write = func(export models.URLExport) error {
+			return encoder.Encode(export)
+		}
+		flush = buffered.Flush
+	default:
+		return models.ErrInvalidExportFormat
+	}
+
+	// writeGroup writes a group of links and flushes it through to the client
+	writeGroup := func(mappings []models.URLMapping) error {
+		var clicks map[string]int64
+		if req.Clicks && len(mappings) > 0 {
+			shortCodes := make([]string, len(mappings))
+			for i, mapping := range mappings {
+				shortCodes[i] = mapping.ShortURL
+			}
+
+			var err error
+			if clicks, err = s.clicks.CountClicks(shortCodes, req.IncludeBots); err != nil {
+				return err
+			}
+		}
+
+		for _, mapping := range mappings {
+			export := newURLExport(mapping)
+			if req.Clicks {
+				total := clicks[mapping.ShortURL]
+				export.Clicks = &total
+			}
+			if err := write(export); err != nil {
+				return err
+			}
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	group := make([]models.URLMapping, 0, exportFlushRows)
+	err := s.storage.ScanByUserID(userID, func(mapping models.URLMapping) (bool, error) {
+		group = append(group, mapping)
+		if len(group) < exportFlushRows {
+			return true, nil
+		}
+
+		err := writeGroup(group)
+		group = group[:0]
+		return true, err
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeGroup(group)
+}
+
+// newURLExport builds the exported view of a mapping
+func newURLExport(mapping models.URLMapping) models.URLExport {
+	export := models.URLExport{
+		ShortCode:  mapping.ShortURL,
+		URL:        mapping.OriginalURL,
+		Alias:      mapping.Alias,
+		Expiration: mapping.ExpirationTimestamp,
+		Tags:       mapping.Tags,
+		Visibility: models.VisibilityPublic,
+		Strategy:   mapping.Strategy,
+		CreatedAt:  mapping.CreatedAt,
+		UpdatedAt:  mapping.UpdatedAt,
+	}
+	if !mapping.IsPublic() {
+		export.Visibility = models.VisibilityPrivate
+	}
+	return export
+}
+
+// exportCSVRecord formats an export in the order of exportCSVHeader, followed by the click total
+// when present; timestamps are RFC 3339 and tags are joined like the import's tags column
+func exportCSVRecord(export models.URLExport) []string {
+	expiration := ""
+	if export.Expiration != nil {
+		expiration = export.Expiration.UTC().Format(time.RFC3339)
+	}
+
+	record := []string{
+		export.ShortCode,
+		export.URL,
+		export.Alias,
+		expiration,
+		strings.Join(export.Tags, importTagSeparator),
+		export.Visibility,
+		export.Strategy,
+		export.CreatedAt.UTC().Format(time.RFC3339),
+		export.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if export.Clicks != nil {
+		record = append(record, strconv.FormatInt(*export.Clicks, 10))
+	}
+	return record
+}
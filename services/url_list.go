@@ -0,0 +1,209 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener-api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// Page size bounds for listing a user's links
+	defaultListLimit = 50
+	maxListLimit     = 100
+
+	// Sort orders accepted by URLListRequest.Sort
+	sortCreatedAtAscending  = "created_at"
+	sortCreatedAtDescending = "-created_at"
+
+	// scanBatchSize is how many mappings ScanByUserID reads from storage at a time
+	scanBatchSize = 500
+)
+
+// ListURLs returns one page of the user's mappings, newest first by default
+func (s *URLServiceImpl) ListURLs(req *models.URLListRequest, userID string) (*models.URLListResponse, error) {
+	query, err := newURLListQuery(req, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra mapping tells whether another page follows
+	limit := query.Limit
+	query.Limit++
+	mappings, err := s.storage.ListByUserID(query)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.URLListResponse{URLs: mappings}
+	if len(mappings) > limit {
+		response.URLs = mappings[:limit]
+		response.NextCursor = encodeListCursor(mappings[limit-1])
+	}
+	if response.URLs == nil {
+		response.URLs = []models.URLMapping{}
+	}
+
+	return response, nil
+}
+
+// newURLListQuery validates a list request and applies its defaults
+func newURLListQuery(req *models.URLListRequest, userID string) (models.URLListQuery, error) {
+	query := models.URLListQuery{
+		UserID:    userID,
+		Limit:     req.Limit,
+		Status:    req.Status,
+		AliasOnly: req.AliasOnly,
+		Domain:    strings.ToLower(strings.TrimSpace(req.Domain)),
+	}
+
+	if query.Limit == 0 {
+		query.Limit = defaultListLimit
+	}
+	if query.Limit < 1 || query.Limit > maxListLimit {
+		return query, models.ErrInvalidListLimit
+	}
+
+	switch req.Sort {
+	case "", sortCreatedAtDescending:
+	case sortCreatedAtAscending:
+		query.Ascending = true
+	default:
+		return query, models.ErrInvalidListFilter
+	}
+
+	switch req.Status {
+	case "", models.LinkStatusActive, models.LinkStatusExpired, models.LinkStatusDeleted:
+	default:
+		return query, models.ErrInvalidListFilter
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeListCursor(req.Cursor)
+		if err != nil {
+			return query, err
+		}
+		query.After = cursor
+	}
+
+	return query, nil
+}
+
+// encodeListCursor returns an opaque cursor pointing just after the mapping
+func encodeListCursor(mapping models.URLMapping) string {
+	raw := strconv.FormatInt(mapping.CreatedAt.UnixNano(), 10) + ":" + mapping.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeListCursor parses a cursor produced by encodeListCursor
+func decodeListCursor(cursor string) (*models.URLListCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, models.ErrInvalidCursor
+	}
+
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return nil, models.ErrInvalidCursor
+	}
+
+	createdAt, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, models.ErrInvalidCursor
+	}
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, models.ErrInvalidCursor
+	}
+
+	return &models.URLListCursor{CreatedAt: time.Unix(0, createdAt), ID: objectID}, nil
+}
+
+// destinationDomainPattern returns a case-insensitive regular expression matching URLs whose
+// host is the domain or one of its subdomains. The syntax is shared by Go, MongoDB and PostgreSQL.
+func destinationDomainPattern(domain string) string {
+	return `(?i)^[a-z][a-z0-9+.-]*://([^/?#]*@)?([^/?#@]*\.)?` + regexp.QuoteMeta(domain) + `(:[0-9]+)?([/?#]|$)`
+}
+
+// matchesListQuery applies the filters of a list query to a mapping, for backends that filter in process
+func matchesListQuery(mapping models.URLMapping, query models.URLListQuery, domain *regexp.Regexp) bool {
+	// Deleted links are only listed when asked for
+	if mapping.IsDeleted() != (query.Status == models.LinkStatusDeleted) {
+		return false
+	}
+
+	switch query.Status {
+	case models.LinkStatusActive:
+		if mapping.IsExpired() {
+			return false
+		}
+	case models.LinkStatusExpired:
+		if !mapping.IsExpired() {
+			return false
+		}
+	}
+
+	if query.AliasOnly && mapping.Alias == "" {
+		return false
+	}
+
+	return domain == nil || domain.MatchString(mapping.OriginalURL)
+}
+
+// compileDomainFilter compiles the domain filter of a list query, returning nil when there is none
+func compileDomainFilter(query models.URLListQuery) *regexp.Regexp {
+	if query.Domain == "" {
+		return nil
+	}
+	return regexp.MustCompile(destinationDomainPattern(query.Domain))
+}
+
+// listedBefore reports whether mapping a comes before mapping b in the order of a list query
+func listedBefore(a models.URLMapping, b models.URLMapping, ascending bool) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt) == ascending
+	}
+	if order := bytes.Compare(a.ID[:], b.ID[:]); order != 0 {
+		return (order < 0) == ascending
+	}
+	return false
+}
+
+// listedAfterCursor reports whether a mapping belongs to the page that starts after the cursor
+func listedAfterCursor(mapping models.URLMapping, query models.URLListQuery) bool {
+	if query.After == nil {
+		return true
+	}
+	return listedBefore(models.URLMapping{CreatedAt: query.After.CreatedAt, ID: query.After.ID}, mapping, query.Ascending)
+}
+
+// scanByUserIDInPages implements ScanByUserID on top of a backend's ListByUserID. Each page is a
+// separate short read, so no transaction or connection stays open while fn runs.
+func scanByUserIDInPages(list func(query models.URLListQuery) ([]models.URLMapping, error), userID string, fn func(mapping models.URLMapping) (bool, error)) error {
+	query := models.URLListQuery{UserID: userID, Limit: scanBatchSize, Ascending: true}
+	for {
+		mappings, err := list(query)
+		if err != nil {
+			return err
+		}
+
+		for _, mapping := range mappings {
+			more, err := fn(mapping)
+			if err != nil || !more {
+				return err
+			}
+		}
+
+		if len(mappings) < query.Limit {
+			return nil
+		}
+		last := mappings[len(mappings)-1]
+		query.After = &models.URLListCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"url-shortener-api/models"
@@ -10,44 +11,138 @@ import (
 
 // URLServiceImpl implements the URLService interface
 type URLServiceImpl struct {
-	storage   *URLStorage
-	generator *ShortCodeGenerator
-	validator *URLValidator
-	cache     *CacheService
+	storage    models.URLRepository
+	generators map[string]models.CodeGenerator // keyed by strategy
+	validator  *URLValidator
+	cache      models.Cache // nil when the storage backend needs no cache in front of it
+
+	// restoreWindow is how long after deletion a link can still be restored
+	restoreWindow time.Duration
+
+	// maxBatchSize is the most URLs one CreateShortURLs call accepts
+	maxBatchSize int
+
+	// clicks holds the recorded click events, used for click totals
+	clicks models.ClickEventRepository
+
+	// visitors estimates the unique visitors of each link
+	visitors models.VisitorCounter
+
+	// stream delivers live clicks; nil when click capture is disabled
+	stream models.ClickStream
 }
 
+// maxCodeInsertAttempts bounds how often a colliding generated code is replaced
+const maxCodeInsertAttempts = 5
+
 // CreateShortURL creates a new short URL mapping
 func (s *URLServiceImpl) CreateShortURL(req *models.URLRequest, userID string) (*models.URLResponse, error) {
-	// Validate URL
-	validatedURL, err := s.validator.ValidateURL(req.URL)
+	mapping, err := s.newMapping(req, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Validate alias if provided
-	if err := s.validator.ValidateAlias(req.Alias); err != nil {
-		return nil, err
-	}
-
-	// Generate short code
+	// Store is a plain insert guarded by unique indexes, so two requests can never both
+	// claim a code. A generated code that collides, for example with an alias that happens
+	// to look like base62, is regenerated.
 	var shortCode string
-	if req.Alias != "" {
-		// Check if alias already exists
-		exists, err := s.storage.Exists(req.Alias)
-		if err != nil {
-			return nil, err
+	for attempt := 1; ; attempt++ {
+		if req.Alias != "" {
+			shortCode = req.Alias
+		} else {
+			shortCode, err = s.generators[mapping.Strategy].Generate(models.CodeInput{
+				URL:    mapping.OriginalURL,
+				UserID: userID,
+				Length: req.Length,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if mapping.IsCounterGenerated() {
+				mapping.Counter = s.counterValue(shortCode)
+			}
 		}
-		if exists {
-			return nil, models.ErrAliasAlreadyExists
+
+		// Hash codes are reproducible, so shortening the same URL again returns the existing link
+		if mapping.Strategy == models.StrategyHash {
+			reuse, err := s.resolveHashCode(shortCode, mapping.OriginalURL, userID)
+			if err != nil {
+				return nil, err
+			}
+			if reuse {
+				return &models.URLResponse{ShortCode: shortCode}, nil
+			}
 		}
-		shortCode = req.Alias
-	} else {
-		// Generate unique short code using distributed counter
-		generatedCode, err := s.generator.Generate()
-		if err != nil {
+
+		err = s.storage.Store(shortCode, mapping)
+		if err != models.ErrAliasAlreadyExists {
+			break
+		}
+
+		if req.Alias != "" {
 			return nil, err
 		}
-		shortCode = generatedCode
+		if attempt == maxCodeInsertAttempts {
+			return nil, models.ErrCodeSpaceExhausted
+		}
+		counterMetrics.Add("code_collisions", 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Write through to cache
+	s.cacheURL(context.Background(), shortCode, mapping.OriginalURL, mapping.ExpirationTimestamp)
+
+	// Return response
+	return &models.URLResponse{
+		ShortCode: shortCode,
+	}, nil
+}
+
+// counterValue returns the counter value a counter code was encoded from, recorded on the mapping so
+// counter recovery can find the highest one through an index
+func (s *URLServiceImpl) counterValue(shortCode string) int64 {
+	generator, ok := s.generators[models.StrategyCounter].(*ShortCodeGenerator)
+	if !ok {
+		return 0
+	}
+
+	counter, err := generator.Decode(shortCode)
+	if err != nil {
+		return 0
+	}
+	return counter
+}
+
+// newMapping validates a create request and returns the mapping it describes, still without a short code
+func (s *URLServiceImpl) newMapping(req *models.URLRequest, userID string) (models.URLMapping, error) {
+	// Validate URL
+	validatedURL, err := s.validator.ValidateURL(req.URL)
+	if err != nil {
+		return models.URLMapping{}, err
+	}
+
+	// Validate alias if provided
+	if err := s.validator.ValidateAlias(req.Alias); err != nil {
+		return models.URLMapping{}, err
+	}
+
+	if err := s.validator.ValidateStrategy(req.Strategy, req.Length, req.Alias); err != nil {
+		return models.URLMapping{}, err
+	}
+
+	if err := s.validator.ValidateVisibility(req.Visibility); err != nil {
+		return models.URLMapping{}, err
+	}
+
+	if err := s.validator.ValidateTags(req.Tags); err != nil {
+		return models.URLMapping{}, err
+	}
+
+	strategy := req.Strategy
+	if strategy == "" && req.Alias == "" {
+		strategy = models.StrategyCounter
 	}
 
 	// Calculate expiration time
@@ -57,40 +152,31 @@ func (s *URLServiceImpl) CreateShortURL(req *models.URLRequest, userID string) (
 		expirationTime = &exp
 	}
 
-	// Store the mapping
-	mapping := models.URLMapping{
+	return models.URLMapping{
 		OriginalURL:         validatedURL,
 		Alias:               req.Alias,
+		Strategy:            strategy,
+		Visibility:          req.Visibility,
 		ExpirationTimestamp: expirationTime,
 		UserID:              userID,
-	}
-
-	if err := s.storage.Store(shortCode, mapping); err != nil {
-		return nil, err
-	}
+		Tags:                req.Tags,
+	}, nil
+}
 
-	// Write through to cache
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("url:%s", shortCode)
-	cacheValue := mapping.OriginalURL
+// maxRenameHops bounds how many renames of a link a redirect left under an old code is followed through
+const maxRenameHops = 8
 
-	// Calculate TTL for cache
-	var ttl time.Duration
-	if expirationTime != nil {
-		ttl = time.Until(*expirationTime)
-		if ttl > 0 {
-			// Only cache if not already expired
-			s.cache.Set(ctx, cacheKey, cacheValue, ttl)
+// resolveMapping loads the mapping of a short code, following the redirects that renamed links leave
+// under their old codes
+func (s *URLServiceImpl) resolveMapping(shortCode string) (models.URLMapping, bool, error) {
+	mapping, exists, err := s.storage.Get(shortCode)
+	for hops := 0; err == nil && exists && mapping.IsRenamed(); hops++ {
+		if hops == maxRenameHops {
+			return mapping, false, nil
 		}
-	} else {
-		// No expiration, cache for a long time (24 hours)
-		s.cache.Set(ctx, cacheKey, cacheValue, 24*time.Hour)
+		mapping, exists, err = s.storage.Get(mapping.RenamedTo)
 	}
-
-	// Return response
-	return &models.URLResponse{
-		ShortCode: shortCode,
-	}, nil
+	return mapping, exists, err
 }
 
 // GetOriginalURL retrieves the original URL for a given short code
@@ -98,9 +184,10 @@ func (s *URLServiceImpl) GetOriginalURL(shortCode string, useCache bool) (string
 	ctx := context.Background()
 	cacheKey := fmt.Sprintf("url:%s", shortCode)
 
+	useCache = useCache && s.cache != nil
+
 	// If cache is enabled, try to get from cache first
 	if useCache {
-		fmt.Println("Getting from cache")
 		cachedURL, err := s.cache.Get(ctx, cacheKey)
 		if err == nil {
 			// Cache hit, return the URL
@@ -108,46 +195,142 @@ func (s *URLServiceImpl) GetOriginalURL(shortCode string, useCache bool) (string
 		}
 	}
 
-	// Cache miss or cache disabled, fallback to MongoDB
-	mapping, exists, err := s.storage.Get(shortCode)
-	fmt.Println("Error getting from MongoDB")
+	// Cache miss or cache disabled, fallback to storage
+	mapping, exists, err := s.resolveMapping(shortCode)
 	if err != nil {
+		log.Printf("Failed to get short code %s from storage: %v", shortCode, err)
 		return "", err
 	}
 	if !exists {
 		return "", models.ErrShortCodeNotFound
 	}
 
+	// Deleted links keep their code until purged but no longer redirect
+	if mapping.IsDeleted() {
+		return "", models.ErrShortCodeDeleted
+	}
+
 	// Check if URL has expired
-	if s.storage.IsExpired(mapping) {
-		s.DeleteExpiredURL(shortCode)
+	if mapping.IsExpired() {
+		s.DeleteExpiredURL(mapping.ShortURL)
 		return "", models.ErrShortCodeExpired
 	}
 
-	// If cache is enabled, cache the result for future requests
-	if useCache {
-		var ttl time.Duration
-		if mapping.ExpirationTimestamp != nil {
-			ttl = time.Until(*mapping.ExpirationTimestamp)
-			if ttl > 0 {
-				s.cache.Set(ctx, cacheKey, mapping.OriginalURL, ttl)
-			}
-		} else {
-			// No expiration, cache for a long time (24 hours)
-			s.cache.Set(ctx, cacheKey, mapping.OriginalURL, 24*time.Hour)
-		}
+	// If cache is enabled, cache the result for future requests. The old code of a renamed link is
+	// not cached, so edits of the link apply to it right away.
+	if useCache && mapping.ShortURL == shortCode {
+		s.cacheURL(ctx, shortCode, mapping.OriginalURL, mapping.ExpirationTimestamp)
 	}
 
 	return mapping.OriginalURL, nil
 }
 
+// GetURLInfo returns the metadata of a short URL without following it; the old code of a renamed link
+// reports the link. The owner sees every field; anyone else, including anonymous callers with an empty
+// userID, sees the public subset the link allows.
+func (s *URLServiceImpl) GetURLInfo(shortCode string, userID string) (*models.URLInfo, error) {
+	mapping, exists, err := s.resolveMapping(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, models.ErrShortCodeNotFound
+	}
+
+	// Only the owner can still see a deleted link, for example to restore it
+	if mapping.IsDeleted() && mapping.UserID != userID {
+		return nil, models.ErrShortCodeDeleted
+	}
+
+	info := newURLInfo(mapping, userID)
+	if info.IsOwner {
+		if err := s.addClickTotals(info, mapping); err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+// addClickTotals adds the click total and the unique visitors since creation, both without bots, to the
+// owner's view of a link
+func (s *URLServiceImpl) addClickTotals(info *models.URLInfo, mapping models.URLMapping) error {
+	counts, err := s.clicks.CountClicks([]string{mapping.ShortURL}, false)
+	if err != nil {
+		return err
+	}
+	visitors, err := s.visitors.CountVisitors(mapping.ShortURL, mapping.CreatedAt, time.Now())
+	if err != nil {
+		return err
+	}
+
+	total := counts[mapping.ShortURL]
+	info.TotalClicks = &total
+	info.UniqueVisitors = &visitors
+	return nil
+}
+
+// newURLInfo builds the view of a mapping that the given user is allowed to see
+func newURLInfo(mapping models.URLMapping, userID string) *models.URLInfo {
+	info := &models.URLInfo{
+		ShortCode:  mapping.ShortURL,
+		Visibility: models.VisibilityPublic,
+		Expired:    mapping.IsExpired(),
+		IsOwner:    userID != "" && userID == mapping.UserID,
+	}
+	if !mapping.IsPublic() {
+		info.Visibility = models.VisibilityPrivate
+	}
+
+	if info.IsOwner || mapping.IsPublic() {
+		info.OriginalURL = mapping.OriginalURL
+		info.Alias = mapping.Alias
+		info.CreatedAt = &mapping.CreatedAt
+		info.ExpirationTimestamp = mapping.ExpirationTimestamp
+	}
+	if info.IsOwner {
+		info.Strategy = mapping.Strategy
+		info.UpdatedAt = &mapping.UpdatedAt
+		info.UserID = mapping.UserID
+		info.DeletedAt = mapping.DeletedAt
+		info.Tags = mapping.Tags
+		info.ETag = urlETag(mapping)
+	}
+
+	return info
+}
+
+// resolveHashCode decides what to do with a hash code before inserting it: reuse the link when
+// the same user already shortened the same normalized URL, fail when another URL holds the code, and
+// clear it when the holder has expired
+func (s *URLServiceImpl) resolveHashCode(shortCode string, originalURL string, userID string) (bool, error) {
+	existing, exists, err := s.storage.Get(shortCode)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	switch {
+	case existing.IsExpired():
+		s.DeleteExpiredURL(shortCode)
+		return false, nil
+	case existing.IsDeleted():
+		return false, models.ErrShortCodeDeleted
+	case normalizeHashURL(existing.OriginalURL) == normalizeHashURL(originalURL) && existing.UserID == userID:
+		return true, nil
+	default:
+		return false, models.ErrShortCodeTaken
+	}
+}
+
 // DeleteExpiredURL removes an expired URL mapping
 func (s *URLServiceImpl) DeleteExpiredURL(shortCode string) {
 	ctx := context.Background()
 	cacheKey := fmt.Sprintf("url:%s", shortCode)
 
 	// Remove from cache
-	s.cache.Delete(ctx, cacheKey)
+	if s.cache != nil {
+		s.cache.Delete(ctx, cacheKey)
+	}
 
 	// Remove from storage
 	if err := s.storage.Delete(shortCode); err != nil {
@@ -155,3 +338,24 @@ func (s *URLServiceImpl) DeleteExpiredURL(shortCode string) {
 		// In a production app, you might want to use a proper logger
 	}
 }
+
+// cacheURL writes a URL to the cache, using the mapping expiration as TTL
+func (s *URLServiceImpl) cacheURL(ctx context.Context, shortCode string, originalURL string, expiration *time.Time) {
+	if s.cache == nil {
+		return
+	}
+
+	cacheKey := fmt.Sprintf("url:%s", shortCode)
+
+	// Calculate TTL for cache
+	if expiration != nil {
+		ttl := time.Until(*expiration)
+		if ttl > 0 {
+			// Only cache if not already expired
+			s.cache.Set(ctx, cacheKey, originalURL, ttl)
+		}
+	} else {
+		// No expiration, cache for a long time (24 hours)
+		s.cache.Set(ctx, cacheKey, originalURL, 24*time.Hour)
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"time"
+
+	"url-shortener-api/models"
+)
+
+const (
+	// defaultStatsRange is how far back stats reach when no from time is given
+	defaultStatsRange = 30 * 24 * time.Hour
+
+	// maxStatsBuckets bounds the length of the time series
+	maxStatsBuckets = 1000
+
+	// statsTopValues is how many values each breakdown returns
+	statsTopValues = 10
+)
+
+// Labels for clicks whose breakdown value is unknown
+const (
+	statsDirectReferrer = "direct"
+	statsUnknownValue   = "unknown"
+)
+
+// GetURLStats returns the click stats of a short URL to its owner: the total and time series over
+// [from, to), and the top referrers, browsers, operating systems, device classes, languages and countries.
+// The series has every interval of the range, including those without clicks. Bots are left out unless
+// req.IncludeBots is set. Unique visitors, never bots, are estimated over the whole UTC days the range
+// overlaps.
+func (s *URLServiceImpl) GetURLStats(shortCode string, req *models.URLStatsRequest, userID string) (*models.URLStats, error) {
+	query, err := newClickStatsQuery(shortCode, req)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, exists, err := s.storage.Get(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, models.ErrShortCodeNotFound
+	}
+	if mapping.UserID == "" || mapping.UserID != userID {
+		return nil, models.ErrNotStatsOwner
+	}
+
+	clickStats, err := s.clicks.ClickStats(query)
+	if err != nil {
+		return nil, err
+	}
+	visitors, err := s.visitors.CountVisitors(shortCode, query.From, query.To)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.URLStats{
+		ShortCode:      shortCode,
+		From:           query.From,
+		To:             query.To,
+		Interval:       query.Interval,
+		IncludeBots:    query.IncludeBots,
+		UniqueVisitors: visitors,
+		ClickStats:     *clickStats,
+	}
+	stats.Series = fillClickSeries(clickStats.Series, query)
+	labelUnknownClicks(stats.Referrers, statsDirectReferrer)
+	labelUnknownClicks(stats.Browsers, statsUnknownValue)
+	labelUnknownClicks(stats.OperatingSystems, statsUnknownValue)
+	labelUnknownClicks(stats.Devices, statsUnknownValue)
+	labelUnknownClicks(stats.Languages, statsUnknownValue)
+	labelUnknownClicks(stats.Countries, statsUnknownValue)
+
+	return stats, nil
+}
+
+// newClickStatsQuery validates a stats request and applies its defaults: daily intervals over the
+// last 30 days
+func newClickStatsQuery(shortCode string, req *models.URLStatsRequest) (models.ClickStatsQuery, error) {
+	query := models.ClickStatsQuery{
+		ShortCode:   shortCode,
+		Interval:    req.Interval,
+		Top:         statsTopValues,
+		To:          time.Now().UTC(),
+		IncludeBots: req.IncludeBots,
+	}
+
+	if query.Interval == "" {
+		query.Interval = models.StatsIntervalDay
+	}
+	if _, ok := statsIntervals[query.Interval]; !ok {
+		return query, models.ErrInvalidStatsInterval
+	}
+
+	if req.To != "" {
+		to, err := time.Parse(time.RFC3339, req.To)
+		if err != nil {
+			return query, models.ErrInvalidStatsRange
+		}
+		query.To = to.UTC()
+	}
+
+	query.From = query.To.Add(-defaultStatsRange)
+	if req.From != "" {
+		from, err := time.Parse(time.RFC3339, req.From)
+		if err != nil {
+			return query, models.ErrInvalidStatsRange
+		}
+		query.From = from.UTC()
+	}
+
+	if !query.From.Before(query.To) {
+		return query, models.ErrInvalidStatsRange
+	}
+	if query.To.Sub(clickBucketStart(query.From, query.Interval)) > maxStatsBuckets*statsIntervals[query.Interval] {
+		return query, models.ErrStatsRangeTooLong
+	}
+
+	return query, nil
+}
+
+// fillClickSeries returns every interval of the query's range in order, taking the clicks of those
+// present in series and zero for the rest. The first interval starts at or before query.From.
+func fillClickSeries(series []models.ClickBucket, query models.ClickStatsQuery) []models.ClickBucket {
+	clicks := make(map[time.Time]int64, len(series))
+	for _, bucket := range series {
+		clicks[bucket.Start] = bucket.Clicks
+	}
+
+	filled := []models.ClickBucket{}
+	width := statsIntervals[query.Interval]
+	for start := clickBucketStart(query.From, query.Interval); start.Before(query.To); start = start.Add(width) {
+		filled = append(filled, models.ClickBucket{Start: start, Clicks: clicks[start]})
+	}
+	return filled
+}
+
+// labelUnknownClicks names the entry of a breakdown that counts clicks without a value
+func labelUnknownClicks(counts []models.ClickCount, label string) {
+	for i := range counts {
+		if counts[i].Value == "" {
+			counts[i].Value = label
+		}
+	}
+}
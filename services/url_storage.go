@@ -2,11 +2,15 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"url-shortener-api/models"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -23,7 +27,8 @@ func NewURLStorage(collection *mongo.Collection) *URLStorage {
 	}
 }
 
-// Store saves a URL mapping to MongoDB (upserts if exists)
+// Store inserts a new URL mapping into MongoDB. The unique indexes on short_url and alias
+// make the insert fail atomically when either is taken, which maps to ErrAliasAlreadyExists.
 func (s *URLStorage) Store(shortCode string, mapping models.URLMapping) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -34,15 +39,66 @@ func (s *URLStorage) Store(shortCode string, mapping models.URLMapping) error {
 	mapping.UpdatedAt = now
 	mapping.ShortURL = shortCode
 
-	// Use upsert to insert or update the document
-	filter := bson.M{"short_url": shortCode}
-	update := bson.M{"$set": mapping}
-	opts := options.Update().SetUpsert(true)
-
-	_, err := s.collection.UpdateOne(ctx, filter, update, opts)
+	_, err := s.collection.InsertOne(ctx, mapping)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.ErrAliasAlreadyExists
+	}
 	return err
 }
 
+// StoreMany inserts mappings under their ShortURL with one unordered BulkWrite, so every insert is
+// attempted and a conflict only fails its own mapping. MongoDB has no multi-document atomicity
+// outside replica set transactions, so an atomic batch with a conflict removes the documents it did
+// insert; they are visible to readers for that short moment.
+func (s *URLStorage) StoreMany(mappings []models.URLMapping, atomic bool) ([]error, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	ids := make([]primitive.ObjectID, len(mappings))
+	writes := make([]mongo.WriteModel, len(mappings))
+	for i, mapping := range mappings {
+		mapping.ID = primitive.NewObjectID()
+		mapping.CreatedAt = now
+		mapping.UpdatedAt = now
+		ids[i] = mapping.ID
+		writes[i] = mongo.NewInsertOneModel().SetDocument(mapping)
+	}
+
+	errs := make([]error, len(mappings))
+	_, err := s.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr.WriteError) {
+				return nil, err
+			}
+			errs[writeErr.Index] = models.ErrAliasAlreadyExists
+		}
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if atomic && len(bulkErr.WriteErrors) > 0 {
+		var inserted bson.A
+		for i, id := range ids {
+			if errs[i] == nil {
+				inserted = append(inserted, id)
+			}
+		}
+		if len(inserted) > 0 {
+			if _, err := s.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": inserted}}); err != nil {
+				return nil, fmt.Errorf("failed to roll back batch insert: %w", err)
+			}
+		}
+	}
+
+	return errs, nil
+}
+
 // Get retrieves a URL mapping by short code from MongoDB
 func (s *URLStorage) Get(shortCode string) (models.URLMapping, bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -88,10 +144,7 @@ func (s *URLStorage) Delete(shortCode string) error {
 
 // IsExpired checks if a URL mapping has expired
 func (s *URLStorage) IsExpired(mapping models.URLMapping) bool {
-	if mapping.ExpirationTimestamp == nil {
-		return false
-	}
-	return time.Now().After(*mapping.ExpirationTimestamp)
+	return mapping.IsExpired()
 }
 
 // GetByAlias retrieves a URL mapping by alias from MongoDB
@@ -133,6 +186,102 @@ func (s *URLStorage) GetByUserID(userID string) ([]models.URLMapping, error) {
 	return mappings, nil
 }
 
+// ListByUserID returns up to query.Limit of the user's mappings that match the query, in its order.
+// Pages are read with a range on the user_id/created_at/_id index, never by skipping documents.
+func (s *URLStorage) ListByUserID(query models.URLListQuery) ([]models.URLMapping, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	direction, after := -1, "$lt"
+	if query.Ascending {
+		direction, after = 1, "$gt"
+	}
+
+	filter := bson.D{{Key: "user_id", Value: query.UserID}}
+	conditions := bson.A{}
+	if query.After != nil {
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"created_at": bson.M{after: query.After.CreatedAt}},
+			bson.M{"created_at": query.After.CreatedAt, "_id": bson.M{after: query.After.ID}},
+		}})
+	}
+
+	if query.Status == models.LinkStatusDeleted {
+		conditions = append(conditions, bson.M{"deleted_at": bson.M{"$ne": nil}})
+	} else {
+		conditions = append(conditions, bson.M{"deleted_at": nil})
+	}
+
+	now := time.Now()
+	switch query.Status {
+	case models.LinkStatusActive:
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"expiration_timestamp": nil},
+			bson.M{"expiration_timestamp": bson.M{"$gte": now}},
+		}})
+	case models.LinkStatusExpired:
+		conditions = append(conditions, bson.M{"expiration_timestamp": bson.M{"$lt": now}})
+	}
+
+	if query.AliasOnly {
+		conditions = append(conditions, bson.M{"alias": bson.M{"$nin": bson.A{nil, ""}}})
+	}
+	if query.Domain != "" {
+		conditions = append(conditions, bson.M{"original_url": bson.M{"$regex": destinationDomainPattern(query.Domain)}})
+	}
+	filter = append(filter, bson.E{Key: "$and", Value: conditions})
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(query.Limit))
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	mappings := make([]models.URLMapping, 0, query.Limit)
+	if err = cursor.All(ctx, &mappings); err != nil {
+		return nil, err
+	}
+
+	return mappings, nil
+}
+
+// ScanByUserID calls fn for every mapping of the user that is not deleted, oldest first, until fn
+// returns false. One cursor streams the mappings in batches, so memory use does not grow with the user's
+// link count. There is no deadline, since fn sets the pace; the cursor is closed when the scan ends.
+func (s *URLStorage) ScanByUserID(userID string, fn func(mapping models.URLMapping) (bool, error)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	filter := bson.M{"user_id": userID, "deleted_at": nil}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetBatchSize(scanBatchSize)
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var mapping models.URLMapping
+		if err := cursor.Decode(&mapping); err != nil {
+			return err
+		}
+
+		more, err := fn(mapping)
+		if err != nil || !more {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
 // Update updates an existing URL mapping
 func (s *URLStorage) Update(shortCode string, mapping models.URLMapping) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -147,17 +296,157 @@ func (s *URLStorage) Update(shortCode string, mapping models.URLMapping) error {
 	return err
 }
 
-// CreateIndexes creates necessary indexes for the collection
-func (s *URLStorage) CreateIndexes() error {
+// ReplaceIfUnchanged replaces the mapping stored under shortCode, moving it to mapping.ShortURL and leaving
+// a renamedRedirect under the old code when that differs, only if it was last updated at lastUpdatedAt.
+// Without a rename, the filter and the unique indexes make the check and the write one atomic
+// operation. It reports false if the mapping is gone or changed.
+func (s *URLStorage) ReplaceIfUnchanged(shortCode string, lastUpdatedAt time.Time, mapping models.URLMapping) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if mapping.ShortURL == "" {
+		mapping.ShortURL = shortCode
+	}
+	filter := bson.M{"short_url": shortCode, "updated_at": lastUpdatedAt}
+
+	if mapping.ShortURL == shortCode {
+		// A replacement, unlike $set, also drops fields that were cleared such as the expiration
+		result, err := s.collection.ReplaceOne(ctx, filter, mapping)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, models.ErrAliasAlreadyExists
+		}
+		if err != nil {
+			return false, err
+		}
+		return result.MatchedCount == 1, nil
+	}
+
+	// A rename turns the document into the redirect first, so the old code is never free, then
+	// inserts the link under its new code and puts the document back if that code is taken
+	var existing models.URLMapping
+	err := s.collection.FindOne(ctx, filter).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	redirect := renamedRedirect(existing, mapping)
+	redirect.ID = existing.ID
+	result, err := s.collection.ReplaceOne(ctx, filter, redirect)
+	if err != nil || result.MatchedCount == 0 {
+		return false, err
+	}
+
+	mapping.ID = primitive.NewObjectID()
+	if _, err := s.collection.InsertOne(ctx, mapping); err != nil {
+		if _, restoreErr := s.collection.ReplaceOne(ctx, bson.M{"_id": existing.ID}, existing); restoreErr != nil {
+			return false, restoreErr
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return false, models.ErrAliasAlreadyExists
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PurgeDeleted removes every mapping deleted before the given time
+func (s *URLStorage) PurgeDeleted(before time.Time) (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Create index on short_url for fast lookups
-	shortURLIndex := mongo.IndexModel{
-		Keys:    bson.D{{Key: "short_url", Value: 1}},
-		Options: options.Index(),
+	result, err := s.collection.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// counterBackfillBatchSize is how many counter values BackfillCounters writes per round trip
+const counterBackfillBatchSize = 1000
+
+// BackfillCounters sets the counter value of mappings stored without one, such as those written
+// before the field existed. Codes that are not counter codes get 0.
+func (s *URLStorage) BackfillCounters(counterOf func(mapping models.URLMapping) int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	// Matching null also matches documents without the field, served by the counter index
+	cursor, err := s.collection.Find(ctx, bson.M{"counter": nil})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var mapping models.URLMapping
+		if err := cursor.Decode(&mapping); err != nil {
+			return err
+		}
+
+		var counter int64
+		if mapping.IsCounterGenerated() {
+			counter = counterOf(mapping)
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": mapping.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"counter": counter}}))
+
+		if len(writes) == counterBackfillBatchSize {
+			if _, err := s.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+				return err
+			}
+			writes = writes[:0]
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+
+	_, err = s.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// HighestCounter returns the largest counter value stored, or 0 when there is none
+func (s *URLStorage) HighestCounter() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var doc struct {
+		Counter int64 `bson:"counter"`
+	}
+	err := s.collection.FindOne(ctx, bson.M{},
+		options.FindOne().SetSort(bson.D{{Key: "counter", Value: -1}}).SetProjection(bson.M{"counter": 1}),
+	).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
 	}
 
+	return doc.Counter, err
+}
+
+// shortURLUniqueIndex names the unique short_url index. Older deployments have a non-unique index
+// under the default name short_url_1, so the unique one is built beside it under its own name.
+const shortURLUniqueIndex = "short_url_unique"
+
+// maxReportedDuplicates is how many duplicated short codes a failed unique index build lists
+const maxReportedDuplicates = 20
+
+// CreateIndexes creates necessary indexes for the collection. The unique short_url index is built
+// before an older non-unique one is dropped, so lookups keep an index when duplicates make the build
+// fail; the error then lists the duplicated short codes to remove.
+func (s *URLStorage) CreateIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
 	// Create index on alias for fast lookups
 	aliasIndex := mongo.IndexModel{
 		Keys:    bson.D{{Key: "alias", Value: 1}},
@@ -169,6 +458,22 @@ func (s *URLStorage) CreateIndexes() error {
 		Keys: bson.D{{Key: "user_id", Value: 1}},
 	}
 
+	// Create index serving the paginated link list, newest first
+	userCreatedIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+	}
+
+	// Create index on deleted_at for the deletion purger
+	deletedAtIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	}
+
+	// Create index on counter for counter recovery
+	counterIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "counter", Value: -1}},
+	}
+
 	// Create TTL index on expiration_timestamp for automatic cleanup
 	ttlIndex := mongo.IndexModel{
 		Keys:    bson.D{{Key: "expiration_timestamp", Value: 1}},
@@ -176,11 +481,103 @@ func (s *URLStorage) CreateIndexes() error {
 	}
 
 	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		shortURLIndex,
 		aliasIndex,
 		userIDIndex,
+		userCreatedIndex,
+		deletedAtIndex,
+		counterIndex,
 		ttlIndex,
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	return s.createShortURLIndex(ctx)
+}
+
+// createShortURLIndex makes sure a unique index on short_url exists for fast lookups and atomic
+// inserts, then drops a non-unique short_url_1 index left by older deployments
+func (s *URLStorage) createShortURLIndex(ctx context.Context) error {
+	unique, legacy, err := s.shortURLIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !unique {
+		_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "short_url", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName(shortURLUniqueIndex),
+		})
+		if err != nil {
+			if duplicates, findErr := s.duplicateShortCodes(ctx); findErr == nil && len(duplicates) > 0 {
+				return fmt.Errorf("cannot create unique short_url index, these short codes are stored more than once: %s",
+					strings.Join(duplicates, ", "))
+			}
+			return err
+		}
+	}
+
+	if legacy {
+		_, err := s.collection.Indexes().DropOne(ctx, "short_url_1")
+		return err
+	}
+	return nil
+}
+
+// shortURLIndexes reports whether a unique index on short_url exists, and whether the non-unique
+// short_url_1 index of older deployments does
+func (s *URLStorage) shortURLIndexes(ctx context.Context) (unique, legacy bool, err error) {
+	cursor, err := s.collection.Indexes().List(ctx)
+	if err != nil {
+		return false, false, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var index struct {
+			Name   string `bson:"name"`
+			Key    bson.D `bson:"key"`
+			Unique bool   `bson:"unique"`
+		}
+		if err := cursor.Decode(&index); err != nil {
+			return false, false, err
+		}
+
+		if len(index.Key) != 1 || index.Key[0].Key != "short_url" {
+			continue
+		}
+		if index.Unique {
+			unique = true
+		} else if index.Name == "short_url_1" {
+			legacy = true
+		}
+	}
+
+	return unique, legacy, cursor.Err()
+}
+
+// duplicateShortCodes returns up to maxReportedDuplicates short codes stored by more than one document
+func (s *URLStorage) duplicateShortCodes(ctx context.Context) ([]string, error) {
+	cursor, err := s.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$short_url"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+		{{Key: "$limit", Value: maxReportedDuplicates}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var duplicates []string
+	for cursor.Next(ctx) {
+		var group struct {
+			ShortCode string `bson:"_id"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, group.ShortCode)
+	}
+
+	return duplicates, cursor.Err()
 }
@@ -0,0 +1,37 @@
+package services
+
+import "url-shortener-api/models"
+
+// SubscribeClicks subscribes the user to the live clicks of one of their short URLs, or of every one of
+// them when shortCode is empty. Bots are left out unless req.IncludeBots is set. With a last event ID,
+// the retained clicks after it are delivered first.
+func (s *URLServiceImpl) SubscribeClicks(shortCode string, req *models.ClickStreamRequest, userID string) (models.ClickSubscription, error) {
+	if s.stream == nil {
+		return nil, models.ErrClickStreamDisabled
+	}
+	if req.LastEventID != "" {
+		if _, _, ok := parseStreamID(req.LastEventID); !ok {
+			return nil, models.ErrInvalidLastEventID
+		}
+	}
+
+	if shortCode != "" {
+		mapping, exists, err := s.storage.Get(shortCode)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, models.ErrShortCodeNotFound
+		}
+		if mapping.UserID == "" || mapping.UserID != userID {
+			return nil, models.ErrNotStreamOwner
+		}
+	}
+
+	filter := models.ClickStreamFilter{
+		UserID:      userID,
+		ShortCode:   shortCode,
+		IncludeBots: req.IncludeBots,
+	}
+	return s.stream.Subscribe(filter, req.LastEventID)
+}
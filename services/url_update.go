@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"url-shortener-api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdateShortURL edits the destination, alias, expiration or visibility of a short URL owned by
+// userID. Setting an alias renames the link, so its short code becomes the alias; the old code stays
+// reserved and keeps redirecting to it. The write only succeeds if nobody changed the link since it
+// was read, or since req.IfMatch when given.
+func (s *URLServiceImpl) UpdateShortURL(shortCode string, req *models.URLUpdateRequest, userID string) (*models.URLInfo, error) {
+	if req.URL == nil && req.Alias == nil && req.ExpirationMs == nil && req.Visibility == nil {
+		return nil, models.ErrEmptyUpdate
+	}
+
+	existing, err := s.getOwnedMapping(shortCode, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.IsDeleted() {
+		return nil, models.ErrShortCodeDeleted
+	}
+	if existing.IsExpired() {
+		return nil, models.ErrShortCodeExpired
+	}
+	if req.IfMatch != "" && req.IfMatch != "*" && req.IfMatch != urlETag(existing) {
+		return nil, models.ErrPreconditionFailed
+	}
+
+	mapping, err := s.applyUpdate(existing, req)
+	if err != nil {
+		return nil, err
+	}
+
+	replaced, err := s.storage.ReplaceIfUnchanged(shortCode, existing.UpdatedAt, mapping)
+	if err != nil {
+		return nil, err
+	}
+	if !replaced {
+		// Someone else wrote in between; with an ETag that is exactly a failed precondition
+		if req.IfMatch != "" {
+			return nil, models.ErrPreconditionFailed
+		}
+		return nil, models.ErrConcurrentUpdate
+	}
+
+	// Redirects must stop serving the old destination, and a renamed code must resolve through its redirect
+	ctx := context.Background()
+	if s.cache != nil {
+		s.cache.Delete(ctx, fmt.Sprintf("url:%s", shortCode))
+		if mapping.ShortURL != shortCode {
+			s.cache.Delete(ctx, fmt.Sprintf("url:%s", mapping.ShortURL))
+		}
+	}
+
+	return newURLInfo(mapping, userID), nil
+}
+
+// applyUpdate validates the requested changes and returns the mapping with them applied
+func (s *URLServiceImpl) applyUpdate(mapping models.URLMapping, req *models.URLUpdateRequest) (models.URLMapping, error) {
+	if req.URL != nil {
+		validatedURL, err := s.validator.ValidateURL(*req.URL)
+		if err != nil {
+			return mapping, err
+		}
+		mapping.OriginalURL = validatedURL
+	}
+
+	if req.Alias != nil && *req.Alias != mapping.ShortURL {
+		// An empty alias would leave the link without a code, so it fails the length check
+		if *req.Alias == "" {
+			return mapping, models.ErrInvalidAliasLength
+		}
+		if err := s.validator.ValidateAlias(*req.Alias); err != nil {
+			return mapping, err
+		}
+		mapping.Alias = *req.Alias
+		mapping.ShortURL = *req.Alias
+	}
+
+	if req.ExpirationMs != nil {
+		switch {
+		case *req.ExpirationMs < 0:
+			return mapping, models.ErrInvalidExpiration
+		case *req.ExpirationMs == 0:
+			mapping.ExpirationTimestamp = nil
+		default:
+			expiration := time.Now().Add(time.Duration(*req.ExpirationMs) * time.Millisecond)
+			mapping.ExpirationTimestamp = &expiration
+		}
+	}
+
+	if req.Visibility != nil {
+		if err := s.validator.ValidateVisibility(*req.Visibility); err != nil {
+			return mapping, err
+		}
+		mapping.Visibility = *req.Visibility
+	}
+
+	mapping.UpdatedAt = nextUpdatedAt(mapping.UpdatedAt)
+	return mapping, nil
+}
+
+// renamedRedirect returns the mapping that keeps the old code of a renamed link, so printed or shared
+// copies of it still resolve and nobody else can claim it. It has no owner, which keeps it out of link
+// lists, and keeps the alias and counter value of the old code.
+func renamedRedirect(existing models.URLMapping, renamed models.URLMapping) models.URLMapping {
+	return models.URLMapping{
+		ID:        primitive.NewObjectID(),
+		ShortURL:  existing.ShortURL,
+		Alias:     existing.Alias,
+		Strategy:  existing.Strategy,
+		Counter:   existing.Counter,
+		RenamedTo: renamed.ShortURL,
+		CreatedAt: renamed.UpdatedAt,
+		UpdatedAt: renamed.UpdatedAt,
+	}
+}
+
+// nextUpdatedAt returns a modification time strictly after last, at the millisecond precision every
+// backend stores, so each write changes the ETag even when two land in the same millisecond
+func nextUpdatedAt(last time.Time) time.Time {
+	next := time.Now().Truncate(time.Millisecond)
+	if !next.After(last) {
+		next = last.Truncate(time.Millisecond).Add(time.Millisecond)
+	}
+	return next
+}
+
+// urlETag returns the strong ETag of a mapping, derived from its modification time
+func urlETag(mapping models.URLMapping) string {
+	return `"` + strconv.FormatInt(mapping.UpdatedAt.UnixNano(), 36) + `"`
+}
@@ -7,6 +7,18 @@ import (
 	"url-shortener-api/models"
 )
 
+// Bounds for the tags of one link
+const (
+	maxTags      = 10
+	maxTagLength = 32
+)
+
+// reservedAliases are path segments of fixed GET routes under /urls
+var reservedAliases = map[string]bool{
+	"export": true,
+	"events": true,
+}
+
 // URLValidator handles URL validation operations
 type URLValidator struct{}
 
@@ -62,5 +74,63 @@ func (v *URLValidator) ValidateAlias(alias string) error {
 		}
 	}
 
+	// Fixed routes under /urls would shadow the redirect for these codes
+	if reservedAliases[alias] {
+		return models.ErrAliasReserved
+	}
+
+	return nil
+}
+
+// ValidateVisibility checks the requested link visibility
+func (v *URLValidator) ValidateVisibility(visibility string) error {
+	switch visibility {
+	case "", models.VisibilityPublic, models.VisibilityPrivate:
+		return nil
+	default:
+		return models.ErrInvalidVisibility
+	}
+}
+
+// ValidateTags checks the number and characters of a link's tags
+func (v *URLValidator) ValidateTags(tags []string) error {
+	if len(tags) > maxTags {
+		return models.ErrInvalidTags
+	}
+
+	for _, tag := range tags {
+		if len(tag) < 1 || len(tag) > maxTagLength {
+			return models.ErrInvalidTags
+		}
+		for _, char := range tag {
+			if !((char >= 'a' && char <= 'z') ||
+				(char >= 'A' && char <= 'Z') ||
+				(char >= '0' && char <= '9') ||
+				char == '-' || char == '_') {
+				return models.ErrInvalidTags
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateStrategy checks the requested short code strategy and length
+func (v *URLValidator) ValidateStrategy(strategy string, length int, alias string) error {
+	switch strategy {
+	case "", models.StrategyCounter:
+	case models.StrategyRandom, models.StrategyHash:
+		if length != 0 && (length < minCodeLength || length > maxCodeLength) {
+			return models.ErrInvalidCodeLength
+		}
+	default:
+		return models.ErrInvalidStrategy
+	}
+
+	// An alias is its own strategy
+	if alias != "" && strategy != "" {
+		return models.ErrInvalidStrategy
+	}
+
 	return nil
 }
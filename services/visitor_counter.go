@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"url-shortener-api/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// visitorDayLayout formats the UTC day in visitor keys
+	visitorDayLayout = "2006-01-02"
+
+	// visitorSaltTTL keeps a day's salt until every instance is done with that day
+	visitorSaltTTL = 48 * time.Hour
+)
+
+// RedisVisitorCounter implements models.VisitorCounter with one HyperLogLog per short code and UTC day,
+// visitors:<code>:<day>, so any range of days is estimated with a single PFCOUNT over their keys. The
+// daily salt is shared by all instances through Redis and expires soon after its day.
+type RedisVisitorCounter struct {
+	client    *redis.Client
+	retention time.Duration
+	mu        sync.Mutex
+	salts     map[string]string // by day
+}
+
+// NewRedisVisitorCounter creates a new instance of RedisVisitorCounter that keeps each day's estimate
+// for retention after the day ends
+func NewRedisVisitorCounter(client *redis.Client, retention time.Duration) *RedisVisitorCounter {
+	return &RedisVisitorCounter{
+		client:    client,
+		retention: retention,
+		salts:     make(map[string]string),
+	}
+}
+
+// AddVisitors adds the visitor of each event to the HyperLogLog of its code and day, in one pipeline
+func (c *RedisVisitorCounter) AddVisitors(events []models.ClickEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	visitors := make(map[string][]interface{})
+	expirations := make(map[string]time.Time)
+	for _, event := range events {
+		day := event.Timestamp.UTC().Truncate(24 * time.Hour)
+		salt, err := c.salt(ctx, day.Format(visitorDayLayout))
+		if err != nil {
+			return err
+		}
+
+		key := visitorKey(event.ShortCode, day)
+		visitors[key] = append(visitors[key], hashVisitor(salt, event))
+		expirations[key] = day.Add(24*time.Hour + c.retention)
+	}
+
+	pipe := c.client.Pipeline()
+	for key, hashes := range visitors {
+		pipe.PFAdd(ctx, key, hashes...)
+		pipe.ExpireAt(ctx, key, expirations[key])
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// CountVisitors estimates the distinct visitors of a short code over the UTC days overlapping [from, to).
+// Days past the retention have expired and are skipped.
+func (c *RedisVisitorCounter) CountVisitors(shortCode string, from time.Time, to time.Time) (int64, error) {
+	if oldest := time.Now().Add(-c.retention - 24*time.Hour); from.Before(oldest) {
+		from = oldest
+	}
+
+	keys := visitorKeys(shortCode, from, to)
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return c.client.PFCount(ctx, keys...).Result()
+}
+
+// salt returns the salt of a day, creating it in Redis if no instance has yet
+func (c *RedisVisitorCounter) salt(ctx context.Context, day string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if salt, ok := c.salts[day]; ok {
+		return salt, nil
+	}
+
+	key := "visitor_salt:" + day
+	if err := c.client.SetNX(ctx, key, newVisitorSalt(), visitorSaltTTL).Err(); err != nil {
+		return "", err
+	}
+	salt, err := c.client.Get(ctx, key).Result()
+	if err != nil {
+		return "", err
+	}
+
+	// Only today's and yesterday's salts are still in use
+	if len(c.salts) > 2 {
+		c.salts = make(map[string]string)
+	}
+	c.salts[day] = salt
+	return salt, nil
+}
+
+// MemoryVisitorCounter implements models.VisitorCounter in process memory with exact sets per short code
+// and UTC day. Counts do not survive a restart and are not shared between instances. Like the Redis
+// counter, it keeps each day's sets for the retention after the day ends and forgets a day's salt once
+// the day before yesterday has begun.
+type MemoryVisitorCounter struct {
+	retention time.Duration
+	mu        sync.Mutex
+	salts     map[time.Time]string                         // by day
+	visitors  map[time.Time]map[string]map[string]struct{} // by day, then short code
+}
+
+// NewMemoryVisitorCounter creates a new, empty instance of MemoryVisitorCounter that keeps each day's
+// visitors for retention after the day ends
+func NewMemoryVisitorCounter(retention time.Duration) *MemoryVisitorCounter {
+	return &MemoryVisitorCounter{
+		retention: retention,
+		salts:     make(map[time.Time]string),
+		visitors:  make(map[time.Time]map[string]map[string]struct{}),
+	}
+}
+
+// AddVisitors adds the visitor of each event to the set of its code and day. Events of days past the
+// retention are skipped.
+func (c *MemoryVisitorCounter) AddVisitors(events []models.ClickEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.prune(now)
+
+	for _, event := range events {
+		day := event.Timestamp.UTC().Truncate(24 * time.Hour)
+		if c.expired(day, now) {
+			continue
+		}
+
+		salt, ok := c.salts[day]
+		if !ok {
+			salt = newVisitorSalt()
+			c.salts[day] = salt
+		}
+
+		if c.visitors[day] == nil {
+			c.visitors[day] = make(map[string]map[string]struct{})
+		}
+		if c.visitors[day][event.ShortCode] == nil {
+			c.visitors[day][event.ShortCode] = make(map[string]struct{})
+		}
+		c.visitors[day][event.ShortCode][hashVisitor(salt, event)] = struct{}{}
+	}
+	return nil
+}
+
+// CountVisitors counts the distinct visitors of a short code over the UTC days overlapping [from, to).
+// Days past the retention are skipped.
+func (c *MemoryVisitorCounter) CountVisitors(shortCode string, from time.Time, to time.Time) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	union := make(map[string]struct{})
+	for day := from.UTC().Truncate(24 * time.Hour); day.Before(to); day = day.Add(24 * time.Hour) {
+		if c.expired(day, now) {
+			continue
+		}
+		for visitor := range c.visitors[day][shortCode] {
+			union[visitor] = struct{}{}
+		}
+	}
+	return int64(len(union)), nil
+}
+
+// expired reports whether a day ended more than the retention ago
+func (c *MemoryVisitorCounter) expired(day time.Time, now time.Time) bool {
+	return !now.Before(day.Add(24*time.Hour + c.retention))
+}
+
+// prune forgets the visitors of expired days and the salts of days before yesterday
+func (c *MemoryVisitorCounter) prune(now time.Time) {
+	yesterday := now.UTC().Truncate(24 * time.Hour).Add(-24 * time.Hour)
+	for day := range c.salts {
+		if day.Before(yesterday) {
+			delete(c.salts, day)
+		}
+	}
+	for day := range c.visitors {
+		if c.expired(day, now) {
+			delete(c.visitors, day)
+		}
+	}
+}
+
+// visitorKey returns the key of a short code's visitors on a UTC day
+func visitorKey(shortCode string, day time.Time) string {
+	return "visitors:" + shortCode + ":" + day.Format(visitorDayLayout)
+}
+
+// visitorKeys returns the keys of the UTC days overlapping [from, to)
+func visitorKeys(shortCode string, from time.Time, to time.Time) []string {
+	var keys []string
+	for day := from.UTC().Truncate(24 * time.Hour); day.Before(to); day = day.Add(24 * time.Hour) {
+		keys = append(keys, visitorKey(shortCode, day))
+	}
+	return keys
+}
+
+// hashVisitor identifies the client of an event without keeping its IP or user agent. The IP must
+// not be truncated yet, or every client of a network would count as one visitor.
+func hashVisitor(salt string, event models.ClickEvent) string {
+	sum := sha256.Sum256([]byte(salt + "\x00" + event.IP + "\x00" + event.UserAgent))
+	return hex.EncodeToString(sum[:16])
+}
+
+// newVisitorSalt returns a random salt for a new day
+func newVisitorSalt() string {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return hex.EncodeToString(salt)
+}
@@ -1,11 +1,14 @@
 package integration
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -23,10 +26,12 @@ func setupTestServer(t *testing.T) (*gin.Engine, func()) {
 	// Initialize services with MongoDB
 	factory, cleanup := testutils.CreateTestServiceFactory(t)
 	urlService := factory.CreateURLService()
+	importService := factory.CreateImportService()
+	clickRecorder := factory.CreateClickRecorder()
 
 	// Setup router
 	router := gin.Default()
-	routes.SetupRoutes(router, urlService)
+	routes.SetupRoutes(router, urlService, importService, clickRecorder)
 
 	return router, cleanup
 }
@@ -81,8 +86,8 @@ func TestAPIIntegration_CreateAndRedirectURL(t *testing.T) {
 	router.ServeHTTP(redirectW, redirectReq)
 
 	// Verify redirect response
-	if redirectW.Code != http.StatusMovedPermanently {
-		t.Errorf("Expected status %d, got %d", http.StatusMovedPermanently, redirectW.Code)
+	if redirectW.Code != http.StatusFound {
+		t.Errorf("Expected status %d, got %d", http.StatusFound, redirectW.Code)
 	}
 
 	location := redirectW.Header().Get("Location")
@@ -130,8 +135,8 @@ func TestAPIIntegration_CreateURLWithCustomAlias(t *testing.T) {
 	redirectW := httptest.NewRecorder()
 	router.ServeHTTP(redirectW, redirectReq)
 
-	if redirectW.Code != http.StatusMovedPermanently {
-		t.Errorf("Expected status %d, got %d", http.StatusMovedPermanently, redirectW.Code)
+	if redirectW.Code != http.StatusFound {
+		t.Errorf("Expected status %d, got %d", http.StatusFound, redirectW.Code)
 	}
 
 	location := redirectW.Header().Get("Location")
@@ -332,6 +337,37 @@ func TestAPIIntegration_NonExistentShortCode(t *testing.T) {
 	}
 }
 
+func TestAPIIntegration_MetricsOnlyOnInternalRouter(t *testing.T) {
+	router, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// The public router does not serve metrics
+	req, _ := http.NewRequest("GET", "/debug/vars", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Public /debug/vars status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// The metrics router serves the application counters and nothing else
+	metrics := gin.New()
+	routes.SetupMetricsRoutes(metrics)
+	req, _ = http.NewRequest("GET", "/debug/vars", nil)
+	w = httptest.NewRecorder()
+	metrics.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Metrics /debug/vars status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("Failed to parse metrics %q: %v", w.Body.String(), err)
+	}
+	if len(vars) != 3 || vars["cache"] == nil || vars["counter"] == nil || vars["clicks"] == nil {
+		t.Errorf("Metrics = %s, want only cache, counter and clicks", w.Body.String())
+	}
+}
+
 func TestAPIIntegration_URLNormalization(t *testing.T) {
 	router, cleanup := setupTestServer(t)
 	defer cleanup()
@@ -369,8 +405,8 @@ func TestAPIIntegration_URLNormalization(t *testing.T) {
 	redirectW := httptest.NewRecorder()
 	router.ServeHTTP(redirectW, redirectReq)
 
-	if redirectW.Code != http.StatusMovedPermanently {
-		t.Errorf("Expected status %d, got %d", http.StatusMovedPermanently, redirectW.Code)
+	if redirectW.Code != http.StatusFound {
+		t.Errorf("Expected status %d, got %d", http.StatusFound, redirectW.Code)
 	}
 
 	location := redirectW.Header().Get("Location")
@@ -379,3 +415,256 @@ func TestAPIIntegration_URLNormalization(t *testing.T) {
 		t.Errorf("Expected Location header '%s', got '%s'", expected, location)
 	}
 }
+
+func TestAPIIntegration_URLInfoVisibility(t *testing.T) {
+	router, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ownerToken := generateTestToken(t, "owner")
+	otherToken := generateTestToken(t, "someone-else")
+
+	for _, createRequest := range []models.URLRequest{
+		{URL: "https://www.example.com/public", Alias: "info-public"},
+		{URL: "https://www.example.com/private", Alias: "info-private", Visibility: models.VisibilityPrivate},
+	} {
+		jsonBody, _ := json.Marshal(createRequest)
+		req, _ := http.NewRequest("POST", "/urls", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+ownerToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d creating %s, got %d", http.StatusCreated, createRequest.Alias, w.Code)
+		}
+	}
+
+	getInfo := func(shortCode string, token string) (int, models.URLInfo) {
+		req, _ := http.NewRequest("GET", "/urls/"+shortCode+"/info", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var info models.URLInfo
+		json.Unmarshal(w.Body.Bytes(), &info)
+		return w.Code, info
+	}
+
+	// The owner sees everything, including private links
+	code, info := getInfo("info-private", ownerToken)
+	if code != http.StatusOK || !info.IsOwner || info.OriginalURL != "https://www.example.com/private" || info.UserID != "owner" {
+		t.Errorf("Owner info = %d %+v, want every field", code, info)
+	}
+
+	// Anyone else sees the destination of public links but not who owns them
+	for _, token := range []string{"", otherToken} {
+		code, info = getInfo("info-public", token)
+		if code != http.StatusOK || info.IsOwner || info.OriginalURL != "https://www.example.com/public" || info.UserID != "" {
+			t.Errorf("Public info = %d %+v, want the destination without the owner", code, info)
+		}
+
+		code, info = getInfo("info-private", token)
+		if code != http.StatusOK || info.OriginalURL != "" || info.Visibility != models.VisibilityPrivate {
+			t.Errorf("Private info = %d %+v, want the destination hidden", code, info)
+		}
+	}
+
+	// An invalid token is rejected rather than treated as anonymous
+	if code, _ := getInfo("info-public", "not-a-token"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an invalid token, got %d", http.StatusUnauthorized, code)
+	}
+
+	// Info never redirects, and unknown codes are not found
+	if code, _ := getInfo("no-such-code", ""); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown code, got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestAPIIntegration_ExportURLs(t *testing.T) {
+	router, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	token := generateTestToken(t, "exporter")
+
+	jsonBody, _ := json.Marshal(models.URLRequest{URL: "https://www.example.com/exported", Alias: "exported"})
+	req, _ := http.NewRequest("POST", "/urls", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	// The export route is not mistaken for a short code
+	req, _ = http.NewRequest("GET", "/urls/export?format=csv", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "exported,https://www.example.com/exported,exported,") {
+		t.Errorf("Unexpected export %q", w.Body.String())
+	}
+
+	// Exports require authentication
+	req, _ = http.NewRequest("GET", "/urls/export", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// Redirects still work for other codes
+	req, _ = http.NewRequest("GET", "/urls/exported", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected status %d for the redirect, got %d", http.StatusFound, w.Code)
+	}
+}
+
+func TestAPIIntegration_ExportIncludesClickTotals(t *testing.T) {
+	router, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	token := generateTestToken(t, "clicker")
+
+	jsonBody, _ := json.Marshal(models.URLRequest{URL: "https://www.example.com/clicked", Alias: "clicked"})
+	req, _ := http.NewRequest("POST", "/urls", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	for i := 0; i < 3; i++ {
+		req, _ = http.NewRequest("GET", "/urls/clicked", nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("Expected status %d for the redirect, got %d", http.StatusFound, w.Code)
+		}
+	}
+
+	// A link unfurler and an uptime check are recorded as bots
+	req, _ = http.NewRequest("GET", "/urls/clicked", nil)
+	req.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	req, _ = http.NewRequest("HEAD", "/urls/clicked", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status %d for the HEAD redirect, got %d", http.StatusFound, w.Code)
+	}
+
+	// exportClicks returns the click total of the only exported link
+	exportClicks := func(query string) int64 {
+		req, _ := http.NewRequest("GET", "/urls/export?format=jsonl&clicks=true"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var export models.URLExport
+		if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil || export.Clicks == nil {
+			return -1
+		}
+		return *export.Clicks
+	}
+
+	// Clicks are stored in the background, so poll the export until they show up
+	testutils.WaitFor(t, 5*time.Second, func() bool {
+		return exportClicks("&include_bots=true") == 5
+	}, "click totals did not reach the export")
+	if clicks := exportClicks(""); clicks != 3 {
+		t.Errorf("Expected 3 clicks without bots, got %d", clicks)
+	}
+}
+
+func TestAPIIntegration_StreamsLiveClicks(t *testing.T) {
+	router, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// Server-sent events need a real connection to read from while the response is still open
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	token := generateTestToken(t, "watcher")
+
+	jsonBody, _ := json.Marshal(models.URLRequest{URL: "https://www.example.com/launch", Alias: "launch"})
+	req, _ := http.NewRequest("POST", "/urls", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	// Only the owner may watch a link
+	req, _ = http.NewRequest("GET", "/urls/launch/events/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(t, "intruder"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for another user, got %d", http.StatusForbidden, w.Code)
+	}
+
+	for _, path := range []string{"/urls/launch/events/stream", "/urls/events/stream"} {
+		t.Run(path, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to open the stream: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+				t.Fatalf("Expected an event stream, got status %d and Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+			}
+
+			req, _ = http.NewRequest("GET", "/urls/launch", nil)
+			req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0")
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			// Read events until the click arrives; a blank line ends each event
+			var id, event, data string
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if line == "" && event == "click" {
+					break
+				}
+				switch {
+				case strings.HasPrefix(line, "id: "):
+					id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "event: "):
+					event = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					data = strings.TrimPrefix(line, "data: ")
+				}
+			}
+			if event != "click" {
+				t.Fatalf("Stream ended without a click: %v", scanner.Err())
+			}
+
+			var click models.LiveClick
+			if err := json.Unmarshal([]byte(data), &click); err != nil {
+				t.Fatalf("Failed to decode click %q: %v", data, err)
+			}
+			if click.ShortCode != "launch" || click.ID != id || id == "" {
+				t.Errorf("Unexpected click %+v with ID %q", click, id)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package testutils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// SetupMiniRedis starts an in-process Redis server and returns it with a connected client.
+// Both are closed when the test finishes.
+func SetupMiniRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return server, client
+}
+
+// WaitFor polls condition until it holds, failing the test after timeout
+func WaitFor(t *testing.T, timeout time.Duration, condition func() bool, message string) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for: %s", message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,9 +2,13 @@ package testutils
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"url-shortener-api/config"
+	"url-shortener-api/models"
 	"url-shortener-api/services"
 
 	"github.com/testcontainers/testcontainers-go"
@@ -122,8 +126,68 @@ func SetupTestRedis(t *testing.T) (string, func()) {
 	return connStr, cleanup
 }
 
-// CreateTestURLStorage creates a URLStorage instance for testing
-func CreateTestURLStorage(t *testing.T) (*services.URLStorage, func()) {
+// TestStorageBackend returns the storage backend selected with TEST_STORAGE_BACKEND.
+// It defaults to the in-memory backend; "mongodb" runs against MongoDB and Redis containers,
+// "bolt" against a temporary bbolt file and "sql" against a temporary SQLite database.
+func TestStorageBackend() string {
+	if backend := os.Getenv("TEST_STORAGE_BACKEND"); backend != "" {
+		return backend
+	}
+	return config.StorageMemory
+}
+
+// testBoltConfig returns a config pointing at a bbolt file in the test's temporary directory
+func testBoltConfig(t *testing.T) *config.Config {
+	return &config.Config{
+		StorageBackend:     config.StorageBolt,
+		BoltPath:           filepath.Join(t.TempDir(), "url_shortener_test.db"),
+		RestoreWindow:      time.Hour,
+		BatchMaxSize:       10,
+		ClickBufferSize:    100,
+		ClickBatchSize:     10,
+		ClickFlushInterval: 10 * time.Millisecond,
+		VisitorRetention:   48 * time.Hour,
+		Timeout:            time.Second,
+	}
+}
+
+// testSQLConfig returns a config pointing at a SQLite file in the test's temporary directory
+func testSQLConfig(t *testing.T) *config.Config {
+	return &config.Config{
+		StorageBackend:     config.StorageSQL,
+		SQLDialect:         services.SQLDialectSQLite,
+		SQLDSN:             "file:" + filepath.Join(t.TempDir(), "url_shortener_test.sqlite"),
+		RestoreWindow:      time.Hour,
+		BatchMaxSize:       10,
+		ClickBufferSize:    100,
+		ClickBatchSize:     10,
+		ClickFlushInterval: 10 * time.Millisecond,
+		VisitorRetention:   48 * time.Hour,
+		Timeout:            time.Second,
+	}
+}
+
+// CreateTestURLStorage creates a URL repository for testing
+func CreateTestURLStorage(t *testing.T) (models.URLRepository, func()) {
+	switch TestStorageBackend() {
+	case config.StorageMemory:
+		return services.NewMemoryURLStorage(), func() {}
+	case config.StorageBolt:
+		cfg := testBoltConfig(t)
+		db, err := services.OpenBoltDB(cfg.BoltPath, cfg.Timeout)
+		if err != nil {
+			t.Fatalf("Failed to open bbolt database: %v", err)
+		}
+		return services.NewBoltURLStorage(db), func() { db.Close() }
+	case config.StorageSQL:
+		cfg := testSQLConfig(t)
+		db, err := services.OpenSQLDB(cfg.SQLDialect, cfg.SQLDSN)
+		if err != nil {
+			t.Fatalf("Failed to open SQLite database: %v", err)
+		}
+		return services.NewSQLURLStorage(db, cfg.SQLDialect), func() { db.Close() }
+	}
+
 	_, collection, cleanup := SetupTestMongoDB(t, nil)
 
 	storage := services.NewURLStorage(collection)
@@ -136,15 +200,105 @@ func CreateTestURLStorage(t *testing.T) (*services.URLStorage, func()) {
 	return storage, cleanup
 }
 
+// CreateTestImportStorage creates an import job repository for testing
+func CreateTestImportStorage(t *testing.T) (models.ImportJobRepository, func()) {
+	switch TestStorageBackend() {
+	case config.StorageMemory:
+		return services.NewMemoryImportStorage(), func() {}
+	case config.StorageBolt:
+		cfg := testBoltConfig(t)
+		db, err := services.OpenBoltDB(cfg.BoltPath, cfg.Timeout)
+		if err != nil {
+			t.Fatalf("Failed to open bbolt database: %v", err)
+		}
+		return services.NewBoltImportStorage(db), func() { db.Close() }
+	case config.StorageSQL:
+		cfg := testSQLConfig(t)
+		db, err := services.OpenSQLDB(cfg.SQLDialect, cfg.SQLDSN)
+		if err != nil {
+			t.Fatalf("Failed to open SQLite database: %v", err)
+		}
+		return services.NewSQLImportStorage(db, cfg.SQLDialect), func() { db.Close() }
+	}
+
+	client, _, cleanup := SetupTestMongoDB(t, nil)
+
+	storage := services.NewImportStorage(client.Database(DefaultTestConfig().Database))
+
+	// Create indexes
+	if err := storage.CreateIndexes(); err != nil {
+		t.Fatalf("Failed to create indexes: %v", err)
+	}
+
+	return storage, cleanup
+}
+
+// CreateTestClickStorage creates a click event repository for testing
+func CreateTestClickStorage(t *testing.T) (models.ClickEventRepository, func()) {
+	switch TestStorageBackend() {
+	case config.StorageMemory:
+		return services.NewMemoryClickStorage(), func() {}
+	case config.StorageBolt:
+		cfg := testBoltConfig(t)
+		db, err := services.OpenBoltDB(cfg.BoltPath, cfg.Timeout)
+		if err != nil {
+			t.Fatalf("Failed to open bbolt database: %v", err)
+		}
+		return services.NewBoltClickStorage(db), func() { db.Close() }
+	case config.StorageSQL:
+		cfg := testSQLConfig(t)
+		db, err := services.OpenSQLDB(cfg.SQLDialect, cfg.SQLDSN)
+		if err != nil {
+			t.Fatalf("Failed to open SQLite database: %v", err)
+		}
+		return services.NewSQLClickStorage(db, cfg.SQLDialect), func() { db.Close() }
+	}
+
+	client, _, cleanup := SetupTestMongoDB(t, nil)
+
+	storage := services.NewClickStorage(client.Database(DefaultTestConfig().Database).Collection("click_events"))
+
+	// Create indexes
+	if err := storage.CreateIndexes(); err != nil {
+		t.Fatalf("Failed to create indexes: %v", err)
+	}
+
+	return storage, cleanup
+}
+
 // CreateTestServiceFactory creates a service factory for testing
 func CreateTestServiceFactory(t *testing.T) (*services.ServiceFactory, func()) {
+	switch TestStorageBackend() {
+	case config.StorageMemory:
+		factory := services.NewMemoryServiceFactory(&config.Config{StorageBackend: config.StorageMemory, RestoreWindow: time.Hour, BatchMaxSize: 10, ClickBufferSize: 100, ClickBatchSize: 10, ClickFlushInterval: 10 * time.Millisecond, VisitorRetention: 48 * time.Hour})
+		return factory, func() { factory.Close() }
+	case config.StorageBolt:
+		factory, err := services.NewBoltServiceFactory(testBoltConfig(t))
+		if err != nil {
+			t.Fatalf("Failed to create bbolt service factory: %v", err)
+		}
+		return factory, func() { factory.Close() }
+	case config.StorageSQL:
+		factory, err := services.NewSQLServiceFactory(testSQLConfig(t))
+		if err != nil {
+			t.Fatalf("Failed to create SQL service factory: %v", err)
+		}
+		return factory, func() { factory.Close() }
+	}
+
 	_, collection, mongoCleanup := SetupTestMongoDB(t, nil)
 	redisURL, redisCleanup := SetupTestRedis(t)
 
-	factory := services.NewServiceFactory(collection, redisURL)
+	factory, err := services.NewMongoServiceFactory(&config.Config{RedisURL: redisURL, RestoreWindow: time.Hour, BatchMaxSize: 10, ClickBufferSize: 100, ClickBatchSize: 10, ClickFlushInterval: 10 * time.Millisecond, VisitorRetention: 48 * time.Hour}, collection)
+	if err != nil {
+		mongoCleanup()
+		redisCleanup()
+		t.Fatalf("Failed to create MongoDB service factory: %v", err)
+	}
 
 	// Combined cleanup function
 	cleanup := func() {
+		factory.Close()
 		mongoCleanup()
 		redisCleanup()
 	}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"url-shortener-api/handlers"
+	"url-shortener-api/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockImportService is a mock implementation of ImportService
+type MockImportService struct {
+	mock.Mock
+}
+
+func (m *MockImportService) CreateImport(req *models.ImportRequest, userID string) (*models.ImportJob, error) {
+	args := m.Called(req, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ImportJob), args.Error(1)
+}
+
+func (m *MockImportService) GetImport(id string, userID string) (*models.ImportJob, error) {
+	args := m.Called(id, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ImportJob), args.Error(1)
+}
+
+// newImportUpload builds a multipart body with the given file and optional format field
+func newImportUpload(t *testing.T, filename string, content string, format string) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if format != "" {
+		writer.WriteField("format", format)
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("CreateFormFile() error = %v", err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+	return body, writer.FormDataContentType()
+}
+
+func TestImportHandler_CreateImport_FormatFromExtension(t *testing.T) {
+	// Setup
+	mockService := new(MockImportService)
+	handler := handlers.NewImportHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.POST("/imports", handler.CreateImport)
+
+	isJSONL := mock.MatchedBy(func(req *models.ImportRequest) bool {
+		return req.Format == models.ImportFormatJSONL
+	})
+	mockService.On("CreateImport", isJSONL, "user123").Return(&models.ImportJob{
+		ID:        "0123456789abcdef01234567",
+		Format:    models.ImportFormatJSONL,
+		Status:    models.ImportStatusQueued,
+		TotalRows: 1,
+	}, nil)
+
+	body, contentType := newImportUpload(t, "links.ndjson", `{"url": "https://www.example.com"}`, "")
+	req, _ := http.NewRequest("POST", "/imports", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "/imports/0123456789abcdef01234567" {
+		t.Errorf("Expected Location /imports/0123456789abcdef01234567, got %q", location)
+	}
+
+	var response models.ImportJob
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Status != models.ImportStatusQueued || response.TotalRows != 1 {
+		t.Errorf("Unexpected job %+v", response)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestImportHandler_CreateImport_MissingFile(t *testing.T) {
+	// Setup
+	mockService := new(MockImportService)
+	handler := handlers.NewImportHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.POST("/imports", handler.CreateImport)
+
+	req, _ := http.NewRequest("POST", "/imports", bytes.NewBufferString(`url
+https://www.example.com`))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	mockService.AssertNotCalled(t, "CreateImport", mock.Anything, mock.Anything)
+}
+
+// endlessUpload is a multipart body whose file never ends; it counts the bytes read from it
+type endlessUpload struct {
+	preamble *bytes.Reader
+	read     int64
+}
+
+func (u *endlessUpload) Read(p []byte) (int, error) {
+	n, _ := u.preamble.Read(p)
+	for i := n; i < len(p); i++ {
+		p[i] = 'a'
+	}
+	u.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestImportHandler_CreateImport_TooLarge(t *testing.T) {
+	// Setup
+	mockService := new(MockImportService)
+	handler := handlers.NewImportHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.POST("/imports", handler.CreateImport)
+
+	preamble := "--boundary\r\nContent-Disposition: form-data; name=\"file\"; filename=\"links.csv\"\r\n" +
+		"Content-Type: text/csv\r\n\r\nurl\n"
+	body := &endlessUpload{preamble: bytes.NewReader([]byte(preamble))}
+	req, _ := http.NewRequest("POST", "/imports", body)
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	// The upload is cut off shortly after the limit rather than read to the end
+	if body.read > 40<<20 {
+		t.Errorf("Read %d bytes of the upload, want it to stop near the 32 MB limit", body.read)
+	}
+
+	mockService.AssertNotCalled(t, "CreateImport", mock.Anything, mock.Anything)
+}
+
+func TestImportHandler_GetImport_NotFound(t *testing.T) {
+	// Setup
+	mockService := new(MockImportService)
+	handler := handlers.NewImportHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.GET("/imports/:id", handler.GetImport)
+
+	mockService.On("GetImport", "missing", "user123").Return(nil, models.ErrImportNotFound)
+
+	req, _ := http.NewRequest("GET", "/imports/missing", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	mockService.AssertExpectations(t)
+}
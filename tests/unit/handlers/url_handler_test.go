@@ -3,9 +3,12 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"url-shortener-api/handlers"
 	"url-shortener-api/models"
@@ -27,6 +30,14 @@ func (m *MockURLService) CreateShortURL(req *models.URLRequest, userID string) (
 	return args.Get(0).(*models.URLResponse), args.Error(1)
 }
 
+func (m *MockURLService) CreateShortURLs(req *models.URLBatchRequest, userID string) (*models.URLBatchResponse, error) {
+	args := m.Called(req, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.URLBatchResponse), args.Error(1)
+}
+
 func (m *MockURLService) GetOriginalURL(shortCode string, useCache bool) (string, error) {
 	args := m.Called(shortCode, useCache)
 	return args.String(0), args.Error(1)
@@ -36,6 +47,64 @@ func (m *MockURLService) DeleteExpiredURL(shortCode string) {
 	m.Called(shortCode)
 }
 
+func (m *MockURLService) ListURLs(req *models.URLListRequest, userID string) (*models.URLListResponse, error) {
+	args := m.Called(req, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.URLListResponse), args.Error(1)
+}
+
+func (m *MockURLService) ExportURLs(req *models.URLExportRequest, userID string, w io.Writer) error {
+	args := m.Called(req, userID, w)
+	return args.Error(0)
+}
+
+func (m *MockURLService) GetURLStats(shortCode string, req *models.URLStatsRequest, userID string) (*models.URLStats, error) {
+	args := m.Called(shortCode, req, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.URLStats), args.Error(1)
+}
+
+func (m *MockURLService) SubscribeClicks(shortCode string, req *models.ClickStreamRequest, userID string) (models.ClickSubscription, error) {
+	args := m.Called(shortCode, req, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(models.ClickSubscription), args.Error(1)
+}
+
+func (m *MockURLService) GetURLInfo(shortCode string, userID string) (*models.URLInfo, error) {
+	args := m.Called(shortCode, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.URLInfo), args.Error(1)
+}
+
+func (m *MockURLService) UpdateShortURL(shortCode string, req *models.URLUpdateRequest, userID string) (*models.URLInfo, error) {
+	args := m.Called(shortCode, req, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.URLInfo), args.Error(1)
+}
+
+func (m *MockURLService) DeleteShortURL(shortCode string, userID string) error {
+	args := m.Called(shortCode, userID)
+	return args.Error(0)
+}
+
+func (m *MockURLService) RestoreShortURL(shortCode string, userID string) (*models.URLInfo, error) {
+	args := m.Called(shortCode, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.URLInfo), args.Error(1)
+}
+
 func setupTestRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	return gin.New()
@@ -172,6 +241,78 @@ func TestURLHandler_CreateShortURL_AliasConflict(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+func TestURLHandler_CreateShortURLs_PartialSuccess(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.POST("/urls/batch", handler.CreateShortURLs)
+
+	expected := &models.URLBatchRequest{
+		URLs:   []models.URLRequest{{URL: "https://www.example.com"}, {URL: "https://www.example.org", Alias: "taken"}},
+		Atomic: false,
+	}
+	mockService.On("CreateShortURLs", expected, "user123").Return(&models.URLBatchResponse{
+		Results: []models.URLBatchResult{
+			{ShortCode: "abc123", Status: http.StatusCreated},
+			{Status: http.StatusConflict, Error: models.ErrAliasAlreadyExists.Error()},
+		},
+		Created: 1,
+		Failed:  1,
+	}, nil)
+
+	body, _ := json.Marshal(expected.URLs)
+	req, _ := http.NewRequest("POST", "/urls/batch", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMultiStatus {
+		t.Errorf("Expected status %d, got %d", http.StatusMultiStatus, w.Code)
+	}
+
+	var response models.URLBatchResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.Results) != 2 || response.Results[0].ShortCode != "abc123" || response.Results[1].Status != http.StatusConflict {
+		t.Errorf("Unexpected results %+v", response.Results)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestURLHandler_CreateShortURLs_AtomicQuery(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.POST("/urls/batch", handler.CreateShortURLs)
+
+	expected := &models.URLBatchRequest{URLs: []models.URLRequest{{URL: "https://www.example.com"}}, Atomic: true}
+	mockService.On("CreateShortURLs", expected, "user123").Return(&models.URLBatchResponse{
+		Results: []models.URLBatchResult{{ShortCode: "abc123", Status: http.StatusCreated}},
+		Created: 1,
+	}, nil)
+
+	req, _ := http.NewRequest("POST", "/urls/batch?atomic=true", bytes.NewBufferString(`[{"url": "https://www.example.com"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
 func TestURLHandler_RedirectToURL_Success(t *testing.T) {
 	// Setup
 	mockService := new(MockURLService)
@@ -194,8 +335,8 @@ func TestURLHandler_RedirectToURL_Success(t *testing.T) {
 	router.ServeHTTP(w, req)
 
 	// Assertions
-	if w.Code != http.StatusMovedPermanently {
-		t.Errorf("Expected status %d, got %d", http.StatusMovedPermanently, w.Code)
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected status %d, got %d", http.StatusFound, w.Code)
 	}
 
 	location := w.Header().Get("Location")
@@ -298,8 +439,8 @@ func TestURLHandler_RedirectToURL_WithUseCacheParam(t *testing.T) {
 	router.ServeHTTP(w, req)
 
 	// Verify response
-	if w.Code != http.StatusMovedPermanently {
-		t.Errorf("Expected status %d, got %d", http.StatusMovedPermanently, w.Code)
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected status %d, got %d", http.StatusFound, w.Code)
 	}
 
 	location := w.Header().Get("Location")
@@ -310,3 +451,392 @@ func TestURLHandler_RedirectToURL_WithUseCacheParam(t *testing.T) {
 	// Verify mock expectations
 	mockService.AssertExpectations(t)
 }
+
+func TestURLHandler_ListURLs_Success(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+
+	// Add middleware to set user_id in context
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.GET("/urls", handler.ListURLs)
+
+	// The query string is bound into the list request
+	expectedRequest := &models.URLListRequest{Limit: 2, Sort: "created_at", Status: "active", AliasOnly: true, Domain: "example.com"}
+	expectedResponse := &models.URLListResponse{
+		URLs:       []models.URLMapping{{ShortURL: "abc123", OriginalURL: "https://example.com"}},
+		NextCursor: "next",
+	}
+	mockService.On("ListURLs", expectedRequest, "user123").Return(expectedResponse, nil)
+
+	// Make request
+	req, _ := http.NewRequest("GET", "/urls?limit=2&sort=created_at&status=active&alias_only=true&domain=example.com", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assertions
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response models.URLListResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.URLs) != 1 || response.URLs[0].ShortURL != "abc123" || response.NextCursor != "next" {
+		t.Errorf("Unexpected response body %s", w.Body.String())
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestURLHandler_ListURLs_InvalidLimit(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.GET("/urls", handler.ListURLs)
+
+	// A non-numeric limit never reaches the service
+	req, _ := http.NewRequest("GET", "/urls?limit=many", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	mockService.AssertNotCalled(t, "ListURLs", mock.Anything, mock.Anything)
+}
+
+func TestURLHandler_ExportURLs_StreamsAttachment(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.GET("/urls/export", handler.ExportURLs)
+
+	expected := &models.URLExportRequest{Format: models.ExportFormatJSONL}
+	mockService.On("ExportURLs", expected, "user123", mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(2).(io.Writer).Write([]byte(`{"short_code":"abc123"}` + "\n"))
+	}).Return(nil)
+
+	req, _ := http.NewRequest("GET", "/urls/export?format=jsonl", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("Expected Content-Type application/x-ndjson, got %q", contentType)
+	}
+	if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename="links.jsonl"` {
+		t.Errorf("Unexpected Content-Disposition %q", disposition)
+	}
+	if w.Body.String() != `{"short_code":"abc123"}`+"\n" {
+		t.Errorf("Unexpected body %q", w.Body.String())
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestURLHandler_ExportURLs_InvalidFormat(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.GET("/urls/export", handler.ExportURLs)
+
+	expected := &models.URLExportRequest{Format: "xml"}
+	mockService.On("ExportURLs", expected, "user123", mock.Anything).Return(models.ErrInvalidExportFormat)
+
+	req, _ := http.NewRequest("GET", "/urls/export?format=xml", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+		t.Errorf("Expected a JSON error, got Content-Type %q", contentType)
+	}
+	if w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Expected no attachment for an error")
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestURLHandler_GetURLStats_PassesRange(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.GET("/urls/:short_code/stats", handler.GetURLStats)
+
+	expected := &models.URLStatsRequest{From: "2024-01-01T00:00:00Z", To: "2024-01-02T00:00:00Z", Interval: "hour"}
+	stats := &models.URLStats{ShortCode: "abc123", Interval: "hour", ClickStats: models.ClickStats{TotalClicks: 7}}
+	mockService.On("GetURLStats", "abc123", expected, "user123").Return(stats, nil)
+
+	req, _ := http.NewRequest("GET", "/urls/abc123/stats?from=2024-01-01T00:00:00Z&to=2024-01-02T00:00:00Z&interval=hour", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response["total_clicks"] != float64(7) || response["interval"] != "hour" {
+		t.Errorf("Unexpected response %s", w.Body.String())
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestURLHandler_GetURLStats_NotOwner(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "intruder")
+		c.Next()
+	})
+	router.GET("/urls/:short_code/stats", handler.GetURLStats)
+
+	mockService.On("GetURLStats", "abc123", &models.URLStatsRequest{}, "intruder").Return(nil, models.ErrNotStatsOwner)
+
+	req, _ := http.NewRequest("GET", "/urls/abc123/stats", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+// closedSubscription delivers a fixed set of messages and then ends
+type closedSubscription struct {
+	messages chan models.ClickStreamMessage
+}
+
+func newClosedSubscription(messages ...models.ClickStreamMessage) *closedSubscription {
+	subscription := &closedSubscription{messages: make(chan models.ClickStreamMessage, len(messages))}
+	for _, message := range messages {
+		subscription.messages <- message
+	}
+	close(subscription.messages)
+	return subscription
+}
+
+func (s *closedSubscription) Messages() <-chan models.ClickStreamMessage {
+	return s.messages
+}
+
+func (s *closedSubscription) Close() {}
+
+func TestURLHandler_StreamClicks_WritesEvents(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.GET("/urls/:short_code/events/stream", handler.StreamClicks)
+
+	click := &models.LiveClick{
+		ID:         "1700000000000-0",
+		UserID:     "user123",
+		ClickEvent: models.ClickEvent{ShortCode: "abc123", Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Browser: "Firefox"},
+	}
+	subscription := newClosedSubscription(
+		models.ClickStreamMessage{},
+		models.ClickStreamMessage{ID: click.ID, Click: click},
+		models.ClickStreamMessage{ID: "1700000000500-3"},
+	)
+
+	// The Last-Event-ID header wins over the query parameter
+	expected := &models.ClickStreamRequest{IncludeBots: true, LastEventID: "1699999999999-0"}
+	mockService.On("SubscribeClicks", "abc123", expected, "user123").Return(subscription, nil)
+
+	req, _ := http.NewRequest("GET", "/urls/abc123/events/stream?include_bots=true&last_event_id=1-0", nil)
+	req.Header.Set("Last-Event-ID", "1699999999999-0")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %q", contentType)
+	}
+
+	events := strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n\n")
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %q", w.Body.String())
+	}
+	if events[0] != ": heartbeat" {
+		t.Errorf("Expected a comment heartbeat before any ID, got %q", events[0])
+	}
+	if !strings.HasPrefix(events[1], "id: 1700000000000-0\nevent: click\ndata: {") || !strings.Contains(events[1], `"browser":"Firefox"`) {
+		t.Errorf("Unexpected click event %q", events[1])
+	}
+	if events[2] != "id: 1700000000500-3\nevent: heartbeat\ndata: {}" {
+		t.Errorf("Unexpected heartbeat %q", events[2])
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestURLHandler_StreamClicks_NotOwner(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "intruder")
+		c.Next()
+	})
+	router.GET("/urls/:short_code/events/stream", handler.StreamClicks)
+
+	mockService.On("SubscribeClicks", "abc123", &models.ClickStreamRequest{}, "intruder").Return(nil, models.ErrNotStreamOwner)
+
+	req, _ := http.NewRequest("GET", "/urls/abc123/events/stream", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestURLHandler_UpdateShortURL_PassesIfMatch(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.PATCH("/urls/:short_code", handler.UpdateShortURL)
+
+	newURL := "https://www.example.com/fixed"
+	expectedRequest := &models.URLUpdateRequest{URL: &newURL, IfMatch: `"v1"`}
+	mockService.On("UpdateShortURL", "abc123", expectedRequest, "user123").
+		Return(&models.URLInfo{ShortCode: "abc123", OriginalURL: newURL, ETag: `"v2"`}, nil)
+
+	// Make request
+	req, _ := http.NewRequest("PATCH", "/urls/abc123", bytes.NewBufferString(`{"url": "https://www.example.com/fixed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"v1"`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assertions
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"v2"` {
+		t.Errorf("Expected ETag header %s, got %s", `"v2"`, etag)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestURLHandler_UpdateShortURL_PreconditionFailed(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.PATCH("/urls/:short_code", handler.UpdateShortURL)
+
+	mockService.On("UpdateShortURL", "abc123", mock.AnythingOfType("*models.URLUpdateRequest"), "user123").
+		Return(nil, models.ErrPreconditionFailed)
+
+	req, _ := http.NewRequest("PATCH", "/urls/abc123", bytes.NewBufferString(`{"visibility": "private"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"stale"`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestURLHandler_DeleteShortURL_Success(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", "user123")
+		c.Next()
+	})
+	router.DELETE("/urls/:short_code", handler.DeleteShortURL)
+
+	mockService.On("DeleteShortURL", "abc123", "user123").Return(nil)
+
+	req, _ := http.NewRequest("DELETE", "/urls/abc123", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestURLHandler_RedirectToURL_Deleted(t *testing.T) {
+	// Setup
+	mockService := new(MockURLService)
+	handler := handlers.NewURLHandler(mockService)
+	router := setupTestRouter()
+	router.GET("/urls/:short_code", handler.RedirectToURL)
+
+	mockService.On("GetOriginalURL", "deleted", true).Return("", models.ErrShortCodeDeleted)
+
+	req, _ := http.NewRequest("GET", "/urls/deleted", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGone {
+		t.Errorf("Expected status %d, got %d", http.StatusGone, w.Code)
+	}
+
+	mockService.AssertExpectations(t)
+}
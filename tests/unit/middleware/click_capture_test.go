@@ -0,0 +1,169 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"url-shortener-api/middleware"
+	"url-shortener-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// capturingRecorder keeps every recorded event
+type capturingRecorder struct {
+	mu     sync.Mutex
+	events []models.ClickEvent
+}
+
+func (r *capturingRecorder) Record(event models.ClickEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func setupClickRouter(recorder models.ClickRecorder) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	redirect := func(c *gin.Context) {
+		if c.Param("short_code") == "missing" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "short URL not found"})
+			return
+		}
+		c.Redirect(http.StatusFound, "https://www.example.com")
+	}
+	router.GET("/urls/:short_code", middleware.ClickCaptureMiddleware(recorder), redirect)
+	router.HEAD("/urls/:short_code", middleware.ClickCaptureMiddleware(recorder), redirect)
+	return router
+}
+
+func TestClickCaptureMiddleware_RecordsRedirects(t *testing.T) {
+	recorder := &capturingRecorder{}
+	router := setupClickRouter(recorder)
+
+	req, _ := http.NewRequest("GET", "/urls/abc", nil)
+	req.RemoteAddr = "203.0.113.77:40000"
+	req.Header.Set("Referer", "https://news.example.com/story")
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(recorder.events) != 1 {
+		t.Fatalf("Recorded %d events, want 1", len(recorder.events))
+	}
+	event := recorder.events[0]
+	if event.ShortCode != "abc" || event.Timestamp.IsZero() {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	// The recorder locates the full address before truncating it
+	if event.IP != "203.0.113.77" {
+		t.Errorf("IP = %q, want the full 203.0.113.77", event.IP)
+	}
+	if event.Referrer != "https://news.example.com/story" || event.UserAgent != "Mozilla/5.0" || event.AcceptLanguage != "en-US,en;q=0.9" {
+		t.Errorf("Headers were not captured: %+v", event)
+	}
+	if event.Bot {
+		t.Errorf("Bot = true for a plain GET, want false")
+	}
+}
+
+func TestClickCaptureMiddleware_TrustsForwardedForOnlyFromProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		want    string
+	}{
+		{"no trusted proxies", nil, "10.0.0.5"},
+		{"trusted proxy", []string{"10.0.0.0/8"}, "198.51.100.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &capturingRecorder{}
+			router := setupClickRouter(recorder)
+			if err := router.SetTrustedProxies(tt.proxies); err != nil {
+				t.Fatalf("SetTrustedProxies() error = %v", err)
+			}
+
+			req, _ := http.NewRequest("GET", "/urls/abc", nil)
+			req.RemoteAddr = "10.0.0.5:40000"
+			req.Header.Set("X-Forwarded-For", "198.51.100.9")
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if len(recorder.events) != 1 || recorder.events[0].IP != tt.want {
+				t.Errorf("Recorded %+v, want one event with IP %q", recorder.events, tt.want)
+			}
+		})
+	}
+}
+
+func TestClickCaptureMiddleware_MarksHeadAndPrefetchAsBots(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		header string
+		value  string
+	}{
+		{"HEAD request", "HEAD", "", ""},
+		{"Purpose prefetch", "GET", "Purpose", "prefetch"},
+		{"Sec-Purpose prefetch", "GET", "Sec-Purpose", "prefetch;prerender"},
+		{"X-Purpose preview", "GET", "X-Purpose", "preview"},
+		{"X-Moz prefetch", "GET", "X-Moz", "prefetch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &capturingRecorder{}
+			router := setupClickRouter(recorder)
+
+			req, _ := http.NewRequest(tt.method, "/urls/abc", nil)
+			req.Header.Set("User-Agent", "Mozilla/5.0")
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if len(recorder.events) != 1 {
+				t.Fatalf("Recorded %d events, want 1", len(recorder.events))
+			}
+			if !recorder.events[0].Bot {
+				t.Errorf("Bot = false, want true")
+			}
+		})
+	}
+}
+
+func TestClickCaptureMiddleware_SkipsOtherResponses(t *testing.T) {
+	recorder := &capturingRecorder{}
+	router := setupClickRouter(recorder)
+
+	req, _ := http.NewRequest("GET", "/urls/missing", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(recorder.events) != 0 {
+		t.Errorf("Recorded %d events for a 404, want 0", len(recorder.events))
+	}
+}
+
+func TestClickCaptureMiddleware_BoundsHeaders(t *testing.T) {
+	recorder := &capturingRecorder{}
+	router := setupClickRouter(recorder)
+
+	req, _ := http.NewRequest("GET", "/urls/abc", nil)
+	req.Header.Set("User-Agent", strings.Repeat("a", 2000))
+	req.Header.Set("Referer", "https://example.com/\xff")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(recorder.events) != 1 {
+		t.Fatalf("Recorded %d events, want 1", len(recorder.events))
+	}
+	if got := len(recorder.events[0].UserAgent); got != 512 {
+		t.Errorf("User agent length = %d, want 512", got)
+	}
+	if recorder.events[0].Referrer != "https://example.com/" {
+		t.Errorf("Referrer = %q, want invalid UTF-8 dropped", recorder.events[0].Referrer)
+	}
+}
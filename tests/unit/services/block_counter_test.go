@@ -0,0 +1,134 @@
+package services_test
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"url-shortener-api/services"
+)
+
+// countingAllocator records how often the shared counter is hit
+type countingAllocator struct {
+	*services.MemoryCounter
+	mu     sync.Mutex
+	leases int
+}
+
+func (a *countingAllocator) AllocateBlock(size int64) (int64, int64, error) {
+	a.mu.Lock()
+	a.leases++
+	a.mu.Unlock()
+	return a.MemoryCounter.AllocateBlock(size)
+}
+
+func TestBlockCounter_LeasesOneBlockPerBlockSize(t *testing.T) {
+	shared := &countingAllocator{MemoryCounter: services.NewMemoryCounter()}
+	counter := services.NewBlockCounter(shared, 10)
+
+	for want := int64(1); want <= 25; want++ {
+		got, err := counter.GetNextCounter()
+		if err != nil {
+			t.Fatalf("GetNextCounter() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("GetNextCounter() = %d, want %d", got, want)
+		}
+	}
+
+	if shared.leases != 3 {
+		t.Errorf("Shared counter leased %d blocks, want 3", shared.leases)
+	}
+
+	current, _ := counter.GetCurrentCounter()
+	if current != 30 {
+		t.Errorf("GetCurrentCounter() = %d, want the high-water mark 30", current)
+	}
+}
+
+func TestBlockCounter_RestartNeverReissues(t *testing.T) {
+	shared := services.NewMemoryCounter()
+
+	first := services.NewBlockCounter(shared, 100)
+	for i := 0; i < 3; i++ {
+		first.GetNextCounter()
+	}
+
+	// A new instance (or a restarted one) starts after the abandoned block
+	second := services.NewBlockCounter(shared, 100)
+	got, err := second.GetNextCounter()
+	if err != nil {
+		t.Fatalf("GetNextCounter() error = %v", err)
+	}
+	if got != 101 {
+		t.Errorf("GetNextCounter() after restart = %d, want 101", got)
+	}
+}
+
+func TestBlockCounter_ConcurrentInstancesAreUnique(t *testing.T) {
+	shared := services.NewMemoryCounter()
+	instances := []*services.BlockCounter{
+		services.NewBlockCounter(shared, 7),
+		services.NewBlockCounter(shared, 7),
+		services.NewBlockCounter(shared, 7),
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int64]bool)
+	var wg sync.WaitGroup
+	for _, instance := range instances {
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(counter *services.BlockCounter) {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					value, err := counter.GetNextCounter()
+					if err != nil {
+						t.Errorf("GetNextCounter() error = %v", err)
+						return
+					}
+					mu.Lock()
+					if seen[value] {
+						t.Errorf("Value %d issued twice", value)
+					}
+					seen[value] = true
+					mu.Unlock()
+				}
+			}(instance)
+		}
+	}
+	wg.Wait()
+
+	if len(seen) != 600 {
+		t.Errorf("Issued %d unique values, want 600", len(seen))
+	}
+}
+
+func TestBoltCounter_AllocateBlockIsDurable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.db")
+	db, err := services.OpenBoltDB(path, time.Second)
+	if err != nil {
+		t.Fatalf("OpenBoltDB() error = %v", err)
+	}
+
+	start, end, err := services.NewBoltCounter(db).AllocateBlock(1000)
+	if err != nil {
+		t.Fatalf("AllocateBlock() error = %v", err)
+	}
+	if start != 1 || end != 1000 {
+		t.Errorf("AllocateBlock() = [%d, %d], want [1, 1000]", start, end)
+	}
+	db.Close()
+
+	db, err = services.OpenBoltDB(path, time.Second)
+	if err != nil {
+		t.Fatalf("OpenBoltDB() reopen error = %v", err)
+	}
+	defer db.Close()
+
+	next, _ := services.NewBoltCounter(db).GetNextCounter()
+	if next != 1001 {
+		t.Errorf("GetNextCounter() after reopen = %d, want 1001", next)
+	}
+}
@@ -0,0 +1,136 @@
+package services_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestBoltStorage_PersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "persist.db")
+
+	db, err := services.OpenBoltDB(path, time.Second)
+	if err != nil {
+		t.Fatalf("OpenBoltDB() error = %v", err)
+	}
+
+	storage := services.NewBoltURLStorage(db)
+	counter := services.NewBoltCounter(db)
+
+	for i := 0; i < 3; i++ {
+		if _, err := counter.GetNextCounter(); err != nil {
+			t.Fatalf("GetNextCounter() error = %v", err)
+		}
+	}
+	if err := storage.Store("persist", models.URLMapping{OriginalURL: "https://www.example.com", Alias: "persist", UserID: "user123"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	db.Close()
+
+	db, err = services.OpenBoltDB(path, time.Second)
+	if err != nil {
+		t.Fatalf("OpenBoltDB() reopen error = %v", err)
+	}
+	defer db.Close()
+
+	storage = services.NewBoltURLStorage(db)
+	counter = services.NewBoltCounter(db)
+
+	next, err := counter.GetNextCounter()
+	if err != nil {
+		t.Fatalf("GetNextCounter() error = %v", err)
+	}
+	if next != 4 {
+		t.Errorf("GetNextCounter() after reopen = %d, want 4", next)
+	}
+
+	retrieved, exists, err := storage.GetByAlias("persist")
+	if err != nil || !exists {
+		t.Fatalf("GetByAlias() exists = %v, error = %v", exists, err)
+	}
+	if retrieved.OriginalURL != "https://www.example.com" {
+		t.Errorf("GetByAlias() OriginalURL = %v, want %v", retrieved.OriginalURL, "https://www.example.com")
+	}
+
+	// Alias uniqueness is enforced from the persisted index
+	err = storage.Store("other", models.URLMapping{OriginalURL: "https://www.other.com", Alias: "persist"})
+	if err != models.ErrAliasAlreadyExists {
+		t.Errorf("Store() error = %v, want %v", err, models.ErrAliasAlreadyExists)
+	}
+}
+
+func TestBoltStorage_DeleteExpired(t *testing.T) {
+	db, err := services.OpenBoltDB(filepath.Join(t.TempDir(), "expiry.db"), time.Second)
+	if err != nil {
+		t.Fatalf("OpenBoltDB() error = %v", err)
+	}
+	defer db.Close()
+	storage := services.NewBoltURLStorage(db)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	storage.Store("expired", models.URLMapping{OriginalURL: "https://www.example1.com", UserID: "user123", ExpirationTimestamp: &past})
+	storage.Store("active", models.URLMapping{OriginalURL: "https://www.example2.com", UserID: "user123", ExpirationTimestamp: &future})
+
+	// Moving the expiration forward must re-index the mapping
+	storage.Update("active", models.URLMapping{OriginalURL: "https://www.example2.com", UserID: "user123", ExpirationTimestamp: &future})
+
+	deleted, err := storage.DeleteExpired(time.Now())
+	if err != nil {
+		t.Fatalf("DeleteExpired() error = %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteExpired() deleted %d mappings, want 1", deleted)
+	}
+
+	mappings, err := storage.GetByUserID("user123")
+	if err != nil {
+		t.Fatalf("GetByUserID() error = %v", err)
+	}
+	if len(mappings) != 1 || mappings[0].ShortURL != "active" {
+		t.Errorf("GetByUserID() after sweep = %v, want only the active mapping", mappings)
+	}
+}
+
+func TestBoltStorage_BackfillsCreationIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backfill.db")
+
+	db, err := services.OpenBoltDB(path, time.Second)
+	if err != nil {
+		t.Fatalf("OpenBoltDB() error = %v", err)
+	}
+	storage := services.NewBoltURLStorage(db)
+	for _, shortCode := range []string{"old1", "old2"} {
+		if err := storage.Store(shortCode, models.URLMapping{OriginalURL: "https://www.example.com", UserID: "user123"}); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	// Simulate a file written before the index existed
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket([]byte("url_user_created_index"))
+	})
+	if err != nil {
+		t.Fatalf("DeleteBucket() error = %v", err)
+	}
+	db.Close()
+
+	db, err = services.OpenBoltDB(path, time.Second)
+	if err != nil {
+		t.Fatalf("OpenBoltDB() reopen error = %v", err)
+	}
+	defer db.Close()
+
+	listed, err := services.NewBoltURLStorage(db).ListByUserID(models.URLListQuery{UserID: "user123", Limit: 10, Ascending: true})
+	if err != nil {
+		t.Fatalf("ListByUserID() error = %v", err)
+	}
+	if len(listed) != 2 || listed[0].ShortURL != "old1" || listed[1].ShortURL != "old2" {
+		t.Errorf("ListByUserID() after reopen returned %d mappings, want old1 and old2", len(listed))
+	}
+}
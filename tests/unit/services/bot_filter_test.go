@@ -0,0 +1,79 @@
+package services_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"url-shortener-api/services"
+)
+
+func TestBotFilter_DefaultPatterns(t *testing.T) {
+	filter := services.NewBotFilter("", 0)
+
+	tests := []struct {
+		userAgent string
+		want      bool
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", false},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1", false},
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", true},
+		{"Twitterbot/1.0", true},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", true},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", true},
+		{"Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)", true},
+		{"curl/8.4.0", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		if got := filter.IsBot(tt.userAgent); got != tt.want {
+			t.Errorf("IsBot(%q) = %v, want %v", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestBotFilter_ReloadsPatternsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot-patterns.txt")
+
+	// The built-in patterns stay in use until the file appears
+	filter := services.NewBotFilter(path, 0)
+	filter.Start()
+	defer filter.Stop()
+	if !filter.IsBot("curl/8.4.0") {
+		t.Errorf("IsBot() without a patterns file = false, want the built-in patterns")
+	}
+
+	if err := os.WriteFile(path, []byte("# Internal monitors\nAcme-Monitor\n\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if reloaded, err := filter.Reload(); err != nil || !reloaded {
+		t.Fatalf("Reload() = %v, %v, want the new file loaded", reloaded, err)
+	}
+	if !filter.IsBot("acme-monitor/2.1") {
+		t.Errorf("IsBot() = false for a pattern from the file, want true")
+	}
+	if filter.IsBot("curl/8.4.0") {
+		t.Errorf("IsBot() = true for a built-in pattern, want the file to replace them")
+	}
+
+	// An unchanged file is not read again
+	if reloaded, err := filter.Reload(); err != nil || reloaded {
+		t.Errorf("Reload() of an unchanged file = %v, %v, want false", reloaded, err)
+	}
+
+	// A replaced file is picked up
+	if err := os.WriteFile(path, []byte("curl/\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	if reloaded, err := filter.Reload(); err != nil || !reloaded {
+		t.Fatalf("Reload() = %v, %v, want the replaced file loaded", reloaded, err)
+	}
+	if !filter.IsBot("curl/8.4.0") || filter.IsBot("acme-monitor/2.1") {
+		t.Errorf("IsBot() after reload did not use the replaced patterns")
+	}
+}
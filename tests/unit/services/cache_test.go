@@ -0,0 +1,125 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+)
+
+func TestLRUCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache := services.NewLRUCache(2)
+
+	cache.Set(ctx, "a", "1", 0)
+	cache.Set(ctx, "b", "2", 0)
+
+	// Touch "a" so "b" becomes the least recently used entry
+	if _, err := cache.Get(ctx, "a"); err != nil {
+		t.Fatalf("Get(a) error = %v", err)
+	}
+	cache.Set(ctx, "c", "3", 0)
+
+	if _, err := cache.Get(ctx, "b"); err != models.ErrCacheMiss {
+		t.Errorf("Get(b) error = %v, want %v", err, models.ErrCacheMiss)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := cache.Get(ctx, key); err != nil {
+			t.Errorf("Get(%s) error = %v", key, err)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+}
+
+func TestLRUCache_RespectsTTL(t *testing.T) {
+	ctx := context.Background()
+	cache := services.NewLRUCache(10)
+
+	cache.Set(ctx, "short", "value", 5*time.Millisecond)
+	cache.Set(ctx, "forever", "value", 0)
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := cache.Get(ctx, "short"); err != models.ErrCacheMiss {
+		t.Errorf("Get(short) error = %v, want %v", err, models.ErrCacheMiss)
+	}
+	if _, err := cache.Get(ctx, "forever"); err != nil {
+		t.Errorf("Get(forever) error = %v", err)
+	}
+}
+
+func TestTieredCache_CountsHitsPerTier(t *testing.T) {
+	ctx := context.Background()
+	remote := services.NewLRUCache(100)
+	cache := services.NewTieredCache(services.NewLRUCache(100), remote, time.Minute, nil)
+
+	remote.Set(ctx, "url:abc", "https://www.example.com", time.Hour)
+
+	// First read misses locally and is promoted from the remote tier
+	for i := 0; i < 3; i++ {
+		value, err := cache.Get(ctx, "url:abc")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if value != "https://www.example.com" {
+			t.Errorf("Get() = %v, want %v", value, "https://www.example.com")
+		}
+	}
+
+	if _, err := cache.Get(ctx, "url:missing"); err != models.ErrCacheMiss {
+		t.Errorf("Get(missing) error = %v, want %v", err, models.ErrCacheMiss)
+	}
+
+	want := services.TieredCacheStats{
+		Local:  services.CacheTierStats{Hits: 2, Misses: 2},
+		Remote: services.CacheTierStats{Hits: 1, Misses: 1},
+	}
+	if stats := cache.Stats(); stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestTieredCache_LocalTTLNeverOutlivesRemote(t *testing.T) {
+	ctx := context.Background()
+	remote := services.NewLRUCache(100)
+	local := services.NewLRUCache(100)
+	cache := services.NewTieredCache(local, remote, time.Hour, nil)
+
+	remote.Set(ctx, "url:soon", "https://www.example.com", 5*time.Millisecond)
+	if _, err := cache.Get(ctx, "url:soon"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := local.Get(ctx, "url:soon"); err != models.ErrCacheMiss {
+		t.Errorf("Local entry should expire with the remote TTL, got error = %v", err)
+	}
+}
+
+func TestTieredCache_DeleteRemovesBothTiers(t *testing.T) {
+	ctx := context.Background()
+	remote := services.NewLRUCache(100)
+	local := services.NewLRUCache(100)
+	cache := services.NewTieredCache(local, remote, time.Minute, nil)
+
+	for i := 0; i < 3; i++ {
+		cache.Set(ctx, fmt.Sprintf("url:%d", i), "https://www.example.com", time.Hour)
+	}
+	cache.Delete(ctx, "url:1")
+
+	if _, err := local.Get(ctx, "url:1"); err != models.ErrCacheMiss {
+		t.Errorf("Local tier still holds deleted key")
+	}
+	if _, err := remote.Get(ctx, "url:1"); err != models.ErrCacheMiss {
+		t.Errorf("Remote tier still holds deleted key")
+	}
+	if local.Len() != 2 || remote.Len() != 2 {
+		t.Errorf("Tiers hold %d/%d entries, want 2/2", local.Len(), remote.Len())
+	}
+}
@@ -0,0 +1,318 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+	"url-shortener-api/tests/testutils"
+)
+
+// batchRecordingStorage records the size of every stored batch and the events of those that succeed
+type batchRecordingStorage struct {
+	mu      sync.Mutex
+	batches []int
+	events  []models.ClickEvent
+	err     error
+}
+
+func (s *batchRecordingStorage) StoreClickEvents(events []models.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, len(events))
+	if s.err == nil {
+		s.events = append(s.events, events...)
+	}
+	return s.err
+}
+
+func (s *batchRecordingStorage) CountClicks(shortCodes []string, includeBots bool) (map[string]int64, error) {
+	return map[string]int64{}, nil
+}
+
+func (s *batchRecordingStorage) ClickStats(query models.ClickStatsQuery) (*models.ClickStats, error) {
+	return &models.ClickStats{}, nil
+}
+
+func (s *batchRecordingStorage) stored() (batches int, events int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, size := range s.batches {
+		events += size
+	}
+	return len(s.batches), events
+}
+
+func TestClickStorage_StoreAndCount(t *testing.T) {
+	storage, cleanup := testutils.CreateTestClickStorage(t)
+	defer cleanup()
+
+	now := time.Now()
+	events := []models.ClickEvent{
+		{ShortCode: "abc", Timestamp: now, Referrer: "https://news.example.com", IP: "203.0.113.0"},
+		{ShortCode: "abc", Timestamp: now.Add(time.Millisecond)},
+		{ShortCode: "xyz", Timestamp: now},
+		{ShortCode: "xyz", Timestamp: now.Add(time.Millisecond), Bot: true},
+		{ShortCode: "bot", Timestamp: now, Bot: true},
+	}
+	if err := storage.StoreClickEvents(events); err != nil {
+		t.Fatalf("StoreClickEvents() error = %v", err)
+	}
+	if err := storage.StoreClickEvents(events[:1]); err != nil {
+		t.Fatalf("StoreClickEvents() error = %v", err)
+	}
+
+	counts, err := storage.CountClicks([]string{"abc", "xyz", "bot", "none"}, false)
+	if err != nil {
+		t.Fatalf("CountClicks() error = %v", err)
+	}
+	if counts["abc"] != 3 || counts["xyz"] != 1 {
+		t.Errorf("CountClicks() = %v, want abc=3 xyz=1", counts)
+	}
+	if _, ok := counts["bot"]; ok {
+		t.Errorf("CountClicks() returned a total for a code with only bot clicks")
+	}
+	if _, ok := counts["none"]; ok {
+		t.Errorf("CountClicks() returned a total for a code without clicks")
+	}
+
+	counts, err = storage.CountClicks([]string{"abc", "xyz", "bot"}, true)
+	if err != nil {
+		t.Fatalf("CountClicks() with bots error = %v", err)
+	}
+	if counts["abc"] != 3 || counts["xyz"] != 2 || counts["bot"] != 1 {
+		t.Errorf("CountClicks() with bots = %v, want abc=3 xyz=2 bot=1", counts)
+	}
+}
+
+func TestClickStorage_ClickStats(t *testing.T) {
+	storage, cleanup := testutils.CreateTestClickStorage(t)
+	defer cleanup()
+
+	// Wednesday 2024-01-03 and the Monday after it
+	wednesday := time.Date(2024, 1, 3, 10, 30, 0, 0, time.UTC)
+	monday := time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC)
+	events := []models.ClickEvent{
+		{ShortCode: "abc", Timestamp: wednesday, ReferrerHost: "news.example.com", Browser: "Chrome", OS: "Windows", Device: "desktop", Language: "en-us", Country: "PT", Region: "Lisbon", City: "Lisbon"},
+		{ShortCode: "abc", Timestamp: wednesday.Add(10 * time.Minute), ReferrerHost: "news.example.com", Browser: "Safari", OS: "iOS", Device: "mobile", Language: "fr"},
+		{ShortCode: "abc", Timestamp: monday, Browser: "Chrome", OS: "Android", Device: "mobile", Language: "en-us", Country: "PT", Region: "Porto", City: "Porto"},
+		{ShortCode: "abc", Timestamp: monday.Add(30 * 24 * time.Hour), Browser: "Firefox"},
+		{ShortCode: "abc", Timestamp: monday.Add(time.Hour), ReferrerHost: "slack.com", Bot: true},
+		{ShortCode: "xyz", Timestamp: wednesday, Browser: "Firefox"},
+	}
+	if err := storage.StoreClickEvents(events); err != nil {
+		t.Fatalf("StoreClickEvents() error = %v", err)
+	}
+
+	stats, err := storage.ClickStats(models.ClickStatsQuery{
+		ShortCode: "abc",
+		From:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		Interval:  models.StatsIntervalWeek,
+		Top:       2,
+	})
+	if err != nil {
+		t.Fatalf("ClickStats() error = %v", err)
+	}
+
+	if stats.TotalClicks != 3 {
+		t.Errorf("TotalClicks = %d, want 3", stats.TotalClicks)
+	}
+	wantSeries := []models.ClickBucket{
+		{Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Clicks: 2},
+		{Start: time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC), Clicks: 1},
+	}
+	if len(stats.Series) != len(wantSeries) {
+		t.Fatalf("Series = %v, want %v", stats.Series, wantSeries)
+	}
+	for i, bucket := range wantSeries {
+		if !stats.Series[i].Start.Equal(bucket.Start) || stats.Series[i].Clicks != bucket.Clicks {
+			t.Errorf("Series[%d] = %v, want %v", i, stats.Series[i], bucket)
+		}
+	}
+
+	if len(stats.Referrers) != 2 || stats.Referrers[0] != (models.ClickCount{Value: "news.example.com", Clicks: 2}) {
+		t.Errorf("Referrers = %v, want news.example.com first", stats.Referrers)
+	}
+	if len(stats.Browsers) != 2 || stats.Browsers[0] != (models.ClickCount{Value: "Chrome", Clicks: 2}) {
+		t.Errorf("Browsers = %v, want Chrome first", stats.Browsers)
+	}
+	if len(stats.OperatingSystems) != 2 {
+		t.Errorf("OperatingSystems = %v, want the top 2", stats.OperatingSystems)
+	}
+	if len(stats.Devices) != 2 || stats.Devices[0] != (models.ClickCount{Value: "mobile", Clicks: 2}) {
+		t.Errorf("Devices = %v, want mobile first", stats.Devices)
+	}
+	if len(stats.Languages) != 2 || stats.Languages[0] != (models.ClickCount{Value: "en-us", Clicks: 2}) {
+		t.Errorf("Languages = %v, want en-us first", stats.Languages)
+	}
+	if len(stats.Countries) != 2 || stats.Countries[0] != (models.ClickCount{Value: "PT", Clicks: 2}) {
+		t.Errorf("Countries = %v, want PT first", stats.Countries)
+	}
+
+	withBots, err := storage.ClickStats(models.ClickStatsQuery{
+		ShortCode:   "abc",
+		From:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:          time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		Interval:    models.StatsIntervalWeek,
+		Top:         5,
+		IncludeBots: true,
+	})
+	if err != nil {
+		t.Fatalf("ClickStats() with bots error = %v", err)
+	}
+	if withBots.TotalClicks != 4 || len(withBots.Series) != 2 || withBots.Series[1].Clicks != 2 {
+		t.Errorf("ClickStats() with bots = %d clicks in %v, want 4 with 2 in the second week", withBots.TotalClicks, withBots.Series)
+	}
+	if len(withBots.Referrers) != 3 {
+		t.Errorf("Referrers with bots = %v, want the bot's referrer included", withBots.Referrers)
+	}
+}
+
+// fixedLocator places 203.0.113.77 in Lisbon and nothing else anywhere
+type fixedLocator struct{}
+
+func (fixedLocator) Locate(ip string) models.GeoLocation {
+	if ip == "203.0.113.77" {
+		return models.GeoLocation{Country: "PT", Region: "Lisbon", City: "Lisbon"}
+	}
+	return models.GeoLocation{}
+}
+
+func TestClickRecorder_LocatesThenTruncatesIP(t *testing.T) {
+	storage := &batchRecordingStorage{}
+	recorder := services.NewClickRecorder(storage, fixedLocator{}, nil, nil, nil, 100, 10, time.Hour)
+	recorder.Start()
+
+	recorder.Record(models.ClickEvent{ShortCode: "abc", Timestamp: time.Now(), IP: "203.0.113.77"})
+	recorder.Record(models.ClickEvent{ShortCode: "abc", Timestamp: time.Now(), IP: "2001:db8:85a3:1234:5678:8a2e:370:7334"})
+	recorder.Record(models.ClickEvent{ShortCode: "abc", Timestamp: time.Now(), IP: "not an ip"})
+	recorder.Stop()
+
+	if len(storage.events) != 3 {
+		t.Fatalf("Stored %d events, want 3", len(storage.events))
+	}
+	located := storage.events[0]
+	if located.IP != "203.0.113.0" || located.Country != "PT" || located.Region != "Lisbon" || located.City != "Lisbon" {
+		t.Errorf("First event = %+v, want the /24 located in Lisbon", located)
+	}
+	if storage.events[1].IP != "2001:db8:85a3::" || storage.events[1].Country != "" {
+		t.Errorf("Second event = %+v, want the /48 without a location", storage.events[1])
+	}
+	if storage.events[2].IP != "" {
+		t.Errorf("Third event IP = %q, want an invalid address dropped", storage.events[2].IP)
+	}
+}
+
+func TestClickRecorder_FlushesInBatches(t *testing.T) {
+	storage := &batchRecordingStorage{}
+	recorder := services.NewClickRecorder(storage, nil, nil, nil, nil, 100, 10, time.Hour)
+	recorder.Start()
+	defer recorder.Stop()
+
+	for i := 0; i < 25; i++ {
+		recorder.Record(models.ClickEvent{ShortCode: "abc", Timestamp: time.Now()})
+	}
+
+	// Two full batches are stored without waiting for the flush interval
+	testutils.WaitFor(t, time.Second, func() bool {
+		batches, _ := storage.stored()
+		return batches == 2
+	}, "full batches were not stored")
+}
+
+func TestClickRecorder_DrainsBufferOnStop(t *testing.T) {
+	storage := &batchRecordingStorage{}
+	recorder := services.NewClickRecorder(storage, nil, nil, nil, nil, 100, 10, time.Hour)
+	recorder.Start()
+
+	for i := 0; i < 25; i++ {
+		recorder.Record(models.ClickEvent{ShortCode: "abc", Timestamp: time.Now()})
+	}
+	recorder.Stop()
+
+	if _, events := storage.stored(); events != 25 {
+		t.Errorf("Stored %d events after Stop, want 25", events)
+	}
+}
+
+func TestClickRecorder_DropsWhenBufferIsFull(t *testing.T) {
+	storage := &batchRecordingStorage{}
+	recorder := services.NewClickRecorder(storage, nil, nil, nil, nil, 5, 10, time.Hour)
+
+	// Without a running worker nothing drains the buffer, so Record must not block
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 8; i++ {
+			recorder.Record(models.ClickEvent{ShortCode: "abc", Timestamp: time.Now()})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Record() blocked on a full buffer")
+	}
+
+	recorder.Start()
+	recorder.Stop()
+	if _, events := storage.stored(); events != 5 {
+		t.Errorf("Stored %d events, want the 5 that fit in the buffer", events)
+	}
+}
+
+func TestClickRecorder_DiscardsFailedBatches(t *testing.T) {
+	storage := &batchRecordingStorage{err: errors.New("storage unavailable")}
+	recorder := services.NewClickRecorder(storage, nil, nil, nil, nil, 100, 2, time.Hour)
+	recorder.Start()
+
+	for i := 0; i < 4; i++ {
+		recorder.Record(models.ClickEvent{ShortCode: "abc", Timestamp: time.Now()})
+	}
+	recorder.Stop()
+
+	// Each failed batch is attempted once and not retried
+	if batches, _ := storage.stored(); batches != 2 {
+		t.Errorf("Attempted %d batches, want 2", batches)
+	}
+}
+
+// prefixBots treats every user agent starting with "bot" as a bot
+type prefixBots struct{}
+
+func (prefixBots) IsBot(userAgent string) bool {
+	return strings.HasPrefix(userAgent, "bot")
+}
+
+func TestClickRecorder_ClassifiesBotsAndSkipsTheirVisitors(t *testing.T) {
+	storage := &batchRecordingStorage{}
+	visitors := services.NewMemoryVisitorCounter(24 * time.Hour)
+	recorder := services.NewClickRecorder(storage, nil, prefixBots{}, visitors, nil, 100, 10, time.Hour)
+	recorder.Start()
+
+	now := time.Now()
+	recorder.Record(models.ClickEvent{ShortCode: "abc", Timestamp: now, IP: "203.0.113.1", UserAgent: "Mozilla/5.0"})
+	recorder.Record(models.ClickEvent{ShortCode: "abc", Timestamp: now, IP: "203.0.113.2", UserAgent: "bot/1.0"})
+	recorder.Record(models.ClickEvent{ShortCode: "abc", Timestamp: now, IP: "203.0.113.3", UserAgent: "Mozilla/5.0", Bot: true})
+	recorder.Stop()
+
+	if len(storage.events) != 3 {
+		t.Fatalf("Stored %d events, want 3", len(storage.events))
+	}
+	if storage.events[0].Bot || !storage.events[1].Bot || !storage.events[2].Bot {
+		t.Errorf("Bot = %v, %v, %v, want false, true, true", storage.events[0].Bot, storage.events[1].Bot, storage.events[2].Bot)
+	}
+
+	count, err := visitors.CountVisitors("abc", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CountVisitors() error = %v", err)
+	}
+	if count != 1 {
+		t.Errorf("CountVisitors() = %d, want only the human visitor", count)
+	}
+}
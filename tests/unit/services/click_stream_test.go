@@ -0,0 +1,233 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+	"url-shortener-api/tests/testutils"
+)
+
+// clickStreamOwners returns storage where alice owns abc and xyz, bob owns other and anon has no owner
+func clickStreamOwners(t *testing.T) models.URLRepository {
+	t.Helper()
+
+	storage := services.NewMemoryURLStorage()
+	for shortCode, owner := range map[string]string{"abc": "alice", "xyz": "alice", "other": "bob", "anon": ""} {
+		mapping := models.URLMapping{ShortURL: shortCode, OriginalURL: "https://www.example.com", UserID: owner}
+		if err := storage.Store(shortCode, mapping); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+	return storage
+}
+
+// nextClickMessage waits for the next message of a subscription, failing the test when none arrives
+func nextClickMessage(t *testing.T, subscription models.ClickSubscription) models.ClickStreamMessage {
+	t.Helper()
+
+	select {
+	case message, ok := <-subscription.Messages():
+		if !ok {
+			t.Fatal("Subscription ended early")
+		}
+		return message
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a live click")
+	}
+	return models.ClickStreamMessage{}
+}
+
+// nextClick waits for the next message of a subscription and checks it is a click of shortCode
+func nextClick(t *testing.T, subscription models.ClickSubscription, shortCode string) models.LiveClick {
+	t.Helper()
+
+	message := nextClickMessage(t, subscription)
+	if message.Click == nil || message.Click.ShortCode != shortCode || message.ID != message.Click.ID {
+		t.Fatalf("Got %+v, want a click of %s", message, shortCode)
+	}
+	return *message.Click
+}
+
+// clickStreamTests runs the same checks against every ClickStream implementation
+func clickStreamTests(t *testing.T, stream models.ClickStream) {
+	firehose, err := stream.Subscribe(models.ClickStreamFilter{UserID: "alice"}, "")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer firehose.Close()
+	single, err := stream.Subscribe(models.ClickStreamFilter{UserID: "alice", ShortCode: "abc"}, "")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer single.Close()
+
+	now := time.Now().UTC()
+	err = stream.PublishClicks([]models.ClickEvent{
+		{ShortCode: "abc", Timestamp: now, Browser: "Firefox"},
+		{ShortCode: "other", Timestamp: now},
+		{ShortCode: "xyz", Timestamp: now},
+		{ShortCode: "anon", Timestamp: now},
+		{ShortCode: "abc", Timestamp: now, Bot: true},
+	})
+	if err != nil {
+		t.Fatalf("PublishClicks() error = %v", err)
+	}
+
+	// The firehose gets every link of its user, without bots
+	first := nextClick(t, firehose, "abc")
+	if first.UserID != "alice" || first.Browser != "Firefox" || !first.Timestamp.Equal(now) {
+		t.Errorf("First click = %+v, want alice's Firefox click", first)
+	}
+	second := nextClick(t, firehose, "xyz")
+	if second.ID <= first.ID {
+		t.Errorf("Second ID %q does not come after %q", second.ID, first.ID)
+	}
+
+	// A subscription to one link gets only its clicks; the marker shows nothing else was queued
+	nextClick(t, single, "abc")
+	if err := stream.PublishClicks([]models.ClickEvent{{ShortCode: "abc", Timestamp: now, Referrer: "marker"}}); err != nil {
+		t.Fatalf("PublishClicks() error = %v", err)
+	}
+	if marker := nextClick(t, single, "abc"); marker.Referrer != "marker" {
+		t.Errorf("Got %+v, want the marker click", marker)
+	}
+
+	// Resuming after the first click replays the rest, bots included when asked for
+	resumed, err := stream.Subscribe(models.ClickStreamFilter{UserID: "alice", IncludeBots: true}, first.ID)
+	if err != nil {
+		t.Fatalf("Subscribe() with a last event ID error = %v", err)
+	}
+	defer resumed.Close()
+	if click := nextClick(t, resumed, "xyz"); click.ID != second.ID {
+		t.Errorf("Replayed ID = %q, want %q", click.ID, second.ID)
+	}
+	if bot := nextClick(t, resumed, "abc"); !bot.Bot {
+		t.Errorf("Replayed %+v, want the bot click", bot)
+	}
+	if marker := nextClick(t, resumed, "abc"); marker.Referrer != "marker" {
+		t.Errorf("Replayed %+v, want the marker click", marker)
+	}
+}
+
+func TestMemoryClickStream(t *testing.T) {
+	stream := services.NewMemoryClickStream(clickStreamOwners(t), 100, 0)
+	stream.Start()
+	defer stream.Stop()
+
+	clickStreamTests(t, stream)
+}
+
+func TestRedisClickStream(t *testing.T) {
+	_, client := testutils.SetupMiniRedis(t)
+	stream := services.NewRedisClickStream(client, clickStreamOwners(t), 100, 0)
+	stream.Start()
+	defer stream.Stop()
+
+	clickStreamTests(t, stream)
+}
+
+func TestMemoryClickStream_HeartbeatsCarryTheLatestID(t *testing.T) {
+	stream := services.NewMemoryClickStream(clickStreamOwners(t), 100, 20*time.Millisecond)
+	stream.Start()
+	defer stream.Stop()
+
+	subscription, err := stream.Subscribe(models.ClickStreamFilter{UserID: "alice", ShortCode: "xyz"}, "")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer subscription.Close()
+
+	// Before any click there is no ID to carry
+	if message := nextClickMessage(t, subscription); message.Click != nil || message.ID != "" {
+		t.Errorf("Got %+v, want an empty heartbeat", message)
+	}
+
+	// Clicks of other links move the heartbeat ID without being sent
+	if err := stream.PublishClicks([]models.ClickEvent{{ShortCode: "abc", Timestamp: time.Now()}}); err != nil {
+		t.Fatalf("PublishClicks() error = %v", err)
+	}
+	testutils.WaitFor(t, 2*time.Second, func() bool {
+		message := nextClickMessage(t, subscription)
+		if message.Click != nil {
+			t.Fatalf("Got %+v, want only heartbeats", message)
+		}
+		return message.ID != ""
+	}, "a heartbeat with the click's ID")
+}
+
+func TestMemoryClickStream_DropsSlowSubscribers(t *testing.T) {
+	stream := services.NewMemoryClickStream(clickStreamOwners(t), 1000, 0)
+	stream.Start()
+	defer stream.Stop()
+
+	subscription, err := stream.Subscribe(models.ClickStreamFilter{UserID: "alice"}, "")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer subscription.Close()
+
+	// Nobody reads while far more clicks arrive than a subscriber may queue
+	events := make([]models.ClickEvent, 500)
+	for i := range events {
+		events[i] = models.ClickEvent{ShortCode: "abc", Timestamp: time.Now()}
+	}
+	if err := stream.PublishClicks(events); err != nil {
+		t.Fatalf("PublishClicks() error = %v", err)
+	}
+
+	received, lastID := 0, ""
+	for message := range subscription.Messages() {
+		received++
+		lastID = message.ID
+	}
+	if received == 0 || received >= len(events) {
+		t.Fatalf("Received %d clicks before the subscription ended, want some but not all", received)
+	}
+
+	// The client resumes from the last ID it got and misses nothing
+	resumed, err := stream.Subscribe(models.ClickStreamFilter{UserID: "alice"}, lastID)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer resumed.Close()
+	for received < len(events) {
+		nextClick(t, resumed, "abc")
+		received++
+	}
+}
+
+func TestRedisClickStream_CatchesUpAfterDrop(t *testing.T) {
+	server, client := testutils.SetupMiniRedis(t)
+	storage := clickStreamOwners(t)
+
+	// One instance publishes while another delivers to its subscriber
+	publisher := services.NewRedisClickStream(client, storage, 100, 0)
+	subscriber := services.NewRedisClickStream(client, storage, 100, 0)
+	subscriber.Start()
+	defer subscriber.Stop()
+
+	subscription, err := subscriber.Subscribe(models.ClickStreamFilter{UserID: "alice"}, "")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer subscription.Close()
+
+	if err := publisher.PublishClicks([]models.ClickEvent{{ShortCode: "abc", Timestamp: time.Now()}}); err != nil {
+		t.Fatalf("PublishClicks() error = %v", err)
+	}
+	nextClick(t, subscription, "abc")
+
+	// A click published while the subscriber is disconnected never reaches it over pub/sub
+	server.Close()
+	if err := server.Restart(); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	if err := publisher.PublishClicks([]models.ClickEvent{{ShortCode: "xyz", Timestamp: time.Now()}}); err != nil {
+		t.Fatalf("PublishClicks() after restart error = %v", err)
+	}
+
+	// It is read back from the stream once the subscriber is back
+	nextClick(t, subscription, "xyz")
+}
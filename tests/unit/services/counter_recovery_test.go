@@ -0,0 +1,235 @@
+package services_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"url-shortener-api/config"
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+)
+
+func TestCounterRecovery_RaisesCounterAboveStoredCodes(t *testing.T) {
+	storage := services.NewMemoryURLStorage()
+	encoder := services.NewBase62Encoder()
+	for _, counter := range []int64{5, 3843, 62} {
+		if err := storage.Store(encoder.Encode(counter), models.URLMapping{OriginalURL: "https://www.example.com"}); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+	// Aliases and codes the generator could never produce are ignored
+	storage.Store("zzzzzzzz", models.URLMapping{OriginalURL: "https://www.example.com", Alias: "zzzzzzzz"})
+	storage.Store("zzzzzzzzzzzz", models.URLMapping{OriginalURL: "https://www.example.com"})
+
+	counter := services.NewMemoryCounter()
+	counter.SeedCounter(100)
+
+	gap, err := services.NewCounterRecovery(storage, counter, services.ShortCodeFormat{}).Recover()
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if gap != 3743 {
+		t.Errorf("Recover() gap = %d, want 3743", gap)
+	}
+
+	next, _ := counter.GetNextCounter()
+	if next != 3844 {
+		t.Errorf("GetNextCounter() after recovery = %d, want 3844", next)
+	}
+}
+
+func TestCounterRecovery_NeverLowersCounter(t *testing.T) {
+	storage := services.NewMemoryURLStorage()
+	storage.Store("A", models.URLMapping{OriginalURL: "https://www.example.com"})
+
+	counter := services.NewMemoryCounter()
+	counter.SeedCounter(500)
+
+	gap, err := services.NewCounterRecovery(storage, counter, services.ShortCodeFormat{}).Recover()
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if gap != 0 {
+		t.Errorf("Recover() gap = %d, want 0", gap)
+	}
+	if current, _ := counter.GetCurrentCounter(); current != 500 {
+		t.Errorf("GetCurrentCounter() = %d, want 500", current)
+	}
+}
+
+func TestCounterRecovery_UsesRecordedCounters(t *testing.T) {
+	cfg := &config.Config{
+		StorageBackend:  config.StorageSQL,
+		SQLDialect:      services.SQLDialectSQLite,
+		SQLDSN:          "file:" + filepath.Join(t.TempDir(), "recovery.sqlite"),
+		RestoreWindow:   time.Hour,
+		BatchMaxSize:    10,
+		ClickBufferSize: 100,
+		ClickBatchSize:  10,
+		Timeout:         time.Second,
+	}
+	factory, err := services.NewSQLServiceFactory(cfg)
+	if err != nil {
+		t.Fatalf("NewSQLServiceFactory() error = %v", err)
+	}
+	defer factory.Close()
+	service := factory.CreateURLService()
+
+	// Links record the counter value of their code, both one at a time and in batches
+	var shortCodes []string
+	response, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com"}, "user123")
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	shortCodes = append(shortCodes, response.ShortCode)
+	batch, err := service.CreateShortURLs(&models.URLBatchRequest{URLs: []models.URLRequest{{URL: "https://www.one.com"}, {URL: "https://www.two.com"}}}, "user123")
+	if err != nil {
+		t.Fatalf("CreateShortURLs() error = %v", err)
+	}
+	for _, result := range batch.Results {
+		shortCodes = append(shortCodes, result.ShortCode)
+	}
+
+	db, err := services.OpenSQLDB(cfg.SQLDialect, cfg.SQLDSN)
+	if err != nil {
+		t.Fatalf("OpenSQLDB() error = %v", err)
+	}
+	defer db.Close()
+	storage := services.NewSQLURLStorage(db, cfg.SQLDialect)
+
+	encoder := services.NewBase62Encoder()
+	var want int64
+	for _, shortCode := range shortCodes {
+		mapping, _, err := storage.Get(shortCode)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", shortCode, err)
+		}
+		counter, _ := encoder.Decode(shortCode)
+		if mapping.Counter != counter {
+			t.Errorf("Get(%s) counter = %d, want %d", shortCode, mapping.Counter, counter)
+		}
+		want = max(want, counter)
+	}
+
+	// Recovery needs no decoding, so a value the code could not reveal still counts
+	if err := storage.Store("custom", models.URLMapping{OriginalURL: "https://www.example.com", Counter: want + 100}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	counter := services.NewMemoryCounter()
+	gap, err := services.NewCounterRecovery(storage, counter, services.ShortCodeFormat{}).Recover()
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if gap != want+100 {
+		t.Errorf("Recover() gap = %d, want %d", gap, want+100)
+	}
+}
+
+func TestCounterRecovery_DurableBackends(t *testing.T) {
+	boltDB, err := services.OpenBoltDB(filepath.Join(t.TempDir(), "recovery.db"), time.Second)
+	if err != nil {
+		t.Fatalf("OpenBoltDB() error = %v", err)
+	}
+	defer boltDB.Close()
+	sqlDB := openTestSQLite(t)
+
+	backends := map[string]struct {
+		storage models.URLRepository
+		counter interface {
+			models.CounterService
+			models.CounterSeeder
+		}
+	}{
+		"bolt": {services.NewBoltURLStorage(boltDB), services.NewBoltCounter(boltDB)},
+		"sql":  {services.NewSQLURLStorage(sqlDB, services.SQLDialectSQLite), services.NewSQLCounter(sqlDB, services.SQLDialectSQLite)},
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			// A counter that lost its state while the mappings survived
+			for _, shortCode := range []string{"9", "1A", "Zz"} {
+				if err := backend.storage.Store(shortCode, models.URLMapping{OriginalURL: "https://www.example.com"}); err != nil {
+					t.Fatalf("Store() error = %v", err)
+				}
+			}
+
+			if _, err := services.NewCounterRecovery(backend.storage, backend.counter, services.ShortCodeFormat{}).Recover(); err != nil {
+				t.Fatalf("Recover() error = %v", err)
+			}
+
+			next, err := backend.counter.GetNextCounter()
+			if err != nil {
+				t.Fatalf("GetNextCounter() error = %v", err)
+			}
+			if want := int64(35*62 + 61 + 1); next != want {
+				t.Errorf("GetNextCounter() after recovery = %d, want %d", next, want)
+			}
+		})
+	}
+}
+
+func TestCounterRecovery_ScrambledCodes(t *testing.T) {
+	format := services.ShortCodeFormat{ScrambleKey: "test-secret", MinLength: 7}
+	generator := services.NewFormattedShortCodeGenerator(nil, format)
+
+	// Scrambled codes carry no order, so the highest counter can hide behind any code
+	storage := services.NewMemoryURLStorage()
+	for _, counter := range []int64{17, 900, 4} {
+		storage.Store(generator.Encode(counter), models.URLMapping{OriginalURL: "https://www.example.com"})
+	}
+
+	counter := services.NewMemoryCounter()
+	gap, err := services.NewCounterRecovery(storage, counter, format).Recover()
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if gap != 900 {
+		t.Errorf("Recover() gap = %d, want 900", gap)
+	}
+}
+
+func TestCounterRecovery_MinLengthDecrease(t *testing.T) {
+	boltDB, err := services.OpenBoltDB(filepath.Join(t.TempDir(), "recovery.db"), time.Second)
+	if err != nil {
+		t.Fatalf("OpenBoltDB() error = %v", err)
+	}
+	defer boltDB.Close()
+	sqlDB := openTestSQLite(t)
+
+	backends := map[string]struct {
+		storage models.URLRepository
+		counter interface {
+			models.CounterService
+			models.CounterSeeder
+		}
+	}{
+		"memory": {services.NewMemoryURLStorage(), services.NewMemoryCounter()},
+		"bolt":   {services.NewBoltURLStorage(boltDB), services.NewBoltCounter(boltDB)},
+		"sql":    {services.NewSQLURLStorage(sqlDB, services.SQLDialectSQLite), services.NewSQLCounter(sqlDB, services.SQLDialectSQLite)},
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			// Codes padded to 6 characters, then newer, larger ones after the minimum was lowered to 3
+			older := services.NewFormattedShortCodeGenerator(nil, services.ShortCodeFormat{MinLength: 6})
+			newer := services.NewFormattedShortCodeGenerator(nil, services.ShortCodeFormat{MinLength: 3})
+			shortCodes := []string{older.Encode(100), older.Encode(3000), newer.Encode(5000), newer.Encode(4000)}
+			for _, shortCode := range shortCodes {
+				if err := backend.storage.Store(shortCode, models.URLMapping{OriginalURL: "https://www.example.com"}); err != nil {
+					t.Fatalf("Store(%s) error = %v", shortCode, err)
+				}
+			}
+
+			format := services.ShortCodeFormat{MinLength: 3}
+			if _, err := services.NewCounterRecovery(backend.storage, backend.counter, format).Recover(); err != nil {
+				t.Fatalf("Recover() error = %v", err)
+			}
+
+			// The padded codes sort first by length, but the unpadded 5000 is the high-water mark
+			if current, _ := backend.counter.GetCurrentCounter(); current != 5000 {
+				t.Errorf("GetCurrentCounter() after recovery = %d, want 5000 (codes %v)", current, shortCodes)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+)
+
+func TestDeletionPurger_KeepsLinksWithinRestoreWindow(t *testing.T) {
+	storage := services.NewMemoryURLStorage()
+	purger := services.NewDeletionPurger(storage, 24*time.Hour, time.Hour)
+
+	expired := time.Now().Add(-25 * time.Hour)
+	restorable := time.Now().Add(-23 * time.Hour)
+	storage.Store("expired", models.URLMapping{OriginalURL: "https://www.example.com", DeletedAt: &expired})
+	storage.Store("restorable", models.URLMapping{OriginalURL: "https://www.example.com", DeletedAt: &restorable})
+
+	purged, err := purger.Purge()
+	if err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Purge() = %d, want 1", purged)
+	}
+	if exists, _ := storage.Exists("restorable"); !exists {
+		t.Errorf("A link still inside the restore window was purged")
+	}
+}
@@ -0,0 +1,113 @@
+package services_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// writeGeoIPDatabase writes a City database placing each network in a country and city
+func writeGeoIPDatabase(t *testing.T, path string, locations map[string]models.GeoLocation) {
+	t.Helper()
+
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: "GeoIP2-City", IncludeReservedNetworks: true})
+	if err != nil {
+		t.Fatalf("Failed to create GeoIP tree: %v", err)
+	}
+	for cidr, location := range locations {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("Invalid network %s: %v", cidr, err)
+		}
+		record := mmdbtype.Map{
+			"country":      mmdbtype.Map{"iso_code": mmdbtype.String(location.Country)},
+			"subdivisions": mmdbtype.Slice{mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(location.Region)}}},
+			"city":         mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(location.City)}},
+		}
+		if err := tree.Insert(network, record); err != nil {
+			t.Fatalf("Failed to insert %s: %v", cidr, err)
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create GeoIP database: %v", err)
+	}
+	defer file.Close()
+	if _, err := tree.WriteTo(file); err != nil {
+		t.Fatalf("Failed to write GeoIP database: %v", err)
+	}
+}
+
+func TestGeoIPLocator_Locate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoIP2-City.mmdb")
+	writeGeoIPDatabase(t, path, map[string]models.GeoLocation{
+		"203.0.113.0/24":     {Country: "PT", Region: "Lisbon", City: "Lisbon"},
+		"2001:db8:85a3::/48": {Country: "DE", Region: "Berlin", City: "Berlin"},
+	})
+
+	locator := services.NewGeoIPLocator(path, 0)
+	locator.Start()
+	defer locator.Stop()
+
+	tests := []struct {
+		ip   string
+		want models.GeoLocation
+	}{
+		{"203.0.113.77", models.GeoLocation{Country: "PT", Region: "Lisbon", City: "Lisbon"}},
+		{"2001:db8:85a3::1", models.GeoLocation{Country: "DE", Region: "Berlin", City: "Berlin"}},
+		{"198.51.100.1", models.GeoLocation{}},
+		{"not an ip", models.GeoLocation{}},
+	}
+	for _, tt := range tests {
+		if got := locator.Locate(tt.ip); got != tt.want {
+			t.Errorf("Locate(%q) = %+v, want %+v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestGeoIPLocator_ReloadsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoIP2-City.mmdb")
+
+	// A database that is not there yet leaves clicks unlocated until it appears
+	locator := services.NewGeoIPLocator(path, 0)
+	locator.Start()
+	defer locator.Stop()
+	if got := locator.Locate("203.0.113.77"); got != (models.GeoLocation{}) {
+		t.Errorf("Locate() without a database = %+v, want no location", got)
+	}
+
+	writeGeoIPDatabase(t, path, map[string]models.GeoLocation{"203.0.113.0/24": {Country: "PT"}})
+	if reloaded, err := locator.Reload(); err != nil || !reloaded {
+		t.Fatalf("Reload() = %v, %v, want the new file loaded", reloaded, err)
+	}
+	if got := locator.Locate("203.0.113.77").Country; got != "PT" {
+		t.Errorf("Locate() country = %q, want PT", got)
+	}
+
+	// An unchanged file is not read again
+	if reloaded, err := locator.Reload(); err != nil || reloaded {
+		t.Errorf("Reload() of an unchanged file = %v, %v, want false", reloaded, err)
+	}
+
+	// A replaced file is picked up
+	writeGeoIPDatabase(t, path, map[string]models.GeoLocation{"203.0.113.0/24": {Country: "ES"}})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	if reloaded, err := locator.Reload(); err != nil || !reloaded {
+		t.Fatalf("Reload() = %v, %v, want the replaced file loaded", reloaded, err)
+	}
+	if got := locator.Locate("203.0.113.77").Country; got != "ES" {
+		t.Errorf("Locate() country after reload = %q, want ES", got)
+	}
+}
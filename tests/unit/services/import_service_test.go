@@ -0,0 +1,368 @@
+package services_test
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+	"url-shortener-api/tests/testutils"
+)
+
+func TestImportStorage_ClaimAndSave(t *testing.T) {
+	storage, cleanup := testutils.CreateTestImportStorage(t)
+	defer cleanup()
+
+	now := time.Now()
+	job := models.ImportJob{
+		ID:        "0123456789abcdef01234567",
+		UserID:    "user123",
+		Format:    models.ImportFormatCSV,
+		Status:    models.ImportStatusQueued,
+		TotalRows: 3,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	rows := []models.ImportRow{
+		{Row: 1, URL: "https://www.one.com"},
+		{Row: 2, URL: "https://www.two.com", Tags: []string{"docs"}},
+		{Row: 4, URL: "https://www.four.com", Alias: "four"},
+	}
+	if err := storage.CreateImportJob(job, rows); err != nil {
+		t.Fatalf("CreateImportJob() error = %v", err)
+	}
+
+	remaining, err := storage.GetImportRows(job.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("GetImportRows() error = %v", err)
+	}
+	if len(remaining) != 2 || remaining[0].Row != 2 || remaining[1].Row != 4 || !reflect.DeepEqual(remaining[0].Tags, []string{"docs"}) {
+		t.Errorf("GetImportRows() = %+v, want rows 2 and 4", remaining)
+	}
+
+	if err := storage.SetImportRowShortCode(job.ID, 2, "abc123"); err != nil {
+		t.Fatalf("SetImportRowShortCode() error = %v", err)
+	}
+	remaining, err = storage.GetImportRows(job.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("GetImportRows() error = %v", err)
+	}
+	if len(remaining) != 3 || remaining[0].ShortCode != "" || remaining[1].ShortCode != "abc123" || remaining[1].URL != "https://www.two.com" {
+		t.Errorf("GetImportRows() after SetImportRowShortCode() = %+v, want row 2 with its short code", remaining)
+	}
+
+	claimed, ok, err := storage.ClaimImportJob(job.ID, "instance-a", now.Add(time.Minute))
+	if err != nil || !ok {
+		t.Fatalf("ClaimImportJob() = %v, %v; want a claim", ok, err)
+	}
+	if claimed.Status != models.ImportStatusRunning || claimed.LeaseOwner != "instance-a" {
+		t.Errorf("ClaimImportJob() job = %+v, want running under instance-a", claimed)
+	}
+
+	// A running lease keeps other instances out
+	if _, ok, _ := storage.ClaimImportJob(job.ID, "instance-b", now.Add(time.Minute)); ok {
+		t.Error("ClaimImportJob() by another instance should fail while the lease runs")
+	}
+	stolen := claimed
+	stolen.LeaseOwner = "instance-b"
+	if saved, _ := storage.SaveImportJob(stolen, nil); saved {
+		t.Error("SaveImportJob() by an instance without the lease should fail")
+	}
+
+	claimed.Cursor = 2
+	claimed.ProcessedRows = 2
+	claimed.Failed = 1
+	claimed.LeaseUntil = time.Time{}
+	if saved, err := storage.SaveImportJob(claimed, []models.ImportRowError{{Row: 2, Status: http.StatusBadRequest, Error: "bad row"}}); err != nil || !saved {
+		t.Fatalf("SaveImportJob() = %v, %v; want saved", saved, err)
+	}
+
+	// A released lease lets another instance resume from the saved cursor
+	resumed, ok, err := storage.ClaimImportJob(job.ID, "instance-b", now.Add(time.Minute))
+	if err != nil || !ok {
+		t.Fatalf("ClaimImportJob() after release = %v, %v; want a claim", ok, err)
+	}
+	if resumed.Cursor != 2 || resumed.Failed != 1 || len(resumed.Errors) != 1 || resumed.Errors[0].Row != 2 {
+		t.Errorf("ClaimImportJob() after release = %+v, want the saved progress", resumed)
+	}
+	if saved, _ := storage.SaveImportJob(claimed, nil); saved {
+		t.Error("SaveImportJob() by the previous owner should fail once the job was taken over")
+	}
+
+	// New errors are appended to the saved ones
+	completedAt := time.Now()
+	resumed.Cursor = 4
+	resumed.ProcessedRows = 3
+	resumed.Failed = 2
+	resumed.Status = models.ImportStatusCompleted
+	resumed.CompletedAt = &completedAt
+	if saved, err := storage.SaveImportJob(resumed, []models.ImportRowError{{Row: 4, Status: http.StatusConflict, Error: "taken"}}); err != nil || !saved {
+		t.Fatalf("SaveImportJob() completed = %v, %v; want saved", saved, err)
+	}
+	completed, _, err := storage.GetImportJob(job.ID)
+	if err != nil {
+		t.Fatalf("GetImportJob() error = %v", err)
+	}
+	if completed.Failed != 2 || len(completed.Errors) != 2 || completed.Errors[0].Row != 2 || completed.Errors[1].Row != 4 {
+		t.Errorf("GetImportJob() after completing = %+v, want both row errors", completed)
+	}
+	if err := storage.DeleteImportRows(job.ID); err != nil {
+		t.Fatalf("DeleteImportRows() error = %v", err)
+	}
+
+	unfinished, err := storage.ListUnfinishedImportJobs()
+	if err != nil || len(unfinished) != 0 {
+		t.Errorf("ListUnfinishedImportJobs() = %+v, %v; want none", unfinished, err)
+	}
+	if remaining, _ := storage.GetImportRows(job.ID, 0, 10); len(remaining) != 0 {
+		t.Errorf("GetImportRows() after DeleteImportRows() = %+v, want none", remaining)
+	}
+	if _, ok, _ := storage.ClaimImportJob(job.ID, "instance-a", now.Add(time.Minute)); ok {
+		t.Error("ClaimImportJob() should never claim a completed job")
+	}
+}
+
+func TestImportService_ProcessesCSV(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	urlService := factory.CreateURLService()
+	importService := factory.CreateImportService()
+
+	file := strings.Join([]string{
+		"url,alias,expiration,tags",
+		"https://www.one.com,imported,,docs;launch",
+		"not a url,,,",
+		"https://www.three.com,dup,,",
+		"https://www.four.com,dup,,",
+		"https://www.five.com,,tomorrow,",
+		"https://www.six.com,,2000-01-01T00:00:00Z,",
+	}, "\n")
+
+	job, err := importService.CreateImport(&models.ImportRequest{Format: models.ImportFormatCSV, File: strings.NewReader(file)}, "user123")
+	if err != nil {
+		t.Fatalf("CreateImport() error = %v", err)
+	}
+	if job.Status != models.ImportStatusQueued || job.TotalRows != 6 {
+		t.Errorf("CreateImport() job = %+v, want 6 queued rows", job)
+	}
+
+	testutils.WaitFor(t, 5*time.Second, func() bool {
+		job, err = importService.GetImport(job.ID, "user123")
+		return err == nil && job.IsFinished()
+	}, "import to complete")
+
+	if job.ProcessedRows != 6 || job.Created != 2 || job.Failed != 4 {
+		t.Errorf("GetImport() processed %d, created %d, failed %d; want 6, 2 and 4", job.ProcessedRows, job.Created, job.Failed)
+	}
+	wantErrors := map[int]int{2: http.StatusBadRequest, 4: http.StatusConflict, 5: http.StatusBadRequest, 6: http.StatusBadRequest}
+	if len(job.Errors) != len(wantErrors) {
+		t.Fatalf("GetImport() errors = %+v, want rows 2, 4, 5 and 6", job.Errors)
+	}
+	for _, rowErr := range job.Errors {
+		if wantErrors[rowErr.Row] != rowErr.Status {
+			t.Errorf("GetImport() error for row %d has status %d, want %d", rowErr.Row, rowErr.Status, wantErrors[rowErr.Row])
+		}
+	}
+
+	info, err := urlService.GetURLInfo("imported", "user123")
+	if err != nil {
+		t.Fatalf("GetURLInfo() error = %v", err)
+	}
+	if info.OriginalURL != "https://www.one.com" || !reflect.DeepEqual(info.Tags, []string{"docs", "launch"}) {
+		t.Errorf("GetURLInfo() = %+v, want the imported link with its tags", info)
+	}
+
+	// Jobs belong to the user who uploaded them
+	if _, err := importService.GetImport(job.ID, "user456"); err != models.ErrImportNotFound {
+		t.Errorf("GetImport() by another user error = %v, want %v", err, models.ErrImportNotFound)
+	}
+}
+
+// countingImportStorage counts the saves of import jobs
+type countingImportStorage struct {
+	*services.MemoryImportStorage
+	saves atomic.Int64
+}
+
+func (s *countingImportStorage) SaveImportJob(job models.ImportJob, newErrors []models.ImportRowError) (bool, error) {
+	s.saves.Add(1)
+	return s.MemoryImportStorage.SaveImportJob(job, newErrors)
+}
+
+func TestImportService_SavesProgressInBatches(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	storage := &countingImportStorage{MemoryImportStorage: services.NewMemoryImportStorage()}
+	importService := services.NewImportService(storage, factory.CreateURLService(), "instance-a")
+
+	// Every row fails, so the errors are appended over several saves
+	lines := []string{"url"}
+	for i := 0; i < 250; i++ {
+		lines = append(lines, "not a url")
+	}
+	job, err := importService.CreateImport(&models.ImportRequest{Format: models.ImportFormatCSV, File: strings.NewReader(strings.Join(lines, "\n"))}, "user123")
+	if err != nil {
+		t.Fatalf("CreateImport() error = %v", err)
+	}
+	if err := importService.ProcessPending(); err != nil {
+		t.Fatalf("ProcessPending() error = %v", err)
+	}
+
+	job, err = importService.GetImport(job.ID, "user123")
+	if err != nil || !job.IsFinished() {
+		t.Fatalf("GetImport() = %+v, %v; want a completed job", job, err)
+	}
+	if job.Failed != 250 || len(job.Errors) != 250 || job.Errors[249].Row != 250 {
+		t.Errorf("GetImport() failed %d with %d errors, want 250 of each", job.Failed, len(job.Errors))
+	}
+	if saves := storage.saves.Load(); saves > 4 {
+		t.Errorf("SaveImportJob() called %d times for 250 rows, want at most 4", saves)
+	}
+}
+
+func TestImportService_CreateImportRejectsBadFiles(t *testing.T) {
+	service := services.NewImportService(services.NewMemoryImportStorage(), nil, "instance-a")
+
+	tests := []struct {
+		name    string
+		format  string
+		file    string
+		wantErr error
+	}{
+		{"unknown format", "xml", "<urls/>", models.ErrInvalidImportFormat},
+		{"no url column", models.ImportFormatCSV, "alias\nfoo", models.ErrMissingURLColumn},
+		{"empty csv", models.ImportFormatCSV, "", models.ErrEmptyImport},
+		{"header only", models.ImportFormatCSV, "url,alias", models.ErrEmptyImport},
+		{"blank jsonl", models.ImportFormatJSONL, "\n\n", models.ErrEmptyImport},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateImport(&models.ImportRequest{Format: tt.format, File: strings.NewReader(tt.file)}, "user123")
+			if err != tt.wantErr {
+				t.Errorf("CreateImport() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImportService_ResumesFromCursor(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	urlService := factory.CreateURLService()
+	storage := services.NewMemoryImportStorage()
+
+	// A previous instance imported the first row and died holding the lease
+	crashed := services.NewImportService(storage, urlService, "crashed")
+	file := "{\"url\": \"https://www.one.com\", \"alias\": \"first\"}\n" +
+		"not json\n" +
+		"\n" +
+		"{\"url\": \"https://www.four.com\", \"alias\": \"second\", \"tags\": [\"resumed\"]}\n"
+	job, err := crashed.CreateImport(&models.ImportRequest{Format: models.ImportFormatJSONL, File: strings.NewReader(file)}, "user123")
+	if err != nil {
+		t.Fatalf("CreateImport() error = %v", err)
+	}
+
+	claimed, ok, err := storage.ClaimImportJob(job.ID, "crashed", time.Now().Add(-time.Second))
+	if err != nil || !ok {
+		t.Fatalf("ClaimImportJob() = %v, %v; want a claim", ok, err)
+	}
+	claimed.Cursor = 1
+	claimed.ProcessedRows = 1
+	claimed.Created = 1
+	if _, err := storage.SaveImportJob(claimed, nil); err != nil {
+		t.Fatalf("SaveImportJob() error = %v", err)
+	}
+
+	// Another instance still holds the lease on a second job, which must be left alone
+	other, err := crashed.CreateImport(&models.ImportRequest{Format: models.ImportFormatCSV, File: strings.NewReader("url\nhttps://www.other.com")}, "user123")
+	if err != nil {
+		t.Fatalf("CreateImport() error = %v", err)
+	}
+	if _, ok, _ := storage.ClaimImportJob(other.ID, "busy", time.Now().Add(time.Minute)); !ok {
+		t.Fatal("ClaimImportJob() should claim the second job")
+	}
+
+	restarted := services.NewImportService(storage, urlService, "restarted")
+	if err := restarted.ProcessPending(); err != nil {
+		t.Fatalf("ProcessPending() error = %v", err)
+	}
+
+	job, err = restarted.GetImport(job.ID, "user123")
+	if err != nil {
+		t.Fatalf("GetImport() error = %v", err)
+	}
+	if !job.IsFinished() || job.TotalRows != 3 || job.ProcessedRows != 3 || job.Created != 2 || job.Failed != 1 {
+		t.Errorf("GetImport() = %+v, want a completed job with 2 created and 1 failed", job)
+	}
+	if len(job.Errors) != 1 || job.Errors[0].Row != 2 {
+		t.Errorf("GetImport() errors = %+v, want the invalid line 2", job.Errors)
+	}
+
+	// The first row was not imported again
+	if _, err := urlService.GetOriginalURL("first", false); err != models.ErrShortCodeNotFound {
+		t.Errorf("GetOriginalURL(first) error = %v, want %v", err, models.ErrShortCodeNotFound)
+	}
+	if url, err := urlService.GetOriginalURL("second", false); err != nil || url != "https://www.four.com" {
+		t.Errorf("GetOriginalURL(second) = %q, %v; want the resumed row", url, err)
+	}
+
+	other, _ = restarted.GetImport(other.ID, "user123")
+	if other.IsFinished() || other.ProcessedRows != 0 {
+		t.Errorf("GetImport() of the leased job = %+v, want it untouched", other)
+	}
+}
+
+// countingURLService counts the links created through it
+type countingURLService struct {
+	models.URLService
+	creates atomic.Int64
+}
+
+func (s *countingURLService) CreateShortURL(req *models.URLRequest, userID string) (*models.URLResponse, error) {
+	s.creates.Add(1)
+	return s.URLService.CreateShortURL(req, userID)
+}
+
+func TestImportService_SkipsRowsCreatedBeforeACrash(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	urlService := &countingURLService{URLService: factory.CreateURLService()}
+	storage := services.NewMemoryImportStorage()
+
+	crashed := services.NewImportService(storage, urlService, "crashed")
+	job, err := crashed.CreateImport(&models.ImportRequest{Format: models.ImportFormatCSV, File: strings.NewReader("url\nhttps://www.one.com\nhttps://www.two.com")}, "user123")
+	if err != nil {
+		t.Fatalf("CreateImport() error = %v", err)
+	}
+
+	// The first row's link was created and recorded, but the process died before saving progress
+	response, err := urlService.CreateShortURL(&models.URLRequest{URL: "https://www.one.com"}, "user123")
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if err := storage.SetImportRowShortCode(job.ID, 1, response.ShortCode); err != nil {
+		t.Fatalf("SetImportRowShortCode() error = %v", err)
+	}
+	urlService.creates.Store(0)
+
+	restarted := services.NewImportService(storage, urlService, "restarted")
+	if err := restarted.ProcessPending(); err != nil {
+		t.Fatalf("ProcessPending() error = %v", err)
+	}
+
+	job, err = restarted.GetImport(job.ID, "user123")
+	if err != nil || !job.IsFinished() {
+		t.Fatalf("GetImport() = %+v, %v; want a completed job", job, err)
+	}
+	if job.ProcessedRows != 2 || job.Created != 2 || job.Failed != 0 {
+		t.Errorf("GetImport() processed %d, created %d, failed %d; want 2, 2 and 0", job.ProcessedRows, job.Created, job.Failed)
+	}
+	if creates := urlService.creates.Load(); creates != 1 {
+		t.Errorf("CreateShortURL() called %d times on resume, want 1 for the second row only", creates)
+	}
+}
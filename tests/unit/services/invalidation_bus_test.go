@@ -0,0 +1,80 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"url-shortener-api/services"
+	"url-shortener-api/tests/testutils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestInvalidationBus_EvictsAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	server, _ := testutils.SetupMiniRedis(t)
+
+	// Two API instances, each with its own client, local tier and bus
+	newInstance := func() (*services.TieredCache, *services.LRUCache) {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+
+		local := services.NewLRUCache(100)
+		bus := services.NewInvalidationBus(client, local)
+		bus.Start()
+		t.Cleanup(bus.Stop)
+
+		remote := services.NewLRUCache(100)
+		return services.NewTieredCache(local, remote, time.Minute, bus), local
+	}
+
+	cacheA, _ := newInstance()
+	_, localB := newInstance()
+
+	localB.Set(ctx, "url:abc", "https://www.old.com", 0)
+	localB.Set(ctx, "url:other", "https://www.other.com", 0)
+
+	if err := cacheA.Delete(ctx, "url:abc"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	testutils.WaitFor(t, 2*time.Second, func() bool {
+		_, err := localB.Get(ctx, "url:abc")
+		return err != nil
+	}, "instance B to evict url:abc")
+
+	if _, err := localB.Get(ctx, "url:other"); err != nil {
+		t.Errorf("Unrelated key should survive the invalidation, got error = %v", err)
+	}
+}
+
+func TestInvalidationBus_FlushesAndResubscribesAfterDrop(t *testing.T) {
+	ctx := context.Background()
+	server, client := testutils.SetupMiniRedis(t)
+
+	local := services.NewLRUCache(100)
+	bus := services.NewInvalidationBus(client, local)
+	bus.Start()
+	defer bus.Stop()
+
+	local.Set(ctx, "url:abc", "https://www.example.com", 0)
+
+	// Dropping the connection must flush everything local
+	server.Close()
+	testutils.WaitFor(t, 2*time.Second, func() bool { return local.Len() == 0 }, "local cache flush")
+
+	if err := server.Restart(); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	testutils.WaitFor(t, 5*time.Second, func() bool {
+		return server.PubSubNumSub("cache_invalidations")["cache_invalidations"] == 1
+	}, "resubscription")
+
+	// Invalidations flow again after reconnecting
+	local.Set(ctx, "url:abc", "https://www.example.com", 0)
+	if err := bus.Publish(ctx, "url:abc"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	testutils.WaitFor(t, 2*time.Second, func() bool { return local.Len() == 0 }, "eviction after resubscribe")
+}
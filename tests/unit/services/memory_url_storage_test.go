@@ -0,0 +1,106 @@
+package services_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+)
+
+func TestMemoryURLStorage_AliasUniqueness(t *testing.T) {
+	storage := services.NewMemoryURLStorage()
+
+	first := models.URLMapping{OriginalURL: "https://www.example1.com", Alias: "taken", UserID: "user123"}
+	if err := storage.Store("taken", first); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	second := models.URLMapping{OriginalURL: "https://www.example2.com", Alias: "taken", UserID: "user456"}
+	if err := storage.Store("other", second); err != models.ErrAliasAlreadyExists {
+		t.Errorf("Store() error = %v, want %v", err, models.ErrAliasAlreadyExists)
+	}
+
+	// Deleting the owner frees the alias
+	if err := storage.Delete("taken"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := storage.Store("other", second); err != nil {
+		t.Errorf("Store() after delete error = %v", err)
+	}
+}
+
+func TestMemoryURLStorage_DeleteExpired(t *testing.T) {
+	storage := services.NewMemoryURLStorage()
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	storage.Store("expired", models.URLMapping{OriginalURL: "https://www.example1.com", Alias: "expired", ExpirationTimestamp: &past})
+	storage.Store("active", models.URLMapping{OriginalURL: "https://www.example2.com", ExpirationTimestamp: &future})
+	storage.Store("forever", models.URLMapping{OriginalURL: "https://www.example3.com"})
+
+	// Like the MongoDB TTL index, expired mappings stay readable until swept
+	if exists, _ := storage.Exists("expired"); !exists {
+		t.Fatalf("Exists() should return true before the sweep")
+	}
+
+	deleted, err := storage.DeleteExpired(time.Now())
+	if err != nil {
+		t.Fatalf("DeleteExpired() error = %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteExpired() deleted %d mappings, want 1", deleted)
+	}
+
+	if exists, _ := storage.Exists("expired"); exists {
+		t.Errorf("Expired mapping should be removed by the sweep")
+	}
+	if _, exists, _ := storage.GetByAlias("expired"); exists {
+		t.Errorf("Alias of an expired mapping should be released by the sweep")
+	}
+	for _, shortCode := range []string{"active", "forever"} {
+		if exists, _ := storage.Exists(shortCode); !exists {
+			t.Errorf("Mapping %q should survive the sweep", shortCode)
+		}
+	}
+}
+
+func TestMemoryURLStorage_ReturnsCopies(t *testing.T) {
+	storage := services.NewMemoryURLStorage()
+
+	expiration := time.Now().Add(time.Hour)
+	storage.Store("copy", models.URLMapping{OriginalURL: "https://www.example.com", ExpirationTimestamp: &expiration})
+
+	// Mutating the caller's pointer must not change the stored mapping
+	expiration = time.Now().Add(-time.Hour)
+
+	retrieved, _, _ := storage.Get("copy")
+	if retrieved.IsExpired() {
+		t.Errorf("Stored mapping should not share the caller's expiration pointer")
+	}
+}
+
+func TestMemoryURLStorage_ConcurrentStores(t *testing.T) {
+	storage := services.NewMemoryURLStorage()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			storage.Store(fmt.Sprintf("code%d", i), models.URLMapping{OriginalURL: "https://www.example.com", UserID: "user123"})
+		}(i)
+	}
+	wg.Wait()
+
+	mappings, err := storage.GetByUserID("user123")
+	if err != nil {
+		t.Fatalf("GetByUserID() error = %v", err)
+	}
+	if len(mappings) != 100 {
+		t.Errorf("GetByUserID() returned %d mappings, want 100", len(mappings))
+	}
+}
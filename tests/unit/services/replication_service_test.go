@@ -0,0 +1,163 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"url-shortener-api/services"
+	"url-shortener-api/tests/testutils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxCheckpointer records the high-water mark with the same $max semantics as MongoDB
+type maxCheckpointer struct {
+	mu      sync.Mutex
+	counter int64
+	writes  int
+	err     error
+}
+
+func (c *maxCheckpointer) PersistHighWaterMark(ctx context.Context, counter int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	c.writes++
+	c.counter = max(c.counter, counter)
+	return nil
+}
+
+func (c *maxCheckpointer) value() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counter
+}
+
+func addCounterEntries(t *testing.T, client *redis.Client, counters ...int64) {
+	t.Helper()
+	for _, counter := range counters {
+		err := client.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: "counter_replication",
+			Values: map[string]interface{}{"counter": counter},
+		}).Err()
+		if err != nil {
+			t.Fatalf("XAdd() error = %v", err)
+		}
+	}
+}
+
+func TestReplicationService_PersistsBatchMaximumOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	_, client := testutils.SetupMiniRedis(t)
+
+	checkpointer := &maxCheckpointer{}
+	replication := services.NewReplicationService(client, "instance-a", checkpointer)
+	if err := replication.EnsureGroup(ctx); err != nil {
+		t.Fatalf("EnsureGroup() error = %v", err)
+	}
+	// Creating the group twice is a no-op
+	if err := replication.EnsureGroup(ctx); err != nil {
+		t.Fatalf("EnsureGroup() second call error = %v", err)
+	}
+
+	addCounterEntries(t, client, 7, 9, 8)
+	acked, err := replication.Replicate(ctx)
+	if err != nil {
+		t.Fatalf("Replicate() error = %v", err)
+	}
+	if acked != 3 {
+		t.Errorf("Expected 3 entries acknowledged, got %d", acked)
+	}
+	if checkpointer.writes != 1 {
+		t.Errorf("Expected a single checkpoint per batch, got %d", checkpointer.writes)
+	}
+
+	// A late, lower value must not move the counter backwards
+	addCounterEntries(t, client, 4)
+	if _, err := replication.Replicate(ctx); err != nil {
+		t.Fatalf("Replicate() error = %v", err)
+	}
+	if got := checkpointer.value(); got != 9 {
+		t.Errorf("Expected high-water mark 9, got %d", got)
+	}
+
+	pending, err := client.XPending(ctx, "counter_replication", "replication_group").Result()
+	if err != nil {
+		t.Fatalf("XPending() error = %v", err)
+	}
+	if pending.Count != 0 {
+		t.Errorf("Expected no pending entries, got %d", pending.Count)
+	}
+
+	// Acknowledged entries are trimmed, keeping only the last one
+	length, err := client.XLen(ctx, "counter_replication").Result()
+	if err != nil {
+		t.Fatalf("XLen() error = %v", err)
+	}
+	if length > 1 {
+		t.Errorf("Expected acknowledged entries to be trimmed, stream length = %d", length)
+	}
+}
+
+func TestReplicationService_ReclaimsEntriesAfterFailedCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	server, client := testutils.SetupMiniRedis(t)
+	now := time.Now()
+	server.SetTime(now)
+
+	failing := &maxCheckpointer{err: errors.New("mongodb unavailable")}
+	crashed := services.NewReplicationService(client, "instance-a", failing)
+	if err := crashed.EnsureGroup(ctx); err != nil {
+		t.Fatalf("EnsureGroup() error = %v", err)
+	}
+
+	addCounterEntries(t, client, 1, 2, 3)
+	if _, err := crashed.Replicate(ctx); err == nil {
+		t.Fatal("Expected Replicate() to fail when the checkpoint fails")
+	}
+
+	pending, err := client.XPending(ctx, "counter_replication", "replication_group").Result()
+	if err != nil {
+		t.Fatalf("XPending() error = %v", err)
+	}
+	if pending.Count != 3 {
+		t.Fatalf("Expected 3 pending entries after a failed checkpoint, got %d", pending.Count)
+	}
+
+	// Once the entries have been idle long enough, another instance takes them over
+	server.SetTime(now.Add(time.Minute))
+	checkpointer := &maxCheckpointer{}
+	survivor := services.NewReplicationService(client, "instance-b", checkpointer)
+
+	acked, err := survivor.Replicate(ctx)
+	if err != nil {
+		t.Fatalf("Replicate() error = %v", err)
+	}
+	if acked != 3 {
+		t.Errorf("Expected 3 reclaimed entries acknowledged, got %d", acked)
+	}
+	if got := checkpointer.value(); got != 3 {
+		t.Errorf("Expected high-water mark 3, got %d", got)
+	}
+}
+
+func TestReplicationService_StartAndStop(t *testing.T) {
+	_, client := testutils.SetupMiniRedis(t)
+
+	checkpointer := &maxCheckpointer{}
+	replication := services.NewReplicationService(client, "instance-a", checkpointer)
+	replication.Start()
+
+	addCounterEntries(t, client, 42)
+	testutils.WaitFor(t, 5*time.Second, func() bool {
+		return checkpointer.value() == 42
+	}, "counter 42 to be replicated")
+
+	replication.Stop()
+}
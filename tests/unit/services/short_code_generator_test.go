@@ -3,6 +3,7 @@ package services_test
 import (
 	"strings"
 	"testing"
+	"url-shortener-api/models"
 	"url-shortener-api/services"
 	"url-shortener-api/tests/testutils"
 )
@@ -23,7 +24,7 @@ func TestShortCodeGenerator_Generate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := generator.Generate()
+			result, err := generator.Generate(models.CodeInput{})
 			if err != nil {
 				t.Errorf("Generate() error = %v", err)
 				return
@@ -49,7 +50,7 @@ func TestShortCodeGenerator_GenerateConsistentLength(t *testing.T) {
 	lengths := make(map[int]int)
 
 	for i := 0; i < 10; i++ {
-		code, err := generator.Generate()
+		code, err := generator.Generate(models.CodeInput{})
 		if err != nil {
 			t.Errorf("Generate() error = %v", err)
 			return
@@ -69,3 +70,104 @@ func TestShortCodeGenerator_GenerateConsistentLength(t *testing.T) {
 		}
 	}
 }
+
+func TestShortCodeGenerator_ScrambledCodesAreUniqueAndDecodable(t *testing.T) {
+	format := services.ShortCodeFormat{ScrambleKey: "test-secret", MinLength: 7}
+	generator := services.NewFormattedShortCodeGenerator(testutils.NewMockCounterService(), format)
+
+	seen := make(map[string]bool)
+	sequential := 0
+	previous := ""
+	for i := 0; i < 10000; i++ {
+		code, err := generator.Generate(models.CodeInput{})
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		if len(code) < 7 {
+			t.Errorf("Generate() = %q, shorter than the minimum length", code)
+		}
+		if seen[code] {
+			t.Fatalf("Generate() returned duplicate code %q", code)
+		}
+		seen[code] = true
+
+		counter, err := generator.Decode(code)
+		if err != nil {
+			t.Fatalf("Decode(%q) error = %v", code, err)
+		}
+		if counter != int64(i+1) {
+			t.Errorf("Decode(%q) = %d, want %d", code, counter, i+1)
+		}
+
+		if code > previous {
+			sequential++
+		}
+		previous = code
+	}
+
+	// Roughly half of random codes sort above their predecessor; sequential ones always do
+	if sequential > 9000 {
+		t.Errorf("Scrambled codes look sequential: %d of 10000 sort above their predecessor", sequential)
+	}
+}
+
+func TestShortCodeGenerator_ScrambleDependsOnKey(t *testing.T) {
+	first := services.NewFormattedShortCodeGenerator(nil, services.ShortCodeFormat{ScrambleKey: "key-one"})
+	second := services.NewFormattedShortCodeGenerator(nil, services.ShortCodeFormat{ScrambleKey: "key-two"})
+
+	if first.Encode(42) == second.Encode(42) {
+		t.Errorf("Different keys should produce different codes, both gave %q", first.Encode(42))
+	}
+
+	// Counters beyond the permuted range still round-trip
+	large := int64(1) << 50
+	if decoded, _ := first.Decode(first.Encode(large)); decoded != large {
+		t.Errorf("Decode(Encode(%d)) = %d", large, decoded)
+	}
+}
+
+func TestShortCodeGenerator_MinLengthPadsSequentialCodes(t *testing.T) {
+	generator := services.NewFormattedShortCodeGenerator(nil, services.ShortCodeFormat{MinLength: 4})
+
+	if code := generator.Encode(61); code != "000z" {
+		t.Errorf("Encode(61) = %q, want %q", code, "000z")
+	}
+	if counter, _ := generator.Decode("000z"); counter != 61 {
+		t.Errorf("Decode(%q) = %d, want 61", "000z", counter)
+	}
+}
+
+func TestHashCodeGenerator_NormalizesURL(t *testing.T) {
+	generator := services.NewHashCodeGenerator()
+	generate := func(url string) string {
+		code, err := generator.Generate(models.CodeInput{URL: url, UserID: "user123"})
+		if err != nil {
+			t.Fatalf("Generate(%q) error = %v", url, err)
+		}
+		return code
+	}
+
+	want := generate("https://www.example.com/")
+	for _, url := range []string{
+		"https://www.example.com",
+		"HTTPS://WWW.Example.COM/",
+		"https://www.example.com:443/",
+		"https://www.example.com/#section",
+	} {
+		if code := generate(url); code != want {
+			t.Errorf("Generate(%q) = %q, want %q like https://www.example.com/", url, code, want)
+		}
+	}
+
+	// Paths, queries and non-default ports still tell URLs apart
+	for _, url := range []string{
+		"https://www.example.com/Page",
+		"https://www.example.com/?q=1",
+		"https://www.example.com:8443/",
+		"http://www.example.com/",
+	} {
+		if code := generate(url); code == want {
+			t.Errorf("Generate(%q) = %q, want a code different from https://www.example.com/", url, code)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package services_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"url-shortener-api/config"
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+)
+
+// steppingClock is a fake clock that moves forward by step every time it is read
+type steppingClock struct {
+	mu      sync.Mutex
+	current time.Time
+	step    time.Duration
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.current
+	c.current = c.current.Add(c.step)
+	return now
+}
+
+func (c *steppingClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current = t
+}
+
+func TestSnowflakeCounter_UniqueAndIncreasing(t *testing.T) {
+	counter, err := services.NewSnowflakeCounter(7)
+	if err != nil {
+		t.Fatalf("NewSnowflakeCounter() error = %v", err)
+	}
+
+	// More values than one millisecond's sequence holds, forcing overflow waits
+	var previous int64
+	for i := 0; i < 10000; i++ {
+		value, err := counter.GetNextCounter()
+		if err != nil {
+			t.Fatalf("GetNextCounter() error = %v", err)
+		}
+		if value <= previous {
+			t.Fatalf("GetNextCounter() = %d after %d, values must increase", value, previous)
+		}
+		if node := (value >> 12) & 1023; node != 7 {
+			t.Fatalf("Value %d carries node ID %d, want 7", value, node)
+		}
+		previous = value
+	}
+
+	if current, _ := counter.GetCurrentCounter(); current != previous {
+		t.Errorf("GetCurrentCounter() = %d, want %d", current, previous)
+	}
+}
+
+func TestSnowflakeCounter_NodesNeverCollide(t *testing.T) {
+	clock := &steppingClock{current: time.Now()}
+	first, _ := services.NewSnowflakeCounterWithClock(1, clock.Now)
+	second, _ := services.NewSnowflakeCounterWithClock(2, clock.Now)
+
+	// The clock stands still, so both values share a timestamp and sequence
+	a, _ := first.GetNextCounter()
+	b, _ := second.GetNextCounter()
+
+	if a == b {
+		t.Errorf("Two nodes at the same instant produced the same value %d", a)
+	}
+}
+
+func TestSnowflakeCounter_ClockSkew(t *testing.T) {
+	start := time.Now()
+	clock := &steppingClock{current: start, step: time.Millisecond}
+	counter, _ := services.NewSnowflakeCounterWithClock(3, clock.Now)
+
+	before, err := counter.GetNextCounter()
+	if err != nil {
+		t.Fatalf("GetNextCounter() error = %v", err)
+	}
+
+	// A small step back is waited out
+	clock.Set(start.Add(-5 * time.Millisecond))
+	after, err := counter.GetNextCounter()
+	if err != nil {
+		t.Fatalf("GetNextCounter() after small skew error = %v", err)
+	}
+	if after <= before {
+		t.Errorf("GetNextCounter() = %d after %d, values must increase across clock skew", after, before)
+	}
+
+	// A large step back is refused
+	clock.Set(start.Add(-time.Minute))
+	if _, err := counter.GetNextCounter(); !errors.Is(err, models.ErrClockMovedBackwards) {
+		t.Errorf("GetNextCounter() error = %v, want ErrClockMovedBackwards", err)
+	}
+}
+
+func TestSnowflakeCounter_RejectsInvalidNodeID(t *testing.T) {
+	for _, nodeID := range []int64{-1, 1024} {
+		if _, err := services.NewSnowflakeCounter(nodeID); err == nil {
+			t.Errorf("NewSnowflakeCounter(%d) should fail", nodeID)
+		}
+	}
+}
+
+func TestNewServiceFactory_RejectsSnowflakeMisconfiguration(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{"no node ID", config.Config{StorageBackend: config.StorageMemory, CounterType: config.CounterSnowflake, NodeID: -1}},
+		{"scramble key", config.Config{StorageBackend: config.StorageMemory, CounterType: config.CounterSnowflake, NodeID: 3, CodeScrambleKey: "secret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if factory, err := services.NewServiceFactory(&tt.cfg); err == nil {
+				factory.Close()
+				t.Error("NewServiceFactory() should fail")
+			}
+		})
+	}
+
+	factory, err := services.NewServiceFactory(&config.Config{StorageBackend: config.StorageMemory, CounterType: config.CounterSnowflake, NodeID: 3})
+	if err != nil {
+		t.Fatalf("NewServiceFactory() with a node ID error = %v", err)
+	}
+	factory.Close()
+}
@@ -0,0 +1,120 @@
+package services_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+)
+
+func openTestSQLite(t *testing.T) *sql.DB {
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.sqlite")
+	db, err := services.OpenSQLDB(services.SQLDialectSQLite, dsn)
+	if err != nil {
+		t.Fatalf("OpenSQLDB() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLStorage_MigrationsAreVersionedAndIdempotent(t *testing.T) {
+	db := openTestSQLite(t)
+
+	// Running migrations again must be a no-op
+	if err := services.MigrateSQL(db, services.SQLDialectSQLite); err != nil {
+		t.Fatalf("MigrateSQL() second run error = %v", err)
+	}
+
+	var applied int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = 1`).Scan(&applied); err != nil {
+		t.Fatalf("Failed to read schema_migrations: %v", err)
+	}
+	if applied != 1 {
+		t.Errorf("schema_migrations has %d rows for version 1, want 1", applied)
+	}
+}
+
+func TestSQLStorage_ShortURLIsUnique(t *testing.T) {
+	db := openTestSQLite(t)
+
+	insert := `INSERT INTO url_mappings (id, short_url, original_url, created_at, updated_at) VALUES (?, 'dup', 'https://www.example.com', 0, 0)`
+	if _, err := db.Exec(insert, "000000000000000000000001"); err != nil {
+		t.Fatalf("First insert error = %v", err)
+	}
+	if _, err := db.Exec(insert, "000000000000000000000002"); err == nil {
+		t.Errorf("Second insert with the same short_url should violate the unique constraint")
+	}
+}
+
+func TestSQLStorage_AliasUniqueness(t *testing.T) {
+	storage := services.NewSQLURLStorage(openTestSQLite(t), services.SQLDialectSQLite)
+
+	if err := storage.Store("first", models.URLMapping{OriginalURL: "https://www.example1.com", Alias: "taken"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	err := storage.Store("second", models.URLMapping{OriginalURL: "https://www.example2.com", Alias: "taken"})
+	if err != models.ErrAliasAlreadyExists {
+		t.Errorf("Store() error = %v, want %v", err, models.ErrAliasAlreadyExists)
+	}
+
+	// Mappings without an alias never conflict with each other
+	for _, shortCode := range []string{"plain1", "plain2"} {
+		if err := storage.Store(shortCode, models.URLMapping{OriginalURL: "https://www.example.com"}); err != nil {
+			t.Errorf("Store(%q) error = %v", shortCode, err)
+		}
+	}
+}
+
+func TestSQLStorage_DeleteExpired(t *testing.T) {
+	storage := services.NewSQLURLStorage(openTestSQLite(t), services.SQLDialectSQLite)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	storage.Store("expired", models.URLMapping{OriginalURL: "https://www.example1.com", ExpirationTimestamp: &past})
+	storage.Store("active", models.URLMapping{OriginalURL: "https://www.example2.com", ExpirationTimestamp: &future})
+	storage.Store("forever", models.URLMapping{OriginalURL: "https://www.example3.com"})
+
+	deleted, err := storage.DeleteExpired(time.Now())
+	if err != nil {
+		t.Fatalf("DeleteExpired() error = %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteExpired() deleted %d mappings, want 1", deleted)
+	}
+	if exists, _ := storage.Exists("expired"); exists {
+		t.Errorf("Expired mapping should be removed by the sweep")
+	}
+}
+
+func TestSQLCounter_GetNextCounter(t *testing.T) {
+	counter := services.NewSQLCounter(openTestSQLite(t), services.SQLDialectSQLite)
+	if err := counter.InitializeCounter(); err != nil {
+		t.Fatalf("InitializeCounter() error = %v", err)
+	}
+
+	for want := int64(1); want <= 3; want++ {
+		got, err := counter.GetNextCounter()
+		if err != nil {
+			t.Fatalf("GetNextCounter() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("GetNextCounter() = %d, want %d", got, want)
+		}
+	}
+
+	// Initializing again must not reset the counter
+	if err := counter.InitializeCounter(); err != nil {
+		t.Fatalf("InitializeCounter() error = %v", err)
+	}
+	current, err := counter.GetCurrentCounter()
+	if err != nil {
+		t.Fatalf("GetCurrentCounter() error = %v", err)
+	}
+	if current != 3 {
+		t.Errorf("GetCurrentCounter() = %d, want 3", current)
+	}
+}
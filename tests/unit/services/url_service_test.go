@@ -1,10 +1,17 @@
 package services_test
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
+	"url-shortener-api/config"
 	"url-shortener-api/models"
+	"url-shortener-api/services"
 	"url-shortener-api/tests/testutils"
 )
 
@@ -229,3 +236,689 @@ func TestURLServiceImpl_URLNormalization(t *testing.T) {
 		t.Errorf("GetOriginalURL() = %v, want %v", originalURL, expected)
 	}
 }
+
+func TestURLServiceImpl_CreateShortURLStrategies(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	service := factory.CreateURLService()
+
+	// Random codes honour the requested length and differ every time
+	first, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com", Strategy: models.StrategyRandom, Length: 12}, "user123")
+	if err != nil {
+		t.Fatalf("CreateShortURL(random) error = %v", err)
+	}
+	second, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com", Strategy: models.StrategyRandom, Length: 12}, "user123")
+	if err != nil {
+		t.Fatalf("CreateShortURL(random) error = %v", err)
+	}
+	if len(first.ShortCode) != 12 || first.ShortCode == second.ShortCode {
+		t.Errorf("Random codes %q and %q should be 12 characters and distinct", first.ShortCode, second.ShortCode)
+	}
+
+	// Hash codes are reproducible for the same URL and user, and resolve to the URL
+	hashed, err := service.CreateShortURL(&models.URLRequest{URL: "www.example.com/page", Strategy: models.StrategyHash}, "user123")
+	if err != nil {
+		t.Fatalf("CreateShortURL(hash) error = %v", err)
+	}
+	again, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com/page", Strategy: models.StrategyHash}, "user123")
+	if err != nil {
+		t.Fatalf("CreateShortURL(hash) repeat error = %v", err)
+	}
+	if hashed.ShortCode != again.ShortCode {
+		t.Errorf("Hash codes differ for the same normalized URL: %q and %q", hashed.ShortCode, again.ShortCode)
+	}
+	// Spellings of the same address reuse the link rather than conflict with it
+	respelled, err := service.CreateShortURL(&models.URLRequest{URL: "https://WWW.Example.com:443/page#intro", Strategy: models.StrategyHash}, "user123")
+	if err != nil || respelled.ShortCode != hashed.ShortCode {
+		t.Errorf("CreateShortURL(hash) of a respelled URL = %+v, %v; want %q", respelled, err, hashed.ShortCode)
+	}
+	other, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com/page", Strategy: models.StrategyHash}, "user456")
+	if err != nil {
+		t.Fatalf("CreateShortURL(hash) other user error = %v", err)
+	}
+	if other.ShortCode == hashed.ShortCode {
+		t.Errorf("Hash codes should differ per user, both got %q", hashed.ShortCode)
+	}
+
+	originalURL, err := service.GetOriginalURL(hashed.ShortCode, false)
+	if err != nil || originalURL != "https://www.example.com/page" {
+		t.Errorf("GetOriginalURL(%q) = %q, %v", hashed.ShortCode, originalURL, err)
+	}
+
+	// Unknown strategies and strategies combined with an alias are rejected
+	for _, request := range []*models.URLRequest{
+		{URL: "https://www.example.com", Strategy: "sequential"},
+		{URL: "https://www.example.com", Strategy: models.StrategyRandom, Alias: "my-alias"},
+	} {
+		if _, err := service.CreateShortURL(request, "user123"); err != models.ErrInvalidStrategy {
+			t.Errorf("CreateShortURL(%+v) error = %v, want %v", request, err, models.ErrInvalidStrategy)
+		}
+	}
+	if _, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com", Strategy: models.StrategyRandom, Length: 3}, "user123"); err != models.ErrInvalidCodeLength {
+		t.Errorf("CreateShortURL() error = %v, want %v", err, models.ErrInvalidCodeLength)
+	}
+}
+
+func TestURLServiceImpl_GeneratedCodeSkipsCollidingAlias(t *testing.T) {
+	factory := services.NewMemoryServiceFactory(&config.Config{CodeMinLength: 3})
+	defer factory.Close()
+	service := factory.CreateURLService()
+
+	// Padded to three characters, the first generated codes are "001" and "002"; claim them as aliases
+	for _, alias := range []string{"001", "002"} {
+		if _, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.alias.com", Alias: alias}, "user123"); err != nil {
+			t.Fatalf("CreateShortURL(alias %q) error = %v", alias, err)
+		}
+	}
+
+	response, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.generated.com"}, "user123")
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	for _, alias := range []string{"001", "002"} {
+		originalURL, err := service.GetOriginalURL(alias, false)
+		if err != nil || originalURL != "https://www.alias.com" {
+			t.Errorf("Alias %q resolves to %q, %v; it must not be overwritten", alias, originalURL, err)
+		}
+	}
+	if response.ShortCode != "003" {
+		t.Errorf("CreateShortURL() short code = %q, want %q", response.ShortCode, "003")
+	}
+	if originalURL, _ := service.GetOriginalURL(response.ShortCode, false); originalURL != "https://www.generated.com" {
+		t.Errorf("Generated code %q resolves to %q", response.ShortCode, originalURL)
+	}
+}
+
+func TestURLServiceImpl_CreateShortURLs(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	service := factory.CreateURLService()
+
+	if _, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com", Alias: "taken"}, "user123"); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	urls := []models.URLRequest{
+		{URL: "https://www.one.com"},
+		{URL: "not a url"},
+		{URL: "https://www.two.com", Alias: "taken"},
+		{URL: "https://www.three.com", Alias: "batch-alias"},
+		{URL: "https://www.four.com", Strategy: models.StrategyRandom},
+		{URL: "https://www.five.com"},
+	}
+
+	// One failure keeps an atomic batch from creating anything
+	response, err := service.CreateShortURLs(&models.URLBatchRequest{URLs: urls, Atomic: true}, "user123")
+	if err != nil {
+		t.Fatalf("CreateShortURLs(atomic) error = %v", err)
+	}
+	if response.Created != 0 || response.Failed != len(urls) {
+		t.Errorf("CreateShortURLs(atomic) created %d, failed %d; want 0 and %d", response.Created, response.Failed, len(urls))
+	}
+	if response.Results[0].Status != http.StatusFailedDependency || response.Results[1].Status != http.StatusBadRequest {
+		t.Errorf("CreateShortURLs(atomic) results = %+v, want the invalid URL and the rest aborted", response.Results)
+	}
+	if _, err := service.GetOriginalURL("batch-alias", false); err != models.ErrShortCodeNotFound {
+		t.Errorf("GetOriginalURL() after a failed atomic batch error = %v, want %v", err, models.ErrShortCodeNotFound)
+	}
+
+	response, err = service.CreateShortURLs(&models.URLBatchRequest{URLs: urls}, "user123")
+	if err != nil {
+		t.Fatalf("CreateShortURLs() error = %v", err)
+	}
+	if response.Created != 4 || response.Failed != 2 {
+		t.Errorf("CreateShortURLs() created %d, failed %d; want 4 and 2", response.Created, response.Failed)
+	}
+	wantStatus := []int{http.StatusCreated, http.StatusBadRequest, http.StatusConflict, http.StatusCreated, http.StatusCreated, http.StatusCreated}
+	for i, result := range response.Results {
+		if result.Status != wantStatus[i] {
+			t.Errorf("Result %d = %+v, want status %d", i, result, wantStatus[i])
+			continue
+		}
+		if result.Status != http.StatusCreated {
+			continue
+		}
+		if originalURL, err := service.GetOriginalURL(result.ShortCode, false); err != nil || originalURL != urls[i].URL {
+			t.Errorf("Result %d code %q resolves to %q, %v; want %s", i, result.ShortCode, originalURL, err, urls[i].URL)
+		}
+	}
+	if response.Results[0].ShortCode == response.Results[5].ShortCode {
+		t.Errorf("Counter codes of one batch must differ, both are %q", response.Results[0].ShortCode)
+	}
+
+	tooMany := make([]models.URLRequest, 11)
+	if _, err := service.CreateShortURLs(&models.URLBatchRequest{URLs: tooMany}, "user123"); err != models.ErrBatchTooLarge {
+		t.Errorf("CreateShortURLs() over the limit error = %v, want %v", err, models.ErrBatchTooLarge)
+	}
+	if _, err := service.CreateShortURLs(&models.URLBatchRequest{}, "user123"); err != models.ErrEmptyBatch {
+		t.Errorf("CreateShortURLs() empty error = %v, want %v", err, models.ErrEmptyBatch)
+	}
+}
+
+func TestURLServiceImpl_CreateShortURLsSkipsCollidingAlias(t *testing.T) {
+	factory := services.NewMemoryServiceFactory(&config.Config{CodeMinLength: 3, BatchMaxSize: 10})
+	defer factory.Close()
+	service := factory.CreateURLService()
+
+	// The first batch leases "001" and "002", then a replacement "003"; the second leases "004" and
+	// "005" and is written again with "006". Claim the first code of each as an alias.
+	for _, alias := range []string{"001", "004"} {
+		if _, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.alias.com", Alias: alias}, "user123"); err != nil {
+			t.Fatalf("CreateShortURL(alias %q) error = %v", alias, err)
+		}
+	}
+
+	for _, atomic := range []bool{false, true} {
+		urls := []models.URLRequest{{URL: "https://www.one.com"}, {URL: "https://www.two.com"}}
+		response, err := service.CreateShortURLs(&models.URLBatchRequest{URLs: urls, Atomic: atomic}, "user123")
+		if err != nil || response.Created != 2 {
+			t.Fatalf("CreateShortURLs(atomic=%v) = %+v, %v; want both created", atomic, response, err)
+		}
+		for i, result := range response.Results {
+			if originalURL, _ := service.GetOriginalURL(result.ShortCode, false); originalURL != urls[i].URL {
+				t.Errorf("CreateShortURLs(atomic=%v) code %q resolves to %q, want %s", atomic, result.ShortCode, originalURL, urls[i].URL)
+			}
+		}
+	}
+	for _, alias := range []string{"001", "004"} {
+		if originalURL, _ := service.GetOriginalURL(alias, false); originalURL != "https://www.alias.com" {
+			t.Errorf("Alias %q resolves to %q; it must not be overwritten", alias, originalURL)
+		}
+	}
+}
+
+func TestURLServiceImpl_ListURLs(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	service := factory.CreateURLService()
+
+	var created []string
+	for i := 0; i < 5; i++ {
+		response, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com"}, "pager")
+		if err != nil {
+			t.Fatalf("CreateShortURL() error = %v", err)
+		}
+		created = append(created, response.ShortCode)
+	}
+
+	// Walk every page, newest first
+	var listed []string
+	req := &models.URLListRequest{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("ListURLs() never stopped returning a next cursor")
+		}
+
+		page, err := service.ListURLs(req, "pager")
+		if err != nil {
+			t.Fatalf("ListURLs() error = %v", err)
+		}
+		for _, mapping := range page.URLs {
+			listed = append(listed, mapping.ShortURL)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+
+	if len(listed) != len(created) {
+		t.Fatalf("ListURLs() pages hold %v, want all of %v", listed, created)
+	}
+	for i := range created {
+		if listed[i] != created[len(created)-1-i] {
+			t.Errorf("ListURLs() pages hold %v, want the reverse of %v", listed, created)
+			break
+		}
+	}
+
+	invalid := []struct {
+		req  *models.URLListRequest
+		want error
+	}{
+		{req: &models.URLListRequest{Limit: 101}, want: models.ErrInvalidListLimit},
+		{req: &models.URLListRequest{Sort: "updated_at"}, want: models.ErrInvalidListFilter},
+		{req: &models.URLListRequest{Status: "archived"}, want: models.ErrInvalidListFilter},
+		{req: &models.URLListRequest{Cursor: "not-a-cursor"}, want: models.ErrInvalidCursor},
+	}
+	for _, tt := range invalid {
+		if _, err := service.ListURLs(tt.req, "pager"); err != tt.want {
+			t.Errorf("ListURLs(%+v) error = %v, want %v", *tt.req, err, tt.want)
+		}
+	}
+}
+
+func TestURLServiceImpl_GetURLInfo(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	service := factory.CreateURLService()
+
+	_, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com", Alias: "secret", Visibility: models.VisibilityPrivate}, "owner")
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	info, err := service.GetURLInfo("secret", "owner")
+	if err != nil {
+		t.Fatalf("GetURLInfo() error = %v", err)
+	}
+	if !info.IsOwner || info.OriginalURL != "https://www.example.com" || info.CreatedAt == nil || info.UpdatedAt == nil {
+		t.Errorf("GetURLInfo() for the owner = %+v, want every field", info)
+	}
+	if info.TotalClicks == nil || *info.TotalClicks != 0 || info.UniqueVisitors == nil || *info.UniqueVisitors != 0 {
+		t.Errorf("GetURLInfo() for the owner = %+v, want zero clicks and visitors", info)
+	}
+
+	info, err = service.GetURLInfo("secret", "")
+	if err != nil {
+		t.Fatalf("GetURLInfo() anonymous error = %v", err)
+	}
+	if info.IsOwner || info.OriginalURL != "" || info.Alias != "" || info.CreatedAt != nil || info.Visibility != models.VisibilityPrivate {
+		t.Errorf("GetURLInfo() for an anonymous caller = %+v, want only the public subset", info)
+	}
+	if info.TotalClicks != nil || info.UniqueVisitors != nil {
+		t.Errorf("GetURLInfo() for an anonymous caller = %+v, want no click totals", info)
+	}
+
+	if _, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com", Visibility: "hidden"}, "owner"); err != models.ErrInvalidVisibility {
+		t.Errorf("CreateShortURL() error = %v, want %v", err, models.ErrInvalidVisibility)
+	}
+}
+
+func TestURLServiceImpl_UpdateShortURL(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	service := factory.CreateURLService()
+
+	created, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.exmaple.com", ExpirationMs: 3600000}, "owner")
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	shortCode := created.ShortCode
+	original, _ := service.GetURLInfo(shortCode, "owner")
+
+	fixedURL := "https://www.example.com"
+	otherURL := "https://www.example.org"
+	noExpiration := int64(0)
+
+	// Only the owner may edit
+	if _, err := service.UpdateShortURL(shortCode, &models.URLUpdateRequest{URL: &fixedURL}, "intruder"); err != models.ErrNotURLOwner {
+		t.Errorf("UpdateShortURL() by another user error = %v, want %v", err, models.ErrNotURLOwner)
+	}
+
+	updated, err := service.UpdateShortURL(shortCode, &models.URLUpdateRequest{URL: &fixedURL, ExpirationMs: &noExpiration, IfMatch: original.ETag}, "owner")
+	if err != nil {
+		t.Fatalf("UpdateShortURL() error = %v", err)
+	}
+	if updated.OriginalURL != fixedURL || updated.ExpirationTimestamp != nil || updated.ETag == original.ETag {
+		t.Errorf("UpdateShortURL() = %+v, want the new destination, no expiration and a new ETag", updated)
+	}
+	if originalURL, _ := service.GetOriginalURL(shortCode, true); originalURL != fixedURL {
+		t.Errorf("GetOriginalURL() = %s after the edit, want %s", originalURL, fixedURL)
+	}
+
+	// The ETag from before the edit is now stale
+	if _, err := service.UpdateShortURL(shortCode, &models.URLUpdateRequest{URL: &fixedURL, IfMatch: original.ETag}, "owner"); err != models.ErrPreconditionFailed {
+		t.Errorf("UpdateShortURL() with a stale ETag error = %v, want %v", err, models.ErrPreconditionFailed)
+	}
+
+	// Setting an alias renames the link
+	alias := "renamed"
+	renamed, err := service.UpdateShortURL(shortCode, &models.URLUpdateRequest{Alias: &alias, IfMatch: updated.ETag}, "owner")
+	if err != nil {
+		t.Fatalf("UpdateShortURL() rename error = %v", err)
+	}
+	if renamed.ShortCode != alias {
+		t.Errorf("UpdateShortURL() short code = %s, want %s", renamed.ShortCode, alias)
+	}
+	if originalURL, err := service.GetOriginalURL(shortCode, true); err != nil || originalURL != fixedURL {
+		t.Errorf("GetOriginalURL() of the old code = %s, %v; want %s", originalURL, err, fixedURL)
+	}
+	if originalURL, _ := service.GetOriginalURL(alias, true); originalURL != fixedURL {
+		t.Errorf("GetOriginalURL() of the new alias = %s, want %s", originalURL, fixedURL)
+	}
+	if info, err := service.GetURLInfo(shortCode, "owner"); err != nil || info.ShortCode != alias {
+		t.Errorf("GetURLInfo() of the old code = %+v, %v; want the renamed link", info, err)
+	}
+
+	// Renaming again keeps both older codes pointing at the link, and edits reach them at once
+	second := "renamed-again"
+	renamed, err = service.UpdateShortURL(alias, &models.URLUpdateRequest{Alias: &second, URL: &otherURL}, "owner")
+	if err != nil {
+		t.Fatalf("UpdateShortURL() second rename error = %v", err)
+	}
+	for _, code := range []string{shortCode, alias, second} {
+		if originalURL, err := service.GetOriginalURL(code, true); err != nil || originalURL != otherURL {
+			t.Errorf("GetOriginalURL(%s) after the second rename = %s, %v; want %s", code, originalURL, err, otherURL)
+		}
+	}
+	alias = second
+
+	invalidURL := ""
+	negative := int64(-1)
+	invalid := []struct {
+		req  *models.URLUpdateRequest
+		want error
+	}{
+		{req: &models.URLUpdateRequest{}, want: models.ErrEmptyUpdate},
+		{req: &models.URLUpdateRequest{URL: &invalidURL}, want: models.ErrInvalidURLFormat},
+		{req: &models.URLUpdateRequest{ExpirationMs: &negative}, want: models.ErrInvalidExpiration},
+	}
+	for _, tt := range invalid {
+		if _, err := service.UpdateShortURL(alias, tt.req, "owner"); err != tt.want {
+			t.Errorf("UpdateShortURL(%+v) error = %v, want %v", *tt.req, err, tt.want)
+		}
+	}
+}
+
+func TestURLServiceImpl_DeleteAndRestore(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	service := factory.CreateURLService()
+
+	if _, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com", Alias: "doomed"}, "owner"); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	if err := service.DeleteShortURL("doomed", "intruder"); err != models.ErrNotURLOwner {
+		t.Errorf("DeleteShortURL() by another user error = %v, want %v", err, models.ErrNotURLOwner)
+	}
+	if err := service.DeleteShortURL("doomed", "owner"); err != nil {
+		t.Fatalf("DeleteShortURL() error = %v", err)
+	}
+	// Deleting twice is harmless
+	if err := service.DeleteShortURL("doomed", "owner"); err != nil {
+		t.Errorf("DeleteShortURL() a second time error = %v", err)
+	}
+
+	if _, err := service.GetOriginalURL("doomed", true); err != models.ErrShortCodeDeleted {
+		t.Errorf("GetOriginalURL() error = %v, want %v", err, models.ErrShortCodeDeleted)
+	}
+	if _, err := service.GetURLInfo("doomed", ""); err != models.ErrShortCodeDeleted {
+		t.Errorf("GetURLInfo() anonymous error = %v, want %v", err, models.ErrShortCodeDeleted)
+	}
+	if info, err := service.GetURLInfo("doomed", "owner"); err != nil || info.DeletedAt == nil {
+		t.Errorf("GetURLInfo() for the owner = %+v, %v, want deleted_at set", info, err)
+	}
+
+	// The code stays reserved until it is purged
+	if _, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.other.com", Alias: "doomed"}, "someone-else"); err != models.ErrAliasAlreadyExists {
+		t.Errorf("CreateShortURL() with a deleted alias error = %v, want %v", err, models.ErrAliasAlreadyExists)
+	}
+
+	// Deleted links only show up when asked for
+	if page, _ := service.ListURLs(&models.URLListRequest{}, "owner"); len(page.URLs) != 0 {
+		t.Errorf("ListURLs() returned %d links, want deleted links hidden", len(page.URLs))
+	}
+	if page, _ := service.ListURLs(&models.URLListRequest{Status: models.LinkStatusDeleted}, "owner"); len(page.URLs) != 1 {
+		t.Errorf("ListURLs(status=deleted) returned %d links, want 1", len(page.URLs))
+	}
+
+	info, err := service.RestoreShortURL("doomed", "owner")
+	if err != nil {
+		t.Fatalf("RestoreShortURL() error = %v", err)
+	}
+	if info.DeletedAt != nil {
+		t.Errorf("RestoreShortURL() deleted_at = %v, want none", info.DeletedAt)
+	}
+	if originalURL, err := service.GetOriginalURL("doomed", true); err != nil || originalURL != "https://www.example.com" {
+		t.Errorf("GetOriginalURL() after restore = %s, %v", originalURL, err)
+	}
+	if _, err := service.RestoreShortURL("doomed", "owner"); err != models.ErrNotDeleted {
+		t.Errorf("RestoreShortURL() of a live link error = %v, want %v", err, models.ErrNotDeleted)
+	}
+}
+
+func TestURLServiceImpl_RestoreAfterWindow(t *testing.T) {
+	// Without a restore window every deletion is final
+	factory := services.NewMemoryServiceFactory(&config.Config{})
+	defer factory.Close()
+	service := factory.CreateURLService()
+
+	if _, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com", Alias: "final"}, "owner"); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if err := service.DeleteShortURL("final", "owner"); err != nil {
+		t.Fatalf("DeleteShortURL() error = %v", err)
+	}
+	if _, err := service.RestoreShortURL("final", "owner"); err != models.ErrRestoreWindowPassed {
+		t.Errorf("RestoreShortURL() error = %v, want %v", err, models.ErrRestoreWindowPassed)
+	}
+}
+
+func TestURLServiceImpl_ExportURLs(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	service := factory.CreateURLService()
+
+	requests := []models.URLRequest{
+		{URL: "https://www.one.com", Alias: "export-one", Tags: []string{"docs", "launch"}, ExpirationMs: 3600000},
+		{URL: "https://www.two.com", Alias: "export-two", Visibility: models.VisibilityPrivate},
+		{URL: "https://www.gone.com", Alias: "export-gone"},
+	}
+	for _, req := range requests {
+		if _, err := service.CreateShortURL(&req, "user123"); err != nil {
+			t.Fatalf("CreateShortURL() error = %v", err)
+		}
+	}
+	if _, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.other.com"}, "user456"); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if err := service.DeleteShortURL("export-gone", "user123"); err != nil {
+		t.Fatalf("DeleteShortURL() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := service.ExportURLs(&models.URLExportRequest{}, "user123", &out); err != nil {
+		t.Fatalf("ExportURLs(csv) error = %v", err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("ExportURLs(csv) wrote invalid CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("ExportURLs(csv) wrote %d records, want a header and 2 links", len(records))
+	}
+	if strings.Join(records[0][:5], ",") != "short_code,url,alias,expiration,tags" {
+		t.Errorf("ExportURLs(csv) header = %v", records[0])
+	}
+	if records[1][0] != "export-one" || records[1][1] != "https://www.one.com" || records[1][3] == "" || records[1][4] != "docs;launch" {
+		t.Errorf("ExportURLs(csv) first link = %v", records[1])
+	}
+	if records[2][0] != "export-two" || records[2][5] != models.VisibilityPrivate {
+		t.Errorf("ExportURLs(csv) second link = %v", records[2])
+	}
+
+	out.Reset()
+	if err := service.ExportURLs(&models.URLExportRequest{Format: models.ExportFormatJSONL}, "user123", &out); err != nil {
+		t.Fatalf("ExportURLs(jsonl) error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("ExportURLs(jsonl) wrote %d lines, want 2", len(lines))
+	}
+	var first models.URLExport
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("ExportURLs(jsonl) wrote invalid JSON: %v", err)
+	}
+	if first.ShortCode != "export-one" || first.URL != "https://www.one.com" || first.Expiration == nil || len(first.Tags) != 2 {
+		t.Errorf("ExportURLs(jsonl) first link = %+v", first)
+	}
+
+	out.Reset()
+	if err := service.ExportURLs(&models.URLExportRequest{Format: "xml"}, "user123", &out); err != models.ErrInvalidExportFormat {
+		t.Errorf("ExportURLs(xml) error = %v, want %v", err, models.ErrInvalidExportFormat)
+	}
+	if out.Len() != 0 {
+		t.Errorf("ExportURLs(xml) wrote %d bytes, want nothing", out.Len())
+	}
+}
+
+func TestURLServiceImpl_GetURLStats(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	service := factory.CreateURLService()
+	recorder := factory.CreateClickRecorder()
+
+	if _, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com", Alias: "stats-link"}, "user123"); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	// Yesterday, so unique visitors are still within the retention
+	day := time.Now().UTC().Truncate(24 * time.Hour).Add(-24 * time.Hour)
+	from, to := day.Add(8*time.Hour).Format(time.RFC3339), day.Add(12*time.Hour).Format(time.RFC3339)
+	clicks := []models.ClickEvent{
+		{
+			Timestamp:      day.Add(9 * time.Hour),
+			IP:             "203.0.113.77",
+			Referrer:       "https://News.Example.com/story",
+			UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0",
+			AcceptLanguage: "de-DE,de;q=0.9",
+		},
+		{
+			Timestamp: day.Add(9*time.Hour + 30*time.Minute),
+			UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+		},
+		{
+			Timestamp: day.Add(11 * time.Hour),
+			UserAgent: "Mozilla/5.0 (Linux; Android 14; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		},
+		{
+			Timestamp: day.Add(10 * time.Hour),
+			UserAgent: "Twitterbot/1.0",
+		},
+	}
+	for _, click := range clicks {
+		click.ShortCode = "stats-link"
+		recorder.Record(click)
+	}
+
+	// The bot is only counted when asked for
+	withBots := &models.URLStatsRequest{From: from, To: to, Interval: "hour", IncludeBots: true}
+	testutils.WaitFor(t, 5*time.Second, func() bool {
+		stats, err := service.GetURLStats("stats-link", withBots, "user123")
+		return err == nil && stats.TotalClicks == 4 && stats.IncludeBots
+	}, "recorded clicks did not reach the stats")
+
+	req := &models.URLStatsRequest{From: from, To: to, Interval: "hour"}
+	stats, err := service.GetURLStats("stats-link", req, "user123")
+	if err != nil {
+		t.Fatalf("GetURLStats() error = %v", err)
+	}
+	if stats.TotalClicks != 3 {
+		t.Errorf("TotalClicks = %d, want 3 without the bot", stats.TotalClicks)
+	}
+
+	// Each human click came from a different user agent, and bots are never visitors
+	if stats.UniqueVisitors != 3 {
+		t.Errorf("UniqueVisitors = %d, want 3", stats.UniqueVisitors)
+	}
+
+	// Every hour of the range is listed, including those without clicks
+	wantSeries := []int64{0, 2, 0, 1}
+	if len(stats.Series) != len(wantSeries) {
+		t.Fatalf("Series = %v, want %d hours", stats.Series, len(wantSeries))
+	}
+	for i, want := range wantSeries {
+		if stats.Series[i].Clicks != want || !stats.Series[i].Start.Equal(day.Add(time.Duration(8+i)*time.Hour)) {
+			t.Errorf("Series[%d] = %v, want %d clicks at %02d:00", i, stats.Series[i], want, 8+i)
+		}
+	}
+
+	// Breakdowns are derived from the headers, and missing values are labelled
+	if stats.Referrers[0] != (models.ClickCount{Value: "direct", Clicks: 2}) || stats.Referrers[1].Value != "news.example.com" {
+		t.Errorf("Referrers = %v", stats.Referrers)
+	}
+	browsers := map[string]int64{}
+	for _, count := range stats.Browsers {
+		browsers[count.Value] = count.Clicks
+	}
+	if browsers["Edge"] != 1 || browsers["Safari"] != 1 || browsers["Chrome"] != 1 {
+		t.Errorf("Browsers = %v, want Edge, Safari and Chrome", stats.Browsers)
+	}
+	devices := map[string]int64{}
+	for _, count := range stats.Devices {
+		devices[count.Value] = count.Clicks
+	}
+	if devices["desktop"] != 1 || devices["mobile"] != 1 || devices["tablet"] != 1 {
+		t.Errorf("Devices = %v, want one desktop, mobile and tablet", stats.Devices)
+	}
+	if stats.Languages[0] != (models.ClickCount{Value: "unknown", Clicks: 2}) || stats.Languages[1].Value != "de-de" {
+		t.Errorf("Languages = %v", stats.Languages)
+	}
+
+	// Only the owner may read the stats
+	if _, err := service.GetURLStats("stats-link", req, "user456"); err != models.ErrNotStatsOwner {
+		t.Errorf("GetURLStats() by another user error = %v, want %v", err, models.ErrNotStatsOwner)
+	}
+	if _, err := service.GetURLStats("missing", req, "user123"); err != models.ErrShortCodeNotFound {
+		t.Errorf("GetURLStats() of a missing code error = %v, want %v", err, models.ErrShortCodeNotFound)
+	}
+
+	invalid := []struct {
+		req  *models.URLStatsRequest
+		want error
+	}{
+		{&models.URLStatsRequest{Interval: "month"}, models.ErrInvalidStatsInterval},
+		{&models.URLStatsRequest{From: "yesterday"}, models.ErrInvalidStatsRange},
+		{&models.URLStatsRequest{From: "2024-03-05T00:00:00Z", To: "2024-03-04T00:00:00Z"}, models.ErrInvalidStatsRange},
+		{&models.URLStatsRequest{From: "2020-01-01T00:00:00Z", To: "2024-01-01T00:00:00Z", Interval: "hour"}, models.ErrStatsRangeTooLong},
+	}
+	for _, tc := range invalid {
+		if _, err := service.GetURLStats("stats-link", tc.req, "user123"); err != tc.want {
+			t.Errorf("GetURLStats(%+v) error = %v, want %v", tc.req, err, tc.want)
+		}
+	}
+}
+
+func TestURLServiceImpl_SubscribeClicks(t *testing.T) {
+	factory, cleanup := testutils.CreateTestServiceFactory(t)
+	defer cleanup()
+	service := factory.CreateURLService()
+	recorder := factory.CreateClickRecorder()
+
+	for _, alias := range []string{"live-link", "quiet-link"} {
+		if _, err := service.CreateShortURL(&models.URLRequest{URL: "https://www.example.com", Alias: alias}, "user123"); err != nil {
+			t.Fatalf("CreateShortURL() error = %v", err)
+		}
+	}
+
+	invalid := []struct {
+		shortCode string
+		req       *models.ClickStreamRequest
+		userID    string
+		want      error
+	}{
+		{"live-link", &models.ClickStreamRequest{}, "user456", models.ErrNotStreamOwner},
+		{"missing", &models.ClickStreamRequest{}, "user123", models.ErrShortCodeNotFound},
+		{"live-link", &models.ClickStreamRequest{LastEventID: "yesterday"}, "user123", models.ErrInvalidLastEventID},
+	}
+	for _, tc := range invalid {
+		if _, err := service.SubscribeClicks(tc.shortCode, tc.req, tc.userID); err != tc.want {
+			t.Errorf("SubscribeClicks(%q, %+v, %q) error = %v, want %v", tc.shortCode, tc.req, tc.userID, err, tc.want)
+		}
+	}
+
+	subscription, err := service.SubscribeClicks("live-link", &models.ClickStreamRequest{}, "user123")
+	if err != nil {
+		t.Fatalf("SubscribeClicks() error = %v", err)
+	}
+	defer subscription.Close()
+	firehose, err := service.SubscribeClicks("", &models.ClickStreamRequest{}, "user123")
+	if err != nil {
+		t.Fatalf("SubscribeClicks() for every link error = %v", err)
+	}
+	defer firehose.Close()
+
+	// Recorded clicks are pushed once stored, enriched like the stored ones
+	recorder.Record(models.ClickEvent{ShortCode: "quiet-link", Timestamp: time.Now(), UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"})
+	recorder.Record(models.ClickEvent{ShortCode: "live-link", Timestamp: time.Now(), IP: "203.0.113.77", UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"})
+
+	click := nextClick(t, subscription, "live-link")
+	if click.UserID != "user123" || click.Browser != "Firefox" || click.IP != "203.0.113.0" {
+		t.Errorf("Live click = %+v, want the enriched click with a truncated IP", click)
+	}
+	nextClick(t, firehose, "quiet-link")
+	nextClick(t, firehose, "live-link")
+}
@@ -1,6 +1,9 @@
 package services_test
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -125,9 +128,6 @@ func TestURLStorage_Delete(t *testing.T) {
 }
 
 func TestURLStorage_IsExpired(t *testing.T) {
-	storage, cleanup := testutils.CreateTestURLStorage(t)
-	defer cleanup()
-
 	tests := []struct {
 		name           string
 		expirationTime *time.Time
@@ -158,7 +158,7 @@ func TestURLStorage_IsExpired(t *testing.T) {
 				UserID:              "user123",
 			}
 
-			result := storage.IsExpired(mapping)
+			result := mapping.IsExpired()
 			if result != tt.expected {
 				t.Errorf("IsExpired() = %v, want %v", result, tt.expected)
 			}
@@ -166,7 +166,7 @@ func TestURLStorage_IsExpired(t *testing.T) {
 	}
 }
 
-func TestURLStorage_Overwrite(t *testing.T) {
+func TestURLStorage_StoreNeverOverwrites(t *testing.T) {
 	storage, cleanup := testutils.CreateTestURLStorage(t)
 	defer cleanup()
 
@@ -191,23 +191,102 @@ func TestURLStorage_Overwrite(t *testing.T) {
 		t.Fatalf("Store() error = %v", err)
 	}
 
-	// Overwrite with new
+	// A second insert under the same short code must fail
 	err = storage.Store("test", newMapping)
-	if err != nil {
-		t.Fatalf("Store() error = %v", err)
+	if err != models.ErrAliasAlreadyExists {
+		t.Fatalf("Store() error = %v, want %v", err, models.ErrAliasAlreadyExists)
 	}
 
-	// Verify new mapping is stored
+	// Verify the original mapping is kept
 	retrieved, exists, err := storage.Get("test")
 	if err != nil {
 		t.Fatalf("Get() error = %v", err)
 	}
 	if !exists {
-		t.Errorf("Key should exist after overwrite")
+		t.Errorf("Key should still exist")
+	}
+
+	if retrieved.OriginalURL != originalMapping.OriginalURL {
+		t.Errorf("Get() OriginalURL = %v, want the original %v", retrieved.OriginalURL, originalMapping.OriginalURL)
+	}
+}
+
+func TestURLStorage_StoreMany(t *testing.T) {
+	storage, cleanup := testutils.CreateTestURLStorage(t)
+	defer cleanup()
+
+	if err := storage.Store("taken", models.URLMapping{OriginalURL: "https://www.taken.com", Alias: "taken"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	batch := []models.URLMapping{
+		{ShortURL: "first", OriginalURL: "https://www.first.com", UserID: "user123"},
+		{ShortURL: "taken", OriginalURL: "https://www.conflict.com", Alias: "taken", UserID: "user123"},
+		{ShortURL: "first", OriginalURL: "https://www.twice.com", UserID: "user123"},
+		{ShortURL: "second", OriginalURL: "https://www.second.com", UserID: "user123"},
+	}
+	wantErrs := []error{nil, models.ErrAliasAlreadyExists, models.ErrAliasAlreadyExists, nil}
+
+	// An atomic batch with a conflict stores nothing
+	errs, err := storage.StoreMany(batch, true)
+	if err != nil {
+		t.Fatalf("StoreMany(atomic) error = %v", err)
+	}
+	for i, want := range wantErrs {
+		if errs[i] != want {
+			t.Errorf("StoreMany(atomic) item %d error = %v, want %v", i, errs[i], want)
+		}
+	}
+	for _, code := range []string{"first", "second"} {
+		if exists, _ := storage.Exists(code); exists {
+			t.Errorf("StoreMany(atomic) stored %q despite a conflict", code)
+		}
+	}
+
+	// Otherwise every mapping without a conflict is stored
+	errs, err = storage.StoreMany(batch, false)
+	if err != nil {
+		t.Fatalf("StoreMany() error = %v", err)
+	}
+	for i, want := range wantErrs {
+		if errs[i] != want {
+			t.Errorf("StoreMany() item %d error = %v, want %v", i, errs[i], want)
+		}
+	}
+	first, exists, err := storage.Get("first")
+	if err != nil || !exists || first.OriginalURL != "https://www.first.com" || first.CreatedAt.IsZero() {
+		t.Errorf("Get(first) = %+v, %v, %v; want the first mapping of the batch", first, exists, err)
+	}
+	if taken, _, _ := storage.Get("taken"); taken.OriginalURL != "https://www.taken.com" {
+		t.Errorf("StoreMany() overwrote an existing mapping with %s", taken.OriginalURL)
+	}
+	if exists, _ := storage.Exists("second"); !exists {
+		t.Errorf("StoreMany() did not store the mapping after the conflicts")
+	}
+}
+
+func TestURLStorage_ConcurrentStoresOfOneCode(t *testing.T) {
+	storage, cleanup := testutils.CreateTestURLStorage(t)
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mapping := models.URLMapping{OriginalURL: fmt.Sprintf("https://www.example%d.com", i), Alias: "contested"}
+			if err := storage.Store("contested", mapping); err == nil {
+				succeeded.Add(1)
+			} else if err != models.ErrAliasAlreadyExists {
+				t.Errorf("Store() error = %v, want nil or %v", err, models.ErrAliasAlreadyExists)
+			}
+		}(i)
 	}
+	wg.Wait()
 
-	if retrieved.OriginalURL != newMapping.OriginalURL {
-		t.Errorf("Get() should return new OriginalURL after overwrite")
+	if succeeded.Load() != 1 {
+		t.Errorf("%d concurrent stores of one code succeeded, want exactly 1", succeeded.Load())
 	}
 }
 
@@ -283,3 +362,278 @@ func TestURLStorage_GetByUserID(t *testing.T) {
 		t.Errorf("GetByUserID() returned %d mappings, want 2", len(mappings))
 	}
 }
+
+func TestURLStorage_HighestCounter(t *testing.T) {
+	storage, cleanup := testutils.CreateTestURLStorage(t)
+	defer cleanup()
+
+	if highest, err := storage.HighestCounter(); err != nil || highest != 0 {
+		t.Fatalf("HighestCounter() on an empty store = %d, %v; want 0", highest, err)
+	}
+
+	for shortCode, counter := range map[string]int64{"5": 5, "Ea": 900, "h": 17} {
+		if err := storage.Store(shortCode, models.URLMapping{OriginalURL: "https://www.example.com", Counter: counter}); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+	// A counter code stored without its value, and codes that are not counter codes
+	if err := storage.Store("zz", models.URLMapping{OriginalURL: "https://www.example.com"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := storage.Store("zzzzzz", models.URLMapping{OriginalURL: "https://www.example.com", Alias: "zzzzzz"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := storage.Store("zzzzzzzz", models.URLMapping{OriginalURL: "https://www.example.com", Strategy: models.StrategyRandom}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	if highest, err := storage.HighestCounter(); err != nil || highest != 900 {
+		t.Fatalf("HighestCounter() = %d, %v; want 900", highest, err)
+	}
+
+	// Only the counter code without a value is backfilled
+	var offered []string
+	err := storage.BackfillCounters(func(mapping models.URLMapping) int64 {
+		offered = append(offered, mapping.ShortURL)
+		return 3843
+	})
+	if err != nil {
+		t.Fatalf("BackfillCounters() error = %v", err)
+	}
+	if len(offered) != 1 || offered[0] != "zz" {
+		t.Errorf("BackfillCounters() offered %v, want [zz]", offered)
+	}
+
+	if highest, err := storage.HighestCounter(); err != nil || highest != 3843 {
+		t.Errorf("HighestCounter() after the backfill = %d, %v; want 3843", highest, err)
+	}
+	if mapping, _, _ := storage.Get("zz"); mapping.Counter != 3843 {
+		t.Errorf("Get() counter after the backfill = %d, want 3843", mapping.Counter)
+	}
+
+	// A backfilled code is not offered again
+	offered = nil
+	storage.BackfillCounters(func(mapping models.URLMapping) int64 {
+		offered = append(offered, mapping.ShortURL)
+		return 0
+	})
+	if len(offered) != 0 {
+		t.Errorf("Second BackfillCounters() offered %v, want none", offered)
+	}
+}
+
+func TestURLStorage_ListByUserID(t *testing.T) {
+	storage, cleanup := testutils.CreateTestURLStorage(t)
+	defer cleanup()
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	mappings := map[string]models.URLMapping{
+		"list1": {OriginalURL: "https://example.com/a", UserID: "lister"},
+		"list2": {OriginalURL: "https://docs.example.com:8443/b", UserID: "lister", Alias: "list2"},
+		"list3": {OriginalURL: "https://notexample.com/c", UserID: "lister", ExpirationTimestamp: &past},
+		"list4": {OriginalURL: "https://example.com.evil.org/d", UserID: "lister", ExpirationTimestamp: &future},
+		"list5": {OriginalURL: "https://example.com/e", UserID: "someone-else"},
+	}
+	for _, shortCode := range []string{"list1", "list2", "list3", "list4", "list5"} {
+		if err := storage.Store(shortCode, mappings[shortCode]); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query models.URLListQuery
+		want  []string
+	}{
+		{name: "newest first", query: models.URLListQuery{}, want: []string{"list4", "list3", "list2", "list1"}},
+		{name: "oldest first", query: models.URLListQuery{Ascending: true}, want: []string{"list1", "list2", "list3", "list4"}},
+		{name: "bounded", query: models.URLListQuery{Limit: 2}, want: []string{"list4", "list3"}},
+		{name: "active", query: models.URLListQuery{Status: models.LinkStatusActive}, want: []string{"list4", "list2", "list1"}},
+		{name: "expired", query: models.URLListQuery{Status: models.LinkStatusExpired}, want: []string{"list3"}},
+		{name: "aliases only", query: models.URLListQuery{AliasOnly: true}, want: []string{"list2"}},
+		{name: "domain and subdomains", query: models.URLListQuery{Domain: "example.com"}, want: []string{"list2", "list1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.UserID = "lister"
+			if tt.query.Limit == 0 {
+				tt.query.Limit = 10
+			}
+
+			listed, err := storage.ListByUserID(tt.query)
+			if err != nil {
+				t.Fatalf("ListByUserID() error = %v", err)
+			}
+
+			var got []string
+			for _, mapping := range listed {
+				got = append(got, mapping.ShortURL)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ListByUserID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A page after the cursor continues where the previous one stopped
+	first, _ := storage.ListByUserID(models.URLListQuery{UserID: "lister", Limit: 2})
+	last := first[len(first)-1]
+	next, err := storage.ListByUserID(models.URLListQuery{
+		UserID: "lister",
+		Limit:  10,
+		After:  &models.URLListCursor{CreatedAt: last.CreatedAt, ID: last.ID},
+	})
+	if err != nil {
+		t.Fatalf("ListByUserID() after cursor error = %v", err)
+	}
+	if len(next) != 2 || next[0].ShortURL != "list2" || next[1].ShortURL != "list1" {
+		t.Errorf("ListByUserID() after cursor returned %d mappings, want list2 and list1", len(next))
+	}
+}
+
+func TestURLStorage_ScanByUserID(t *testing.T) {
+	storage, cleanup := testutils.CreateTestURLStorage(t)
+	defer cleanup()
+
+	// More links than one page of a paging backend, most of them sharing a creation time
+	var want []string
+	for batch := 0; batch < 6; batch++ {
+		mappings := make([]models.URLMapping, 100)
+		for i := range mappings {
+			shortCode := fmt.Sprintf("scan%03d", batch*100+i)
+			mappings[i] = models.URLMapping{ShortURL: shortCode, OriginalURL: "https://www.example.com", UserID: "user123"}
+			want = append(want, shortCode)
+		}
+		if _, err := storage.StoreMany(mappings, true); err != nil {
+			t.Fatalf("StoreMany() error = %v", err)
+		}
+	}
+
+	deletedAt := time.Now()
+	if err := storage.Store("scan-deleted", models.URLMapping{OriginalURL: "https://www.example.com", UserID: "user123", DeletedAt: &deletedAt}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := storage.Store("scan-other", models.URLMapping{OriginalURL: "https://www.example.com", UserID: "user456"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	var got []string
+	err := storage.ScanByUserID("user123", func(mapping models.URLMapping) (bool, error) {
+		got = append(got, mapping.ShortURL)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("ScanByUserID() error = %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ScanByUserID() returned %d links, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("ScanByUserID() link %d = %s, want %s in creation order", i, got[i], want[i])
+		}
+	}
+
+	// Returning false stops the scan
+	calls := 0
+	err = storage.ScanByUserID("user123", func(mapping models.URLMapping) (bool, error) {
+		calls++
+		return calls < 3, nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("ScanByUserID() made %d calls with error %v, want 3 and none", calls, err)
+	}
+}
+
+func TestURLStorage_ReplaceIfUnchanged(t *testing.T) {
+	storage, cleanup := testutils.CreateTestURLStorage(t)
+	defer cleanup()
+
+	expiration := time.Now().Add(time.Hour)
+	if err := storage.Store("before", models.URLMapping{OriginalURL: "https://www.example.com", UserID: "user123", ExpirationTimestamp: &expiration}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := storage.Store("taken", models.URLMapping{OriginalURL: "https://www.taken.com", Alias: "taken"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	existing, _, _ := storage.Get("before")
+
+	// Renaming onto a taken code fails and leaves both mappings alone
+	renamed := existing
+	renamed.ShortURL, renamed.Alias = "taken", "taken"
+	renamed.UpdatedAt = existing.UpdatedAt.Add(time.Second)
+	if _, err := storage.ReplaceIfUnchanged("before", existing.UpdatedAt, renamed); err != models.ErrAliasAlreadyExists {
+		t.Errorf("ReplaceIfUnchanged() onto a taken code error = %v, want %v", err, models.ErrAliasAlreadyExists)
+	}
+
+	// A rename that clears the expiration moves the mapping to its new code
+	renamed.ShortURL, renamed.Alias = "after", "after"
+	renamed.OriginalURL = "https://www.changed.com"
+	renamed.ExpirationTimestamp = nil
+	replaced, err := storage.ReplaceIfUnchanged("before", existing.UpdatedAt, renamed)
+	if err != nil || !replaced {
+		t.Fatalf("ReplaceIfUnchanged() = %v, %v, want true", replaced, err)
+	}
+
+	// The old code stays reserved, redirecting to the new one, without showing up among the user's links
+	redirect, exists, err := storage.Get("before")
+	if err != nil || !exists || redirect.RenamedTo != "after" || redirect.UserID != "" {
+		t.Errorf("Get(before) after a rename = %+v, %v, %v; want an unowned redirect to after", redirect, exists, err)
+	}
+	if err := storage.Store("before", models.URLMapping{OriginalURL: "https://www.hijack.com", Alias: "before"}); err != models.ErrAliasAlreadyExists {
+		t.Errorf("Store() over a renamed code error = %v, want %v", err, models.ErrAliasAlreadyExists)
+	}
+	if mappings, _ := storage.GetByUserID("user123"); len(mappings) != 1 || mappings[0].ShortURL != "after" {
+		t.Errorf("GetByUserID() after a rename = %+v, want only the renamed link", mappings)
+	}
+	after, exists, err := storage.Get("after")
+	if err != nil || !exists {
+		t.Fatalf("Get(after) exists = %v, error = %v", exists, err)
+	}
+	if after.OriginalURL != "https://www.changed.com" || after.ExpirationTimestamp != nil || after.UserID != "user123" {
+		t.Errorf("Get(after) = %+v, want the new destination without expiration", after)
+	}
+	if !after.CreatedAt.Equal(existing.CreatedAt) || !after.UpdatedAt.Equal(renamed.UpdatedAt) {
+		t.Errorf("Get(after) created_at = %v, updated_at = %v; want %v and %v", after.CreatedAt, after.UpdatedAt, existing.CreatedAt, renamed.UpdatedAt)
+	}
+
+	// A stale modification time never overwrites a newer write
+	stale := after
+	stale.OriginalURL = "https://www.stale.com"
+	replaced, err = storage.ReplaceIfUnchanged("after", existing.UpdatedAt, stale)
+	if err != nil || replaced {
+		t.Errorf("ReplaceIfUnchanged() with a stale time = %v, %v, want false", replaced, err)
+	}
+	if current, _, _ := storage.Get("after"); current.OriginalURL != "https://www.changed.com" {
+		t.Errorf("Stale replace changed the destination to %s", current.OriginalURL)
+	}
+}
+
+func TestURLStorage_PurgeDeleted(t *testing.T) {
+	storage, cleanup := testutils.CreateTestURLStorage(t)
+	defer cleanup()
+
+	longAgo := time.Now().Add(-48 * time.Hour)
+	recently := time.Now().Add(-time.Minute)
+	for shortCode, deletedAt := range map[string]*time.Time{"purge-old": &longAgo, "purge-new": &recently, "purge-live": nil} {
+		if err := storage.Store(shortCode, models.URLMapping{OriginalURL: "https://www.example.com", DeletedAt: deletedAt}); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	purged, err := storage.PurgeDeleted(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("PurgeDeleted() error = %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("PurgeDeleted() = %d, want 1", purged)
+	}
+
+	for shortCode, want := range map[string]bool{"purge-old": false, "purge-new": true, "purge-live": true} {
+		if exists, _ := storage.Exists(shortCode); exists != want {
+			t.Errorf("Exists(%s) = %v after purge, want %v", shortCode, exists, want)
+		}
+	}
+}
@@ -150,6 +150,18 @@ func TestURLValidator_ValidateAlias(t *testing.T) {
 			wantErr: true,
 			errType: models.ErrInvalidAliasChars,
 		},
+		{
+			name:    "reserved alias",
+			alias:   "export",
+			wantErr: true,
+			errType: models.ErrAliasReserved,
+		},
+		{
+			name:    "reserved stream alias",
+			alias:   "events",
+			wantErr: true,
+			errType: models.ErrAliasReserved,
+		},
 	}
 
 	for _, tt := range tests {
@@ -172,3 +184,35 @@ func TestURLValidator_ValidateAlias(t *testing.T) {
 		})
 	}
 }
+
+func TestURLValidator_ValidateTags(t *testing.T) {
+	validator := services.NewURLValidator()
+
+	tests := []struct {
+		name    string
+		tags    []string
+		wantErr bool
+	}{
+		{name: "no tags", tags: nil, wantErr: false},
+		{name: "letters, numbers, hyphens and underscores", tags: []string{"q3-launch", "team_a", "2024"}, wantErr: false},
+		{name: "maximum number of tags", tags: []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}, wantErr: false},
+		{name: "too many tags", tags: []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}, wantErr: true},
+		{name: "empty tag", tags: []string{""}, wantErr: true},
+		{name: "tag too long", tags: []string{"abcdefghijklmnopqrstuvwxyz0123456"}, wantErr: true},
+		{name: "tag with comma", tags: []string{"a,b"}, wantErr: true},
+		{name: "tag with spaces", tags: []string{"two words"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.ValidateTags(tt.tags)
+
+			if tt.wantErr && err != models.ErrInvalidTags {
+				t.Errorf("ValidateTags() error = %v, want %v", err, models.ErrInvalidTags)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("ValidateTags() unexpected error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener-api/models"
+	"url-shortener-api/services"
+	"url-shortener-api/tests/testutils"
+)
+
+// visitorCounterTests runs the same checks against every VisitorCounter implementation
+func visitorCounterTests(t *testing.T, counter models.VisitorCounter) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	yesterday := today.Add(-24 * time.Hour)
+	alice := models.ClickEvent{ShortCode: "abc", IP: "203.0.113.77", UserAgent: "Mozilla/5.0 (Windows)"}
+	bob := models.ClickEvent{ShortCode: "abc", IP: "203.0.113.78", UserAgent: "Mozilla/5.0 (Windows)"}
+	carol := models.ClickEvent{ShortCode: "abc", IP: "203.0.113.77", UserAgent: "Mozilla/5.0 (iPhone)"}
+
+	at := func(event models.ClickEvent, timestamp time.Time) models.ClickEvent {
+		event.Timestamp = timestamp
+		return event
+	}
+	events := []models.ClickEvent{
+		at(alice, yesterday.Add(time.Hour)),
+		at(alice, yesterday.Add(2*time.Hour)),
+		at(bob, yesterday.Add(3*time.Hour)),
+		at(alice, today.Add(time.Hour)),
+		at(carol, today.Add(2*time.Hour)),
+		{ShortCode: "xyz", Timestamp: today, IP: "198.51.100.1", UserAgent: "curl/8.0"},
+	}
+	if err := counter.AddVisitors(events); err != nil {
+		t.Fatalf("AddVisitors() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int64
+	}{
+		{"yesterday", yesterday, today, 2},
+		{"today", today, today.Add(24 * time.Hour), 2},
+		// The salt changes daily, so alice counts once per day
+		{"both days", yesterday, today.Add(24 * time.Hour), 4},
+		{"part of a day counts the whole day", today.Add(12 * time.Hour), today.Add(13 * time.Hour), 2},
+		{"before any clicks", yesterday.Add(-72 * time.Hour), yesterday, 0},
+	}
+	for _, tt := range tests {
+		got, err := counter.CountVisitors("abc", tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("CountVisitors(%s) error = %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("CountVisitors(%s) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryVisitorCounter(t *testing.T) {
+	visitorCounterTests(t, services.NewMemoryVisitorCounter(24*time.Hour))
+}
+
+func TestMemoryVisitorCounter_SkipsDaysPastRetention(t *testing.T) {
+	counter := services.NewMemoryVisitorCounter(24 * time.Hour)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	// Two days ago ended more than the retention ago; yesterday did not
+	events := []models.ClickEvent{
+		{ShortCode: "abc", Timestamp: today.Add(-47 * time.Hour), IP: "203.0.113.77", UserAgent: "Mozilla/5.0"},
+		{ShortCode: "abc", Timestamp: today.Add(-23 * time.Hour), IP: "203.0.113.78", UserAgent: "Mozilla/5.0"},
+	}
+	if err := counter.AddVisitors(events); err != nil {
+		t.Fatalf("AddVisitors() error = %v", err)
+	}
+
+	got, err := counter.CountVisitors("abc", today.Add(-72*time.Hour), today.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("CountVisitors() error = %v", err)
+	}
+	if got != 1 {
+		t.Errorf("CountVisitors() = %d, want only yesterday's visitor", got)
+	}
+}
+
+func TestRedisVisitorCounter(t *testing.T) {
+	server, client := testutils.SetupMiniRedis(t)
+	counter := services.NewRedisVisitorCounter(client, 24*time.Hour)
+	visitorCounterTests(t, counter)
+
+	// Day keys expire after the retention
+	key := "visitors:abc:" + time.Now().UTC().Format("2006-01-02")
+	if ttl := server.TTL(key); ttl <= 24*time.Hour || ttl > 48*time.Hour {
+		t.Errorf("TTL(%s) = %v, want the rest of the day plus the retention", key, ttl)
+	}
+
+	// Instances share the daily salt, so a visitor seen by two of them is counted once
+	other := services.NewRedisVisitorCounter(client, 24*time.Hour)
+	visitor := models.ClickEvent{ShortCode: "shared", Timestamp: time.Now(), IP: "203.0.113.77", UserAgent: "Mozilla/5.0"}
+	if err := counter.AddVisitors([]models.ClickEvent{visitor}); err != nil {
+		t.Fatalf("AddVisitors() error = %v", err)
+	}
+	if err := other.AddVisitors([]models.ClickEvent{visitor}); err != nil {
+		t.Fatalf("AddVisitors() error = %v", err)
+	}
+	if got, _ := other.CountVisitors("shared", time.Now().Add(-time.Hour), time.Now()); got != 1 {
+		t.Errorf("CountVisitors() across instances = %d, want 1", got)
+	}
+}